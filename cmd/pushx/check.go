@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/flags"
+	"github.com/robertlestak/pushx/pkg/pushx"
+	"github.com/robertlestak/pushx/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+func printCheckResults(driver string, results []pushx.CheckResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DRIVER\tSTEP\tSTATUS\tLATENCY\tERROR")
+	for _, r := range results {
+		status := "pass"
+		if r.Skipped {
+			status = "skip"
+		} else if !r.Ok() {
+			status = "fail"
+		}
+		var errStr string
+		if r.Err != nil {
+			errStr = r.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", driver, r.Step, status, r.Latency.Round(time.Millisecond), errStr)
+	}
+	w.Flush()
+}
+
+// check runs the connectivity and permission preflight for the configured
+// driver and returns the process exit code of the failed step, if any.
+func check(args []string) int {
+	l := log.WithFields(log.Fields{
+		"app": AppName,
+		"fn":  "check",
+	})
+	l.Debug("start")
+	if err := flags.FlagSet.Parse(args); err != nil {
+		return drivers.ExitConfig
+	}
+	if err := LoadEnv(EnvKeyPrefix); err != nil {
+		l.Error(err)
+		return drivers.ExitConfig
+	}
+	if err := utils.SetProxy(*flags.Proxy); err != nil {
+		l.WithError(err).Error("proxy")
+		return drivers.ExitConfig
+	}
+	j := &pushx.PushX{
+		DriverName: drivers.DriverName(*flags.Driver),
+		Meta:       flags.Meta.Map(),
+		CloudEvent: cloudEvent(),
+	}
+	cc, err := claimCheck()
+	if err != nil {
+		l.WithError(err).Error("claimCheck")
+		return drivers.ExitConfig
+	}
+	j.ClaimCheck = cc
+	results := j.Check(EnvKeyPrefix)
+	printCheckResults(*flags.Driver, results)
+	code := drivers.ExitOK
+	initialized := false
+	for _, r := range results {
+		if !r.Ok() {
+			code = drivers.ExitCode(r.Err)
+		} else if r.Step == "init" {
+			initialized = true
+		}
+	}
+	if initialized {
+		if err := cleanup(j); err != nil {
+			l.WithError(err).Error("cleanup")
+		}
+	}
+	return code
+}
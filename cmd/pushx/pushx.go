@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/robertlestak/pushx/pkg/drivers"
 	"github.com/robertlestak/pushx/pkg/flags"
 	"github.com/robertlestak/pushx/pkg/pushx"
+	"github.com/robertlestak/pushx/pkg/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -30,7 +36,7 @@ func printVersion() {
 }
 
 func printUsage() {
-	fmt.Printf("Usage: %s [options]\n", AppName)
+	fmt.Printf("Usage: %s [check|relay] [options]\n", AppName)
 	flags.FlagSet.PrintDefaults()
 }
 
@@ -47,6 +53,189 @@ func LoadEnv(prefix string) error {
 		i := os.Getenv(prefix + "INPUT_FILE")
 		flags.InputFile = &i
 	}
+	if os.Getenv(prefix+"IN_DIR") != "" {
+		v := os.Getenv(prefix + "IN_DIR")
+		flags.InputDir = &v
+	}
+	if os.Getenv(prefix+"IN_RECURSIVE") != "" {
+		v := os.Getenv(prefix+"IN_RECURSIVE") == "true"
+		flags.InputRecursive = &v
+	}
+	if os.Getenv(prefix+"IN_GLOB") != "" {
+		v := os.Getenv(prefix + "IN_GLOB")
+		flags.InputGlob = &v
+	}
+	if os.Getenv(prefix+"IN_INCLUDE") != "" {
+		v := os.Getenv(prefix + "IN_INCLUDE")
+		flags.InputInclude = &v
+	}
+	if os.Getenv(prefix+"IN_EXCLUDE") != "" {
+		v := os.Getenv(prefix + "IN_EXCLUDE")
+		flags.InputExclude = &v
+	}
+	if os.Getenv(prefix+"IN_CONCURRENCY") != "" {
+		v, err := strconv.Atoi(os.Getenv(prefix + "IN_CONCURRENCY"))
+		if err != nil {
+			return err
+		}
+		flags.InputConcurrency = &v
+	}
+	if os.Getenv(prefix+"IN_FORMAT") != "" {
+		v := os.Getenv(prefix + "IN_FORMAT")
+		flags.InputFormat = &v
+	}
+	if os.Getenv(prefix+"IN_COLUMNS") != "" {
+		v := os.Getenv(prefix + "IN_COLUMNS")
+		flags.InputColumns = &v
+	}
+	if os.Getenv(prefix+"IN_NO_INFER") != "" {
+		v := os.Getenv(prefix+"IN_NO_INFER") == "true"
+		flags.InputNoInfer = &v
+	}
+	if os.Getenv(prefix+"ON_SUCCESS") != "" {
+		v := os.Getenv(prefix + "ON_SUCCESS")
+		flags.OnSuccess = &v
+	}
+	if os.Getenv(prefix+"WATCH_FILE") != "" {
+		v := os.Getenv(prefix + "WATCH_FILE")
+		flags.WatchFile = &v
+	}
+	if os.Getenv(prefix+"WATCH_DIR") != "" {
+		v := os.Getenv(prefix + "WATCH_DIR")
+		flags.WatchDir = &v
+	}
+	if os.Getenv(prefix+"WATCH_STATE_FILE") != "" {
+		v := os.Getenv(prefix + "WATCH_STATE_FILE")
+		flags.WatchStateFile = &v
+	}
+	if os.Getenv(prefix+"WATCH_BATCH") != "" {
+		v, err := strconv.Atoi(os.Getenv(prefix + "WATCH_BATCH"))
+		if err != nil {
+			return err
+		}
+		flags.WatchBatch = &v
+	}
+	if os.Getenv(prefix+"WATCH_POLL_INTERVAL") != "" {
+		v := os.Getenv(prefix + "WATCH_POLL_INTERVAL")
+		flags.WatchPollInterval = &v
+	}
+	if os.Getenv(prefix+"WATCH_SETTLE") != "" {
+		v := os.Getenv(prefix + "WATCH_SETTLE")
+		flags.WatchSettle = &v
+	}
+	if os.Getenv(prefix+"AGGREGATE_FORMAT") != "" {
+		v := os.Getenv(prefix + "AGGREGATE_FORMAT")
+		flags.AggregateFormat = &v
+	}
+	if os.Getenv(prefix+"AGGREGATE_GZIP") != "" {
+		v := os.Getenv(prefix+"AGGREGATE_GZIP") == "true"
+		flags.AggregateGzip = &v
+	}
+	if os.Getenv(prefix+"AGGREGATE_MAX_RECORDS") != "" {
+		v, err := strconv.Atoi(os.Getenv(prefix + "AGGREGATE_MAX_RECORDS"))
+		if err != nil {
+			return err
+		}
+		flags.AggregateMaxRecords = &v
+	}
+	if os.Getenv(prefix+"AGGREGATE_MAX_BYTES") != "" {
+		v := os.Getenv(prefix + "AGGREGATE_MAX_BYTES")
+		flags.AggregateMaxBytes = &v
+	}
+	if os.Getenv(prefix+"AGGREGATE_MAX_AGE") != "" {
+		v := os.Getenv(prefix + "AGGREGATE_MAX_AGE")
+		flags.AggregateMaxAge = &v
+	}
+	if os.Getenv(prefix+"AGGREGATE_PARQUET_SCHEMA_FILE") != "" {
+		v := os.Getenv(prefix + "AGGREGATE_PARQUET_SCHEMA_FILE")
+		flags.AggregateParquetSchemaFile = &v
+	}
+	if os.Getenv(prefix+"AGGREGATE_PARQUET_COMPRESSION") != "" {
+		v := os.Getenv(prefix + "AGGREGATE_PARQUET_COMPRESSION")
+		flags.AggregateParquetCompression = &v
+	}
+	if os.Getenv(prefix+"AGGREGATE_PARQUET_ROW_GROUP_SIZE") != "" {
+		v := os.Getenv(prefix + "AGGREGATE_PARQUET_ROW_GROUP_SIZE")
+		flags.AggregateParquetRowGroupSize = &v
+	}
+	if os.Getenv(prefix+"RELAY_SOURCE") != "" {
+		v := os.Getenv(prefix + "RELAY_SOURCE")
+		flags.RelaySource = &v
+	}
+	if os.Getenv(prefix+"RELAY_RETRIES") != "" {
+		v, err := strconv.Atoi(os.Getenv(prefix + "RELAY_RETRIES"))
+		if err != nil {
+			return err
+		}
+		flags.RelayRetries = &v
+	}
+	if os.Getenv(prefix+"RELAY_RETRY_BACKOFF") != "" {
+		v := os.Getenv(prefix + "RELAY_RETRY_BACKOFF")
+		flags.RelayRetryBackoff = &v
+	}
+	if os.Getenv(prefix+"RELAY_DLQ_DRIVER") != "" {
+		v := os.Getenv(prefix + "RELAY_DLQ_DRIVER")
+		flags.RelayDLQDriver = &v
+	}
+	if os.Getenv(prefix+"RELAY_METRICS_ADDR") != "" {
+		v := os.Getenv(prefix + "RELAY_METRICS_ADDR")
+		flags.RelayMetricsAddr = &v
+	}
+	if os.Getenv(prefix+"META") != "" {
+		for _, kv := range flags.SplitList(os.Getenv(prefix + "META")) {
+			if err := flags.Meta.Set(kv); err != nil {
+				return err
+			}
+		}
+	}
+	if os.Getenv(prefix+"CLOUDEVENTS_MODE") != "" {
+		v := os.Getenv(prefix + "CLOUDEVENTS_MODE")
+		flags.CloudEventsMode = &v
+	}
+	if os.Getenv(prefix+"CLOUDEVENTS_ID") != "" {
+		v := os.Getenv(prefix + "CLOUDEVENTS_ID")
+		flags.CloudEventsID = &v
+	}
+	if os.Getenv(prefix+"CLOUDEVENTS_SOURCE") != "" {
+		v := os.Getenv(prefix + "CLOUDEVENTS_SOURCE")
+		flags.CloudEventsSource = &v
+	}
+	if os.Getenv(prefix+"CLOUDEVENTS_TYPE") != "" {
+		v := os.Getenv(prefix + "CLOUDEVENTS_TYPE")
+		flags.CloudEventsType = &v
+	}
+	if os.Getenv(prefix+"CLOUDEVENTS_SUBJECT") != "" {
+		v := os.Getenv(prefix + "CLOUDEVENTS_SUBJECT")
+		flags.CloudEventsSubject = &v
+	}
+	if os.Getenv(prefix+"CLOUDEVENTS_TIME") != "" {
+		v := os.Getenv(prefix + "CLOUDEVENTS_TIME")
+		flags.CloudEventsTime = &v
+	}
+	if os.Getenv(prefix+"CLOUDEVENTS_DATACONTENTTYPE") != "" {
+		v := os.Getenv(prefix + "CLOUDEVENTS_DATACONTENTTYPE")
+		flags.CloudEventsDataContentType = &v
+	}
+	if os.Getenv(prefix+"CLAIM_CHECK_DRIVER") != "" {
+		v := os.Getenv(prefix + "CLAIM_CHECK_DRIVER")
+		flags.ClaimCheckDriver = &v
+	}
+	if os.Getenv(prefix+"CLAIM_CHECK_THRESHOLD") != "" {
+		v := os.Getenv(prefix + "CLAIM_CHECK_THRESHOLD")
+		flags.ClaimCheckThreshold = &v
+	}
+	if os.Getenv(prefix+"CLAIM_CHECK_PREFIX") != "" {
+		v := os.Getenv(prefix + "CLAIM_CHECK_PREFIX")
+		flags.ClaimCheckPrefix = &v
+	}
+	if os.Getenv(prefix+"MAX_PAYLOAD_SIZE") != "" {
+		v := os.Getenv(prefix + "MAX_PAYLOAD_SIZE")
+		flags.MaxPayloadSize = &v
+	}
+	if os.Getenv(prefix+"PROXY") != "" {
+		v := os.Getenv(prefix + "PROXY")
+		flags.Proxy = &v
+	}
 	if os.Getenv(prefix+"OUTPUT") != "" {
 		o := os.Getenv(prefix + "OUTPUT")
 		flags.Output = &o
@@ -54,12 +243,152 @@ func LoadEnv(prefix string) error {
 	return nil
 }
 
+// cloudEvent returns the CloudEvents configuration from the flags.
+func cloudEvent() *pushx.CloudEvent {
+	if *flags.CloudEventsMode == "" {
+		return nil
+	}
+	return &pushx.CloudEvent{
+		Mode:            *flags.CloudEventsMode,
+		ID:              *flags.CloudEventsID,
+		Source:          *flags.CloudEventsSource,
+		Type:            *flags.CloudEventsType,
+		Subject:         *flags.CloudEventsSubject,
+		Time:            *flags.CloudEventsTime,
+		DataContentType: *flags.CloudEventsDataContentType,
+	}
+}
+
+// claimCheck returns the claim-check configuration from the flags.
+func claimCheck() (*pushx.ClaimCheck, error) {
+	if *flags.ClaimCheckDriver == "" {
+		return nil, nil
+	}
+	t, err := utils.ParseSize(*flags.ClaimCheckThreshold)
+	if err != nil {
+		return nil, err
+	}
+	return &pushx.ClaimCheck{
+		DriverName: drivers.DriverName(*flags.ClaimCheckDriver),
+		Threshold:  t,
+		Prefix:     *flags.ClaimCheckPrefix,
+	}, nil
+}
+
+// inputFormat returns the input format configuration from the flags.
+func inputFormat() *pushx.InputFormat {
+	if *flags.InputFormat == "" || *flags.InputFormat == pushx.FormatRaw {
+		return nil
+	}
+	f := &pushx.InputFormat{
+		Format:  *flags.InputFormat,
+		NoInfer: *flags.InputNoInfer,
+	}
+	if *flags.InputColumns != "" {
+		f.Columns = strings.Split(*flags.InputColumns, ",")
+	}
+	return f
+}
+
+// files returns the directory or glob input configuration from the flags.
+func files() *pushx.Files {
+	if *flags.InputDir == "" && *flags.InputGlob == "" {
+		return nil
+	}
+	split := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(s, ",")
+	}
+	return &pushx.Files{
+		Dir:         *flags.InputDir,
+		Recursive:   *flags.InputRecursive,
+		Glob:        *flags.InputGlob,
+		Include:     split(*flags.InputInclude),
+		Exclude:     split(*flags.InputExclude),
+		Concurrency: *flags.InputConcurrency,
+		OnSuccess:   *flags.OnSuccess,
+	}
+}
+
+// watch returns the watch configuration from the flags.
+func watch() (*pushx.Watch, error) {
+	if *flags.WatchFile == "" && *flags.WatchDir == "" {
+		return nil, nil
+	}
+	poll, err := time.ParseDuration(*flags.WatchPollInterval)
+	if err != nil {
+		return nil, err
+	}
+	settle, err := time.ParseDuration(*flags.WatchSettle)
+	if err != nil {
+		return nil, err
+	}
+	return &pushx.Watch{
+		File:         *flags.WatchFile,
+		Dir:          *flags.WatchDir,
+		StateFile:    *flags.WatchStateFile,
+		Batch:        *flags.WatchBatch,
+		PollInterval: poll,
+		Settle:       settle,
+		OnSuccess:    *flags.OnSuccess,
+	}, nil
+}
+
+// aggregate returns the aggregation configuration from the flags.
+func aggregate() (*pushx.Aggregate, error) {
+	if *flags.AggregateFormat == "" {
+		return nil, nil
+	}
+	a := &pushx.Aggregate{
+		Format:             *flags.AggregateFormat,
+		Gzip:               *flags.AggregateGzip,
+		MaxRecords:         *flags.AggregateMaxRecords,
+		ParquetCompression: *flags.AggregateParquetCompression,
+	}
+	var err error
+	if *flags.AggregateMaxBytes != "" {
+		if a.MaxBytes, err = utils.ParseSize(*flags.AggregateMaxBytes); err != nil {
+			return nil, err
+		}
+	}
+	if *flags.AggregateMaxAge != "" {
+		if a.MaxAge, err = time.ParseDuration(*flags.AggregateMaxAge); err != nil {
+			return nil, err
+		}
+	}
+	if *flags.AggregateParquetSchemaFile != "" {
+		bd, err := os.ReadFile(*flags.AggregateParquetSchemaFile)
+		if err != nil {
+			return nil, err
+		}
+		a.ParquetSchema = string(bd)
+	}
+	if *flags.AggregateParquetRowGroupSize != "" {
+		if a.ParquetRowGroupSize, err = utils.ParseSize(*flags.AggregateParquetRowGroupSize); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
 func run(j *pushx.PushX) error {
 	l := log.WithFields(log.Fields{
 		"app": AppName,
 		"fn":  "run",
 	})
 	l.Debug("start")
+	if j.Watch != nil {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := j.PushWatch(ctx); err != nil {
+			l.Errorf("failed to watch: %s", err)
+			return err
+		}
+		l.Debug("done")
+		return nil
+	}
 	if err := j.Push(); err != nil {
 		l.Errorf("failed to do work: %s", err)
 		return err
@@ -74,7 +403,7 @@ func cleanup(j *pushx.PushX) error {
 		"fn":  "cleanup",
 	})
 	l.Debug("cleanup")
-	if err := j.Driver.Cleanup(); err != nil {
+	if err := j.Close(); err != nil {
 		l.Error(err)
 		return err
 	}
@@ -96,31 +425,67 @@ func main() {
 			printUsage()
 			os.Exit(0)
 		}
+		if os.Args[1] == "check" {
+			os.Exit(check(os.Args[2:]))
+		}
+		if os.Args[1] == "relay" {
+			os.Exit(relay(os.Args[2:]))
+		}
+	}
+	if err := flags.FlagSet.Parse(os.Args[1:]); err != nil {
+		os.Exit(drivers.ExitConfig)
 	}
-	flags.FlagSet.Parse(os.Args[1:])
 	if err := LoadEnv(EnvKeyPrefix); err != nil {
 		l.Error(err)
-		os.Exit(1)
+		os.Exit(drivers.ExitCode(drivers.ConfigError(err)))
+	}
+	if err := utils.SetProxy(*flags.Proxy); err != nil {
+		l.WithError(err).Error("proxy")
+		os.Exit(drivers.ExitConfig)
 	}
 	l.Debug("parsed flags")
 	j := &pushx.PushX{
-		DriverName: drivers.DriverName(*flags.Driver),
-		InputStr:   *flags.InputStr,
-		InputFile:  *flags.InputFile,
-		OutputFile: *flags.Output,
+		DriverName:  drivers.DriverName(*flags.Driver),
+		InputStr:    *flags.InputStr,
+		InputFile:   *flags.InputFile,
+		OutputFile:  *flags.Output,
+		Meta:        flags.Meta.Map(),
+		CloudEvent:  cloudEvent(),
+		InputFormat: inputFormat(),
+		Files:       files(),
+	}
+	cc, err := claimCheck()
+	if err != nil {
+		l.WithError(err).Error("claimCheck")
+		os.Exit(drivers.ExitConfig)
+	}
+	j.ClaimCheck = cc
+	if j.Watch, err = watch(); err != nil {
+		l.WithError(err).Error("watch")
+		os.Exit(drivers.ExitConfig)
+	}
+	if j.Aggregate, err = aggregate(); err != nil {
+		l.WithError(err).Error("aggregate")
+		os.Exit(drivers.ExitConfig)
+	}
+	if *flags.MaxPayloadSize != "" {
+		if j.MaxPayloadSize, err = utils.ParseSize(*flags.MaxPayloadSize); err != nil {
+			l.WithError(err).Error("max-payload-size")
+			os.Exit(drivers.ExitConfig)
+		}
 	}
 	if err := j.Init(EnvKeyPrefix); err != nil {
 		l.WithError(err).Error("InitDriver")
-		os.Exit(1)
+		os.Exit(drivers.ExitCode(err))
 	}
 	l.Debug("initialized driver")
 	if err := run(j); err != nil {
 		l.WithError(err).Error("run")
-		os.Exit(1)
+		os.Exit(drivers.ExitCode(err))
 	}
 	if err := cleanup(j); err != nil {
 		l.WithError(err).Error("cleanup")
-		os.Exit(1)
+		os.Exit(drivers.ExitUnknown)
 	}
 	l.Debug("exited")
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/flags"
+	"github.com/robertlestak/pushx/pkg/pushx"
+	"github.com/robertlestak/pushx/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// relayConfig returns the relay configuration from the flags.
+func relayConfig() (*pushx.Relay, error) {
+	backoff, err := time.ParseDuration(*flags.RelayRetryBackoff)
+	if err != nil {
+		return nil, err
+	}
+	return &pushx.Relay{
+		SourceName:   drivers.DriverName(*flags.RelaySource),
+		Retries:      *flags.RelayRetries,
+		RetryBackoff: backoff,
+		DLQName:      drivers.DriverName(*flags.RelayDLQDriver),
+		MetricsAddr:  *flags.RelayMetricsAddr,
+	}, nil
+}
+
+// relay receives messages from the source driver and pushes each of them
+// to the driver until signaled, and returns the process exit code.
+func relay(args []string) int {
+	l := log.WithFields(log.Fields{
+		"app": AppName,
+		"fn":  "relay",
+	})
+	l.Debug("start")
+	if err := flags.FlagSet.Parse(args); err != nil {
+		return drivers.ExitConfig
+	}
+	if err := LoadEnv(EnvKeyPrefix); err != nil {
+		l.Error(err)
+		return drivers.ExitConfig
+	}
+	if err := utils.SetProxy(*flags.Proxy); err != nil {
+		l.WithError(err).Error("proxy")
+		return drivers.ExitConfig
+	}
+	j := &pushx.PushX{
+		DriverName:  drivers.DriverName(*flags.Driver),
+		OutputFile:  *flags.Output,
+		Meta:        flags.Meta.Map(),
+		CloudEvent:  cloudEvent(),
+		InputFormat: inputFormat(),
+	}
+	var err error
+	if j.ClaimCheck, err = claimCheck(); err != nil {
+		l.WithError(err).Error("claimCheck")
+		return drivers.ExitConfig
+	}
+	if j.Relay, err = relayConfig(); err != nil {
+		l.WithError(err).Error("relayConfig")
+		return drivers.ExitConfig
+	}
+	if *flags.MaxPayloadSize != "" {
+		if j.MaxPayloadSize, err = utils.ParseSize(*flags.MaxPayloadSize); err != nil {
+			l.WithError(err).Error("max-payload-size")
+			return drivers.ExitConfig
+		}
+	}
+	if err := j.Init(EnvKeyPrefix); err != nil {
+		l.WithError(err).Error("Init")
+		return drivers.ExitCode(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	code := drivers.ExitOK
+	if err := j.PushRelay(ctx); err != nil {
+		l.WithError(err).Error("PushRelay")
+		code = drivers.ExitCode(err)
+	}
+	if err := cleanup(j); err != nil && code == drivers.ExitOK {
+		code = drivers.ExitUnknown
+	}
+	return code
+}
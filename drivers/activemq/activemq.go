@@ -1,13 +1,15 @@
 package activemq
 
 import (
-	"crypto/tls"
+	"context"
+	"errors"
 	"io"
 	"io/ioutil"
 	"net"
 	"os"
 
 	stomp "github.com/go-stomp/stomp/v3"
+	"github.com/go-stomp/stomp/v3/frame"
 	"github.com/robertlestak/pushx/pkg/flags"
 	"github.com/robertlestak/pushx/pkg/utils"
 	log "github.com/sirupsen/logrus"
@@ -88,20 +90,20 @@ func (d *ActiveMQ) Init() error {
 	// create connection
 	var err error
 	var conn net.Conn
-	if *d.EnableTLS {
+	if d.EnableTLS != nil && *d.EnableTLS {
 		l.Debug("Creating TLS connection")
 		tc, err := utils.TlsConfig(d.EnableTLS, d.TLSInsecure, d.TLSCA, d.TLSCert, d.TLSKey)
 		if err != nil {
 			return err
 		}
 
-		conn, err = tls.Dial("tcp", d.Address, tc)
+		conn, err = utils.Dialer{}.DialTLS(context.Background(), "tcp", d.Address, tc)
 		if err != nil {
 			return err
 		}
 	} else {
 		l.Debug("Creating non-TLS connection")
-		conn, err = net.Dial("tcp", d.Address)
+		conn, err = utils.Dialer{}.Dial("tcp", d.Address)
 		if err != nil {
 			return err
 		}
@@ -116,17 +118,29 @@ func (d *ActiveMQ) Init() error {
 }
 
 func (d *ActiveMQ) Push(r io.Reader) error {
+	return d.PushMeta(r, nil)
+}
+
+// PushMeta pushes r with meta set as STOMP frame headers.
+func (d *ActiveMQ) PushMeta(r io.Reader, meta map[string]string) error {
 	l := log.WithFields(log.Fields{
 		"pkg": "activemq",
 		"fn":  "Push",
 	})
 	l.Debug("Pushing message")
+	if d.Name == nil || *d.Name == "" {
+		return errors.New("name is empty")
+	}
 	jd, err := ioutil.ReadAll(r)
 	if err != nil {
 		l.Errorf("%+v", err)
 		return err
 	}
-	err = d.Client.Send(*d.Name, "text/plain", jd, nil)
+	var opts []func(*frame.Frame) error
+	for k, v := range meta {
+		opts = append(opts, stomp.SendOpt.Header(k, v))
+	}
+	err = d.Client.Send(*d.Name, "text/plain", jd, opts...)
 	if err != nil {
 		l.Errorf("%+v", err)
 		return err
@@ -2,7 +2,9 @@ package aws
 
 import (
 	"bytes"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
 	"net/url"
 	"os"
@@ -16,9 +18,17 @@ import (
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/google/uuid"
 	"github.com/robertlestak/pushx/pkg/flags"
+	"github.com/robertlestak/pushx/pkg/schema"
+	"github.com/robertlestak/pushx/pkg/utils"
 	log "github.com/sirupsen/logrus"
 )
 
+// Server-side encryption of S3 objects.
+const (
+	S3SSEAES256 = "AES256"
+	S3SSEKMS    = "aws:kms"
+)
+
 type S3 struct {
 	Client  *s3manager.Uploader
 	sts     *STSSession
@@ -28,6 +38,24 @@ type S3 struct {
 	RoleARN string
 	ACL     string
 	Tags    map[string]string
+	// Endpoint and ForcePathStyle address S3 compatible storage, such as
+	// MinIO or Cloudflare R2.
+	Endpoint       string
+	ForcePathStyle bool
+	// SSE is the server-side encryption, AES256 or aws:kms, with the KMS
+	// key SSEKMSKeyID. SSECustomerKey is the base64 encoded key of SSE-C.
+	SSE            string
+	SSEKMSKeyID    string
+	SSECustomerKey string
+	StorageClass   string
+	// ContentType, CacheControl and ContentDisposition are the headers of
+	// the object, and Metadata its user metadata.
+	ContentType        string
+	CacheControl       string
+	ContentDisposition string
+	Metadata           map[string]string
+
+	customerKey []byte
 }
 
 func (d *S3) LogIdentity() error {
@@ -46,9 +74,9 @@ func (d *S3) LogIdentity() error {
 	r, err := sc.GetCallerIdentity(streq)
 	if err != nil {
 		l.Errorf("%+v", err)
-	} else {
-		l.Debugf("%+v", r)
+		return err
 	}
+	l.Debugf("%+v", r)
 	return nil
 }
 
@@ -82,6 +110,42 @@ func (d *S3) LoadEnv(prefix string) error {
 			}
 		}
 	}
+	if os.Getenv(prefix+"AWS_ENDPOINT") != "" {
+		d.Endpoint = os.Getenv(prefix + "AWS_ENDPOINT")
+	}
+	if os.Getenv(prefix+"AWS_S3_FORCE_PATH_STYLE") != "" {
+		d.ForcePathStyle = os.Getenv(prefix+"AWS_S3_FORCE_PATH_STYLE") == "true"
+	}
+	if os.Getenv(prefix+"AWS_S3_SSE") != "" {
+		d.SSE = os.Getenv(prefix + "AWS_S3_SSE")
+	}
+	if os.Getenv(prefix+"AWS_S3_SSE_KMS_KEY_ID") != "" {
+		d.SSEKMSKeyID = os.Getenv(prefix + "AWS_S3_SSE_KMS_KEY_ID")
+	}
+	if os.Getenv(prefix+"AWS_S3_SSE_C_KEY") != "" {
+		d.SSECustomerKey = os.Getenv(prefix + "AWS_S3_SSE_C_KEY")
+	}
+	if os.Getenv(prefix+"AWS_S3_STORAGE_CLASS") != "" {
+		d.StorageClass = os.Getenv(prefix + "AWS_S3_STORAGE_CLASS")
+	}
+	if os.Getenv(prefix+"AWS_S3_CONTENT_TYPE") != "" {
+		d.ContentType = os.Getenv(prefix + "AWS_S3_CONTENT_TYPE")
+	}
+	if os.Getenv(prefix+"AWS_S3_CACHE_CONTROL") != "" {
+		d.CacheControl = os.Getenv(prefix + "AWS_S3_CACHE_CONTROL")
+	}
+	if os.Getenv(prefix+"AWS_S3_CONTENT_DISPOSITION") != "" {
+		d.ContentDisposition = os.Getenv(prefix + "AWS_S3_CONTENT_DISPOSITION")
+	}
+	if os.Getenv(prefix+"AWS_S3_METADATA") != "" {
+		d.Metadata = make(map[string]string)
+		for _, kv := range flags.SplitList(os.Getenv(prefix + "AWS_S3_METADATA")) {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) == 2 {
+				d.Metadata[parts[0]] = parts[1]
+			}
+		}
+	}
 	if os.Getenv(prefix+"AWS_LOAD_CONFIG") != "" || os.Getenv("AWS_SDK_LOAD_CONFIG") != "" {
 		os.Setenv("AWS_SDK_LOAD_CONFIG", "1")
 	}
@@ -106,12 +170,51 @@ func (d *S3) LoadFlags() error {
 			d.Tags[parts[0]] = parts[1]
 		}
 	}
+	d.Endpoint = *flags.AWSEndpoint
+	d.ForcePathStyle = *flags.AWSS3ForcePathStyle
+	d.SSE = *flags.AWSS3SSE
+	d.SSEKMSKeyID = *flags.AWSS3SSEKMSKeyID
+	d.SSECustomerKey = *flags.AWSS3SSECustomerKey
+	d.StorageClass = *flags.AWSS3StorageClass
+	d.ContentType = *flags.AWSS3ContentType
+	d.CacheControl = *flags.AWSS3CacheControl
+	d.ContentDisposition = *flags.AWSS3ContentDisposition
+	d.Metadata = flags.AWSS3Metadata.Map()
 	if flags.AWSLoadConfig != nil && *flags.AWSLoadConfig {
 		os.Setenv("AWS_SDK_LOAD_CONFIG", "1")
 	}
 	return nil
 }
 
+// checkSSE returns an error if the server-side encryption is invalid, and
+// decodes the customer key.
+func (d *S3) checkSSE() error {
+	switch d.SSE {
+	case "", S3SSEAES256, S3SSEKMS:
+	default:
+		return fmt.Errorf("unknown server-side encryption %q", d.SSE)
+	}
+	if d.SSEKMSKeyID != "" && d.SSE != S3SSEKMS {
+		return errors.New("kms key id requires aws:kms server-side encryption")
+	}
+	d.customerKey = nil
+	if d.SSECustomerKey == "" {
+		return nil
+	}
+	if d.SSE != "" {
+		return errors.New("sse-c may not be used with another server-side encryption")
+	}
+	k, err := base64.StdEncoding.DecodeString(d.SSECustomerKey)
+	if err != nil {
+		return fmt.Errorf("sse-c key: %w", err)
+	}
+	if len(k) != 32 {
+		return fmt.Errorf("sse-c key is %d bytes, want 32", len(k))
+	}
+	d.customerKey = k
+	return nil
+}
+
 func (d *S3) Init() error {
 	l := log.WithFields(
 		log.Fields{
@@ -126,8 +229,13 @@ func (d *S3) Init() error {
 	if d.Region == "" {
 		d.Region = "us-east-1"
 	}
+	if err := d.checkSSE(); err != nil {
+		l.Errorf("%+v", err)
+		return err
+	}
 	cfg := &aws.Config{
-		Region: aws.String(d.Region),
+		Region:     aws.String(d.Region),
+		HTTPClient: utils.HTTPClient(),
 	}
 	sess, err := session.NewSession(cfg)
 	if err != nil {
@@ -151,7 +259,10 @@ func (d *S3) Init() error {
 		return err
 
 	}
-	s3Svc := s3.New(sess, cfg)
+	s3Svc := s3.New(sess, cfg, &aws.Config{
+		Endpoint:         endpoint(d.Endpoint),
+		S3ForcePathStyle: aws.Bool(d.ForcePathStyle),
+	})
 	d.Client = s3manager.NewUploaderWithClient(s3Svc)
 	d.sts = &STSSession{
 		Session: sess,
@@ -160,6 +271,9 @@ func (d *S3) Init() error {
 	return err
 }
 
+// reader hides any Seek method of the payload so that the uploader always
+// streams it in parts, buffering at most PartSize * Concurrency bytes,
+// rather than reading a seekable payload into memory to sign it.
 type reader struct {
 	r io.Reader
 }
@@ -168,7 +282,44 @@ func (r *reader) Read(p []byte) (int, error) {
 	return r.r.Read(p)
 }
 
+// templated returns true if any of the object options are templated from
+// the payload.
+func (d *S3) templated(meta map[string]string) bool {
+	for _, s := range []string{d.StorageClass, d.SSEKMSKeyID, d.ContentType, d.CacheControl, d.ContentDisposition} {
+		if strings.Contains(s, "{{") {
+			return true
+		}
+	}
+	for _, m := range []map[string]string{d.Tags, d.Metadata, meta} {
+		for _, v := range m {
+			if strings.Contains(v, "{{") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// optional returns the option s templated from the payload bd, or nil if it
+// is empty.
+func optional(bd []byte, s string) *string {
+	if bd != nil {
+		s = schema.ReplaceParamsString(bd, s)
+	}
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
 func (d *S3) Push(r io.Reader) error {
+	return d.PushMeta(r, nil)
+}
+
+// PushMeta pushes r with meta set as user metadata, in addition to the
+// configured metadata. Options templated from the payload, such as
+// {{type}}, are rendered with the payload, which is then read into memory.
+func (d *S3) PushMeta(r io.Reader, meta map[string]string) error {
 	l := log.WithFields(log.Fields{
 		"pkg": "aws",
 		"fn":  "Push",
@@ -180,18 +331,53 @@ func (d *S3) Push(r io.Reader) error {
 	if d.Key == "" {
 		return errors.New("key not set")
 	}
+	var bd []byte
+	if d.templated(meta) {
+		var err error
+		if bd, err = io.ReadAll(r); err != nil {
+			l.Errorf("%+v", err)
+			return err
+		}
+		r = bytes.NewReader(bd)
+	}
 	req := &s3manager.UploadInput{
-		Bucket: aws.String(d.Bucket),
-		Key:    aws.String(d.Key),
-		Body:   &reader{r},
+		Bucket:               aws.String(d.Bucket),
+		Key:                  aws.String(d.Key),
+		Body:                 &reader{r},
+		ServerSideEncryption: optional(nil, d.SSE),
+		SSEKMSKeyId:          optional(bd, d.SSEKMSKeyID),
+		StorageClass:         optional(bd, d.StorageClass),
+		ContentType:          optional(bd, d.ContentType),
+		CacheControl:         optional(bd, d.CacheControl),
+		ContentDisposition:   optional(bd, d.ContentDisposition),
+	}
+	if d.customerKey != nil {
+		// the SDK sends the key base64 encoded, with its MD5
+		req.SSECustomerAlgorithm = aws.String(S3SSEAES256)
+		req.SSECustomerKey = aws.String(string(d.customerKey))
 	}
 	if d.ACL != "" {
 		req.ACL = aws.String(d.ACL)
 	}
+	if len(d.Metadata) > 0 || len(meta) > 0 {
+		req.Metadata = make(map[string]*string, len(d.Metadata)+len(meta))
+		for _, m := range []map[string]string{d.Metadata, meta} {
+			for k, v := range m {
+				if bd != nil {
+					v = schema.ReplaceParamsString(bd, v)
+				}
+				k = strings.TrimPrefix(strings.ToLower(k), "x-amz-meta-")
+				req.Metadata[k] = aws.String(v)
+			}
+		}
+	}
 	if d.Tags != nil {
 		// encode tags as url query string
 		var buf bytes.Buffer
 		for k, v := range d.Tags {
+			if bd != nil {
+				v = schema.ReplaceParamsString(bd, v)
+			}
 			if buf.Len() > 0 {
 				buf.WriteByte('&')
 			}
@@ -212,6 +398,40 @@ func (d *S3) Push(r io.Reader) error {
 	return nil
 }
 
+func (d *S3) Check() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "aws",
+		"fn":  "Check",
+	})
+	l.Debug("Check")
+	if d.Bucket == "" {
+		return errors.New("bucket not set")
+	}
+	_, err := d.Client.S3.HeadBucket(&s3.HeadBucketInput{
+		Bucket: aws.String(d.Bucket),
+	})
+	if err != nil {
+		l.Errorf("%+v", err)
+		return err
+	}
+	return nil
+}
+
+// GetKey returns the key of the next push.
+func (d *S3) GetKey() string {
+	return d.Key
+}
+
+// SetKey sets the key of the next push.
+func (d *S3) SetKey(key string) {
+	d.Key = key
+}
+
+// URI returns the URI of the object at the current key.
+func (d *S3) URI() string {
+	return "s3://" + d.Bucket + "/" + d.Key
+}
+
 func (d *S3) Cleanup() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "aws",
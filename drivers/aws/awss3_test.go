@@ -0,0 +1,284 @@
+package aws_test
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/robertlestak/pushx/drivers/aws"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest"
+	"github.com/robertlestak/pushx/pkg/utils"
+)
+
+// s3Server is a fake S3 compatible endpoint which records the last object
+// put.
+type s3Server struct {
+	*httptest.Server
+	mu     sync.Mutex
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// newS3Server returns a fake served with TLS, as SSE-C keys are only sent
+// over HTTPS.
+func newS3Server(t *testing.T) *s3Server {
+	s := &s3Server{}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	setS3Credentials(t)
+	return s
+}
+
+// newPlainS3Server returns a fake served over HTTP, which the driver can
+// be pointed at with its endpoint alone.
+func newPlainS3Server(t *testing.T) *s3Server {
+	s := &s3Server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	setS3Credentials(t)
+	return s
+}
+
+func setS3Credentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "minio")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "minio123")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+// serve stores objects put to the bucket named bucket.
+func (s *s3Server) serve(w http.ResponseWriter, r *http.Request) {
+	bd, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/bucket/") {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`<Error><Code>NoSuchBucket</Code></Error>`))
+		return
+	}
+	s.path, s.header, s.body = r.URL.Path, r.Header, bd
+	w.Header().Set("ETag", `"etag"`)
+}
+
+func TestS3Conformance(t *testing.T) {
+	s := newPlainS3Server(t)
+	driverstest.Run(t, driverstest.Case{
+		New: func() drivers.Driver { return &aws.S3{} },
+		Flags: map[string]string{
+			"aws-region":              "us-east-1",
+			"aws-endpoint":            s.URL,
+			"aws-s3-force-path-style": "true",
+			"aws-s3-bucket":           "bucket",
+			"aws-s3-key":              "path/to/object",
+		},
+		Env: map[string]string{
+			"AWS_REGION":              "us-east-1",
+			"AWS_ENDPOINT":            s.URL,
+			"AWS_S3_FORCE_PATH_STYLE": "true",
+			"AWS_S3_BUCKET":           "bucket",
+			"AWS_S3_KEY":              "path/to/object",
+		},
+		BadEnv: map[string]string{
+			"AWS_REGION":              "us-east-1",
+			"AWS_ENDPOINT":            s.URL,
+			"AWS_S3_FORCE_PATH_STYLE": "true",
+			"AWS_S3_BUCKET":           "missing",
+			"AWS_S3_KEY":              "path/to/object",
+		},
+		Received: func(t *testing.T) []byte {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.path != "/bucket/path/to/object" {
+				t.Errorf("got a put to %s", s.path)
+			}
+			return s.body
+		},
+	})
+}
+
+func (s *s3Server) init(t *testing.T, d *aws.S3) {
+	t.Helper()
+	d.Endpoint = s.URL
+	d.ForcePathStyle = true
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	d.Client.S3.(*s3.S3).Config.HTTPClient = s.Client()
+}
+
+func TestS3Proxy(t *testing.T) {
+	s := newPlainS3Server(t)
+	var proxied string
+	// a forward proxy which sends requests for s3.test to the fake
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.Host
+		r.URL.Host = strings.TrimPrefix(s.URL, "http://")
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer proxy.Close()
+	if err := utils.SetProxy(proxy.URL); err != nil {
+		t.Fatal(err)
+	}
+	defer utils.SetProxy("")
+	d := &aws.S3{Endpoint: "http://s3.test", ForcePathStyle: true, Bucket: "bucket", Key: "object"}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Push(strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if proxied != "s3.test" || string(s.body) != "hello" {
+		t.Errorf("got a put of %q through the proxy to %q, want it proxied to s3.test", s.body, proxied)
+	}
+}
+
+func TestS3ObjectOptions(t *testing.T) {
+	s := newS3Server(t)
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	sum := md5.Sum(key)
+	for _, tc := range []struct {
+		name string
+		d    *aws.S3
+		want map[string]string
+	}{
+		{
+			name: "kms",
+			d: &aws.S3{
+				SSE:                aws.S3SSEKMS,
+				SSEKMSKeyID:        "alias/pushx",
+				StorageClass:       "STANDARD_IA",
+				ContentType:        "application/json",
+				CacheControl:       "max-age=60",
+				ContentDisposition: `attachment; filename="report.json"`,
+				Metadata:           map[string]string{"Owner": "team-a", "x-amz-meta-source": "pushx"},
+			},
+			want: map[string]string{
+				"X-Amz-Server-Side-Encryption":                "aws:kms",
+				"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": "alias/pushx",
+				"X-Amz-Storage-Class":                         "STANDARD_IA",
+				"Content-Type":                                "application/json",
+				"Cache-Control":                               "max-age=60",
+				"Content-Disposition":                         `attachment; filename="report.json"`,
+				"X-Amz-Meta-Owner":                            "team-a",
+				"X-Amz-Meta-Source":                           "pushx",
+			},
+		},
+		{
+			name: "sse-s3",
+			d:    &aws.S3{SSE: aws.S3SSEAES256},
+			want: map[string]string{"X-Amz-Server-Side-Encryption": "AES256"},
+		},
+		{
+			name: "sse-c",
+			d:    &aws.S3{SSECustomerKey: base64.StdEncoding.EncodeToString(key)},
+			want: map[string]string{
+				"X-Amz-Server-Side-Encryption-Customer-Algorithm": "AES256",
+				"X-Amz-Server-Side-Encryption-Customer-Key":       base64.StdEncoding.EncodeToString(key),
+				"X-Amz-Server-Side-Encryption-Customer-Key-Md5":   base64.StdEncoding.EncodeToString(sum[:]),
+				"X-Amz-Server-Side-Encryption":                    "",
+			},
+		},
+	} {
+		tc.d.Bucket, tc.d.Key = "bucket", "path/to/object.json"
+		s.init(t, tc.d)
+		if err := tc.d.Push(strings.NewReader(`{"id":1}`)); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		s.mu.Lock()
+		if s.path != "/bucket/path/to/object.json" || string(s.body) != `{"id":1}` {
+			t.Errorf("%s: got %s with body %q, want a path-style put", tc.name, s.path, s.body)
+		}
+		for k, v := range tc.want {
+			if got := s.header.Get(k); got != v {
+				t.Errorf("%s: got header %s %q, want %q", tc.name, k, got, v)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestS3Templates(t *testing.T) {
+	s := newS3Server(t)
+	d := &aws.S3{
+		Bucket:             "bucket",
+		Key:                "object",
+		ContentType:        "{{type}}",
+		ContentDisposition: `attachment; filename="{{name}}"`,
+		Metadata:           map[string]string{"id": "{{id}}"},
+		Tags:               map[string]string{"tenant": "{{tenant}}"},
+	}
+	s.init(t, d)
+	payload := `{"id":7,"type":"text/csv","name":"orders.csv","tenant":"acme"}`
+	if err := d.PushMeta(strings.NewReader(payload), map[string]string{"Source": "pushx"}); err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if string(s.body) != payload {
+		t.Errorf("got body %q", s.body)
+	}
+	for k, v := range map[string]string{
+		"Content-Type":        "text/csv",
+		"Content-Disposition": `attachment; filename="orders.csv"`,
+		"X-Amz-Meta-Id":       "7",
+		"X-Amz-Meta-Source":   "pushx",
+		"X-Amz-Tagging":       "tenant=acme",
+	} {
+		if got := s.header.Get(k); got != v {
+			t.Errorf("got header %s %q, want %q", k, got, v)
+		}
+	}
+}
+
+func TestS3InvalidSSE(t *testing.T) {
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	for name, d := range map[string]*aws.S3{
+		"unknown":       {SSE: "aws:kms:dsse:unknown"},
+		"kms key":       {SSE: aws.S3SSEAES256, SSEKMSKeyID: "alias/pushx"},
+		"sse-c and sse": {SSE: aws.S3SSEAES256, SSECustomerKey: key},
+		"short key":     {SSECustomerKey: base64.StdEncoding.EncodeToString(make([]byte, 16))},
+		"invalid key":   {SSECustomerKey: "not base64"},
+	} {
+		if err := d.Init(); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	q := &aws.SQS{Endpoint: "http://localhost:4566"}
+	if err := q.Init(); err != nil {
+		t.Fatal(err)
+	}
+	db := &aws.Dynamo{Endpoint: "http://localhost:4566"}
+	if err := db.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if q.Client.Endpoint != "http://localhost:4566" || db.Client.Endpoint != "http://localhost:4566" {
+		t.Errorf("got endpoints %s and %s, want LocalStack", q.Client.Endpoint, db.Client.Endpoint)
+	}
+}
@@ -1,6 +1,7 @@
 package aws
 
 import (
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/google/uuid"
 	"github.com/robertlestak/pushx/pkg/flags"
+	"github.com/robertlestak/pushx/pkg/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -21,12 +23,24 @@ type STSSession struct {
 	Config  *aws.Config
 }
 
+// endpoint returns the endpoint of the service client, or nil for the AWS
+// endpoint of the region. It is not set on the session, so that STS
+// requests still go to AWS.
+func endpoint(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
 type SQS struct {
 	Client  *sqs.SQS
 	sts     *STSSession
 	Queue   string
 	Region  string
 	RoleARN string
+	// Endpoint is the endpoint of SQS, such as LocalStack.
+	Endpoint string
 }
 
 func (d *SQS) LoadEnv(prefix string) error {
@@ -44,6 +58,9 @@ func (d *SQS) LoadEnv(prefix string) error {
 	if os.Getenv(prefix+"AWS_SQS_QUEUE_URL") != "" {
 		d.Queue = os.Getenv(prefix + "AWS_SQS_QUEUE_URL")
 	}
+	if os.Getenv(prefix+"AWS_ENDPOINT") != "" {
+		d.Endpoint = os.Getenv(prefix + "AWS_ENDPOINT")
+	}
 	if os.Getenv(prefix+"AWS_LOAD_CONFIG") != "" || os.Getenv("AWS_SDK_LOAD_CONFIG") != "" {
 		os.Setenv("AWS_SDK_LOAD_CONFIG", "1")
 	}
@@ -59,6 +76,7 @@ func (d *SQS) LoadFlags() error {
 	d.Queue = *flags.SQSQueueURL
 	d.Region = *flags.AWSRegion
 	d.RoleARN = *flags.AWSRoleARN
+	d.Endpoint = *flags.AWSEndpoint
 	if flags.AWSLoadConfig != nil && *flags.AWSLoadConfig {
 		os.Setenv("AWS_SDK_LOAD_CONFIG", "1")
 	}
@@ -81,9 +99,9 @@ func (d *SQS) LogIdentity() error {
 	r, err := sc.GetCallerIdentity(streq)
 	if err != nil {
 		l.Errorf("%+v", err)
-	} else {
-		l.Debugf("%+v", r)
+		return err
 	}
+	l.Debugf("%+v", r)
 	return nil
 }
 
@@ -102,7 +120,8 @@ func (d *SQS) Init() error {
 		d.Region = "us-east-1"
 	}
 	cfg := &aws.Config{
-		Region: aws.String(d.Region),
+		Region:     aws.String(d.Region),
+		HTTPClient: utils.HTTPClient(),
 	}
 	sess, err := session.NewSession(cfg)
 	if err != nil {
@@ -111,7 +130,7 @@ func (d *SQS) Init() error {
 	}
 	reqId := uuid.New().String()
 	if d.RoleARN != "" {
-		l.Debug("CreateAWSSession roleArn=%s requestId=%s", d.RoleARN, reqId)
+		l.Debugf("CreateAWSSession roleArn=%s requestId=%s", d.RoleARN, reqId)
 		creds := stscreds.NewCredentials(sess, d.RoleARN, func(p *stscreds.AssumeRoleProvider) {
 			p.RoleSessionName = "pushx-" + reqId
 		})
@@ -125,7 +144,7 @@ func (d *SQS) Init() error {
 		return err
 
 	}
-	d.Client = sqs.New(sess, cfg)
+	d.Client = sqs.New(sess, cfg, &aws.Config{Endpoint: endpoint(d.Endpoint)})
 	d.sts = &STSSession{
 		Session: sess,
 		Config:  cfg,
@@ -134,6 +153,11 @@ func (d *SQS) Init() error {
 }
 
 func (d *SQS) Push(r io.Reader) error {
+	return d.PushMeta(r, nil)
+}
+
+// PushMeta pushes r with meta set as string message attributes.
+func (d *SQS) PushMeta(r io.Reader, meta map[string]string) error {
 	l := log.WithFields(log.Fields{
 		"pkg": "aws",
 		"fn":  "Push",
@@ -148,6 +172,15 @@ func (d *SQS) Push(r io.Reader) error {
 		MessageBody: aws.String(strings.TrimSpace(string(bd))),
 		QueueUrl:    aws.String(d.Queue),
 	}
+	if len(meta) > 0 {
+		req.MessageAttributes = make(map[string]*sqs.MessageAttributeValue, len(meta))
+		for k, v := range meta {
+			req.MessageAttributes[k] = &sqs.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String(v),
+			}
+		}
+	}
 	_, err = d.Client.SendMessage(req)
 	if err != nil {
 		l.Errorf("%+v", err)
@@ -155,6 +188,26 @@ func (d *SQS) Push(r io.Reader) error {
 	return err
 }
 
+func (d *SQS) Check() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "aws",
+		"fn":  "Check",
+	})
+	l.Debug("Check")
+	if d.Queue == "" {
+		return errors.New("queue url not set")
+	}
+	_, err := d.Client.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(d.Queue),
+		AttributeNames: []*string{aws.String(sqs.QueueAttributeNameQueueArn)},
+	})
+	if err != nil {
+		l.Errorf("%+v", err)
+		return err
+	}
+	return nil
+}
+
 func (d *SQS) Cleanup() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "aws",
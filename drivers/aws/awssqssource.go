@@ -0,0 +1,55 @@
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	log "github.com/sirupsen/logrus"
+)
+
+// Receive long polls the queue for the next message.
+func (d *SQS) Receive(ctx context.Context) ([]byte, any, error) {
+	l := log.WithFields(log.Fields{
+		"pkg": "aws",
+		"fn":  "Receive",
+	})
+	for {
+		out, err := d.Client.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(d.Queue),
+			MaxNumberOfMessages: aws.Int64(1),
+			WaitTimeSeconds:     aws.Int64(20),
+		})
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if err != nil {
+			l.Errorf("%+v", err)
+			return nil, nil, err
+		}
+		if len(out.Messages) == 0 {
+			continue
+		}
+		m := out.Messages[0]
+		return []byte(aws.StringValue(m.Body)), m.ReceiptHandle, nil
+	}
+}
+
+// Ack deletes the message from the queue.
+func (d *SQS) Ack(ref any) error {
+	_, err := d.Client.DeleteMessage(&sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(d.Queue),
+		ReceiptHandle: ref.(*string),
+	})
+	return err
+}
+
+// Nack makes the message visible again, so that it is received again.
+func (d *SQS) Nack(ref any) error {
+	_, err := d.Client.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(d.Queue),
+		ReceiptHandle:     ref.(*string),
+		VisibilityTimeout: aws.Int64(0),
+	})
+	return err
+}
@@ -2,6 +2,7 @@ package aws
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
@@ -14,6 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/google/uuid"
 	"github.com/robertlestak/pushx/pkg/flags"
+	"github.com/robertlestak/pushx/pkg/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -23,6 +25,8 @@ type Dynamo struct {
 	Table   string
 	Region  string
 	RoleARN string
+	// Endpoint is the endpoint of DynamoDB, such as LocalStack.
+	Endpoint string
 }
 
 func (d *Dynamo) LogIdentity() error {
@@ -41,9 +45,9 @@ func (d *Dynamo) LogIdentity() error {
 	r, err := sc.GetCallerIdentity(streq)
 	if err != nil {
 		l.Errorf("%+v", err)
-	} else {
-		l.Debugf("%+v", r)
+		return err
 	}
+	l.Debugf("%+v", r)
 	return nil
 }
 
@@ -62,6 +66,9 @@ func (d *Dynamo) LoadEnv(prefix string) error {
 	if os.Getenv(prefix+"AWS_DYNAMO_TABLE") != "" {
 		d.Table = os.Getenv(prefix + "AWS_DYNAMO_TABLE")
 	}
+	if os.Getenv(prefix+"AWS_ENDPOINT") != "" {
+		d.Endpoint = os.Getenv(prefix + "AWS_ENDPOINT")
+	}
 	if os.Getenv(prefix+"AWS_LOAD_CONFIG") != "" || os.Getenv("AWS_SDK_LOAD_CONFIG") != "" {
 		os.Setenv("AWS_SDK_LOAD_CONFIG", "1")
 	}
@@ -77,6 +84,7 @@ func (d *Dynamo) LoadFlags() error {
 	d.Table = *flags.AWSDynamoTable
 	d.Region = *flags.AWSRegion
 	d.RoleARN = *flags.AWSRoleARN
+	d.Endpoint = *flags.AWSEndpoint
 	if flags.AWSLoadConfig != nil && *flags.AWSLoadConfig {
 		os.Setenv("AWS_SDK_LOAD_CONFIG", "1")
 	}
@@ -98,7 +106,8 @@ func (d *Dynamo) Init() error {
 		d.Region = "us-east-1"
 	}
 	cfg := &aws.Config{
-		Region: aws.String(d.Region),
+		Region:     aws.String(d.Region),
+		HTTPClient: utils.HTTPClient(),
 	}
 	sess, err := session.NewSession(cfg)
 	if err != nil {
@@ -107,7 +116,7 @@ func (d *Dynamo) Init() error {
 	}
 	reqId := uuid.New().String()
 	if d.RoleARN != "" {
-		l.Debug("CreateAWSSession roleArn=%s requestId=%s", d.RoleARN, reqId)
+		l.Debugf("CreateAWSSession roleArn=%s requestId=%s", d.RoleARN, reqId)
 		creds := stscreds.NewCredentials(sess, d.RoleARN, func(p *stscreds.AssumeRoleProvider) {
 			p.RoleSessionName = "pushx-" + reqId
 		})
@@ -121,7 +130,7 @@ func (d *Dynamo) Init() error {
 		return err
 
 	}
-	d.Client = dynamodb.New(sess, cfg)
+	d.Client = dynamodb.New(sess, cfg, &aws.Config{Endpoint: endpoint(d.Endpoint)})
 	d.sts = &STSSession{
 		Session: sess,
 		Config:  cfg,
@@ -144,7 +153,7 @@ func (d *Dynamo) Push(r io.Reader) error {
 	var m map[string]interface{}
 	if err = json.Unmarshal(data, &m); err != nil {
 		l.Errorf("%+v", err)
-		return err
+		return utils.Permanent(err)
 	}
 	av, err := dynamodbattribute.MarshalMap(m)
 	if err != nil {
@@ -161,6 +170,25 @@ func (d *Dynamo) Push(r io.Reader) error {
 	return nil
 }
 
+func (d *Dynamo) Check() error {
+	l := log.WithFields(log.Fields{
+		"fn":  "Check",
+		"pkg": "aws",
+	})
+	l.Debug("Check")
+	if d.Table == "" {
+		return errors.New("table not set")
+	}
+	_, err := d.Client.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(d.Table),
+	})
+	if err != nil {
+		l.Errorf("%+v", err)
+		return err
+	}
+	return nil
+}
+
 func (d *Dynamo) Cleanup() error {
 	l := log.WithFields(log.Fields{
 		"fn":  "Cleanup",
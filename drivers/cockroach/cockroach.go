@@ -9,9 +9,10 @@ import (
 	"strconv"
 	"strings"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/robertlestak/pushx/pkg/flags"
 	"github.com/robertlestak/pushx/pkg/schema"
+	"github.com/robertlestak/pushx/pkg/utils"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -160,11 +161,13 @@ func (d *CockroachDB) Init() error {
 	}
 	connStr += opts
 	l.Debugf("Connecting to %s", connStr)
-	d.Client, err = sql.Open("postgres", connStr)
+	c, err := pq.NewConnector(connStr)
 	if err != nil {
 		l.Error(err)
 		return err
 	}
+	c.Dialer(utils.Dialer{})
+	d.Client = sql.OpenDB(c)
 	err = d.Client.Ping()
 	if err != nil {
 		l.Error(err)
@@ -189,9 +192,9 @@ func (d *CockroachDB) Push(r io.Reader) error {
 		l.Error(err)
 		return err
 	}
-	d.Query.Params = schema.ReplaceParams(bd, d.Query.Params)
-	l.Debugf("Executing query: %s %v", d.Query.Query, d.Query.Params)
-	_, err = d.Client.Exec(d.Query.Query, d.Query.Params...)
+	params := schema.ReplaceParams(bd, d.Query.Params)
+	l.Debugf("Executing query: %s %v", d.Query.Query, params)
+	_, err = d.Client.Exec(d.Query.Query, params...)
 	if err != nil {
 		l.Error(err)
 		return err
@@ -200,6 +203,19 @@ func (d *CockroachDB) Push(r io.Reader) error {
 	return nil
 }
 
+func (d *CockroachDB) Check() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "cockroach",
+		"fn":  "Check",
+	})
+	l.Debug("Checking cockroach connection")
+	if err := d.Client.Ping(); err != nil {
+		l.Error(err)
+		return err
+	}
+	return nil
+}
+
 func (d *CockroachDB) Cleanup() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "cockroach",
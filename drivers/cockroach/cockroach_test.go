@@ -0,0 +1,55 @@
+package cockroach_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/robertlestak/pushx/drivers/cockroach"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest/sqlfake"
+)
+
+func TestConformance(t *testing.T) {
+	db := sqlfake.Open(t)
+	if _, err := db.Exec("CREATE TABLE pushes (data BLOB)"); err != nil {
+		t.Fatal(err)
+	}
+	addr := sqlfake.ServePostgres(t, db)
+	port := strconv.Itoa(addr.Port)
+	driverstest.Run(t, driverstest.Case{
+		New: func() drivers.Driver { return &cockroach.CockroachDB{} },
+		Flags: map[string]string{
+			"cockroach-host":     addr.IP.String(),
+			"cockroach-port":     port,
+			"cockroach-user":     "pushx",
+			"cockroach-password": "pushx",
+			"cockroach-database": "pushx",
+			"cockroach-query":    "INSERT INTO pushes (data) VALUES ($1)",
+			"cockroach-params":   "{{pushx_payload}}",
+		},
+		Env: map[string]string{
+			"COCKROACH_HOST":         addr.IP.String(),
+			"COCKROACH_PORT":         port,
+			"COCKROACH_USER":         "pushx",
+			"COCKROACH_PASSWORD":     "pushx",
+			"COCKROACH_DATABASE":     "pushx",
+			"COCKROACH_QUERY":        "INSERT INTO pushes (data) VALUES ($1)",
+			"COCKROACH_QUERY_PARAMS": "{{pushx_payload}}",
+		},
+		BadEnv: map[string]string{
+			"COCKROACH_HOST":         addr.IP.String(),
+			"COCKROACH_PORT":         port,
+			"COCKROACH_USER":         "pushx",
+			"COCKROACH_QUERY":        "INSERT INTO missing (data) VALUES ($1)",
+			"COCKROACH_QUERY_PARAMS": "{{pushx_payload}}",
+		},
+		Received: func(t *testing.T) []byte {
+			var bd []byte
+			if err := db.QueryRow("SELECT data FROM pushes ORDER BY rowid DESC LIMIT 1").Scan(&bd); err != nil {
+				t.Fatal(err)
+			}
+			return bd
+		},
+	})
+}
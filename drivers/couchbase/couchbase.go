@@ -168,7 +168,7 @@ func (d *Couchbase) Push(r io.Reader) error {
 	err := json.NewDecoder(r).Decode(&message)
 	if err != nil {
 		l.Error(err)
-		return err
+		return utils.Permanent(err)
 	}
 	if d.BucketName == nil || *d.BucketName == "" {
 		l.Error("bucket name is not set")
@@ -184,8 +184,15 @@ func (d *Couchbase) Push(r io.Reader) error {
 		return errors.New("id is empty")
 	}
 	d.ID = &i
+	scope, collection := "_default", "_default"
+	if d.Scope != nil && *d.Scope != "" {
+		scope = *d.Scope
+	}
+	if d.Collection != nil && *d.Collection != "" {
+		collection = *d.Collection
+	}
 	bucket := d.Client.Bucket(*d.BucketName)
-	coll := bucket.Scope(*d.Scope).Collection(*d.Collection)
+	coll := bucket.Scope(scope).Collection(collection)
 	_, err = coll.Upsert(*d.ID, message, nil)
 	if err != nil {
 		l.Error(err)
@@ -2,7 +2,7 @@ package elasticsearch
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -108,6 +108,7 @@ func (d *Elasticsearch) Init() error {
 	client, err := elasticsearch8.NewClient(elasticsearch8.Config{
 		Transport: &http.Transport{
 			TLSClientConfig: tc,
+			Proxy:           utils.HTTPProxy,
 		},
 		Addresses: []string{d.Address},
 		Username:  d.Username,
@@ -127,8 +128,9 @@ func (d *Elasticsearch) Push(r io.Reader) error {
 		"fn":  "Push",
 	})
 	l.Debug("Putting work")
-	put := esapi.IndexRequest{
-		DocumentID: *d.Key,
+	put := esapi.IndexRequest{}
+	if d.Key != nil {
+		put.DocumentID = *d.Key
 	}
 	if d.Index != nil {
 		put.Index = *d.Index
@@ -139,6 +141,7 @@ func (d *Elasticsearch) Push(r io.Reader) error {
 		l.Errorf("error putting work: %v", err)
 		return err
 	}
+	defer putResponse.Body.Close()
 	if putResponse.StatusCode != 200 && putResponse.StatusCode != 201 {
 		bd, err := ioutil.ReadAll(putResponse.Body)
 		if err != nil {
@@ -146,7 +149,12 @@ func (d *Elasticsearch) Push(r io.Reader) error {
 			return err
 		}
 		l.Errorf("error putting work(%d): %v", putResponse.StatusCode, string(bd))
-		return errors.New("error putting work")
+		err = fmt.Errorf("error putting work(%d)", putResponse.StatusCode)
+		// documents which fail to parse or map will never be accepted
+		if putResponse.StatusCode == http.StatusBadRequest {
+			return utils.Permanent(err)
+		}
+		return err
 	}
 	return nil
 }
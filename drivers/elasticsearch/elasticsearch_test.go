@@ -0,0 +1,82 @@
+package elasticsearch_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/robertlestak/pushx/drivers/elasticsearch"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest"
+)
+
+// server is a fake Elasticsearch which accepts documents for a single index.
+type server struct {
+	*httptest.Server
+	mu   sync.Mutex
+	docs map[string][]byte
+}
+
+func newServer(t *testing.T, index string) *server {
+	s := &server{docs: make(map[string][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		id := strings.TrimPrefix(r.URL.Path, "/"+index+"/_doc/")
+		if id == r.URL.Path || (r.Method != http.MethodPut && r.Method != http.MethodPost) {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error":"index_not_found_exception"}`)
+			return
+		}
+		bd, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var doc map[string]any
+		if err := json.Unmarshal(bd, &doc); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"mapper_parsing_exception"}`)
+			return
+		}
+		s.mu.Lock()
+		s.docs[id] = bd
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"result":"created"}`)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	s := newServer(t, "pushx")
+	driverstest.Run(t, driverstest.Case{
+		New: func() drivers.Driver { return &elasticsearch.Elasticsearch{} },
+		Flags: map[string]string{
+			"elasticsearch-address": s.URL,
+			"elasticsearch-index":   "pushx",
+			"elasticsearch-doc-id":  "1",
+		},
+		Env: map[string]string{
+			"ELASTICSEARCH_ADDRESS": s.URL,
+			"ELASTICSEARCH_INDEX":   "pushx",
+			"ELASTICSEARCH_DOC_ID":  "1",
+		},
+		BadEnv: map[string]string{
+			"ELASTICSEARCH_ADDRESS": s.URL,
+			"ELASTICSEARCH_INDEX":   "missing",
+			"ELASTICSEARCH_DOC_ID":  "1",
+		},
+		JSON: true,
+		Received: func(t *testing.T) []byte {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return s.docs["1"]
+		},
+	})
+}
@@ -163,9 +163,13 @@ func (d *Etcd) Cleanup() error {
 		"fn":  "Cleanup",
 	})
 	l.Debug("Cleanup")
+	if d.Client == nil {
+		return nil
+	}
 	if err := d.Client.Close(); err != nil {
 		l.Error(err)
 		return err
 	}
+	d.Client = nil
 	return nil
 }
@@ -0,0 +1,72 @@
+package etcd_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/robertlestak/pushx/drivers/etcd"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"google.golang.org/grpc"
+)
+
+// kvServer is a fake of the etcd KV service which stores the values put.
+type kvServer struct {
+	etcdserverpb.UnimplementedKVServer
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (s *kvServer) Put(ctx context.Context, r *etcdserverpb.PutRequest) (*etcdserverpb.PutResponse, error) {
+	if len(r.Key) == 0 {
+		return nil, rpctypes.ErrGRPCEmptyKey
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[string(r.Key)] = r.Value
+	return &etcdserverpb.PutResponse{Header: &etcdserverpb.ResponseHeader{}}, nil
+}
+
+func (s *kvServer) get(key string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data[key]
+}
+
+func newServer(t *testing.T) (*kvServer, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv := &kvServer{data: make(map[string][]byte)}
+	gs := grpc.NewServer()
+	etcdserverpb.RegisterKVServer(gs, kv)
+	go gs.Serve(ln)
+	t.Cleanup(gs.Stop)
+	return kv, ln.Addr().String()
+}
+
+func TestConformance(t *testing.T) {
+	kv, addr := newServer(t)
+	driverstest.Run(t, driverstest.Case{
+		New: func() drivers.Driver { return &etcd.Etcd{} },
+		Flags: map[string]string{
+			"etcd-hosts": addr,
+			"etcd-key":   "pushx",
+		},
+		Env: map[string]string{
+			"ETCD_HOSTS": addr,
+			"ETCD_KEY":   "pushx",
+		},
+		BadEnv: map[string]string{
+			"ETCD_HOSTS": addr,
+		},
+		Received: func(t *testing.T) []byte {
+			return kv.get("pushx")
+		},
+	})
+}
@@ -2,7 +2,9 @@ package fs
 
 import (
 	"io"
+	"net/url"
 	"os"
+	"path/filepath"
 
 	"github.com/robertlestak/pushx/pkg/flags"
 	log "github.com/sirupsen/logrus"
@@ -11,6 +13,10 @@ import (
 type FS struct {
 	Folder string
 	Key    string
+
+	// inflight are the files received as a relay source and not yet
+	// acknowledged
+	inflight map[string]bool
 }
 
 func (d *FS) LoadEnv(prefix string) error {
@@ -56,6 +62,17 @@ func (d *FS) Push(r io.Reader) error {
 		"fn":  "Push",
 	})
 	l.Debug("Push")
+	// create the subdirectories of the key, but not the folder itself
+	if dir := filepath.Dir(d.Key); dir != "." {
+		if _, err := os.Stat(d.Folder); err != nil {
+			l.WithError(err).Error("Stat")
+			return err
+		}
+		if err := os.MkdirAll(filepath.Join(d.Folder, dir), 0755); err != nil {
+			l.WithError(err).Error("MkdirAll")
+			return err
+		}
+	}
 	// write the input to the file
 	f, err := os.Create(d.Folder + "/" + d.Key)
 	if err != nil {
@@ -71,6 +88,25 @@ func (d *FS) Push(r io.Reader) error {
 	return nil
 }
 
+// GetKey returns the key of the next push.
+func (d *FS) GetKey() string {
+	return d.Key
+}
+
+// SetKey sets the key of the next push.
+func (d *FS) SetKey(key string) {
+	d.Key = key
+}
+
+// URI returns the URI of the object at the current key.
+func (d *FS) URI() string {
+	p, err := filepath.Abs(filepath.Join(d.Folder, d.Key))
+	if err != nil {
+		p = filepath.Join(d.Folder, d.Key)
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(p)}).String()
+}
+
 func (d *FS) Cleanup() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "fs",
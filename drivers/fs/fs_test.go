@@ -0,0 +1,75 @@
+package fs_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/pushx/drivers/fs"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest"
+)
+
+func TestConformance(t *testing.T) {
+	dir := t.TempDir()
+	driverstest.Run(t, driverstest.Case{
+		New: func() drivers.Driver { return &fs.FS{} },
+		Flags: map[string]string{
+			"fs-folder": dir,
+			"fs-key":    "out",
+		},
+		Env: map[string]string{
+			"FS_FOLDER": dir,
+			"FS_KEY":    "out",
+		},
+		BadEnv: map[string]string{
+			"FS_FOLDER": filepath.Join(dir, "missing"),
+			"FS_KEY":    "out",
+		},
+		Received: func(t *testing.T) []byte {
+			bd, err := os.ReadFile(filepath.Join(dir, "out"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return bd
+		},
+	})
+}
+
+func TestPushStreams(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	d := &fs.FS{Folder: dir, Key: "out"}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("hello"))
+		// the rest of the payload is only written once the start of it is
+		// on disk, so a driver that buffers the payload never completes
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if fi, err := os.Stat(out); err == nil && fi.Size() == 5 {
+				pw.Write([]byte(" world"))
+				pw.Close()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		pw.CloseWithError(errors.New("payload not streamed"))
+	}()
+	if err := d.Push(pr); err != nil {
+		t.Fatal(err)
+	}
+	bd, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bd) != "hello world" {
+		t.Errorf("got %q, want %q", bd, "hello world")
+	}
+}
@@ -0,0 +1,97 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// pollInterval is how often the folder is listed when it has no files to
+// receive.
+const pollInterval = 250 * time.Millisecond
+
+// Receive returns the content of the oldest file in the folder which is
+// not already being relayed. Files whose names start with a dot are
+// skipped, so that writers can create files under a temporary name and
+// rename them once complete.
+func (d *FS) Receive(ctx context.Context) ([]byte, any, error) {
+	l := log.WithFields(log.Fields{
+		"pkg": "fs",
+		"fn":  "Receive",
+	})
+	for {
+		p, err := d.next()
+		if err != nil {
+			l.WithError(err).Error("next")
+			return nil, nil, err
+		}
+		if p != "" {
+			bd, err := os.ReadFile(p)
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				l.WithError(err).Error("ReadFile")
+				return nil, nil, err
+			}
+			if d.inflight == nil {
+				d.inflight = map[string]bool{}
+			}
+			d.inflight[p] = true
+			return bd, p, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// next returns the path of the oldest file to receive, or "" if there is
+// none.
+func (d *FS) next() (string, error) {
+	entries, err := os.ReadDir(d.Folder)
+	if err != nil {
+		return "", err
+	}
+	type file struct {
+		path    string
+		modTime time.Time
+	}
+	var files []file
+	for _, e := range entries {
+		p := filepath.Join(d.Folder, e.Name())
+		if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") || d.inflight[p] {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, file{path: p, modTime: fi.ModTime()})
+	}
+	if len(files) == 0 {
+		return "", nil
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	return files[0].path, nil
+}
+
+// Ack deletes the file.
+func (d *FS) Ack(ref any) error {
+	delete(d.inflight, ref.(string))
+	return os.Remove(ref.(string))
+}
+
+// Nack releases the file, so that it is received again.
+func (d *FS) Nack(ref any) error {
+	delete(d.inflight, ref.(string))
+	return nil
+}
@@ -0,0 +1,74 @@
+package fs_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/pushx/drivers/fs"
+)
+
+func TestSource(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Minute)
+	for _, f := range []struct {
+		name, data string
+		modTime    time.Time
+	}{
+		{"b", "second", time.Now()},
+		{"a", "first", old},
+		{".partial", "skipped", old},
+	} {
+		p := filepath.Join(dir, f.name)
+		if err := os.WriteFile(p, []byte(f.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, f.modTime, f.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := &fs.FS{Folder: dir}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	bd, a, err := d.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bd) != "first" {
+		t.Fatalf("got %q, want the oldest file", bd)
+	}
+	// files being relayed are not received again until released
+	bd, b, err := d.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bd) != "second" {
+		t.Fatalf("got %q, want the second file", bd)
+	}
+	if err := d.Nack(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Ack(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b")); !os.IsNotExist(err) {
+		t.Errorf("acked file was not deleted: %v", err)
+	}
+	bd, a, err = d.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bd) != "first" {
+		t.Fatalf("got %q after nack, want the first file", bd)
+	}
+	if err := d.Ack(a); err != nil {
+		t.Fatal(err)
+	}
+	short, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := d.Receive(short); err != context.DeadlineExceeded {
+		t.Errorf("got error %v with only a dot file, want deadline exceeded", err)
+	}
+}
@@ -57,7 +57,11 @@ func (d *BQ) Init() error {
 	l.Debug("Initializing GCP_BQ client")
 	var err error
 	ctx := context.Background()
-	c, err := bigquery.NewClient(ctx, d.ProjectID)
+	opts, err := httpOptions(ctx, bigquery.Scope, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return err
+	}
+	c, err := bigquery.NewClient(ctx, d.ProjectID, opts...)
 	if err != nil {
 		return err
 	}
@@ -73,7 +77,7 @@ func (d *BQ) Push(r io.Reader) error {
 	})
 	l.Debug("Handling failure in GCP_BQ")
 	var err error
-	if *d.Query == "" {
+	if d.Query == nil || *d.Query == "" {
 		return nil
 	}
 	bd, err := ioutil.ReadAll(r)
@@ -10,6 +10,7 @@ import (
 	"cloud.google.com/go/firestore"
 	"github.com/google/uuid"
 	"github.com/robertlestak/pushx/pkg/flags"
+	"github.com/robertlestak/pushx/pkg/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -60,7 +61,7 @@ func (d *GCPFirestore) Init() error {
 	})
 	l.Debug("Initializing gcp firestore driver")
 	ctx := context.Background()
-	client, err := firestore.NewClient(ctx, d.ProjectID)
+	client, err := firestore.NewClient(ctx, d.ProjectID, grpcOptions()...)
 	if err != nil {
 		return err
 	}
@@ -74,10 +75,10 @@ func (d *GCPFirestore) Push(r io.Reader) error {
 		"fn":  "Push",
 	})
 	l.Debug("Creating document in gcp firestore driver")
-	if *d.Collection == "" {
+	if d.Collection == nil || *d.Collection == "" {
 		return errors.New("no collection to create document in")
 	}
-	if *d.ID == "" {
+	if d.ID == nil || *d.ID == "" {
 		// generate new id
 		v := uuid.New().String()
 		d.ID = &v
@@ -86,7 +87,7 @@ func (d *GCPFirestore) Push(r io.Reader) error {
 	var message map[string]interface{}
 	if err := json.NewDecoder(r).Decode(&message); err != nil {
 		l.Error("Failed to decode message")
-		return err
+		return utils.Permanent(err)
 	}
 	_, err := d.Client.Doc(*d.Collection+"/"+*d.ID).Create(ctx, message)
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 	"cloud.google.com/go/storage"
 	"github.com/robertlestak/pushx/pkg/flags"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/option"
 )
 
 type GCS struct {
@@ -52,7 +53,16 @@ func (d *GCS) Init() error {
 	)
 	l.Debug("CreateGCPSession")
 	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
+	var opts []option.ClientOption
+	// the emulator is connected to without credentials
+	if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		var err error
+		opts, err = httpOptions(ctx, storage.ScopeFullControl, "https://www.googleapis.com/auth/cloud-platform")
+		if err != nil {
+			return err
+		}
+	}
+	client, err := storage.NewClient(ctx, opts...)
 	if err != nil {
 		return err
 	}
@@ -83,6 +93,37 @@ func (d *GCS) Push(r io.Reader) error {
 	return nil
 }
 
+func (d *GCS) Check() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "gcp",
+		"fn":  "Check",
+	})
+	l.Debug("Check")
+	if d.Bucket == "" {
+		return fmt.Errorf("bucket is empty")
+	}
+	if _, err := d.Client.Bucket(d.Bucket).Attrs(context.Background()); err != nil {
+		l.Error(err)
+		return err
+	}
+	return nil
+}
+
+// GetKey returns the key of the next push.
+func (d *GCS) GetKey() string {
+	return d.Key
+}
+
+// SetKey sets the key of the next push.
+func (d *GCS) SetKey(key string) {
+	d.Key = key
+}
+
+// URI returns the URI of the object at the current key.
+func (d *GCS) URI() string {
+	return "gs://" + d.Bucket + "/" + d.Key
+}
+
 func (d *GCS) Cleanup() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "gcp",
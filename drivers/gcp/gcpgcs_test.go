@@ -0,0 +1,96 @@
+package gcp_test
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/robertlestak/pushx/drivers/gcp"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest"
+)
+
+// gcsServer is a fake of the Cloud Storage JSON API which stores the
+// objects uploaded to a single bucket.
+type gcsServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newGCSServer(t *testing.T, bucket string) *gcsServer {
+	s := &gcsServer{objects: make(map[string][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/upload/storage/v1/b/"+bucket+"/o" {
+			http.NotFound(w, r)
+			return
+		}
+		// a multipart upload of the object metadata and then its data
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		var obj struct {
+			Name string `json:"name"`
+		}
+		p, err := mr.NextPart()
+		if err == nil {
+			err = json.NewDecoder(p).Decode(&obj)
+		}
+		if err == nil {
+			p, err = mr.NextPart()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		bd, err := io.ReadAll(p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.objects[obj.Name] = bd
+		s.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"bucket": bucket, "name": obj.Name})
+	}))
+	t.Cleanup(s.Close)
+	t.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(s.URL, "http://"))
+	return s
+}
+
+func (s *gcsServer) get(key string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.objects[key]
+}
+
+func TestGCSConformance(t *testing.T) {
+	s := newGCSServer(t, "bucket")
+	driverstest.Run(t, driverstest.Case{
+		New: func() drivers.Driver { return &gcp.GCS{} },
+		Flags: map[string]string{
+			"gcp-gcs-bucket": "bucket",
+			"gcp-gcs-key":    "path/to/object",
+		},
+		Env: map[string]string{
+			"GCP_GCS_BUCKET": "bucket",
+			"GCP_GCS_KEY":    "path/to/object",
+		},
+		BadEnv: map[string]string{
+			"GCP_GCS_BUCKET": "missing",
+			"GCP_GCS_KEY":    "path/to/object",
+		},
+		Received: func(t *testing.T) []byte {
+			return s.get("path/to/object")
+		},
+	})
+}
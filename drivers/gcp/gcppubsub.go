@@ -50,7 +50,7 @@ func (d *GCPPubSub) Init() error {
 	})
 	l.Debug("Initializing gcp pubsub driver")
 	ctx := context.Background()
-	client, err := pubsub.NewClient(ctx, d.ProjectID)
+	client, err := pubsub.NewClient(ctx, d.ProjectID, grpcOptions()...)
 	if err != nil {
 		return err
 	}
@@ -59,6 +59,11 @@ func (d *GCPPubSub) Init() error {
 }
 
 func (d *GCPPubSub) Push(r io.Reader) error {
+	return d.PushMeta(r, nil)
+}
+
+// PushMeta pushes r with meta set as message attributes.
+func (d *GCPPubSub) PushMeta(r io.Reader, meta map[string]string) error {
 	l := log.WithFields(log.Fields{
 		"pkg": "gcp",
 		"fn":  "Push",
@@ -73,7 +78,8 @@ func (d *GCPPubSub) Push(r io.Reader) error {
 		return err
 	}
 	msg := &pubsub.Message{
-		Data: buf.Bytes(),
+		Data:       buf.Bytes(),
+		Attributes: meta,
 	}
 	result := topic.Publish(ctx, msg)
 	mid, err := result.Get(ctx)
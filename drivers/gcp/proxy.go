@@ -0,0 +1,34 @@
+package gcp
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/robertlestak/pushx/pkg/utils"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+	"google.golang.org/grpc"
+)
+
+// httpOptions returns the client options of the clients of JSON APIs,
+// which connect through the proxy with the default credentials and scopes.
+func httpOptions(ctx context.Context, scopes ...string) ([]option.ClientOption, error) {
+	tr, err := htransport.NewTransport(ctx, utils.HTTPClient().Transport, option.WithScopes(scopes...))
+	if err != nil {
+		return nil, err
+	}
+	return []option.ClientOption{option.WithHTTPClient(&http.Client{Transport: tr})}, nil
+}
+
+// grpcOptions returns the client options of gRPC clients, which dial
+// through the proxy set with utils.SetProxy. Without it, gRPC uses the
+// HTTPS_PROXY environment variable itself.
+func grpcOptions() []option.ClientOption {
+	if utils.Proxy() == "" {
+		return nil
+	}
+	return []option.ClientOption{option.WithGRPCDialOption(grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return utils.Dialer{}.DialContext(ctx, "tcp", addr)
+	}))}
+}
@@ -2,15 +2,18 @@ package github
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"time"
 
 	"github.com/google/go-github/v35/github"
 	"github.com/google/uuid"
 	"github.com/robertlestak/pushx/pkg/flags"
+	"github.com/robertlestak/pushx/pkg/utils"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
 )
@@ -25,6 +28,7 @@ var (
 
 type GitHub struct {
 	Client        *github.Client
+	APIURL        *string
 	Repo          string
 	Owner         string
 	Token         string
@@ -47,6 +51,10 @@ func (d *GitHub) LoadEnv(prefix string) error {
 		"fn":  "LoadEnv",
 	})
 	l.Debug("Loading environment")
+	if os.Getenv(prefix+"GITHUB_API_URL") != "" {
+		v := os.Getenv(prefix + "GITHUB_API_URL")
+		d.APIURL = &v
+	}
 	if os.Getenv(prefix+"GITHUB_REPO") != "" {
 		d.Repo = os.Getenv(prefix + "GITHUB_REPO")
 	}
@@ -104,6 +112,7 @@ func (d *GitHub) LoadFlags() error {
 		"fn":  "LoadFlags",
 	})
 	l.Debug("Loading flags")
+	d.APIURL = flags.GitHubAPIURL
 	d.Repo = *flags.GitHubRepo
 	d.Owner = *flags.GitHubOwner
 	d.Token = *flags.GitHubToken
@@ -126,11 +135,22 @@ func (d *GitHub) Init() error {
 		"fn":  "Init",
 	})
 	l.Debug("Initializing github driver")
-	ctx := context.Background()
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = utils.HTTPProxy
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: tr})
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: d.Token},
 	)
 	tc := oauth2.NewClient(ctx, ts)
+	if d.APIURL != nil && *d.APIURL != "" {
+		c, err := github.NewEnterpriseClient(*d.APIURL, *d.APIURL, tc)
+		if err != nil {
+			l.WithError(err).Error("Failed to create github client")
+			return err
+		}
+		d.Client = c
+		return nil
+	}
 	d.Client = github.NewClient(tc)
 	return nil
 }
@@ -154,6 +174,32 @@ func (d *GitHub) Push(r io.Reader) error {
 	return nil
 }
 
+// GetKey returns the file path of the next push.
+func (d *GitHub) GetKey() string {
+	return d.File
+}
+
+// SetKey sets the file path of the next push.
+func (d *GitHub) SetKey(key string) {
+	d.File = key
+}
+
+func (d *GitHub) Check() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "github",
+		"fn":  "Check",
+	})
+	l.Debug("Checking github repo")
+	if d.Owner == "" || d.Repo == "" {
+		return errors.New("owner and repo required")
+	}
+	if _, _, err := d.Client.Repositories.Get(context.Background(), d.Owner, d.Repo); err != nil {
+		l.WithError(err).Error("Failed to get repo")
+		return err
+	}
+	return nil
+}
+
 func (d *GitHub) Cleanup() error {
 	return nil
 }
@@ -191,6 +237,19 @@ func (d *GitHub) createBranch(ctx context.Context) (*github.Reference, error) {
 	return ref, err
 }
 
+// createBlob uploads the pushed data as a base64 encoded blob so that
+// binary content is committed unmodified.
+func (d *GitHub) createBlob(ctx context.Context) (*github.Blob, error) {
+	blob, _, err := d.Client.Git.CreateBlob(ctx, d.Owner, d.Repo, &github.Blob{
+		Content:  github.String(base64.StdEncoding.EncodeToString([]byte(d.data))),
+		Encoding: github.String("base64"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
+
 func (d *GitHub) createTree(ctx context.Context, ref *github.Reference, op GitHubOp, nl string) (*github.Tree, error) {
 	l := log.WithFields(log.Fields{
 		"action": "createTree",
@@ -220,15 +279,24 @@ func (d *GitHub) createTree(ctx context.Context, ref *github.Reference, op GitHu
 			Type: github.String("blob"),
 			Mode: github.String("100644"),
 		}
-		te.SHA = nil
-		te.Content = github.String(d.data)
+		blob, err := d.createBlob(ctx)
+		if err != nil {
+			l.Debugf("CreateBlob error=%v", err)
+			return nil, err
+		}
+		te.SHA = blob.SHA
 		entries = append(entries, te)
 	} else if op == GitHubOpAdd {
+		blob, err := d.createBlob(ctx)
+		if err != nil {
+			l.Debugf("CreateBlob error=%v", err)
+			return nil, err
+		}
 		te := &github.TreeEntry{
-			Path:    github.String(d.File),
-			Type:    github.String("blob"),
-			Mode:    github.String("100644"),
-			Content: github.String(d.data),
+			Path: github.String(d.File),
+			Type: github.String("blob"),
+			Mode: github.String("100644"),
+			SHA:  blob.SHA,
 		}
 		entries = append(entries, te)
 	} else {
@@ -299,11 +367,15 @@ func (d *GitHub) createPR(ctx context.Context) (string, error) {
 	if d.PRTitle == nil || *d.PRTitle == "" {
 		d.PRTitle = d.CommitMessage
 	}
+	var body string
+	if d.PRBody != nil {
+		body = *d.PRBody
+	}
 	newPR := &github.NewPullRequest{
 		Title:               github.String(*d.PRTitle),
 		Head:                github.String(d.Owner + ":" + *d.Branch),
 		Base:                github.String(*d.BaseBranch),
-		Body:                github.String(*d.PRBody),
+		Body:                github.String(body),
 		MaintainerCanModify: github.Bool(true),
 	}
 	pr, _, err := d.Client.PullRequests.Create(ctx, d.Owner, d.Repo, newPR)
@@ -0,0 +1,112 @@
+package github_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/robertlestak/pushx/drivers/github"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest"
+)
+
+// server is a fake of the GitHub git data API for a single repository
+// with a main branch.
+type server struct {
+	*httptest.Server
+	mu   sync.Mutex
+	blob []byte
+}
+
+func newServer(t *testing.T) *server {
+	s := &server{}
+	mux := http.NewServeMux()
+	repo := "/api/v3/repos/owner/repo/"
+	reply := func(w http.ResponseWriter, code int, body string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		io.WriteString(w, body)
+	}
+	mux.HandleFunc(repo+"git/ref/heads/main", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, `{"ref":"refs/heads/main","object":{"sha":"base"}}`)
+	})
+	mux.HandleFunc(repo+"git/blobs", func(w http.ResponseWriter, r *http.Request) {
+		var b struct {
+			Content  string `json:"content"`
+			Encoding string `json:"encoding"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&b); err != nil || b.Encoding != "base64" {
+			reply(w, http.StatusUnprocessableEntity, `{"message":"invalid blob"}`)
+			return
+		}
+		bd, err := base64.StdEncoding.DecodeString(b.Content)
+		if err != nil {
+			reply(w, http.StatusUnprocessableEntity, `{"message":"invalid base64"}`)
+			return
+		}
+		s.mu.Lock()
+		s.blob = bd
+		s.mu.Unlock()
+		reply(w, http.StatusCreated, `{"sha":"blob"}`)
+	})
+	mux.HandleFunc(repo+"git/trees", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusCreated, `{"sha":"tree"}`)
+	})
+	mux.HandleFunc(repo+"commits/base", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, `{"sha":"base","commit":{"message":"initial"}}`)
+	})
+	mux.HandleFunc(repo+"git/commits", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusCreated, `{"sha":"commit"}`)
+	})
+	mux.HandleFunc(repo+"git/refs/heads/main", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, `{"ref":"refs/heads/main","object":{"sha":"commit"}}`)
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	s := newServer(t)
+	env := map[string]string{
+		"GITHUB_API_URL":        s.URL,
+		"GITHUB_OWNER":          "owner",
+		"GITHUB_REPO":           "repo",
+		"GITHUB_TOKEN":          "token",
+		"GITHUB_FILE":           "data/out",
+		"GITHUB_BASE_BRANCH":    "main",
+		"GITHUB_COMMIT_NAME":    "pushx",
+		"GITHUB_COMMIT_EMAIL":   "pushx@example.com",
+		"GITHUB_COMMIT_MESSAGE": "push",
+	}
+	bad := make(map[string]string)
+	for k, v := range env {
+		bad[k] = v
+	}
+	bad["GITHUB_BASE_BRANCH"] = "missing"
+	driverstest.Run(t, driverstest.Case{
+		New: func() drivers.Driver { return &github.GitHub{} },
+		Flags: map[string]string{
+			"github-api-url":        s.URL,
+			"github-owner":          "owner",
+			"github-repo":           "repo",
+			"github-token":          "token",
+			"github-file":           "data/out",
+			"github-base-branch":    "main",
+			"github-commit-name":    "pushx",
+			"github-commit-email":   "pushx@example.com",
+			"github-commit-message": "push",
+		},
+		Env:    env,
+		BadEnv: bad,
+		Received: func(t *testing.T) []byte {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return s.blob
+		},
+	})
+}
@@ -0,0 +1,245 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/google/uuid"
+	"github.com/robertlestak/pushx/pkg/utils"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+type AuthType string
+
+const (
+	AuthTypeBasic    AuthType = "basic"
+	AuthTypeBearer   AuthType = "bearer"
+	AuthTypeOAuth2   AuthType = "oauth2"
+	AuthTypeAWSSigV4 AuthType = "aws-sigv4"
+)
+
+// defaultAWSService is the service of API Gateway endpoints.
+const defaultAWSService = "execute-api"
+
+// HTTPAuth is the authentication of the requests.
+type HTTPAuth struct {
+	Type     AuthType
+	Username string
+	Password string
+	// Token is a static bearer token. TokenFile is a file containing the
+	// bearer token, which is read again when it changes.
+	Token     string
+	TokenFile string
+	// OAuthTokenURL is the token endpoint of the OAuth2 client credentials
+	// grant.
+	OAuthTokenURL     string
+	OAuthClientID     string
+	OAuthClientSecret string
+	OAuthScopes       []string
+	// AWSRegion and AWSService are the scope of SigV4 signatures. The
+	// service is execute-api for API Gateway, or es for OpenSearch.
+	AWSRegion  string
+	AWSService string
+	AWSRoleARN string
+}
+
+// authorizer authenticates a request.
+type authorizer interface {
+	authorize(req *http.Request) error
+}
+
+type basicAuth struct {
+	username string
+	password string
+}
+
+func (a basicAuth) authorize(req *http.Request) error {
+	req.SetBasicAuth(a.username, a.password)
+	return nil
+}
+
+// tokenFile is a bearer token read from a file, which is read again when
+// its modification time or size changes, so that rotated tokens are used
+// without a restart.
+type tokenFile struct {
+	path string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+func (f *tokenFile) get() (string, error) {
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.token != "" && fi.ModTime().Equal(f.modTime) && fi.Size() == f.size {
+		return f.token, nil
+	}
+	bd, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", err
+	}
+	t := strings.TrimSpace(string(bd))
+	if t == "" {
+		return "", fmt.Errorf("token file %s is empty", f.path)
+	}
+	f.token, f.modTime, f.size = t, fi.ModTime(), fi.Size()
+	return t, nil
+}
+
+func (f *tokenFile) authorize(req *http.Request) error {
+	t, err := f.get()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+t)
+	return nil
+}
+
+// tokenSource authenticates with the tokens of a token source, such as
+// the static token or the cached tokens of the client credentials grant.
+type tokenSource struct {
+	ts oauth2.TokenSource
+}
+
+func (s tokenSource) authorize(req *http.Request) error {
+	t, err := s.ts.Token()
+	if err != nil {
+		return fmt.Errorf("oauth2 token: %w", err)
+	}
+	t.SetAuthHeader(req)
+	return nil
+}
+
+// sigV4 signs requests with AWS Signature Version 4. The payload is
+// signed, so it is read into memory.
+type sigV4 struct {
+	signer  *v4.Signer
+	service string
+	region  string
+}
+
+func (s sigV4) authorize(req *http.Request) error {
+	bd, err := readBody(req)
+	if err != nil {
+		return err
+	}
+	_, err = s.signer.Sign(req, bytes.NewReader(bd), s.service, s.region, time.Now())
+	return err
+}
+
+// awsCredentials returns the credentials of the default AWS credential
+// chain, or of the assumed role, and the region.
+func (a *HTTPAuth) awsCredentials() (*credentials.Credentials, string, error) {
+	region := a.AWSRegion
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return nil, "", errors.New("aws region is required for aws-sigv4")
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Region:     aws.String(region),
+		HTTPClient: utils.HTTPClient(),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if a.AWSRoleARN != "" {
+		return stscreds.NewCredentials(sess, a.AWSRoleARN, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = "pushx-" + uuid.New().String()
+		}), region, nil
+	}
+	return sess.Config.Credentials, region, nil
+}
+
+// authorizer returns the authorizer of the auth type. Token requests of the
+// client credentials grant are sent with client, so that they use its TLS
+// configuration.
+func (a *HTTPAuth) authorizer(client *http.Client) (authorizer, error) {
+	switch a.Type {
+	case "":
+		return nil, nil
+	case AuthTypeBasic:
+		if a.Username == "" {
+			return nil, errors.New("username is required for basic auth")
+		}
+		return basicAuth{username: a.Username, password: a.Password}, nil
+	case AuthTypeBearer:
+		switch {
+		case a.Token != "" && a.TokenFile != "":
+			return nil, errors.New("only one of token and token file may be set")
+		case a.TokenFile != "":
+			f := &tokenFile{path: a.TokenFile}
+			if _, err := f.get(); err != nil {
+				return nil, err
+			}
+			return f, nil
+		case a.Token != "":
+			return tokenSource{ts: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: a.Token})}, nil
+		}
+		return nil, errors.New("token or token file is required for bearer auth")
+	case AuthTypeOAuth2:
+		if a.OAuthTokenURL == "" {
+			return nil, errors.New("oauth token url is required for oauth2 auth")
+		}
+		cc := &clientcredentials.Config{
+			ClientID:     a.OAuthClientID,
+			ClientSecret: a.OAuthClientSecret,
+			TokenURL:     a.OAuthTokenURL,
+			Scopes:       a.OAuthScopes,
+		}
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+		return tokenSource{ts: cc.TokenSource(ctx)}, nil
+	case AuthTypeAWSSigV4:
+		creds, region, err := a.awsCredentials()
+		if err != nil {
+			return nil, err
+		}
+		service := a.AWSService
+		if service == "" {
+			service = defaultAWSService
+		}
+		return sigV4{signer: v4.NewSigner(creds), service: service, region: region}, nil
+	}
+	return nil, fmt.Errorf("unknown auth type %q", a.Type)
+}
+
+// sensitiveHeaders are the header name fragments whose values are redacted
+// from logs.
+var sensitiveHeaders = []string{"auth", "token", "secret", "key", "cookie", "signature", "password"}
+
+// redactHeaders returns h with the values of headers which may contain
+// credentials redacted.
+func redactHeaders(h http.Header) http.Header {
+	r := make(http.Header, len(h))
+	for k, v := range h {
+		r[k] = v
+		lk := strings.ToLower(k)
+		for _, s := range sensitiveHeaders {
+			if strings.Contains(lk, s) {
+				r[k] = []string{"REDACTED"}
+				break
+			}
+		}
+	}
+	return r
+}
@@ -0,0 +1,244 @@
+package http_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	pushxhttp "github.com/robertlestak/pushx/drivers/http"
+	log "github.com/sirupsen/logrus"
+)
+
+// authServer records the requests it receives.
+type authServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newAuthServer(t *testing.T) *authServer {
+	s := &authServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bd, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, bd)
+		s.mu.Unlock()
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *authServer) last() (*http.Request, []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[len(s.requests)-1], s.bodies[len(s.bodies)-1]
+}
+
+func authDriver(t *testing.T, url string, a *pushxhttp.HTTPAuth) *pushxhttp.HTTP {
+	t.Helper()
+	d := &pushxhttp.HTTP{
+		Request: &pushxhttp.HTTPRequest{URL: url},
+		Auth:    a,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestAuthBasic(t *testing.T) {
+	s := newAuthServer(t)
+	d := authDriver(t, s.URL, &pushxhttp.HTTPAuth{
+		Type:     pushxhttp.AuthTypeBasic,
+		Username: "user",
+		Password: "pa:ss,word",
+	})
+	if err := d.Push(strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := s.last()
+	if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "pa:ss,word" {
+		t.Errorf("got basic auth %q %q", u, p)
+	}
+}
+
+func TestAuthBearerFile(t *testing.T) {
+	s := newAuthServer(t)
+	f := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(f, []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	d := authDriver(t, s.URL, &pushxhttp.HTTPAuth{
+		Type:      pushxhttp.AuthTypeBearer,
+		TokenFile: f,
+	})
+	for _, want := range []string{"first", "second-token"} {
+		if want != "first" {
+			if err := os.WriteFile(f, []byte(want), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := d.Push(strings.NewReader("hello")); err != nil {
+			t.Fatal(err)
+		}
+		r, _ := s.last()
+		if v := r.Header.Get("Authorization"); v != "Bearer "+want {
+			t.Errorf("got authorization %q, want token %q", v, want)
+		}
+	}
+	if err := os.Remove(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Push(strings.NewReader("hello")); err == nil {
+		t.Error("got no error for a removed token file")
+	}
+}
+
+func TestAuthOAuth2(t *testing.T) {
+	var tokens int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if r.FormValue("grant_type") != "client_credentials" || id != "client" || secret != "secret" || r.FormValue("scope") != "read write" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		tokens++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":3600}`, tokens)
+	}))
+	defer ts.Close()
+	s := newAuthServer(t)
+	d := authDriver(t, s.URL, &pushxhttp.HTTPAuth{
+		Type:              pushxhttp.AuthTypeOAuth2,
+		OAuthTokenURL:     ts.URL,
+		OAuthClientID:     "client",
+		OAuthClientSecret: "secret",
+		OAuthScopes:       []string{"read", "write"},
+	})
+	for i := 0; i < 2; i++ {
+		if err := d.Push(strings.NewReader("hello")); err != nil {
+			t.Fatal(err)
+		}
+		r, _ := s.last()
+		if v := r.Header.Get("Authorization"); v != "Bearer token-1" {
+			t.Errorf("got authorization %q", v)
+		}
+	}
+	if tokens != 1 {
+		t.Errorf("got %d token requests, want the token cached", tokens)
+	}
+
+	d = authDriver(t, s.URL, &pushxhttp.HTTPAuth{
+		Type:          pushxhttp.AuthTypeOAuth2,
+		OAuthTokenURL: ts.URL,
+		OAuthClientID: "other",
+	})
+	if err := d.Push(strings.NewReader("hello")); err == nil {
+		t.Error("got no error for rejected client credentials")
+	}
+}
+
+func TestAuthAWSSigV4(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_REGION", "")
+	s := newAuthServer(t)
+	a := &pushxhttp.HTTPAuth{
+		Type:       pushxhttp.AuthTypeAWSSigV4,
+		AWSService: "es",
+	}
+	d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{URL: s.URL}, Auth: a}
+	if err := d.Init(); err == nil {
+		t.Error("got no error without a region")
+	}
+	a.AWSRegion = "eu-west-1"
+	d = authDriver(t, s.URL+"/index/_doc?refresh=true", a)
+	d.Request.ContentType = "application/json"
+	// the payload is not seekable, so it is read to be signed
+	if err := d.Push(io.MultiReader(strings.NewReader(`{"a":`), strings.NewReader(`1}`))); err != nil {
+		t.Fatal(err)
+	}
+	r, bd := s.last()
+	if string(bd) != `{"a":1}` {
+		t.Errorf("got body %q", bd)
+	}
+	auth := r.Header.Get("Authorization")
+	date := r.Header.Get("X-Amz-Date")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/"+date[:8]+"/eu-west-1/es/aws4_request") {
+		t.Fatalf("got authorization %q", auth)
+	}
+	// sign the received request again to verify the signature
+	signed := strings.TrimPrefix(auth[strings.Index(auth, "SignedHeaders="):], "SignedHeaders=")
+	signed = signed[:strings.Index(signed, ",")]
+	req, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	for _, h := range strings.Split(signed, ";") {
+		if h != "host" {
+			req.Header.Set(h, r.Header.Get(h))
+		}
+	}
+	st, err := time.Parse("20060102T150405Z", date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v4.NewSigner(credentials.NewStaticCredentials("AKID", "secret", "")).Sign(req, bytes.NewReader(bd), "es", "eu-west-1", st)
+	if v := req.Header.Get("Authorization"); v != auth {
+		t.Errorf("got signature %q, want %q", auth, v)
+	}
+}
+
+func TestAuthErrors(t *testing.T) {
+	for name, a := range map[string]*pushxhttp.HTTPAuth{
+		"unknown":      {Type: "digest"},
+		"basic":        {Type: pushxhttp.AuthTypeBasic},
+		"bearer":       {Type: pushxhttp.AuthTypeBearer},
+		"bearer both":  {Type: pushxhttp.AuthTypeBearer, Token: "a", TokenFile: "b"},
+		"bearer file":  {Type: pushxhttp.AuthTypeBearer, TokenFile: filepath.Join(t.TempDir(), "missing")},
+		"oauth2 token": {Type: pushxhttp.AuthTypeOAuth2},
+	} {
+		d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{URL: "http://localhost"}, Auth: a}
+		if err := d.Init(); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+func TestAuthRedacted(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetLevel(log.DebugLevel)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetLevel(log.InfoLevel)
+	}()
+	s := newAuthServer(t)
+	d := authDriver(t, strings.Replace(s.URL, "http://", "http://user:url-secret@", 1), &pushxhttp.HTTPAuth{
+		Type:  pushxhttp.AuthTypeBearer,
+		Token: "bearer-secret",
+	})
+	d.Request.Headers = map[string]string{"X-Api-Key": "key-secret", "X-Request": "visible"}
+	if err := d.Push(strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, secret := range []string{"bearer-secret", "key-secret", "url-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("got %s in the log: %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "visible") || !strings.Contains(out, "REDACTED") {
+		t.Errorf("got log without the redacted headers: %s", out)
+	}
+}
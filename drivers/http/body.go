@@ -0,0 +1,161 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/robertlestak/pushx/pkg/utils"
+	"github.com/tidwall/gjson"
+)
+
+// Body modes of the request.
+const (
+	// BodyModeRaw sends the payload as the body.
+	BodyModeRaw = "raw"
+	// BodyModeMultipart sends the payload as a file part of a
+	// multipart/form-data body.
+	BodyModeMultipart = "multipart"
+	// BodyModeForm sends the fields of a JSON object payload as an
+	// application/x-www-form-urlencoded body.
+	BodyModeForm = "form"
+)
+
+// Defaults of the multipart file part.
+const (
+	defaultMultipartField       = "file"
+	defaultMultipartFilename    = "file"
+	defaultMultipartContentType = "application/octet-stream"
+)
+
+// checkBodyMode returns an error if the body mode is unknown.
+func (r *HTTPRequest) checkBodyMode() error {
+	switch r.BodyMode {
+	case "", BodyModeRaw, BodyModeMultipart, BodyModeForm:
+		return nil
+	}
+	return fmt.Errorf("unknown body mode %q", r.BodyMode)
+}
+
+// encodeBody returns the body of the payload r in the body mode, and its
+// content type. A body streamed from the payload is returned with a
+// channel which is closed once the payload is no longer read.
+func (r *HTTPRequest) encodeBody(p io.Reader) (io.Reader, string, <-chan struct{}, error) {
+	switch r.BodyMode {
+	case BodyModeMultipart:
+		body, ct, done := r.multipartBody(p)
+		return body, ct, done, nil
+	case BodyModeForm:
+		body, ct, err := r.formBody(p)
+		return body, ct, nil, err
+	}
+	return p, r.ContentType, nil, nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// multipartBody streams the form fields and then the payload as the file
+// part, without reading the payload into memory. The payload is copied as
+// the body is read, which stops if the body is closed, after which the
+// returned channel is closed.
+func (r *HTTPRequest) multipartBody(p io.Reader) (*io.PipeReader, string, <-chan struct{}) {
+	field, filename, ct := r.MultipartField, r.MultipartFilename, r.MultipartContentType
+	if field == "" {
+		field = defaultMultipartField
+	}
+	if filename == "" {
+		filename = defaultMultipartFilename
+	}
+	if ct == "" {
+		ct = r.ContentType
+	}
+	if ct == "" {
+		ct = defaultMultipartContentType
+	}
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(func() error {
+			for _, k := range sortedKeys(r.FormFields) {
+				if err := mw.WriteField(k, r.FormFields[k]); err != nil {
+					return err
+				}
+			}
+			h := make(textproto.MIMEHeader)
+			h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+				quoteEscaper.Replace(field), quoteEscaper.Replace(filename)))
+			h.Set("Content-Type", ct)
+			part, err := mw.CreatePart(h)
+			if err != nil {
+				return err
+			}
+			if p != nil {
+				if _, err := io.Copy(part, p); err != nil {
+					return err
+				}
+			}
+			return mw.Close()
+		}())
+	}()
+	return pr, mw.FormDataContentType(), done
+}
+
+// formBody encodes the fields of the JSON object payload, and the form
+// fields. Strings, numbers and booleans are sent as their text, arrays as a
+// value for each element, and objects as JSON.
+func (r *HTTPRequest) formBody(p io.Reader) (io.Reader, string, error) {
+	var bd []byte
+	if p != nil {
+		var err error
+		if bd, err = io.ReadAll(p); err != nil {
+			return nil, "", err
+		}
+	}
+	v := url.Values{}
+	if len(bytes.TrimSpace(bd)) > 0 {
+		if !gjson.ValidBytes(bd) || !gjson.ParseBytes(bd).IsObject() {
+			return nil, "", utils.Permanent(errors.New("form body mode requires a JSON object payload"))
+		}
+		gjson.ParseBytes(bd).ForEach(func(k, f gjson.Result) bool {
+			if f.IsArray() {
+				for _, e := range f.Array() {
+					v.Add(k.String(), formValue(e))
+				}
+			} else {
+				v.Add(k.String(), formValue(f))
+			}
+			return true
+		})
+	}
+	for _, k := range sortedKeys(r.FormFields) {
+		v.Add(k, r.FormFields[k])
+	}
+	return strings.NewReader(v.Encode()), "application/x-www-form-urlencoded", nil
+}
+
+func formValue(v gjson.Result) string {
+	switch v.Type {
+	case gjson.String:
+		return v.Str
+	case gjson.Null:
+		return ""
+	}
+	return v.Raw
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
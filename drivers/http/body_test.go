@@ -0,0 +1,259 @@
+package http_test
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pushxhttp "github.com/robertlestak/pushx/drivers/http"
+	"github.com/robertlestak/pushx/pkg/drivers"
+)
+
+// multipartPart is a part of a received multipart body.
+type multipartPart struct {
+	name, filename, contentType, data string
+}
+
+func readMultipart(t *testing.T, r *http.Request) []multipartPart {
+	t.Helper()
+	mr, err := r.MultipartReader()
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	var parts []multipartPart
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Error(err)
+			return parts
+		}
+		bd, _ := io.ReadAll(p)
+		parts = append(parts, multipartPart{p.FormName(), p.FileName(), p.Header.Get("Content-Type"), string(bd)})
+	}
+}
+
+func TestMultipartBody(t *testing.T) {
+	var attempts int
+	var parts []multipartPart
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		parts = readMultipart(t, r)
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer s.Close()
+	d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{
+		URL:                  s.URL,
+		ContentType:          "text/plain",
+		BodyMode:             pushxhttp.BodyModeMultipart,
+		MultipartField:       "document",
+		MultipartFilename:    `report "q1".csv`,
+		MultipartContentType: "text/csv",
+		FormFields:           map[string]string{"folder": "reports", "public": "false"},
+		Retries:              1,
+		RetryBackoff:         time.Millisecond,
+	}}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Push(strings.NewReader("a,b\n1,2\n")); err != nil {
+		t.Fatal(err)
+	}
+	want := []multipartPart{
+		{"folder", "", "", "reports"},
+		{"public", "", "", "false"},
+		{"document", `report "q1".csv`, "text/csv", "a,b\n1,2\n"},
+	}
+	if attempts != 2 || !reflect.DeepEqual(parts, want) {
+		t.Errorf("got %d attempts with parts %q, want the retry to send %q", attempts, parts, want)
+	}
+
+	// the part content type defaults to the content type
+	d.Request.MultipartContentType = ""
+	d.Request.FormFields = nil
+	if err := d.Push(strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 1 || parts[0].contentType != "text/plain" {
+		t.Errorf("got parts %q, want a text/plain part", parts)
+	}
+}
+
+// slowReader is a payload which is slow to read, and records whether it
+// was seeked during a read.
+type slowReader struct {
+	*strings.Reader
+	reads, overlapped atomic.Int32
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	r.reads.Add(1)
+	defer r.reads.Add(-1)
+	time.Sleep(time.Millisecond)
+	return r.Reader.Read(p)
+}
+
+func (r *slowReader) Seek(offset int64, whence int) (int64, error) {
+	if r.reads.Load() > 0 {
+		r.overlapped.Add(1)
+	}
+	return r.Reader.Seek(offset, whence)
+}
+
+func TestMultipartRetryUnread(t *testing.T) {
+	payload := strings.Repeat("0123456789abcdef", 1<<16)
+	var attempts int32
+	var got string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first attempt is rejected before its body is read, while
+		// the payload is still being streamed
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if parts := readMultipart(t, r); len(parts) == 1 {
+			got = parts[0].data
+		}
+	}))
+	defer s.Close()
+	d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{
+		URL:          s.URL,
+		BodyMode:     pushxhttp.BodyModeMultipart,
+		Retries:      1,
+		RetryBackoff: time.Millisecond,
+	}}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	r := &slowReader{Reader: strings.NewReader(payload)}
+	if err := d.Push(r); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.overlapped.Load(); n > 0 {
+		t.Errorf("payload rewound while the previous attempt was reading it")
+	}
+	if got != payload {
+		t.Errorf("got a %d byte part, want the %d byte payload", len(got), len(payload))
+	}
+}
+
+func TestMultipartStreams(t *testing.T) {
+	first := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "multipart/form-data" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mr, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		p, err := mr.NextPart()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(p, buf); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		close(first)
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer s.Close()
+	d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{
+		URL:      s.URL,
+		BodyMode: pushxhttp.BodyModeMultipart,
+	}}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("hello"))
+		// the rest of the payload is only written once the server has
+		// received the start of the part, so a body that is buffered
+		// never completes
+		select {
+		case <-first:
+			pw.Write([]byte(" world"))
+			pw.Close()
+		case <-time.After(5 * time.Second):
+			pw.CloseWithError(errors.New("payload not streamed"))
+		}
+	}()
+	if err := d.Push(pr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFormBody(t *testing.T) {
+	var form url.Values
+	var contentType string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		r.ParseForm()
+		form = r.PostForm
+	}))
+	defer s.Close()
+	d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{
+		URL:        s.URL,
+		BodyMode:   pushxhttp.BodyModeForm,
+		FormFields: map[string]string{"source": "pushx"},
+	}}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Push(strings.NewReader(`{"name":"Ann & Bo","age":3,"admin":true,"tags":["a","b"],"address":{"city":"X"},"note":null}`)); err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{
+		"name":    {"Ann & Bo"},
+		"age":     {"3"},
+		"admin":   {"true"},
+		"tags":    {"a", "b"},
+		"address": {`{"city":"X"}`},
+		"note":    {""},
+		"source":  {"pushx"},
+	}
+	if contentType != "application/x-www-form-urlencoded" || !reflect.DeepEqual(form, want) {
+		t.Errorf("got %s form %v, want %v", contentType, form, want)
+	}
+
+	// a body template builds the form from the payload
+	d.Request.BodyTemplate = `{"text":"order {{id}}","channel":"C1"}`
+	if err := d.Push(strings.NewReader(`{"id":7}`)); err != nil {
+		t.Fatal(err)
+	}
+	want = url.Values{"text": {"order 7"}, "channel": {"C1"}, "source": {"pushx"}}
+	if !reflect.DeepEqual(form, want) {
+		t.Errorf("got form %v, want %v", form, want)
+	}
+
+	d.Request.BodyTemplate = ""
+	if err := d.Push(strings.NewReader(`["a"]`)); !errors.Is(drivers.PushError(err), drivers.ErrPushRejected) {
+		t.Errorf("got %v, want a rejected push for a payload which is not an object", err)
+	}
+}
+
+func TestUnknownBodyMode(t *testing.T) {
+	d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{URL: "http://localhost", BodyMode: "xml"}}
+	if err := d.Init(); err == nil {
+		t.Error("got no error for an unknown body mode")
+	}
+}
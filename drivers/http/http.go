@@ -1,12 +1,16 @@
 package http
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/robertlestak/pushx/pkg/flags"
 	"github.com/robertlestak/pushx/pkg/utils"
@@ -19,6 +23,47 @@ type HTTPRequest struct {
 	ContentType           string
 	SuccessfulStatusCodes []int
 	Headers               map[string]string
+	// BodyTemplate, if set, is rendered with the payload as the body.
+	BodyTemplate string
+	// BodyMode is how the payload is sent: raw, the default, multipart or
+	// form.
+	BodyMode string
+	// MultipartField, MultipartFilename and MultipartContentType are the
+	// name, filename and content type of the file part of the multipart
+	// body mode.
+	MultipartField       string
+	MultipartFilename    string
+	MultipartContentType string
+	// FormFields are sent in addition to the payload in the multipart and
+	// form body modes.
+	FormFields map[string]string
+	// Timeout bounds each attempt of the request, including reading the
+	// response.
+	Timeout time.Duration
+	// Retries is the number of times a request is retried when the
+	// response status is one of RetryStatusCodes, after the Retry-After
+	// delay of the response, or else RetryBackoff doubled for each further
+	// retry.
+	Retries          int
+	RetryStatusCodes []int
+	RetryBackoff     time.Duration
+	// RetryMaxWait bounds the wait before a retry. A backoff is shortened
+	// to it, while a longer Retry-After fails the push with a retryable
+	// error. It defaults to 1m.
+	RetryMaxWait time.Duration
+}
+
+// defaultRetryMaxWait is the longest wait before a retry if no maximum is
+// set.
+const defaultRetryMaxWait = time.Minute
+
+// defaultRetryStatusCodes are the statuses retried if no retry status codes
+// are set.
+var defaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
 }
 
 type HTTP struct {
@@ -29,7 +74,23 @@ type HTTP struct {
 	TLSKey      *string
 	TLSInsecure *bool
 	Request     *HTTPRequest
+	Auth        *HTTPAuth
+	Response    *HTTPResponse
+	Sign        *HTTPSign
 	Key         *string
+	// ListenAddr is the address requests are received on as a relay
+	// source.
+	ListenAddr string
+
+	server   *http.Server
+	requests chan *request
+	auth     authorizer
+	signer   *signer
+
+	responses  *responseWriter
+	assertions []assertion
+	// ctx ends the waits before retries once it is done
+	ctx context.Context
 }
 
 func (d *HTTP) LoadEnv(prefix string) error {
@@ -56,6 +117,145 @@ func (d *HTTP) LoadEnv(prefix string) error {
 	if os.Getenv(prefix+"HTTP_REQUEST_HEADERS") != "" {
 		d.Request.Headers = parseHeaderMap(os.Getenv(prefix + "HTTP_REQUEST_HEADERS"))
 	}
+	if os.Getenv(prefix+"HTTP_REQUEST_BODY_TEMPLATE") != "" {
+		d.Request.BodyTemplate = os.Getenv(prefix + "HTTP_REQUEST_BODY_TEMPLATE")
+	}
+	if os.Getenv(prefix+"HTTP_REQUEST_BODY_MODE") != "" {
+		d.Request.BodyMode = os.Getenv(prefix + "HTTP_REQUEST_BODY_MODE")
+	}
+	if os.Getenv(prefix+"HTTP_REQUEST_MULTIPART_FIELD") != "" {
+		d.Request.MultipartField = os.Getenv(prefix + "HTTP_REQUEST_MULTIPART_FIELD")
+	}
+	if os.Getenv(prefix+"HTTP_REQUEST_MULTIPART_FILENAME") != "" {
+		d.Request.MultipartFilename = os.Getenv(prefix + "HTTP_REQUEST_MULTIPART_FILENAME")
+	}
+	if os.Getenv(prefix+"HTTP_REQUEST_MULTIPART_CONTENT_TYPE") != "" {
+		d.Request.MultipartContentType = os.Getenv(prefix + "HTTP_REQUEST_MULTIPART_CONTENT_TYPE")
+	}
+	if os.Getenv(prefix+"HTTP_REQUEST_FORM_FIELDS") != "" {
+		d.Request.FormFields = parseFormFields(os.Getenv(prefix + "HTTP_REQUEST_FORM_FIELDS"))
+	}
+	if os.Getenv(prefix+"HTTP_REQUEST_TIMEOUT") != "" {
+		v, err := time.ParseDuration(os.Getenv(prefix + "HTTP_REQUEST_TIMEOUT"))
+		if err != nil {
+			l.WithError(err).Error("Failed to parse HTTP_REQUEST_TIMEOUT")
+			return err
+		}
+		d.Request.Timeout = v
+	}
+	if os.Getenv(prefix+"HTTP_REQUEST_RETRIES") != "" {
+		v, err := strconv.Atoi(os.Getenv(prefix + "HTTP_REQUEST_RETRIES"))
+		if err != nil {
+			l.WithError(err).Error("Failed to parse HTTP_REQUEST_RETRIES")
+			return err
+		}
+		d.Request.Retries = v
+	}
+	if os.Getenv(prefix+"HTTP_REQUEST_RETRY_STATUS_CODES") != "" {
+		d.Request.RetryStatusCodes = parseIntSlice(os.Getenv(prefix + "HTTP_REQUEST_RETRY_STATUS_CODES"))
+	}
+	if os.Getenv(prefix+"HTTP_REQUEST_RETRY_BACKOFF") != "" {
+		v, err := time.ParseDuration(os.Getenv(prefix + "HTTP_REQUEST_RETRY_BACKOFF"))
+		if err != nil {
+			l.WithError(err).Error("Failed to parse HTTP_REQUEST_RETRY_BACKOFF")
+			return err
+		}
+		d.Request.RetryBackoff = v
+	}
+	if os.Getenv(prefix+"HTTP_REQUEST_RETRY_MAX_WAIT") != "" {
+		v, err := time.ParseDuration(os.Getenv(prefix + "HTTP_REQUEST_RETRY_MAX_WAIT"))
+		if err != nil {
+			l.WithError(err).Error("Failed to parse HTTP_REQUEST_RETRY_MAX_WAIT")
+			return err
+		}
+		d.Request.RetryMaxWait = v
+	}
+	if d.Response == nil {
+		d.Response = &HTTPResponse{}
+	}
+	if os.Getenv(prefix+"HTTP_RESPONSE_TIMEOUT") != "" {
+		v, err := time.ParseDuration(os.Getenv(prefix + "HTTP_RESPONSE_TIMEOUT"))
+		if err != nil {
+			l.WithError(err).Error("Failed to parse HTTP_RESPONSE_TIMEOUT")
+			return err
+		}
+		d.Response.Timeout = v
+	}
+	if os.Getenv(prefix+"HTTP_RESPONSE_OUT") != "" {
+		d.Response.Output = os.Getenv(prefix + "HTTP_RESPONSE_OUT")
+	}
+	if os.Getenv(prefix+"HTTP_RESPONSE_ASSERT") != "" {
+		d.Response.Assert = os.Getenv(prefix + "HTTP_RESPONSE_ASSERT")
+	}
+	if d.Auth == nil {
+		d.Auth = &HTTPAuth{}
+	}
+	if os.Getenv(prefix+"HTTP_AUTH_TYPE") != "" {
+		d.Auth.Type = AuthType(os.Getenv(prefix + "HTTP_AUTH_TYPE"))
+	}
+	if os.Getenv(prefix+"HTTP_AUTH_USERNAME") != "" {
+		d.Auth.Username = os.Getenv(prefix + "HTTP_AUTH_USERNAME")
+	}
+	if os.Getenv(prefix+"HTTP_AUTH_PASSWORD") != "" {
+		d.Auth.Password = os.Getenv(prefix + "HTTP_AUTH_PASSWORD")
+	}
+	if os.Getenv(prefix+"HTTP_AUTH_TOKEN") != "" {
+		d.Auth.Token = os.Getenv(prefix + "HTTP_AUTH_TOKEN")
+	}
+	if os.Getenv(prefix+"HTTP_AUTH_TOKEN_FILE") != "" {
+		d.Auth.TokenFile = os.Getenv(prefix + "HTTP_AUTH_TOKEN_FILE")
+	}
+	if os.Getenv(prefix+"HTTP_AUTH_OAUTH_TOKEN_URL") != "" {
+		d.Auth.OAuthTokenURL = os.Getenv(prefix + "HTTP_AUTH_OAUTH_TOKEN_URL")
+	}
+	if os.Getenv(prefix+"HTTP_AUTH_OAUTH_CLIENT_ID") != "" {
+		d.Auth.OAuthClientID = os.Getenv(prefix + "HTTP_AUTH_OAUTH_CLIENT_ID")
+	}
+	if os.Getenv(prefix+"HTTP_AUTH_OAUTH_CLIENT_SECRET") != "" {
+		d.Auth.OAuthClientSecret = os.Getenv(prefix + "HTTP_AUTH_OAUTH_CLIENT_SECRET")
+	}
+	if os.Getenv(prefix+"HTTP_AUTH_OAUTH_SCOPES") != "" {
+		d.Auth.OAuthScopes = strings.Split(os.Getenv(prefix+"HTTP_AUTH_OAUTH_SCOPES"), ",")
+	}
+	if os.Getenv(prefix+"HTTP_AUTH_AWS_REGION") != "" {
+		d.Auth.AWSRegion = os.Getenv(prefix + "HTTP_AUTH_AWS_REGION")
+	}
+	if os.Getenv(prefix+"HTTP_AUTH_AWS_SERVICE") != "" {
+		d.Auth.AWSService = os.Getenv(prefix + "HTTP_AUTH_AWS_SERVICE")
+	}
+	if os.Getenv(prefix+"HTTP_AUTH_AWS_ROLE_ARN") != "" {
+		d.Auth.AWSRoleARN = os.Getenv(prefix + "HTTP_AUTH_AWS_ROLE_ARN")
+	}
+	if d.Sign == nil {
+		d.Sign = &HTTPSign{}
+	}
+	if os.Getenv(prefix+"HTTP_SIGN_SECRET") != "" {
+		d.Sign.Secret = os.Getenv(prefix + "HTTP_SIGN_SECRET")
+	}
+	if os.Getenv(prefix+"HTTP_SIGN_SECRET_FILE") != "" {
+		d.Sign.SecretFile = os.Getenv(prefix + "HTTP_SIGN_SECRET_FILE")
+	}
+	if os.Getenv(prefix+"HTTP_SIGN_ALGORITHM") != "" {
+		d.Sign.Algorithm = os.Getenv(prefix + "HTTP_SIGN_ALGORITHM")
+	}
+	if os.Getenv(prefix+"HTTP_SIGN_HEADER") != "" {
+		d.Sign.Header = os.Getenv(prefix + "HTTP_SIGN_HEADER")
+	}
+	if os.Getenv(prefix+"HTTP_SIGN_FORMAT") != "" {
+		d.Sign.Format = os.Getenv(prefix + "HTTP_SIGN_FORMAT")
+	}
+	if os.Getenv(prefix+"HTTP_SIGN_PAYLOAD") != "" {
+		d.Sign.Payload = os.Getenv(prefix + "HTTP_SIGN_PAYLOAD")
+	}
+	if os.Getenv(prefix+"HTTP_SIGN_TIMESTAMP_HEADER") != "" {
+		d.Sign.TimestampHeader = os.Getenv(prefix + "HTTP_SIGN_TIMESTAMP_HEADER")
+	}
+	if os.Getenv(prefix+"HTTP_SIGN_ENCODING") != "" {
+		d.Sign.Encoding = os.Getenv(prefix + "HTTP_SIGN_ENCODING")
+	}
+	if os.Getenv(prefix+"HTTP_LISTEN_ADDR") != "" {
+		d.ListenAddr = os.Getenv(prefix + "HTTP_LISTEN_ADDR")
+	}
 	if os.Getenv(prefix+"HTTP_ENABLE_TLS") != "" {
 		v := os.Getenv(prefix+"HTTP_ENABLE_TLS") == "true"
 		d.EnableTLS = &v
@@ -87,10 +287,25 @@ func parseIntSlice(s string) []int {
 	return r
 }
 
+// parseHeaderMap parses comma separated Name:value pairs. Values may
+// contain colons, but not commas.
 func parseHeaderMap(s string) map[string]string {
 	r := make(map[string]string)
 	for _, v := range strings.Split(s, ",") {
-		kv := strings.Split(v, ":")
+		kv := strings.SplitN(v, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		r[kv[0]] = kv[1]
+	}
+	return r
+}
+
+// parseFormFields parses comma separated key=value pairs.
+func parseFormFields(s string) map[string]string {
+	r := make(map[string]string)
+	for _, v := range strings.Split(s, ",") {
+		kv := strings.SplitN(v, "=", 2)
 		if len(kv) != 2 {
 			continue
 		}
@@ -99,6 +314,14 @@ func parseHeaderMap(s string) map[string]string {
 	return r
 }
 
+// parseDuration parses the duration s, which is 0 if s is empty.
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
 func (d *HTTP) LoadFlags() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "http",
@@ -112,10 +335,69 @@ func (d *HTTP) LoadFlags() error {
 		SuccessfulStatusCodes: parseIntSlice(*flags.HTTPSuccessfulStatusCodes),
 		Headers:               parseHeaderMap(*flags.HTTPHeaders),
 	}
+	for k, v := range flags.HTTPHeader.Map() {
+		rr.Headers[k] = v
+	}
 	if rr.Method == "" {
 		rr.Method = "POST"
 	}
+	var err error
+	if rr.Timeout, err = parseDuration(*flags.HTTPTimeout); err != nil {
+		l.WithError(err).Error("Failed to parse http-timeout")
+		return err
+	}
+	rr.BodyTemplate = *flags.HTTPBodyTemplate
+	rr.BodyMode = *flags.HTTPBodyMode
+	rr.MultipartField = *flags.HTTPMultipartField
+	rr.MultipartFilename = *flags.HTTPMultipartFilename
+	rr.MultipartContentType = *flags.HTTPMultipartContentType
+	rr.FormFields = flags.HTTPFormField.Map()
+	rr.Retries = *flags.HTTPRetries
+	rr.RetryStatusCodes = parseIntSlice(*flags.HTTPRetryStatusCodes)
+	if rr.RetryBackoff, err = parseDuration(*flags.HTTPRetryBackoff); err != nil {
+		l.WithError(err).Error("Failed to parse http-retry-backoff")
+		return err
+	}
+	if rr.RetryMaxWait, err = parseDuration(*flags.HTTPRetryMaxWait); err != nil {
+		l.WithError(err).Error("Failed to parse http-retry-max-wait")
+		return err
+	}
 	d.Request = rr
+	d.Response = &HTTPResponse{
+		Output: *flags.HTTPResponseOut,
+		Assert: *flags.HTTPResponseAssert,
+	}
+	if d.Response.Timeout, err = parseDuration(*flags.HTTPResponseTimeout); err != nil {
+		l.WithError(err).Error("Failed to parse http-response-timeout")
+		return err
+	}
+	d.Sign = &HTTPSign{
+		Secret:          *flags.HTTPSignSecret,
+		SecretFile:      *flags.HTTPSignSecretFile,
+		Algorithm:       *flags.HTTPSignAlgorithm,
+		Header:          *flags.HTTPSignHeader,
+		Format:          *flags.HTTPSignFormat,
+		Payload:         *flags.HTTPSignPayload,
+		TimestampHeader: *flags.HTTPSignTimestampHeader,
+		Encoding:        *flags.HTTPSignEncoding,
+	}
+	d.Auth = &HTTPAuth{
+		Type:              AuthType(*flags.HTTPAuthType),
+		Username:          *flags.HTTPAuthUsername,
+		Password:          *flags.HTTPAuthPassword,
+		Token:             *flags.HTTPAuthToken,
+		TokenFile:         *flags.HTTPAuthTokenFile,
+		OAuthTokenURL:     *flags.HTTPAuthOAuthTokenURL,
+		OAuthClientID:     *flags.HTTPAuthOAuthClientID,
+		OAuthClientSecret: *flags.HTTPAuthOAuthClientSecret,
+		AWSRegion:         *flags.HTTPAuthAWSRegion,
+		AWSService:        *flags.HTTPAuthAWSService,
+		AWSRoleARN:        *flags.HTTPAuthAWSRoleARN,
+	}
+	if *flags.HTTPAuthOAuthScopes != "" {
+		d.Auth.OAuthScopes = strings.Split(*flags.HTTPAuthOAuthScopes, ",")
+	}
+	d.ListenAddr = *flags.HTTPListenAddr
 	d.EnableTLS = flags.HTTPEnableTLS
 	d.TLSCert = flags.HTTPTLSCertFile
 	d.TLSKey = flags.HTTPTLSKeyFile
@@ -134,8 +416,46 @@ func (d *HTTP) Init() error {
 	if err != nil {
 		return err
 	}
-	d.Client.Transport = &http.Transport{
+	tr := &http.Transport{
 		TLSClientConfig: tc,
+		Proxy:           utils.HTTPProxy,
+	}
+	d.Client.Transport = tr
+	if d.Request != nil {
+		if d.Request.Retries < 0 || d.Request.Timeout < 0 || d.Request.RetryBackoff < 0 || d.Request.RetryMaxWait < 0 {
+			return errors.New("retries, timeout, retry backoff and retry max wait must not be negative")
+		}
+		if err := d.Request.checkBodyMode(); err != nil {
+			return err
+		}
+		d.Client.Timeout = d.Request.Timeout
+	}
+	if d.Response != nil {
+		tr.ResponseHeaderTimeout = d.Response.Timeout
+		if d.Response.Assert != "" {
+			if d.assertions, err = parseAssertions(d.Response.Assert); err != nil {
+				l.WithError(err).Error("Failed to parse response assertion")
+				return err
+			}
+		}
+		if d.Response.Output != "" {
+			if d.responses, err = openResponseWriter(d.Response.Output); err != nil {
+				l.WithError(err).Error("Failed to open response output")
+				return err
+			}
+		}
+	}
+	if d.Sign != nil {
+		if d.signer, err = d.Sign.signer(); err != nil {
+			l.WithError(err).Error("Failed to configure signing")
+			return err
+		}
+	}
+	if d.Auth != nil {
+		if d.auth, err = d.Auth.authorizer(d.Client); err != nil {
+			l.WithError(err).Error("Failed to configure auth")
+			return err
+		}
 	}
 	return nil
 }
@@ -149,7 +469,36 @@ func contains(s []int, e int) bool {
 	return false
 }
 
+// statusError returns the error for an unsuccessful response status code.
+// Client errors are permanent, except for those which indicate the request
+// may succeed if retried later.
+func statusError(code int) error {
+	err := fmt.Errorf("status code %d not in successful status codes", code)
+	switch {
+	case code == http.StatusRequestTimeout,
+		code == http.StatusTooEarly,
+		code == http.StatusTooManyRequests:
+		return utils.Retryable(err)
+	case code >= 400 && code < 500:
+		return utils.Permanent(err)
+	}
+	return utils.Retryable(err)
+}
+
+// CloudEventsBinding returns the CloudEvents protocol binding of the driver.
+func (d *HTTP) CloudEventsBinding() string {
+	return "http"
+}
+
 func (d *HTTP) Push(r io.Reader) error {
+	return d.PushMeta(r, nil)
+}
+
+// PushMeta pushes r with meta set as request headers. Requests which are
+// retried are sent with the payload from its start, which is read into
+// memory unless it can be seeked. Payloads rendered with a body template
+// or signed are read into memory.
+func (d *HTTP) PushMeta(r io.Reader, meta map[string]string) error {
 	l := log.WithFields(log.Fields{
 		"pkg": "http",
 		"fn":  "Push",
@@ -164,32 +513,259 @@ func (d *HTTP) Push(r io.Reader) error {
 	if d.Request.URL == "" {
 		return errors.New("URL is nil")
 	}
-	req, err := http.NewRequest(d.Request.Method, d.Request.URL, r)
+	if d.Request.BodyTemplate != "" {
+		var bd []byte
+		if r != nil {
+			var err error
+			if bd, err = io.ReadAll(r); err != nil {
+				l.WithError(err).Error("Failed to read payload")
+				return err
+			}
+		}
+		r = bytes.NewReader(renderBody(d.Request.BodyTemplate, bd))
+	}
+	body := r
+	var rewind func() (io.Reader, error)
+	if d.Request.Retries > 0 && r != nil {
+		var err error
+		if rewind, err = replayable(r); err != nil {
+			l.WithError(err).Error("Failed to read payload")
+			return err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		if rewind != nil {
+			var err error
+			if body, err = rewind(); err != nil {
+				l.WithError(err).Error("Failed to rewind payload")
+				return err
+			}
+		}
+		enc, ct, done, err := d.Request.encodeBody(body)
+		if err != nil {
+			l.WithError(err).Error("Failed to encode body")
+			return err
+		}
+		resp, bd, err := d.send(enc, ct, meta)
+		if done != nil {
+			// stop streaming a body which was not sent, and wait for the
+			// payload to no longer be read before it is rewound
+			enc.(io.Closer).Close()
+			<-done
+		}
+		if err != nil {
+			l.Errorf("%+v", err)
+			return err
+		}
+		if d.successful(resp.StatusCode) {
+			if err := d.writeResponse(resp.StatusCode, bd); err != nil {
+				return err
+			}
+			for _, a := range d.assertions {
+				if err := a.check(bd); err != nil {
+					l.WithError(err).Error("Response assertion failed")
+					return utils.Permanent(err)
+				}
+			}
+			l.Debug("http request sent")
+			return nil
+		}
+		if attempt < d.Request.Retries && contains(d.retryStatusCodes(), resp.StatusCode) {
+			wait, ok := retryAfter(resp.Header)
+			if !ok {
+				wait = d.backoff(attempt)
+			}
+			if wait > d.retryMaxWait() {
+				l.WithFields(log.Fields{
+					"status":  resp.StatusCode,
+					"wait":    wait,
+					"maxWait": d.retryMaxWait(),
+				}).Error("Retry-After exceeds the retry max wait")
+				if err := d.writeResponse(resp.StatusCode, bd); err != nil {
+					return err
+				}
+				return utils.Retryable(fmt.Errorf("status code %d with Retry-After %s longer than the retry max wait %s", resp.StatusCode, wait, d.retryMaxWait()))
+			}
+			l.WithFields(log.Fields{
+				"status":  resp.StatusCode,
+				"attempt": attempt + 1,
+				"wait":    wait,
+			}).Warn("Retrying request")
+			if err := d.wait(wait); err != nil {
+				l.WithError(err).Error("Retry canceled")
+				return err
+			}
+			continue
+		}
+		if err := d.writeResponse(resp.StatusCode, bd); err != nil {
+			return err
+		}
+		l.Errorf("Status code %d not in successful status codes", resp.StatusCode)
+		return statusError(resp.StatusCode)
+	}
+}
+
+// send sends a request with the body of the content type, and returns the
+// response with its body, if the response is written or asserted. The
+// response body is always read and closed, so that the connection is reused.
+func (d *HTTP) send(body io.Reader, contentType string, meta map[string]string) (*http.Response, []byte, error) {
+	l := log.WithFields(log.Fields{
+		"pkg": "http",
+		"fn":  "send",
+	})
+	req, err := http.NewRequest(d.Request.Method, d.Request.URL, body)
 	if err != nil {
-		l.Errorf("%+v", err)
-		return err
+		return nil, nil, err
 	}
 	for k, v := range d.Request.Headers {
 		req.Header.Add(k, v)
 	}
-	if d.Request.ContentType != "" {
-		req.Header.Add("Content-Type", d.Request.ContentType)
+	if contentType != "" {
+		req.Header.Add("Content-Type", contentType)
+	}
+	for k, v := range meta {
+		req.Header.Set(k, v)
+	}
+	if d.signer != nil {
+		if err := d.signer.sign(req, time.Now()); err != nil {
+			l.WithError(err).Error("Failed to sign request")
+			return nil, nil, err
+		}
+	}
+	if d.auth != nil {
+		if err := d.auth.authorize(req); err != nil {
+			l.WithError(err).Error("Failed to authorize request")
+			return nil, nil, err
+		}
 	}
+	l.WithFields(log.Fields{
+		"method":  req.Method,
+		"url":     req.URL.Redacted(),
+		"headers": redactHeaders(req.Header),
+	}).Debug("sending request")
 	resp, err := d.Client.Do(req)
 	if err != nil {
-		l.Errorf("%+v", err)
-		return err
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	var bd []byte
+	if d.responses != nil || len(d.assertions) > 0 {
+		bd, err = io.ReadAll(resp.Body)
+	} else {
+		_, err = io.Copy(io.Discard, resp.Body)
+	}
+	if err != nil {
+		return nil, nil, err
 	}
+	return resp, bd, nil
+}
+
+// successful reports whether the status is one of the successful status
+// codes, or 2xx if none are set.
+func (d *HTTP) successful(code int) bool {
 	if len(d.Request.SuccessfulStatusCodes) > 0 {
-		if !contains(d.Request.SuccessfulStatusCodes, resp.StatusCode) {
-			l.Errorf("Status code %d not in successful status codes", resp.StatusCode)
-			return errors.New("status code not in successful status codes")
-		}
+		return contains(d.Request.SuccessfulStatusCodes, code)
+	}
+	return code >= 200 && code < 300
+}
+
+func (d *HTTP) retryStatusCodes() []int {
+	if len(d.Request.RetryStatusCodes) > 0 {
+		return d.Request.RetryStatusCodes
+	}
+	return defaultRetryStatusCodes
+}
+
+// backoff returns the delay before the retry attempt, counting from 0, at
+// most the retry max wait.
+func (d *HTTP) backoff(attempt int) time.Duration {
+	b := d.Request.RetryBackoff
+	if b == 0 {
+		b = time.Second
+	}
+	for ; attempt > 0 && b < d.retryMaxWait(); attempt-- {
+		b *= 2
+	}
+	if b > d.retryMaxWait() {
+		b = d.retryMaxWait()
+	}
+	return b
+}
+
+func (d *HTTP) retryMaxWait() time.Duration {
+	if d.Request.RetryMaxWait > 0 {
+		return d.Request.RetryMaxWait
+	}
+	return defaultRetryMaxWait
+}
+
+// SetContext sets the context which ends the waits before retries once it
+// is done, failing the push with a retryable error.
+func (d *HTTP) SetContext(ctx context.Context) {
+	d.ctx = ctx
+}
+
+// wait waits for dur, or until the context of the driver is done.
+func (d *HTTP) wait(dur time.Duration) error {
+	if d.ctx == nil {
+		time.Sleep(dur)
+		return nil
+	}
+	t := time.NewTimer(dur)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-d.ctx.Done():
+		return utils.Retryable(d.ctx.Err())
+	}
+}
+
+// writeResponse writes the response to the response output, if it is set.
+func (d *HTTP) writeResponse(status int, bd []byte) error {
+	if d.responses == nil {
+		return nil
+	}
+	if err := d.responses.write(status, bd); err != nil {
+		return utils.Permanent(fmt.Errorf("write response: %w", err))
 	}
-	l.Debug("http request sent")
 	return nil
 }
 
+// replayable returns a function which returns r from its start for each
+// attempt. Payloads which can not be seeked, such as a pipe, are read into
+// memory.
+func replayable(r io.Reader) (func() (io.Reader, error), error) {
+	if s, ok := r.(io.ReadSeeker); ok {
+		if off, err := s.Seek(0, io.SeekCurrent); err == nil {
+			return func() (io.Reader, error) {
+				if _, err := s.Seek(off, io.SeekStart); err != nil {
+					return nil, err
+				}
+				// hide Close, so that the transport does not close the
+				// payload after the first attempt
+				return struct{ io.Reader }{s}, nil
+			}, nil
+		}
+	}
+	bd, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return func() (io.Reader, error) {
+		return bytes.NewReader(bd), nil
+	}, nil
+}
+
 func (d *HTTP) Cleanup() error {
+	if d.responses != nil {
+		if err := d.responses.Close(); err != nil {
+			return err
+		}
+		d.responses = nil
+	}
+	if d.server != nil {
+		return d.server.Close()
+	}
 	return nil
 }
@@ -0,0 +1,220 @@
+package http_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pushxhttp "github.com/robertlestak/pushx/drivers/http"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest"
+	"github.com/robertlestak/pushx/pkg/flags"
+	"github.com/robertlestak/pushx/pkg/utils"
+)
+
+type server struct {
+	*httptest.Server
+	mu     sync.Mutex
+	last   []byte
+	header http.Header
+}
+
+func newServer(t *testing.T) *server {
+	s := &server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bd, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.mu.Lock()
+		s.last = bd
+		s.header = r.Header
+		s.mu.Unlock()
+		switch r.URL.Path {
+		case "/notfound":
+			w.WriteHeader(http.StatusNotFound)
+		case "/throttled":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	s := newServer(t)
+	driverstest.Run(t, driverstest.Case{
+		New: func() drivers.Driver { return &pushxhttp.HTTP{} },
+		Flags: map[string]string{
+			"http-url":                     s.URL,
+			"http-method":                  "PUT",
+			"http-content-type":            "application/octet-stream",
+			"http-successful-status-codes": "200,201",
+			"http-headers":                 "X-Test:pushx",
+		},
+		Env: map[string]string{
+			"HTTP_REQUEST_URL":                     s.URL,
+			"HTTP_REQUEST_METHOD":                  "PUT",
+			"HTTP_REQUEST_CONTENT_TYPE":            "application/octet-stream",
+			"HTTP_REQUEST_SUCCESSFUL_STATUS_CODES": "200,201",
+			"HTTP_REQUEST_HEADERS":                 "X-Test:pushx",
+		},
+		BadEnv: map[string]string{
+			"HTTP_REQUEST_URL":                     s.URL + "/notfound",
+			"HTTP_REQUEST_SUCCESSFUL_STATUS_CODES": "200,201",
+		},
+		Received: func(t *testing.T) []byte {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return s.last
+		},
+	})
+}
+
+func TestStatusErrorClass(t *testing.T) {
+	s := newServer(t)
+	for _, tc := range []struct {
+		path string
+		want error
+	}{
+		{"/notfound", drivers.ErrPushRejected},
+		{"/throttled", drivers.ErrPushFailed},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{
+				URL:                   s.URL + tc.path,
+				SuccessfulStatusCodes: []int{200, 201},
+			}}
+			if err := d.Init(); err != nil {
+				t.Fatal(err)
+			}
+			err := d.Push(nil)
+			if !errors.Is(drivers.PushError(err), tc.want) {
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestPushMeta(t *testing.T) {
+	s := newServer(t)
+	d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{URL: s.URL}}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PushMeta(strings.NewReader("hello"), map[string]string{"X-Trace-Id": "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v := s.header.Get("X-Trace-Id"); v != "abc" {
+		t.Errorf("got header %q, want %q", v, "abc")
+	}
+}
+
+func TestPushStreams(t *testing.T) {
+	first := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(r.Body, buf); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		close(first)
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer s.Close()
+	d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{URL: s.URL}}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("hello"))
+		// the rest of the payload is only written once the server has
+		// received the start of it, so a driver that buffers the payload
+		// never completes
+		select {
+		case <-first:
+			pw.Write([]byte(" world"))
+			pw.Close()
+		case <-time.After(5 * time.Second):
+			pw.CloseWithError(errors.New("payload not streamed"))
+		}
+	}()
+	if err := d.Push(pr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeaderFlag(t *testing.T) {
+	s := newServer(t)
+	defer func() { *flags.HTTPHeader = nil }()
+	for _, h := range []string{"X-Callback: https://example.com/a,b", "X-Test:pushx"} {
+		if err := flags.FlagSet.Set("http-header", h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := flags.FlagSet.Set("http-header", "invalid"); err == nil {
+		t.Error("got no error for a header without a value")
+	}
+	d := &pushxhttp.HTTP{}
+	if err := d.LoadFlags(); err != nil {
+		t.Fatal(err)
+	}
+	d.Request.URL = s.URL
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Push(strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, want := range map[string]string{"X-Callback": "https://example.com/a,b", "X-Test": "pushx"} {
+		if v := s.header.Get(k); v != want {
+			t.Errorf("got header %s %q, want %q", k, v, want)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	defer utils.SetProxy("")
+	var proxied []string
+	p := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+	}))
+	defer p.Close()
+	d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{URL: "http://api.test/jobs"}}
+	if err := utils.SetProxy(p.URL); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Push(strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the environment is used without an explicit proxy
+	t.Setenv("HTTP_PROXY", p.URL)
+	utils.SetProxy("")
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Push(strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if len(proxied) != 2 || proxied[0] != "http://api.test/jobs" || proxied[1] != proxied[0] {
+		t.Errorf("got proxied requests %q, want two to http://api.test/jobs", proxied)
+	}
+}
@@ -0,0 +1,197 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// HTTPResponse configures how responses are handled.
+type HTTPResponse struct {
+	// Timeout is how long to wait for the response headers once the
+	// request is written.
+	Timeout time.Duration
+	// Output is the file each response is written to as a JSON record of
+	// its status and body. "-" is stdout.
+	Output string
+	// Assert is an assertion on the JSON response body of a successful
+	// status, such as `.ok == true`.
+	Assert string
+}
+
+// responseRecord is a response written to the response output.
+type responseRecord struct {
+	Status int `json:"status"`
+	Body   any `json:"body"`
+}
+
+// responseWriter writes response records.
+type responseWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+func openResponseWriter(path string) (*responseWriter, error) {
+	if path == "-" {
+		return &responseWriter{w: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &responseWriter{w: f, closer: f}, nil
+}
+
+// write writes the response status and body. JSON bodies are written as
+// JSON, other bodies as a string.
+func (w *responseWriter) write(status int, body []byte) error {
+	rec := responseRecord{Status: status, Body: string(body)}
+	if json.Valid(body) {
+		rec.Body = json.RawMessage(body)
+	}
+	bd, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err = w.w.Write(append(bd, '\n'))
+	return err
+}
+
+func (w *responseWriter) Close() error {
+	if w.closer != nil {
+		return w.closer.Close()
+	}
+	return nil
+}
+
+// assertion is a condition on a gjson path of the response body.
+type assertion struct {
+	path  string
+	op    string
+	value gjson.Result
+}
+
+// assertionOps are the operators of assertions, longest first.
+var assertionOps = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+// parseAssertions parses assertions joined with &&. An assertion is a
+// gjson path, with an optional leading dot, compared to a JSON value, such
+// as `.ok == true` or `.count > 0`. A path alone asserts the value is
+// truthy. Values which are not JSON are compared as strings.
+func parseAssertions(s string) ([]assertion, error) {
+	var as []assertion
+	for _, e := range strings.Split(s, "&&") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			return nil, fmt.Errorf("empty assertion in %q", s)
+		}
+		a := assertion{path: e}
+		for _, op := range assertionOps {
+			if i := strings.Index(e, op); i >= 0 {
+				a.path = strings.TrimSpace(e[:i])
+				a.op = op
+				v := strings.TrimSpace(e[i+len(op):])
+				if !gjson.Valid(v) {
+					v = strconv.Quote(v)
+				}
+				a.value = gjson.Parse(v)
+				break
+			}
+		}
+		a.path = strings.TrimPrefix(a.path, ".")
+		if a.path == "" {
+			return nil, fmt.Errorf("assertion %q has no path", e)
+		}
+		if (a.op == ">" || a.op == ">=" || a.op == "<" || a.op == "<=") && a.value.Type != gjson.Number {
+			return nil, fmt.Errorf("assertion %q compares a value which is not a number", e)
+		}
+		as = append(as, a)
+	}
+	return as, nil
+}
+
+func (a assertion) String() string {
+	if a.op == "" {
+		return "." + a.path
+	}
+	return fmt.Sprintf(".%s %s %s", a.path, a.op, a.value.Raw)
+}
+
+// check returns an error if the body does not satisfy the assertion.
+func (a assertion) check(body []byte) error {
+	v := gjson.GetBytes(body, a.path)
+	var ok bool
+	switch a.op {
+	case "":
+		ok = v.Exists() && v.Bool()
+	case "==", "!=":
+		ok = equal(v, a.value) == (a.op == "==")
+	default:
+		ok = v.Type == gjson.Number
+		switch a.op {
+		case ">":
+			ok = ok && v.Num > a.value.Num
+		case ">=":
+			ok = ok && v.Num >= a.value.Num
+		case "<":
+			ok = ok && v.Num < a.value.Num
+		case "<=":
+			ok = ok && v.Num <= a.value.Num
+		}
+	}
+	if !ok {
+		got := v.Raw
+		if !v.Exists() {
+			got = "missing"
+		}
+		return fmt.Errorf("response assertion %s failed, got %s", a, got)
+	}
+	return nil
+}
+
+// equal reports whether the values are of the same type and equal.
+func equal(v, w gjson.Result) bool {
+	if !v.Exists() || v.Type != w.Type {
+		return false
+	}
+	switch v.Type {
+	case gjson.Number:
+		return v.Num == w.Num
+	case gjson.String:
+		return v.Str == w.Str
+	case gjson.JSON:
+		return v.Raw == w.Raw
+	}
+	return true
+}
+
+// retryAfter returns the delay of the Retry-After header, in seconds or as
+// a date, if it is set.
+func retryAfter(h http.Header) (time.Duration, bool) {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
@@ -0,0 +1,285 @@
+package http_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pushxhttp "github.com/robertlestak/pushx/drivers/http"
+	"github.com/robertlestak/pushx/pkg/drivers"
+)
+
+func TestDefaultSuccessfulStatus(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+	d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{URL: s.URL}}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Push(strings.NewReader("hello")); !errors.Is(drivers.PushError(err), drivers.ErrPushFailed) {
+		t.Errorf("got %v, want a failed push for a 500 response", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var attempts int32
+	var bodies []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bd, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(bd))
+		switch atomic.AddInt32(&attempts, 1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer s.Close()
+	f := filepath.Join(t.TempDir(), "payload")
+	if err := os.WriteFile(f, []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, open := range map[string]func() io.Reader{
+		"stream": func() io.Reader { return io.MultiReader(strings.NewReader("hello "), strings.NewReader("world")) },
+		"file": func() io.Reader {
+			fh, err := os.Open(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { fh.Close() })
+			return fh
+		},
+	} {
+		atomic.StoreInt32(&attempts, 0)
+		bodies = nil
+		d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{
+			URL:          s.URL,
+			Retries:      2,
+			RetryBackoff: time.Millisecond,
+		}}
+		if err := d.Init(); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Push(open()); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(bodies) != 3 {
+			t.Fatalf("%s: got %d attempts, want 3", name, len(bodies))
+		}
+		for _, bd := range bodies {
+			if bd != "hello world" {
+				t.Errorf("%s: got body %q, want the payload resent", name, bd)
+			}
+		}
+	}
+
+	// the last retry status is returned once the retries are exhausted
+	atomic.StoreInt32(&attempts, 0)
+	d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{
+		URL:              s.URL,
+		Retries:          1,
+		RetryStatusCodes: []int{http.StatusTooManyRequests},
+	}}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Push(strings.NewReader("hello")); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("got %v, want the 503 of the last attempt", err)
+	}
+}
+
+func TestRetryMaxWait(t *testing.T) {
+	var attempts int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		if r.URL.Path == "/retry-after" {
+			w.Header().Set("Retry-After", "86400")
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	// a Retry-After longer than the max wait fails without waiting
+	d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{
+		URL:          s.URL + "/retry-after",
+		Retries:      1,
+		RetryMaxWait: time.Second,
+	}}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err := d.Push(strings.NewReader("hello"))
+	if !errors.Is(drivers.PushError(err), drivers.ErrPushFailed) {
+		t.Errorf("got %v, want a retryable error", err)
+	}
+	if e := time.Since(start); e > 2*time.Second || atomic.LoadInt32(&attempts) != 1 {
+		t.Errorf("got %d attempts after %s, want 1 without waiting", attempts, e)
+	}
+
+	// backoffs are shortened to the max wait
+	atomic.StoreInt32(&attempts, 0)
+	d = &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{
+		URL:          s.URL,
+		Retries:      2,
+		RetryBackoff: time.Hour,
+		RetryMaxWait: 10 * time.Millisecond,
+	}}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	start = time.Now()
+	if err := d.Push(strings.NewReader("hello")); err == nil {
+		t.Error("got no error")
+	}
+	if e := time.Since(start); e > 2*time.Second || atomic.LoadInt32(&attempts) != 3 {
+		t.Errorf("got %d attempts after %s, want 3", attempts, e)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+	d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{URL: s.URL, Retries: 1}}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	d.SetContext(ctx)
+	start := time.Now()
+	err := d.Push(strings.NewReader("hello"))
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(drivers.PushError(err), drivers.ErrPushFailed) {
+		t.Errorf("got %v, want a retryable %v", err, context.DeadlineExceeded)
+	}
+	if e := time.Since(start); e > 2*time.Second {
+		t.Errorf("canceled after %s", e)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	done := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer s.Close()
+	defer close(done)
+	for name, d := range map[string]*pushxhttp.HTTP{
+		"request":  {Request: &pushxhttp.HTTPRequest{URL: s.URL, Timeout: 50 * time.Millisecond}},
+		"response": {Request: &pushxhttp.HTTPRequest{URL: s.URL}, Response: &pushxhttp.HTTPResponse{Timeout: 50 * time.Millisecond}},
+	} {
+		if err := d.Init(); err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		if err := d.Push(strings.NewReader("hello")); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+		if e := time.Since(start); e > 2*time.Second {
+			t.Errorf("%s: timed out after %s", name, e)
+		}
+	}
+}
+
+func TestResponseOutputAndAssert(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/text":
+			w.Write([]byte("accepted"))
+		case "/error":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"error":"invalid_payload"}`))
+		default:
+			w.Write([]byte(`{"ok":true,"count":2,"channel":"C1"}`))
+		}
+	}))
+	defer s.Close()
+	out := filepath.Join(t.TempDir(), "responses.jsonl")
+	push := func(path, assert string) error {
+		d := &pushxhttp.HTTP{
+			Request:  &pushxhttp.HTTPRequest{URL: s.URL + path},
+			Response: &pushxhttp.HTTPResponse{Output: out, Assert: assert},
+		}
+		if err := d.Init(); err != nil {
+			t.Fatal(err)
+		}
+		defer d.Cleanup()
+		return d.Push(strings.NewReader("hello"))
+	}
+	for _, a := range []string{"", ".ok == true", "ok && count >= 2 && .channel == C1", `.channel == "C1" && .error != 1`} {
+		if err := push("/", a); err != nil {
+			t.Errorf("assert %q: %v", a, err)
+		}
+	}
+	for _, a := range []string{".ok == false", ".count < 2", ".missing", ".channel != C1"} {
+		err := push("/", a)
+		if !errors.Is(drivers.PushError(err), drivers.ErrPushRejected) {
+			t.Errorf("assert %q: got %v, want a rejected push", a, err)
+		}
+	}
+	if err := push("/text", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := push("/error", ""); err == nil {
+		t.Fatal("got no error for a 400 response")
+	}
+	fh, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	var recs []map[string]any
+	sc := bufio.NewScanner(fh)
+	for sc.Scan() {
+		var rec map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) != 10 {
+		t.Fatalf("got %d response records, want 10", len(recs))
+	}
+	if b, ok := recs[0]["body"].(map[string]any); !ok || b["channel"] != "C1" || recs[0]["status"] != float64(200) {
+		t.Errorf("got record %v", recs[0])
+	}
+	if recs[8]["body"] != "accepted" {
+		t.Errorf("got record %v, want a text body", recs[8])
+	}
+	if recs[9]["status"] != float64(400) {
+		t.Errorf("got record %v, want the failed response", recs[9])
+	}
+}
+
+func TestResponseAssertInvalid(t *testing.T) {
+	for _, a := range []string{".count > ten", "== true", ".a && "} {
+		d := &pushxhttp.HTTP{
+			Request:  &pushxhttp.HTTPRequest{URL: "http://localhost"},
+			Response: &pushxhttp.HTTPResponse{Assert: a},
+		}
+		if err := d.Init(); err == nil {
+			t.Errorf("assert %q: got no error", a)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package http
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults of the request signature.
+const (
+	defaultSignHeader  = "X-Signature"
+	defaultSignFormat  = "{{signature}}"
+	defaultSignPayload = "{{body}}"
+)
+
+// HTTPSign signs requests with an HMAC of the body, as webhook receivers
+// verify. Format is the value of the signature header, and Payload the
+// signed message, in which {{signature}}, {{timestamp}} and {{body}} are
+// replaced with the encoded signature, the Unix time of the request and
+// the body. For example, GitHub signs {{body}} with the format
+// sha256={{signature}}, Stripe signs {{timestamp}}.{{body}} with the
+// format t={{timestamp}},v1={{signature}}, and Slack signs
+// v0:{{timestamp}}:{{body}} with the format v0={{signature}}.
+type HTTPSign struct {
+	Secret     string
+	SecretFile string
+	// Algorithm is the hash of the HMAC: sha1, sha256 or sha512.
+	Algorithm string
+	Header    string
+	Format    string
+	Payload   string
+	// TimestampHeader, if set, is sent the timestamp of the signature.
+	TimestampHeader string
+	// Encoding of the signature: hex or base64.
+	Encoding string
+}
+
+// signer signs requests.
+type signer struct {
+	secret          []byte
+	hash            func() hash.Hash
+	header          string
+	format          string
+	payload         string
+	timestampHeader string
+	encode          func([]byte) string
+}
+
+// signer returns the signer of the configuration, or nil if no secret is
+// set.
+func (s *HTTPSign) signer() (*signer, error) {
+	if s.Secret == "" && s.SecretFile == "" {
+		return nil, nil
+	}
+	if s.Secret != "" && s.SecretFile != "" {
+		return nil, errors.New("only one of sign secret and sign secret file may be set")
+	}
+	sg := &signer{
+		secret:          []byte(s.Secret),
+		header:          s.Header,
+		format:          s.Format,
+		payload:         s.Payload,
+		timestampHeader: s.TimestampHeader,
+	}
+	if s.SecretFile != "" {
+		bd, err := os.ReadFile(s.SecretFile)
+		if err != nil {
+			return nil, err
+		}
+		sg.secret = bytes.TrimSpace(bd)
+	}
+	if len(sg.secret) == 0 {
+		return nil, errors.New("sign secret is empty")
+	}
+	switch s.Algorithm {
+	case "sha1":
+		sg.hash = sha1.New
+	case "", "sha256":
+		sg.hash = sha256.New
+	case "sha512":
+		sg.hash = sha512.New
+	default:
+		return nil, fmt.Errorf("unknown sign algorithm %q", s.Algorithm)
+	}
+	switch s.Encoding {
+	case "", "hex":
+		sg.encode = hex.EncodeToString
+	case "base64":
+		sg.encode = base64.StdEncoding.EncodeToString
+	default:
+		return nil, fmt.Errorf("unknown sign encoding %q", s.Encoding)
+	}
+	if sg.header == "" {
+		sg.header = defaultSignHeader
+	}
+	if sg.format == "" {
+		sg.format = defaultSignFormat
+	}
+	if sg.payload == "" {
+		sg.payload = defaultSignPayload
+	}
+	if !strings.Contains(sg.format, "{{signature}}") {
+		return nil, errors.New("sign format must contain {{signature}}")
+	}
+	return sg, nil
+}
+
+// sign sets the signature header of the request, and its timestamp header.
+func (s *signer) sign(req *http.Request, t time.Time) error {
+	bd, err := readBody(req)
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(s.hash, s.secret)
+	// the body is not replaced in the payload template, so that a body
+	// containing a placeholder is signed as it is sent
+	parts := strings.Split(s.payload, "{{body}}")
+	for i, p := range parts {
+		if i > 0 {
+			mac.Write(bd)
+		}
+		io.WriteString(mac, strings.ReplaceAll(p, "{{timestamp}}", ts))
+	}
+	sig := s.encode(mac.Sum(nil))
+	v := strings.NewReplacer("{{signature}}", sig, "{{timestamp}}", ts).Replace(s.format)
+	req.Header.Set(s.header, v)
+	if s.timestampHeader != "" {
+		req.Header.Set(s.timestampHeader, ts)
+	}
+	return nil
+}
+
+// readBody reads the body of the request, which is replaced so that it
+// can be sent.
+func readBody(req *http.Request) ([]byte, error) {
+	var bd []byte
+	if req.Body != nil {
+		var err error
+		if bd, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	req.ContentLength = int64(len(bd))
+	req.Body = http.NoBody
+	if len(bd) > 0 {
+		req.Body = io.NopCloser(bytes.NewReader(bd))
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(bd)), nil
+	}
+	return bd, nil
+}
@@ -0,0 +1,206 @@
+package http_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	pushxhttp "github.com/robertlestak/pushx/drivers/http"
+)
+
+func hmacOf(h func() hash.Hash, secret, msg string) []byte {
+	m := hmac.New(h, []byte(secret))
+	m.Write([]byte(msg))
+	return m.Sum(nil)
+}
+
+func TestSign(t *testing.T) {
+	s := newAuthServer(t)
+	body := `{"id":1}`
+	for _, tc := range []struct {
+		name   string
+		sign   pushxhttp.HTTPSign
+		header string
+		// want returns the expected header value for the timestamp
+		want func(ts string) string
+	}{
+		{
+			name:   "github",
+			sign:   pushxhttp.HTTPSign{Secret: "s", Header: "X-Hub-Signature-256", Format: "sha256={{signature}}"},
+			header: "X-Hub-Signature-256",
+			want: func(string) string {
+				return "sha256=" + hex.EncodeToString(hmacOf(sha256.New, "s", body))
+			},
+		},
+		{
+			name:   "stripe",
+			sign:   pushxhttp.HTTPSign{Secret: "s", Header: "Stripe-Signature", Format: "t={{timestamp}},v1={{signature}}", Payload: "{{timestamp}}.{{body}}"},
+			header: "Stripe-Signature",
+			want: func(ts string) string {
+				return "t=" + ts + ",v1=" + hex.EncodeToString(hmacOf(sha256.New, "s", ts+"."+body))
+			},
+		},
+		{
+			name:   "slack",
+			sign:   pushxhttp.HTTPSign{Secret: "s", Header: "X-Slack-Signature", Format: "v0={{signature}}", Payload: "v0:{{timestamp}}:{{body}}", TimestampHeader: "X-Slack-Request-Timestamp"},
+			header: "X-Slack-Signature",
+			want: func(ts string) string {
+				return "v0=" + hex.EncodeToString(hmacOf(sha256.New, "s", "v0:"+ts+":"+body))
+			},
+		},
+		{
+			name:   "sha1",
+			sign:   pushxhttp.HTTPSign{Secret: "s", Algorithm: "sha1"},
+			header: "X-Signature",
+			want: func(string) string {
+				return hex.EncodeToString(hmacOf(sha1.New, "s", body))
+			},
+		},
+		{
+			name:   "sha512 base64",
+			sign:   pushxhttp.HTTPSign{Secret: "s", Algorithm: "sha512", Encoding: "base64"},
+			header: "X-Signature",
+			want: func(string) string {
+				return base64.StdEncoding.EncodeToString(hmacOf(sha512.New, "s", body))
+			},
+		},
+	} {
+		sign := tc.sign
+		d := &pushxhttp.HTTP{
+			Request: &pushxhttp.HTTPRequest{URL: s.URL},
+			Sign:    &sign,
+		}
+		if err := d.Init(); err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now().Unix()
+		if err := d.Push(strings.NewReader(body)); err != nil {
+			t.Fatal(err)
+		}
+		r, bd := s.last()
+		if string(bd) != body {
+			t.Errorf("%s: got body %q", tc.name, bd)
+		}
+		ts := strconv.FormatInt(start, 10)
+		if v := r.Header.Get(tc.header); v != tc.want(ts) {
+			// the second may have passed while pushing
+			ts = strconv.FormatInt(start+1, 10)
+			if v != tc.want(ts) {
+				t.Errorf("%s: got signature %q", tc.name, v)
+			}
+		}
+		if tc.sign.TimestampHeader != "" && r.Header.Get(tc.sign.TimestampHeader) != ts {
+			t.Errorf("%s: got timestamp %q, want %s", tc.name, r.Header.Get(tc.sign.TimestampHeader), ts)
+		}
+	}
+}
+
+func TestSignSecretFile(t *testing.T) {
+	s := newAuthServer(t)
+	f := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(f, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	d := &pushxhttp.HTTP{
+		Request: &pushxhttp.HTTPRequest{URL: s.URL},
+		Sign:    &pushxhttp.HTTPSign{SecretFile: f},
+	}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Push(strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := s.last()
+	if v := r.Header.Get("X-Signature"); v != hex.EncodeToString(hmacOf(sha256.New, "file-secret", "hello")) {
+		t.Errorf("got signature %q", v)
+	}
+	for name, sign := range map[string]*pushxhttp.HTTPSign{
+		"both":      {Secret: "s", SecretFile: f},
+		"missing":   {SecretFile: filepath.Join(t.TempDir(), "missing")},
+		"algorithm": {Secret: "s", Algorithm: "md5"},
+		"encoding":  {Secret: "s", Encoding: "base32"},
+		"format":    {Secret: "s", Format: "sha256="},
+	} {
+		d := &pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{URL: s.URL}, Sign: sign}
+		if err := d.Init(); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+func TestBodyTemplate(t *testing.T) {
+	s := newAuthServer(t)
+	payload := `{"id":7,"user":{"name":"Ann \"A\" <a@example.com>"},"tags":["a","b"]}`
+	for _, tc := range []struct {
+		tmpl    string
+		payload string
+		want    string
+	}{
+		{
+			tmpl:    `{"text":"Order {{id}} from {{user.name}}","tags":{{tags}},"user":{{user}},"missing":{{missing}},"raw":"{{pushx_payload}}"}`,
+			payload: payload,
+			want:    `{"text":"Order 7 from Ann \"A\" <a@example.com>","tags":["a","b"],"user":{"name":"Ann \"A\" <a@example.com>"},"missing":null,"raw":"{\"id\":7,\"user\":{\"name\":\"Ann \\\"A\\\" <a@example.com>\"},\"tags\":[\"a\",\"b\"]}"}`,
+		},
+		{
+			tmpl:    `[{"event":{{pushx_payload}},"escaped \"{{id}}\"":"{{id}}"}]`,
+			payload: `{"id":"x"}`,
+			want:    `[{"event":{"id":"x"},"escaped \"x\"":"x"}]`,
+		},
+		{
+			tmpl:    `{"message":{{pushx_payload}}}`,
+			payload: "not json",
+			want:    `{"message":"not json"}`,
+		},
+		{
+			tmpl:    `id={{id}}&name={{user.name}}`,
+			payload: `{"id":7,"user":{"name":"Ann"}}`,
+			want:    `id=7&name=Ann`,
+		},
+		{
+			tmpl:    `{{name}} signed up`,
+			payload: `{"name":"bob"}`,
+			want:    `bob signed up`,
+		},
+		{
+			tmpl:    `{{pushx_payload}}`,
+			payload: `{"id":7}`,
+			want:    `{"id":7}`,
+		},
+	} {
+		d := &pushxhttp.HTTP{
+			Request: &pushxhttp.HTTPRequest{URL: s.URL, BodyTemplate: tc.tmpl},
+			Sign:    &pushxhttp.HTTPSign{Secret: "s"},
+		}
+		if err := d.Init(); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Push(strings.NewReader(tc.payload)); err != nil {
+			t.Fatal(err)
+		}
+		r, bd := s.last()
+		if string(bd) != tc.want {
+			t.Errorf("template %s: got %s, want %s", tc.tmpl, bd, tc.want)
+		}
+		if strings.HasPrefix(tc.tmpl, "[") || (strings.HasPrefix(tc.tmpl, "{") && !strings.HasPrefix(tc.tmpl, "{{")) {
+			if !json.Valid(bd) {
+				t.Errorf("template %s: got invalid JSON %s", tc.tmpl, bd)
+			}
+		}
+		// the rendered body is signed
+		if v := r.Header.Get("X-Signature"); v != hex.EncodeToString(hmacOf(sha256.New, "s", tc.want)) {
+			t.Errorf("template %s: got signature %q of another body", tc.tmpl, v)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// request is a request received by the listener, which is responded to
+// once the message is acknowledged.
+type request struct {
+	data []byte
+	done chan bool
+}
+
+// listen starts the listener, if it is not already started.
+func (d *HTTP) listen() error {
+	if d.requests != nil {
+		return nil
+	}
+	if d.ListenAddr == "" {
+		return errors.New("listen address is empty")
+	}
+	ln, err := net.Listen("tcp", d.ListenAddr)
+	if err != nil {
+		return err
+	}
+	d.requests = make(chan *request)
+	d.server = &http.Server{Handler: http.HandlerFunc(d.handle)}
+	go d.server.Serve(ln)
+	return nil
+}
+
+// handle passes the body of POST and PUT requests to Receive, and
+// responds with 200 once the message is acknowledged, or 503 if it is
+// negatively acknowledged so that the client retries.
+func (d *HTTP) handle(w http.ResponseWriter, r *http.Request) {
+	l := log.WithFields(log.Fields{
+		"pkg": "http",
+		"fn":  "handle",
+	})
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	bd, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		l.WithError(err).Error("Failed to read request body")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	m := &request{data: bd, done: make(chan bool, 1)}
+	select {
+	case d.requests <- m:
+	case <-r.Context().Done():
+		return
+	}
+	select {
+	case ok := <-m.done:
+		if ok {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	case <-r.Context().Done():
+		l.Warn("client disconnected before the message was acknowledged")
+	}
+}
+
+// Receive starts the listener on ListenAddr if needed, and returns the
+// body of the next request.
+func (d *HTTP) Receive(ctx context.Context) ([]byte, any, error) {
+	if err := d.listen(); err != nil {
+		return nil, nil, err
+	}
+	select {
+	case m := <-d.requests:
+		return m.data, m, nil
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+// Ack responds to the request with 200.
+func (d *HTTP) Ack(ref any) error {
+	ref.(*request).done <- true
+	return nil
+}
+
+// Nack responds to the request with 503.
+func (d *HTTP) Nack(ref any) error {
+	ref.(*request).done <- false
+	return nil
+}
@@ -0,0 +1,81 @@
+package http_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	pushxhttp "github.com/robertlestak/pushx/drivers/http"
+)
+
+func TestSource(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	d := &pushxhttp.HTTP{ListenAddr: addr}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// the listener is started on the first receive
+	type result struct {
+		data []byte
+		ref  any
+		err  error
+	}
+	received := make(chan result, 1)
+	receive := func() {
+		bd, ref, err := d.Receive(ctx)
+		received <- result{bd, ref, err}
+	}
+	go receive()
+	post := func(body string) int {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			resp, err := http.Post("http://"+addr, "text/plain", strings.NewReader(body))
+			if err == nil {
+				resp.Body.Close()
+				return resp.StatusCode
+			}
+		}
+		return 0
+	}
+	for _, c := range []struct {
+		ack  bool
+		want int
+	}{
+		{false, http.StatusServiceUnavailable},
+		{true, http.StatusOK},
+	} {
+		status := make(chan int, 1)
+		go func() {
+			status <- post("hello")
+		}()
+		r := <-received
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		if string(r.data) != "hello" {
+			t.Errorf("got %q, want hello", r.data)
+		}
+		go receive()
+		if c.ack {
+			err = d.Ack(r.ref)
+		} else {
+			err = d.Nack(r.ref)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := <-status; got != c.want {
+			t.Errorf("got status %d, want %d", got, c.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/robertlestak/pushx/pkg/schema"
+	"github.com/tidwall/gjson"
+)
+
+// payloadPlaceholder is replaced with the whole payload.
+const payloadPlaceholder = "pushx_payload"
+
+// renderBody renders the body template with the payload bd. Placeholders
+// are gjson paths of the payload, such as {{user.id}}, or {{pushx_payload}}
+// for the whole payload. A template of a JSON object or array is rendered
+// as JSON: placeholders in strings are replaced with the escaped value,
+// and other placeholders with the JSON value, or null if it is missing.
+func renderBody(tmpl string, bd []byte) []byte {
+	if !jsonTemplate(tmpl) {
+		return []byte(schema.ReplaceParamsString(bd, tmpl))
+	}
+	var buf bytes.Buffer
+	var inString, escaped bool
+	for i := 0; i < len(tmpl); i++ {
+		c := tmpl[i]
+		if strings.HasPrefix(tmpl[i:], "{{") {
+			if end := strings.Index(tmpl[i+2:], "}}"); end >= 0 {
+				v := lookup(bd, strings.TrimSpace(tmpl[i+2:i+2+end]))
+				if inString {
+					buf.WriteString(escapeString(v.String()))
+				} else if v.Exists() {
+					buf.WriteString(v.Raw)
+				} else {
+					buf.WriteString("null")
+				}
+				i += end + 3
+				escaped = false
+				continue
+			}
+		}
+		buf.WriteByte(c)
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && inString:
+			escaped = true
+		case c == '"':
+			inString = !inString
+		}
+	}
+	return buf.Bytes()
+}
+
+// jsonTemplate reports whether tmpl is a JSON object or array, rather than
+// text which starts with a placeholder.
+func jsonTemplate(tmpl string) bool {
+	t := strings.TrimSpace(tmpl)
+	return strings.HasPrefix(t, "[") || (strings.HasPrefix(t, "{") && !strings.HasPrefix(t, "{{"))
+}
+
+// lookup returns the value of the path in the payload. The whole payload is
+// a string if it is not JSON.
+func lookup(bd []byte, path string) gjson.Result {
+	if path != payloadPlaceholder {
+		return gjson.GetBytes(bd, path)
+	}
+	if gjson.ValidBytes(bd) {
+		return gjson.ParseBytes(bd)
+	}
+	q, _ := json.Marshal(string(bd))
+	return gjson.Result{Type: gjson.String, Str: string(bd), Raw: string(q)}
+}
+
+// escapeString returns s escaped as the content of a JSON string.
+func escapeString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	q := strings.TrimSuffix(buf.String(), "\n")
+	return q[1 : len(q)-1]
+}
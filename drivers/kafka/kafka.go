@@ -2,33 +2,110 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
 	"github.com/robertlestak/pushx/pkg/flags"
+	"github.com/robertlestak/pushx/pkg/schema"
 	"github.com/robertlestak/pushx/pkg/utils"
 	kafka "github.com/segmentio/kafka-go"
 	"github.com/segmentio/kafka-go/sasl"
 	"github.com/segmentio/kafka-go/sasl/plain"
 	"github.com/segmentio/kafka-go/sasl/scram"
 	log "github.com/sirupsen/logrus"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"golang.org/x/oauth2"
 )
 
 type SaslType string
 
 var (
 	SaslTypePlain = SaslType("plain")
-	SaslTypeScram = SaslType("scram")
+	// SaslTypeScram is SCRAM-SHA-512.
+	SaslTypeScram       = SaslType("scram")
+	SaslTypeScramSHA256 = SaslType("scram-sha-256")
+	SaslTypeScramSHA512 = SaslType("scram-sha-512")
+	SaslTypeOAuthBearer = SaslType("oauthbearer")
+	SaslTypeAWSMSKIAM   = SaslType("aws-msk-iam")
+)
+
+// Partitioners of the Kafka driver. PartitionerHash is compatible with
+// sarama, PartitionerMurmur2 with the Java client and PartitionerCRC32
+// with librdkafka.
+const (
+	PartitionerHash       = "hash"
+	PartitionerMurmur2    = "murmur2"
+	PartitionerCRC32      = "crc32"
+	PartitionerRoundRobin = "round-robin"
+	PartitionerLeastBytes = "least-bytes"
 )
 
 type Kafka struct {
 	Client  *kafka.Writer
+	dialer  *kafka.Dialer
 	Brokers []string
 	Topic   *string
-	Key     *string
+	// Key is the message key. It may be templated from the payload, for
+	// example {{id}}.
+	Key *string
+	// Partitioner is one of the Partitioner constants. It defaults to
+	// PartitionerLeastBytes.
+	Partitioner *string
+	// Partition, if not negative, is the partition every message is
+	// written to, in place of the partitioner.
+	Partition *int
+	// RequiredAcks is none, one or all, the default.
+	RequiredAcks *string
+	// Compression is none, gzip, snappy, lz4 or zstd.
+	Compression *string
+	// BatchSize, BatchTimeout and WriteTimeout default to those of
+	// kafka-go, 100 messages, 1s and 10s.
+	BatchSize    *int
+	BatchTimeout *string
+	WriteTimeout *string
+	// BatchBytes is the maximum size of a batch, and so of a message. It
+	// defaults to that of the client, about 1MB.
+	BatchBytes *int
+	// Group is the consumer group used to receive from the topic as a
+	// relay source. It defaults to pushx.
+	Group  *string
+	reader *kafka.Reader
+	// Serializer, if set, is one of the Serializer constants, with which
+	// the JSON input is encoded in the Confluent wire format.
+	Serializer             *string
+	SchemaRegistryURL      *string
+	SchemaRegistryUsername *string
+	SchemaRegistryPassword *string
+	// SchemaSubject is the registry subject of the schema. It defaults to
+	// <topic>-value.
+	SchemaSubject *string
+	// SchemaFile, if set, is a schema registered under the subject, if it
+	// is not already, and encoded with. Otherwise the schema with SchemaID,
+	// or the latest schema of the subject, is encoded with.
+	SchemaFile *string
+	SchemaID   *int
+	// SchemaMessage is the fully qualified name of the Protobuf message of
+	// the schema. It defaults to the first message.
+	SchemaMessage *string
+	registry      *registry
+	serializersMu sync.Mutex
+	serializers   map[int]*serializer
+	// TransactionalID, if set, writes messages with a transactional
+	// producer, so that the records of an input are committed atomically.
+	TransactionalID *string
+	txClient        *kgo.Client
+	txMu            sync.Mutex
+	inTx            bool
+	txErr           error
 	// TLS
 	EnableTLS   *bool
 	TLSInsecure *bool
@@ -40,6 +117,17 @@ type Kafka struct {
 	SaslType   *SaslType
 	Username   *string
 	Password   *string
+	// OAuthToken is a static OAUTHBEARER token. Otherwise tokens are
+	// fetched from OAuthTokenURL with the client credentials grant.
+	OAuthToken        *string
+	OAuthTokenURL     *string
+	OAuthClientID     *string
+	OAuthClientSecret *string
+	// OAuthScopes are comma separated.
+	OAuthScopes *string
+	// AWSRegion is the region of the MSK cluster for AWS_MSK_IAM. It
+	// defaults to AWS_REGION.
+	AWSRegion *string
 }
 
 func (d *Kafka) LoadEnv(prefix string) error {
@@ -55,6 +143,98 @@ func (d *Kafka) LoadEnv(prefix string) error {
 		v := os.Getenv(prefix + "KAFKA_TOPIC")
 		d.Topic = &v
 	}
+	if os.Getenv(prefix+"KAFKA_KEY") != "" {
+		v := os.Getenv(prefix + "KAFKA_KEY")
+		d.Key = &v
+	}
+	if os.Getenv(prefix+"KAFKA_PARTITIONER") != "" {
+		v := os.Getenv(prefix + "KAFKA_PARTITIONER")
+		d.Partitioner = &v
+	}
+	if os.Getenv(prefix+"KAFKA_PARTITION") != "" {
+		v, err := strconv.Atoi(os.Getenv(prefix + "KAFKA_PARTITION"))
+		if err != nil {
+			l.WithError(err).Error("Failed to parse KAFKA_PARTITION")
+			return err
+		}
+		d.Partition = &v
+	}
+	if os.Getenv(prefix+"KAFKA_REQUIRED_ACKS") != "" {
+		v := os.Getenv(prefix + "KAFKA_REQUIRED_ACKS")
+		d.RequiredAcks = &v
+	}
+	if os.Getenv(prefix+"KAFKA_COMPRESSION") != "" {
+		v := os.Getenv(prefix + "KAFKA_COMPRESSION")
+		d.Compression = &v
+	}
+	if os.Getenv(prefix+"KAFKA_BATCH_SIZE") != "" {
+		v, err := strconv.Atoi(os.Getenv(prefix + "KAFKA_BATCH_SIZE"))
+		if err != nil {
+			l.WithError(err).Error("Failed to parse KAFKA_BATCH_SIZE")
+			return err
+		}
+		d.BatchSize = &v
+	}
+	if os.Getenv(prefix+"KAFKA_BATCH_BYTES") != "" {
+		v, err := strconv.Atoi(os.Getenv(prefix + "KAFKA_BATCH_BYTES"))
+		if err != nil {
+			l.WithError(err).Error("Failed to parse KAFKA_BATCH_BYTES")
+			return err
+		}
+		d.BatchBytes = &v
+	}
+	if os.Getenv(prefix+"KAFKA_BATCH_TIMEOUT") != "" {
+		v := os.Getenv(prefix + "KAFKA_BATCH_TIMEOUT")
+		d.BatchTimeout = &v
+	}
+	if os.Getenv(prefix+"KAFKA_WRITE_TIMEOUT") != "" {
+		v := os.Getenv(prefix + "KAFKA_WRITE_TIMEOUT")
+		d.WriteTimeout = &v
+	}
+	if os.Getenv(prefix+"KAFKA_GROUP") != "" {
+		v := os.Getenv(prefix + "KAFKA_GROUP")
+		d.Group = &v
+	}
+	if os.Getenv(prefix+"KAFKA_SERIALIZER") != "" {
+		v := os.Getenv(prefix + "KAFKA_SERIALIZER")
+		d.Serializer = &v
+	}
+	if os.Getenv(prefix+"KAFKA_SCHEMA_REGISTRY_URL") != "" {
+		v := os.Getenv(prefix + "KAFKA_SCHEMA_REGISTRY_URL")
+		d.SchemaRegistryURL = &v
+	}
+	if os.Getenv(prefix+"KAFKA_SCHEMA_REGISTRY_USERNAME") != "" {
+		v := os.Getenv(prefix + "KAFKA_SCHEMA_REGISTRY_USERNAME")
+		d.SchemaRegistryUsername = &v
+	}
+	if os.Getenv(prefix+"KAFKA_SCHEMA_REGISTRY_PASSWORD") != "" {
+		v := os.Getenv(prefix + "KAFKA_SCHEMA_REGISTRY_PASSWORD")
+		d.SchemaRegistryPassword = &v
+	}
+	if os.Getenv(prefix+"KAFKA_SCHEMA_SUBJECT") != "" {
+		v := os.Getenv(prefix + "KAFKA_SCHEMA_SUBJECT")
+		d.SchemaSubject = &v
+	}
+	if os.Getenv(prefix+"KAFKA_SCHEMA_FILE") != "" {
+		v := os.Getenv(prefix + "KAFKA_SCHEMA_FILE")
+		d.SchemaFile = &v
+	}
+	if os.Getenv(prefix+"KAFKA_SCHEMA_ID") != "" {
+		v, err := strconv.Atoi(os.Getenv(prefix + "KAFKA_SCHEMA_ID"))
+		if err != nil {
+			l.WithError(err).Error("Failed to parse KAFKA_SCHEMA_ID")
+			return err
+		}
+		d.SchemaID = &v
+	}
+	if os.Getenv(prefix+"KAFKA_SCHEMA_MESSAGE") != "" {
+		v := os.Getenv(prefix + "KAFKA_SCHEMA_MESSAGE")
+		d.SchemaMessage = &v
+	}
+	if os.Getenv(prefix+"KAFKA_TRANSACTIONAL_ID") != "" {
+		v := os.Getenv(prefix + "KAFKA_TRANSACTIONAL_ID")
+		d.TransactionalID = &v
+	}
 	if os.Getenv(prefix+"KAFKA_ENABLE_TLS") != "" {
 		v := os.Getenv(prefix+"KAFKA_ENABLE_TLS") == "true"
 		d.EnableTLS = &v
@@ -91,6 +271,30 @@ func (d *Kafka) LoadEnv(prefix string) error {
 		v := os.Getenv(prefix + "KAFKA_SASL_PASSWORD")
 		d.Password = &v
 	}
+	if os.Getenv(prefix+"KAFKA_SASL_OAUTH_TOKEN") != "" {
+		v := os.Getenv(prefix + "KAFKA_SASL_OAUTH_TOKEN")
+		d.OAuthToken = &v
+	}
+	if os.Getenv(prefix+"KAFKA_SASL_OAUTH_TOKEN_URL") != "" {
+		v := os.Getenv(prefix + "KAFKA_SASL_OAUTH_TOKEN_URL")
+		d.OAuthTokenURL = &v
+	}
+	if os.Getenv(prefix+"KAFKA_SASL_OAUTH_CLIENT_ID") != "" {
+		v := os.Getenv(prefix + "KAFKA_SASL_OAUTH_CLIENT_ID")
+		d.OAuthClientID = &v
+	}
+	if os.Getenv(prefix+"KAFKA_SASL_OAUTH_CLIENT_SECRET") != "" {
+		v := os.Getenv(prefix + "KAFKA_SASL_OAUTH_CLIENT_SECRET")
+		d.OAuthClientSecret = &v
+	}
+	if os.Getenv(prefix+"KAFKA_SASL_OAUTH_SCOPES") != "" {
+		v := os.Getenv(prefix + "KAFKA_SASL_OAUTH_SCOPES")
+		d.OAuthScopes = &v
+	}
+	if os.Getenv(prefix+"KAFKA_SASL_AWS_REGION") != "" {
+		v := os.Getenv(prefix + "KAFKA_SASL_AWS_REGION")
+		d.AWSRegion = &v
+	}
 	l.Debug("Loaded environment")
 	return nil
 }
@@ -106,6 +310,25 @@ func (d *Kafka) LoadFlags() error {
 		d.Brokers = strings.Split(b, ",")
 	}
 	d.Topic = flags.KafkaTopic
+	d.Key = flags.KafkaKey
+	d.Partitioner = flags.KafkaPartitioner
+	d.Partition = flags.KafkaPartition
+	d.RequiredAcks = flags.KafkaRequiredAcks
+	d.Compression = flags.KafkaCompression
+	d.BatchSize = flags.KafkaBatchSize
+	d.BatchTimeout = flags.KafkaBatchTimeout
+	d.BatchBytes = flags.KafkaBatchBytes
+	d.WriteTimeout = flags.KafkaWriteTimeout
+	d.Group = flags.KafkaGroup
+	d.Serializer = flags.KafkaSerializer
+	d.SchemaRegistryURL = flags.KafkaSchemaRegistryURL
+	d.SchemaRegistryUsername = flags.KafkaSchemaRegistryUsername
+	d.SchemaRegistryPassword = flags.KafkaSchemaRegistryPassword
+	d.SchemaSubject = flags.KafkaSchemaSubject
+	d.SchemaFile = flags.KafkaSchemaFile
+	d.SchemaID = flags.KafkaSchemaID
+	d.SchemaMessage = flags.KafkaSchemaMessage
+	d.TransactionalID = flags.KafkaTransactionalID
 	d.EnableTLS = flags.KafkaEnableTLS
 	d.TLSInsecure = flags.KafkaTLSInsecure
 	d.TLSCert = flags.KafkaCertFile
@@ -118,6 +341,12 @@ func (d *Kafka) LoadFlags() error {
 	}
 	d.Username = flags.KafkaSaslUsername
 	d.Password = flags.KafkaSaslPassword
+	d.OAuthToken = flags.KafkaSaslOAuthToken
+	d.OAuthTokenURL = flags.KafkaSaslOAuthTokenURL
+	d.OAuthClientID = flags.KafkaSaslOAuthClientID
+	d.OAuthClientSecret = flags.KafkaSaslOAuthClientSecret
+	d.OAuthScopes = flags.KafkaSaslOAuthScopes
+	d.AWSRegion = flags.KafkaSaslAWSRegion
 	l.Debug("Loaded flags")
 	return nil
 }
@@ -128,39 +357,182 @@ func (d *Kafka) saslConfig() (sasl.Mechanism, error) {
 		"fn":  "saslConfig",
 	})
 	l.Debug("Loading SASL config")
+	var t SaslType
+	if d.SaslType != nil {
+		t = *d.SaslType
+	}
 	var m sasl.Mechanism
 	var err error
-	if d.SaslType != nil && *d.SaslType == SaslTypePlain {
+	switch t {
+	case "":
+		l.Debug("SASL type is NONE")
+		return nil, nil
+	case SaslTypePlain:
 		l.Debug("SASL type is PLAIN")
 		m = plain.Mechanism{
-			Username: *d.Username,
-			Password: *d.Password,
+			Username: value(d.Username),
+			Password: value(d.Password),
 		}
-	} else if d.SaslType != nil && *d.SaslType == SaslTypeScram {
-		l.Debug("SASL type is SCRAM")
-		m, err = scram.Mechanism(scram.SHA512, *d.Username, *d.Password)
-		if err != nil {
-			l.Error(err)
-			return nil, err
+	case SaslTypeScram, SaslTypeScramSHA512:
+		l.Debug("SASL type is SCRAM-SHA-512")
+		m, err = scram.Mechanism(scram.SHA512, value(d.Username), value(d.Password))
+	case SaslTypeScramSHA256:
+		l.Debug("SASL type is SCRAM-SHA-256")
+		m, err = scram.Mechanism(scram.SHA256, value(d.Username), value(d.Password))
+	case SaslTypeOAuthBearer:
+		l.Debug("SASL type is OAUTHBEARER")
+		var ts oauth2.TokenSource
+		if ts, err = d.tokenSource(); err == nil {
+			m = oauthBearer{ts: ts}
 		}
-
-	} else {
-		l.Debug("SASL type is NONE")
-		return nil, nil
+	case SaslTypeAWSMSKIAM:
+		l.Debug("SASL type is AWS_MSK_IAM")
+		var creds *credentials.Credentials
+		var region string
+		if creds, region, err = d.awsCredentials(); err == nil {
+			m = &mskIAM{signer: v4.NewSigner(creds), region: region}
+		}
+	default:
+		err = fmt.Errorf("unknown SASL type %q", t)
+	}
+	if err != nil {
+		l.Error(err)
+		return nil, err
 	}
 	l.Debug("Loaded SASL config")
 	return m, nil
 }
 
+// partitionBalancer writes every message to one partition.
+type partitionBalancer int
+
+func (p partitionBalancer) Balance(msg kafka.Message, partitions ...int) int {
+	return int(p)
+}
+
+// balancer returns the balancer of the partitioner and partition.
+func (d *Kafka) balancer() (kafka.Balancer, error) {
+	if d.Partition != nil && *d.Partition >= 0 {
+		return partitionBalancer(*d.Partition), nil
+	}
+	var p string
+	if d.Partitioner != nil {
+		p = *d.Partitioner
+	}
+	switch p {
+	case "", PartitionerLeastBytes:
+		return &kafka.LeastBytes{}, nil
+	case PartitionerHash:
+		return &kafka.Hash{}, nil
+	case PartitionerMurmur2:
+		return kafka.Murmur2Balancer{}, nil
+	case PartitionerCRC32:
+		return kafka.CRC32Balancer{}, nil
+	case PartitionerRoundRobin:
+		return &kafka.RoundRobin{}, nil
+	}
+	return nil, fmt.Errorf("unknown partitioner %q", p)
+}
+
+// producerConfig applies the acks, compression, batch and timeout options
+// to the writer.
+func (d *Kafka) producerConfig(w *kafka.Writer) error {
+	if d.RequiredAcks != nil {
+		switch *d.RequiredAcks {
+		case "", "all":
+			w.RequiredAcks = kafka.RequireAll
+		case "one":
+			w.RequiredAcks = kafka.RequireOne
+		case "none":
+			w.RequiredAcks = kafka.RequireNone
+		default:
+			return fmt.Errorf("unknown required acks %q", *d.RequiredAcks)
+		}
+	}
+	if d.Compression != nil {
+		switch *d.Compression {
+		case "", "none":
+		case "gzip":
+			w.Compression = kafka.Gzip
+		case "snappy":
+			w.Compression = kafka.Snappy
+		case "lz4":
+			w.Compression = kafka.Lz4
+		case "zstd":
+			w.Compression = kafka.Zstd
+		default:
+			return fmt.Errorf("unknown compression %q", *d.Compression)
+		}
+	}
+	if d.BatchSize != nil && *d.BatchSize > 0 {
+		w.BatchSize = *d.BatchSize
+	}
+	if d.BatchBytes != nil && *d.BatchBytes > 0 {
+		w.BatchBytes = int64(*d.BatchBytes)
+	}
+	if d.BatchTimeout != nil && *d.BatchTimeout != "" {
+		t, err := time.ParseDuration(*d.BatchTimeout)
+		if err != nil {
+			return err
+		}
+		w.BatchTimeout = t
+	}
+	if d.WriteTimeout != nil && *d.WriteTimeout != "" {
+		t, err := time.ParseDuration(*d.WriteTimeout)
+		if err != nil {
+			return err
+		}
+		w.WriteTimeout = t
+	}
+	return nil
+}
+
+// serializerConfig checks the serializer options, and creates the
+// registry client if a serializer is set.
+func (d *Kafka) serializerConfig() error {
+	if d.Serializer == nil || *d.Serializer == "" {
+		return nil
+	}
+	if _, ok := serializerSchemaTypes[*d.Serializer]; !ok {
+		return fmt.Errorf("unknown serializer %q", *d.Serializer)
+	}
+	if d.SchemaRegistryURL == nil || *d.SchemaRegistryURL == "" {
+		return errors.New("schema registry url is required with a serializer")
+	}
+	hasID := d.SchemaID != nil && *d.SchemaID > 0
+	if d.subject() == "" && !hasID {
+		return errors.New("schema subject or topic is required with a serializer")
+	}
+	var username, password string
+	if d.SchemaRegistryUsername != nil {
+		username = *d.SchemaRegistryUsername
+	}
+	if d.SchemaRegistryPassword != nil {
+		password = *d.SchemaRegistryPassword
+	}
+	d.registry = newRegistry(*d.SchemaRegistryURL, username, password)
+	d.serializers = make(map[int]*serializer)
+	return nil
+}
+
 func (d *Kafka) Init() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "kafka",
 		"fn":  "Init",
 	})
 	l.Debug("Initializing kafka driver")
+	b, err := d.balancer()
+	if err != nil {
+		l.Error(err)
+		return err
+	}
+	if err := d.serializerConfig(); err != nil {
+		l.Error(err)
+		return err
+	}
 	kc := kafka.WriterConfig{
 		Brokers:  d.Brokers,
-		Balancer: &kafka.LeastBytes{},
+		Balancer: b,
 	}
 	if d.Topic != nil {
 		kc.Topic = *d.Topic
@@ -168,6 +540,7 @@ func (d *Kafka) Init() error {
 	dialer := &kafka.Dialer{
 		Timeout:   10 * time.Second,
 		DualStack: true,
+		DialFunc:  utils.Dialer{}.DialContext,
 	}
 	if d.EnableTLS != nil && *d.EnableTLS {
 		tc, err := utils.TlsConfig(d.EnableTLS, d.TLSInsecure, d.TLSCA, d.TLSCert, d.TLSKey)
@@ -181,16 +554,42 @@ func (d *Kafka) Init() error {
 		if err != nil {
 			return err
 		}
-		if m != nil {
-			kc.Dialer.SASLMechanism = m
-		}
+		dialer.SASLMechanism = m
 	}
 	kc.Dialer = dialer
-	d.Client = kafka.NewWriter(kc)
+	d.dialer = dialer
+	if d.Transactional() {
+		if err := d.initTx(); err != nil {
+			l.Error(err)
+			return err
+		}
+		return nil
+	}
+	w := kafka.NewWriter(kc)
+	// the writer dials with its transport, rather than the dialer
+	if t, ok := w.Transport.(*kafka.Transport); ok {
+		t.Dial = dialer.DialFunc
+	}
+	if err := d.producerConfig(w); err != nil {
+		l.Error(err)
+		w.Close()
+		return err
+	}
+	d.Client = w
 	return nil
 }
 
+// CloudEventsBinding returns the CloudEvents protocol binding of the driver.
+func (d *Kafka) CloudEventsBinding() string {
+	return "kafka"
+}
+
 func (d *Kafka) Push(r io.Reader) error {
+	return d.PushMeta(r, nil)
+}
+
+// PushMeta pushes r with meta set as message headers.
+func (d *Kafka) PushMeta(r io.Reader, meta map[string]string) error {
 	l := log.WithFields(log.Fields{
 		"pkg": "kafka",
 		"fn":  "Push",
@@ -203,22 +602,101 @@ func (d *Kafka) Push(r io.Reader) error {
 	m := kafka.Message{
 		Value: bd,
 	}
+	for k, v := range meta {
+		m.Headers = append(m.Headers, kafka.Header{Key: k, Value: []byte(v)})
+	}
 	if d.Key != nil && *d.Key != "" {
-		m.Key = []byte(*d.Key)
+		key := *d.Key
+		if strings.Contains(key, "{{") {
+			key = schema.ReplaceParamsString(bd, key)
+		}
+		m.Key = []byte(key)
+	}
+	if m.Value, err = d.Serialize(bd); err != nil {
+		l.WithError(err).Error("Failed to serialize message")
+		return err
+	}
+	if d.txClient != nil {
+		if err := d.produce(m); err != nil {
+			l.WithError(err).Error("Failed to write message")
+			return err
+		}
+		l.Debug("Pushed to kafka")
+		return nil
 	}
 	if err := d.Client.WriteMessages(context.Background(), m); err != nil {
+		err = writeError(err)
+		l.WithError(err).Error("Failed to write message")
 		return err
 	}
 	l.Debug("Pushed to kafka")
 	return nil
 }
 
+// writeError returns the error of the written message, which is permanent
+// if Kafka rejected it with an error which is not temporary, such as a
+// message which is too large.
+func writeError(err error) error {
+	var werrs kafka.WriteErrors
+	if errors.As(err, &werrs) {
+		for _, e := range werrs {
+			if e != nil {
+				err = e
+				break
+			}
+		}
+	}
+	var kerr kafka.Error
+	if errors.As(err, &kerr) && !kerr.Temporary() {
+		return utils.Permanent(err)
+	}
+	return err
+}
+
+func (d *Kafka) Check() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "kafka",
+		"fn":  "Check",
+	})
+	l.Debug("Checking kafka connection")
+	if len(d.Brokers) == 0 {
+		return errors.New("no brokers configured")
+	}
+	if d.Topic == nil || *d.Topic == "" {
+		return errors.New("no topic configured")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := d.dialer.DialContext(ctx, "tcp", d.Brokers[0])
+	if err != nil {
+		l.Error(err)
+		return err
+	}
+	defer conn.Close()
+	ps, err := conn.ReadPartitions(*d.Topic)
+	if err != nil {
+		l.Error(err)
+		return err
+	}
+	l.Debugf("topic %s has %d partitions", *d.Topic, len(ps))
+	return nil
+}
+
 func (d *Kafka) Cleanup() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "kafka",
 		"fn":  "Cleanup",
 	})
 	l.Debug("Cleaning up")
+	if err := d.closeReader(); err != nil {
+		return err
+	}
+	if d.txClient != nil {
+		d.txClient.Close()
+	}
+	if d.Client == nil {
+		return nil
+	}
 	if err := d.Client.Close(); err != nil {
 		l.Error(err)
 		return err
@@ -0,0 +1,195 @@
+package kafka_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pushxkafka "github.com/robertlestak/pushx/drivers/kafka"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+)
+
+func str(s string) *string {
+	return &s
+}
+
+func TestProducerConfig(t *testing.T) {
+	batchBytes := 2 << 20
+	d := &pushxkafka.Kafka{
+		Brokers:      []string{"localhost:9092"},
+		Topic:        str("pushx"),
+		Partitioner:  str(pushxkafka.PartitionerMurmur2),
+		RequiredAcks: str("one"),
+		Compression:  str("zstd"),
+		BatchTimeout: str("10ms"),
+		BatchBytes:   &batchBytes,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Cleanup()
+	w := d.Client
+	if _, ok := w.Balancer.(kafka.Murmur2Balancer); !ok {
+		t.Errorf("got balancer %T, want murmur2", w.Balancer)
+	}
+	if w.RequiredAcks != kafka.RequireOne {
+		t.Errorf("got required acks %v, want one", w.RequiredAcks)
+	}
+	if w.Compression != kafka.Zstd {
+		t.Errorf("got compression %v, want zstd", w.Compression)
+	}
+	if w.BatchTimeout != 10*time.Millisecond {
+		t.Errorf("got batch timeout %s, want 10ms", w.BatchTimeout)
+	}
+	if w.BatchBytes != 2<<20 {
+		t.Errorf("got batch bytes %d, want %d", w.BatchBytes, 2<<20)
+	}
+
+	partition := 3
+	d = &pushxkafka.Kafka{Brokers: []string{"localhost:9092"}, Partition: &partition}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Cleanup()
+	if p := d.Client.Balancer.Balance(kafka.Message{}, 0, 1, 2, 3); p != 3 {
+		t.Errorf("got partition %d, want 3", p)
+	}
+	if d.Client.RequiredAcks != kafka.RequireAll {
+		t.Errorf("got default required acks %v, want all", d.Client.RequiredAcks)
+	}
+}
+
+func TestProducerConfigErrors(t *testing.T) {
+	for name, d := range map[string]*pushxkafka.Kafka{
+		"partitioner": {Partitioner: str("random")},
+		"acks":        {RequiredAcks: str("two")},
+		"compression": {Compression: str("brotli")},
+		"timeout":     {WriteTimeout: str("soon")},
+	} {
+		d.Brokers = []string{"localhost:9092"}
+		if err := d.Init(); err == nil {
+			d.Cleanup()
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+func TestTransactionalConfig(t *testing.T) {
+	d := &pushxkafka.Kafka{
+		Brokers:         []string{"localhost:9092"},
+		Topic:           str("pushx"),
+		TransactionalID: str("pushx-test"),
+		Partitioner:     str(pushxkafka.PartitionerMurmur2),
+		Compression:     str("zstd"),
+	}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Cleanup()
+	if !d.Transactional() {
+		t.Error("got not transactional")
+	}
+	if d.Client != nil {
+		t.Error("got a non-transactional writer")
+	}
+	// transactions are only committed with acknowledgements of all
+	// replicas
+	d = &pushxkafka.Kafka{
+		Brokers:         []string{"localhost:9092"},
+		TransactionalID: str("pushx-test"),
+		RequiredAcks:    str("one"),
+	}
+	if err := d.Init(); err == nil {
+		d.Cleanup()
+		t.Error("got no error for transactions with one required ack")
+	}
+	d = &pushxkafka.Kafka{Brokers: []string{"localhost:9092"}}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Cleanup()
+	if d.Transactional() {
+		t.Error("got transactional without a transactional id")
+	}
+	if err := d.Begin(); err == nil {
+		t.Error("got no error beginning a transaction without a transactional id")
+	}
+}
+
+// TestConformance runs the suite against a fake cluster which requires
+// SASL, so that the writer must authenticate with the dialer it is
+// configured with.
+func TestConformance(t *testing.T) {
+	c, err := kfake.NewCluster(
+		kfake.NumBrokers(1),
+		kfake.SeedTopics(1, "pushx"),
+		kfake.EnableSASL(),
+		kfake.Superuser("PLAIN", "user", "pass"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	addr := c.ListenAddrs()[0]
+	cl, err := kgo.NewClient(
+		kgo.SeedBrokers(addr),
+		kgo.SASL(plain.Auth{User: "user", Pass: "pass"}.AsMechanism()),
+		kgo.ConsumeTopics("pushx"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	var received []*kgo.Record
+	driverstest.Run(t, driverstest.Case{
+		New: func() drivers.Driver { return &pushxkafka.Kafka{} },
+		Flags: map[string]string{
+			"kafka-brokers":       addr,
+			"kafka-topic":         "pushx",
+			"kafka-batch-bytes":   "2097152",
+			"kafka-batch-timeout": "10ms",
+			"kafka-enable-sasl":   "true",
+			"kafka-sasl-type":     "plain",
+			"kafka-sasl-username": "user",
+			"kafka-sasl-password": "pass",
+		},
+		Env: map[string]string{
+			"KAFKA_BROKERS":       addr,
+			"KAFKA_TOPIC":         "pushx",
+			"KAFKA_BATCH_BYTES":   "2097152",
+			"KAFKA_BATCH_TIMEOUT": "10ms",
+			"KAFKA_ENABLE_SASL":   "true",
+			"KAFKA_SASL_TYPE":     "plain",
+			"KAFKA_SASL_USERNAME": "user",
+			"KAFKA_SASL_PASSWORD": "pass",
+		},
+		BadEnv: map[string]string{
+			"KAFKA_BROKERS":       addr,
+			"KAFKA_TOPIC":         "pushx",
+			"KAFKA_WRITE_TIMEOUT": "1s",
+			"KAFKA_ENABLE_SASL":   "true",
+			"KAFKA_SASL_TYPE":     "plain",
+			"KAFKA_SASL_USERNAME": "user",
+			"KAFKA_SASL_PASSWORD": "wrong",
+		},
+		Received: func(t *testing.T) []byte {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			for len(received) == 0 {
+				fs := cl.PollFetches(ctx)
+				if err := fs.Err0(); err != nil {
+					t.Fatalf("poll: %v", err)
+				}
+				received = append(received, fs.Records()...)
+			}
+			r := received[0]
+			received = received[1:]
+			return r.Value
+		},
+	})
+}
@@ -0,0 +1,165 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robertlestak/pushx/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// Schema types of the Schema Registry REST API.
+const (
+	schemaTypeAvro     = "AVRO"
+	schemaTypeProtobuf = "PROTOBUF"
+	schemaTypeJSON     = "JSON"
+)
+
+// registeredSchema is a schema of the registry.
+type registeredSchema struct {
+	ID         int    `json:"id"`
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+// registry is a client of a Schema Registry compatible REST API, which
+// caches the schemas it looks up or registers.
+type registry struct {
+	url      string
+	username string
+	password string
+	client   *http.Client
+
+	mu      sync.Mutex
+	schemas map[string]*registeredSchema
+}
+
+func newRegistry(u, username, password string) *registry {
+	return &registry{
+		url:      strings.TrimSuffix(u, "/"),
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		schemas:  make(map[string]*registeredSchema),
+	}
+}
+
+// do sends the request and decodes the response into v. Client errors,
+// such as an incompatible or invalid schema, are permanent.
+func (r *registry) do(method, path string, body any, v any) error {
+	var bd []byte
+	if body != nil {
+		var err error
+		if bd, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, r.url+path, bytes.NewReader(bd))
+	if err != nil {
+		return utils.Permanent(err)
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	}
+	if r.username != "" || r.password != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	bd, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Code    int    `json:"error_code"`
+			Message string `json:"message"`
+		}
+		err := fmt.Errorf("schema registry %s %s: %s", method, path, resp.Status)
+		if json.Unmarshal(bd, &e) == nil && e.Message != "" {
+			err = fmt.Errorf("schema registry %s %s: %s (%d)", method, path, e.Message, e.Code)
+		}
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return utils.Permanent(err)
+		}
+		return err
+	}
+	return json.Unmarshal(bd, v)
+}
+
+// cached returns the schema cached with key, or calls get and caches its
+// schema.
+func (r *registry) cached(key string, get func() (*registeredSchema, error)) (*registeredSchema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.schemas[key]; ok {
+		return s, nil
+	}
+	s, err := get()
+	if err != nil {
+		return nil, err
+	}
+	r.schemas[key] = s
+	return s, nil
+}
+
+// register registers the schema under the subject, if it is not already,
+// and returns it with its ID.
+func (r *registry) register(subject, schemaType, schema string) (*registeredSchema, error) {
+	l := log.WithFields(log.Fields{
+		"pkg":     "kafka",
+		"fn":      "register",
+		"subject": subject,
+	})
+	return r.cached("register:"+subject+":"+schema, func() (*registeredSchema, error) {
+		req := struct {
+			Schema     string `json:"schema"`
+			SchemaType string `json:"schemaType,omitempty"`
+		}{Schema: schema}
+		if schemaType != schemaTypeAvro {
+			// AVRO is the default, which older registries do not accept
+			req.SchemaType = schemaType
+		}
+		var res registeredSchema
+		if err := r.do(http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", req, &res); err != nil {
+			l.WithError(err).Error("Failed to register schema")
+			return nil, err
+		}
+		l.WithField("id", res.ID).Debug("Registered schema")
+		return &registeredSchema{ID: res.ID, Schema: schema, SchemaType: schemaType}, nil
+	})
+}
+
+// latest returns the latest schema of the subject.
+func (r *registry) latest(subject string) (*registeredSchema, error) {
+	return r.cached("latest:"+subject, func() (*registeredSchema, error) {
+		var s registeredSchema
+		if err := r.do(http.MethodGet, "/subjects/"+url.PathEscape(subject)+"/versions/latest", nil, &s); err != nil {
+			return nil, err
+		}
+		return &s, nil
+	})
+}
+
+// byID returns the schema with the ID.
+func (r *registry) byID(id int) (*registeredSchema, error) {
+	return r.cached(fmt.Sprintf("id:%d", id), func() (*registeredSchema, error) {
+		var s registeredSchema
+		if err := r.do(http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &s); err != nil {
+			return nil, err
+		}
+		s.ID = id
+		return &s, nil
+	})
+}
@@ -0,0 +1,148 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/robertlestak/pushx/pkg/utils"
+	"github.com/segmentio/kafka-go/sasl"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// value returns the value of p, or "" if it is nil.
+func value(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
+// tokenSource returns the OAUTHBEARER token source: the static token, or
+// tokens fetched with the client credentials grant, which are reused
+// until they expire.
+func (d *Kafka) tokenSource() (oauth2.TokenSource, error) {
+	if t := value(d.OAuthToken); t != "" {
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: t}), nil
+	}
+	if value(d.OAuthTokenURL) == "" {
+		return nil, errors.New("oauth token or token url is required for oauthbearer")
+	}
+	cc := &clientcredentials.Config{
+		ClientID:     value(d.OAuthClientID),
+		ClientSecret: value(d.OAuthClientSecret),
+		TokenURL:     *d.OAuthTokenURL,
+	}
+	if s := value(d.OAuthScopes); s != "" {
+		cc.Scopes = strings.Split(s, ",")
+	}
+	return cc.TokenSource(context.Background()), nil
+}
+
+// oauthBearer is the OAUTHBEARER SASL mechanism of RFC 7628.
+type oauthBearer struct {
+	ts oauth2.TokenSource
+}
+
+func (m oauthBearer) Name() string {
+	return "OAUTHBEARER"
+}
+
+func (m oauthBearer) Start(ctx context.Context) (sasl.StateMachine, []byte, error) {
+	tok, err := m.ts.Token()
+	if err != nil {
+		return nil, nil, fmt.Errorf("oauth token: %w", err)
+	}
+	return m, []byte("n,,\x01auth=Bearer " + tok.AccessToken + "\x01\x01"), nil
+}
+
+// Next completes the authentication. The server only challenges a failed
+// authentication, with the error as a JSON object.
+func (m oauthBearer) Next(ctx context.Context, challenge []byte) (bool, []byte, error) {
+	if len(challenge) > 0 {
+		return false, nil, fmt.Errorf("oauthbearer authentication failed: %s", challenge)
+	}
+	return true, nil, nil
+}
+
+// awsCredentials returns the credentials of the default AWS credential
+// chain, and the region of the cluster.
+func (d *Kafka) awsCredentials() (*credentials.Credentials, string, error) {
+	region := value(d.AWSRegion)
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return nil, "", errors.New("aws region is required for aws-msk-iam")
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Region:     aws.String(region),
+		HTTPClient: utils.HTTPClient(),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return sess.Config.Credentials, region, nil
+}
+
+// mskIAM is the AWS_MSK_IAM SASL mechanism of Amazon MSK, which
+// authenticates with a presigned kafka-cluster:Connect request.
+type mskIAM struct {
+	signer *v4.Signer
+	region string
+}
+
+func (m *mskIAM) Name() string {
+	return "AWS_MSK_IAM"
+}
+
+func (m *mskIAM) Start(ctx context.Context) (sasl.StateMachine, []byte, error) {
+	md := sasl.MetadataFromContext(ctx)
+	if md == nil {
+		return nil, nil, errors.New("aws-msk-iam: no broker host")
+	}
+	bd, err := m.payload(md.Host, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, bd, nil
+}
+
+// Next completes the authentication. The server responds to the payload
+// with its version and request ID, or fails the authentication.
+func (m *mskIAM) Next(ctx context.Context, challenge []byte) (bool, []byte, error) {
+	return true, nil, nil
+}
+
+// payload returns the authentication payload for the broker host, which
+// is the query of the presigned request as a JSON object.
+func (m *mskIAM) payload(host string, t time.Time) ([]byte, error) {
+	q := url.Values{"Action": {"kafka-cluster:Connect"}}
+	req, err := http.NewRequest(http.MethodGet, "https://"+host+"/?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.signer.Presign(req, nil, "kafka-cluster", m.region, 15*time.Minute, t); err != nil {
+		return nil, fmt.Errorf("aws-msk-iam: %w", err)
+	}
+	p := map[string]string{
+		"version":    "2020_10_22",
+		"host":       host,
+		"user-agent": "pushx",
+	}
+	for k, v := range req.URL.Query() {
+		p[strings.ToLower(k)] = v[0]
+	}
+	return json.Marshal(p)
+}
@@ -0,0 +1,355 @@
+package kafka_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	pushxkafka "github.com/robertlestak/pushx/drivers/kafka"
+	"github.com/xdg-go/scram"
+)
+
+// Kafka API keys of the fake broker.
+const (
+	apiMetadata         = 3
+	apiSaslHandshake    = 17
+	apiApiVersions      = 18
+	apiSaslAuthenticate = 36
+)
+
+// saslBroker is a fake Kafka broker which performs the SASL handshake and
+// authentication with auth, and then serves the metadata of one topic.
+type saslBroker struct {
+	mechanism string
+	// auth returns the challenge to the client data, or the error message
+	// of a failed authentication.
+	auth func(data []byte) ([]byte, string)
+
+	mu            sync.Mutex
+	authenticated bool
+}
+
+func (b *saslBroker) start(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(c, ln.Addr().(*net.TCPAddr).Port)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// kafkaWriter encodes Kafka protocol primitives.
+type kafkaWriter struct {
+	bytes.Buffer
+}
+
+func (w *kafkaWriter) int16(v int16) { binary.Write(w, binary.BigEndian, v) }
+func (w *kafkaWriter) int32(v int32) { binary.Write(w, binary.BigEndian, v) }
+func (w *kafkaWriter) string(s string) {
+	w.int16(int16(len(s)))
+	w.WriteString(s)
+}
+func (w *kafkaWriter) bytes(b []byte) {
+	w.int32(int32(len(b)))
+	w.Write(b)
+}
+
+func readString(r *bytes.Reader) string {
+	var n int16
+	binary.Read(r, binary.BigEndian, &n)
+	if n < 0 {
+		return ""
+	}
+	b := make([]byte, n)
+	io.ReadFull(r, b)
+	return string(b)
+}
+
+func (b *saslBroker) serve(c net.Conn, port int) {
+	defer c.Close()
+	for {
+		var size int32
+		if err := binary.Read(c, binary.BigEndian, &size); err != nil {
+			return
+		}
+		req := make([]byte, size)
+		if _, err := io.ReadFull(c, req); err != nil {
+			return
+		}
+		r := bytes.NewReader(req)
+		var key, version int16
+		var id int32
+		binary.Read(r, binary.BigEndian, &key)
+		binary.Read(r, binary.BigEndian, &version)
+		binary.Read(r, binary.BigEndian, &id)
+		readString(r)
+		var w kafkaWriter
+		w.int32(id)
+		switch key {
+		case apiApiVersions:
+			w.int16(0)
+			w.int32(4)
+			for _, v := range [][3]int16{{apiMetadata, 0, 1}, {apiSaslHandshake, 0, 1}, {apiApiVersions, 0, 0}, {apiSaslAuthenticate, 0, 0}} {
+				w.int16(v[0])
+				w.int16(v[1])
+				w.int16(v[2])
+			}
+		case apiSaslHandshake:
+			if readString(r) != b.mechanism {
+				// UNSUPPORTED_SASL_MECHANISM
+				w.int16(33)
+			} else {
+				w.int16(0)
+			}
+			w.int32(1)
+			w.string(b.mechanism)
+		case apiSaslAuthenticate:
+			var n int32
+			binary.Read(r, binary.BigEndian, &n)
+			data := make([]byte, n)
+			io.ReadFull(r, data)
+			challenge, msg := b.auth(data)
+			if msg != "" {
+				// SASL_AUTHENTICATION_FAILED
+				w.int16(58)
+				w.string(msg)
+				w.bytes(nil)
+				break
+			}
+			w.int16(0)
+			w.int16(-1)
+			w.bytes(challenge)
+			b.mu.Lock()
+			b.authenticated = true
+			b.mu.Unlock()
+		case apiMetadata:
+			b.mu.Lock()
+			ok := b.authenticated
+			b.mu.Unlock()
+			if !ok {
+				return
+			}
+			w.int32(1)
+			w.int32(0)
+			w.string("127.0.0.1")
+			w.int32(int32(port))
+			w.int16(-1)
+			w.int32(0)
+			w.int32(1)
+			w.int16(0)
+			w.string("pushx")
+			w.WriteByte(0)
+			w.int32(1)
+			w.int16(0)
+			w.int32(0)
+			w.int32(0)
+			w.int32(1)
+			w.int32(0)
+			w.int32(1)
+			w.int32(0)
+		default:
+			return
+		}
+		var out kafkaWriter
+		out.bytes(w.Bytes())
+		if _, err := c.Write(out.Bytes()); err != nil {
+			return
+		}
+	}
+}
+
+func saslDriver(addr string, t pushxkafka.SaslType) *pushxkafka.Kafka {
+	enabled := true
+	return &pushxkafka.Kafka{
+		Brokers:    []string{addr},
+		Topic:      str("pushx"),
+		EnableSASL: &enabled,
+		SaslType:   &t,
+		Username:   str("user"),
+		Password:   str("pass"),
+	}
+}
+
+func checkSASL(t *testing.T, d *pushxkafka.Kafka) error {
+	t.Helper()
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Cleanup()
+	return d.Check()
+}
+
+func TestSASLPlain(t *testing.T) {
+	b := &saslBroker{
+		mechanism: "PLAIN",
+		auth: func(data []byte) ([]byte, string) {
+			if string(data) != "\x00user\x00pass" {
+				return nil, "invalid credentials"
+			}
+			return nil, ""
+		},
+	}
+	addr := b.start(t)
+	if err := checkSASL(t, saslDriver(addr, pushxkafka.SaslTypePlain)); err != nil {
+		t.Fatal(err)
+	}
+	d := saslDriver(addr, pushxkafka.SaslTypePlain)
+	d.Password = str("wrong")
+	if err := checkSASL(t, d); err == nil || !strings.Contains(err.Error(), "SASL") {
+		t.Errorf("got error %v, want SASL authentication failed", err)
+	}
+	// a mechanism the broker does not support fails the handshake
+	if err := checkSASL(t, saslDriver(addr, pushxkafka.SaslTypeScramSHA256)); err == nil {
+		t.Error("got no error for an unsupported mechanism")
+	}
+}
+
+func TestSASLScram(t *testing.T) {
+	for _, tc := range []struct {
+		typ       pushxkafka.SaslType
+		mechanism string
+		hash      scram.HashGeneratorFcn
+	}{
+		{pushxkafka.SaslTypeScram, "SCRAM-SHA-512", scram.SHA512},
+		{pushxkafka.SaslTypeScramSHA512, "SCRAM-SHA-512", scram.SHA512},
+		{pushxkafka.SaslTypeScramSHA256, "SCRAM-SHA-256", scram.SHA256},
+	} {
+		client, err := tc.hash.NewClient("user", "pass", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		creds := client.GetStoredCredentials(scram.KeyFactors{Salt: "salt", Iters: 4096})
+		srv, err := tc.hash.NewServer(func(string) (scram.StoredCredentials, error) {
+			return creds, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var conv *scram.ServerConversation
+		b := &saslBroker{
+			mechanism: tc.mechanism,
+			auth: func(data []byte) ([]byte, string) {
+				if conv == nil || conv.Done() {
+					conv = srv.NewConversation()
+				}
+				resp, err := conv.Step(string(data))
+				if err != nil {
+					return nil, err.Error()
+				}
+				return []byte(resp), ""
+			},
+		}
+		if err := checkSASL(t, saslDriver(b.start(t), tc.typ)); err != nil {
+			t.Errorf("%s: %v", tc.typ, err)
+		}
+		if conv == nil || !conv.Valid() {
+			t.Errorf("%s: got no valid scram conversation", tc.typ)
+		}
+	}
+}
+
+func TestSASLOAuthBearer(t *testing.T) {
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if r.FormValue("grant_type") != "client_credentials" || id != "client" || secret != "secret" || r.FormValue("scope") != "kafka a" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"token","token_type":"bearer","expires_in":3600}`))
+	}))
+	defer tokens.Close()
+	b := &saslBroker{
+		mechanism: "OAUTHBEARER",
+		auth: func(data []byte) ([]byte, string) {
+			if string(data) != "n,,\x01auth=Bearer token\x01\x01" {
+				return []byte(`{"status":"invalid_token"}`), ""
+			}
+			return nil, ""
+		},
+	}
+	addr := b.start(t)
+	d := saslDriver(addr, pushxkafka.SaslTypeOAuthBearer)
+	d.OAuthTokenURL = str(tokens.URL)
+	d.OAuthClientID = str("client")
+	d.OAuthClientSecret = str("secret")
+	d.OAuthScopes = str("kafka,a")
+	if err := checkSASL(t, d); err != nil {
+		t.Fatal(err)
+	}
+	d = saslDriver(addr, pushxkafka.SaslTypeOAuthBearer)
+	d.OAuthToken = str("expired")
+	if err := checkSASL(t, d); err == nil || !strings.Contains(err.Error(), "invalid_token") {
+		t.Errorf("got error %v, want invalid token", err)
+	}
+}
+
+func TestSASLAWSMSKIAM(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "session")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_SDK_LOAD_CONFIG", "")
+	var payload map[string]string
+	b := &saslBroker{
+		mechanism: "AWS_MSK_IAM",
+		auth: func(data []byte) ([]byte, string) {
+			if err := json.Unmarshal(data, &payload); err != nil {
+				return nil, err.Error()
+			}
+			return []byte(`{"version":"2020_10_22","request-id":"1"}`), ""
+		},
+	}
+	addr := b.start(t)
+	d := saslDriver(addr, pushxkafka.SaslTypeAWSMSKIAM)
+	if err := d.Init(); err == nil {
+		d.Cleanup()
+		t.Error("got no error without a region")
+	}
+	d.AWSRegion = str("eu-west-1")
+	if err := checkSASL(t, d); err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{
+		"version":              "2020_10_22",
+		"host":                 "127.0.0.1",
+		"action":               "kafka-cluster:Connect",
+		"x-amz-algorithm":      "AWS4-HMAC-SHA256",
+		"x-amz-expires":        "900",
+		"x-amz-signedheaders":  "host",
+		"x-amz-security-token": "session",
+	} {
+		if payload[k] != want {
+			t.Errorf("got %s %q, want %q", k, payload[k], want)
+		}
+	}
+	if c := payload["x-amz-credential"]; !strings.HasPrefix(c, "AKID/") || !strings.HasSuffix(c, "/eu-west-1/kafka-cluster/aws4_request") {
+		t.Errorf("got credential %q", c)
+	}
+	if sig, err := hex.DecodeString(payload["x-amz-signature"]); err != nil || len(sig) != 32 {
+		t.Errorf("got signature %q", payload["x-amz-signature"])
+	}
+}
+
+func TestSASLUnknownType(t *testing.T) {
+	if err := saslDriver("localhost:9092", "kerberos").Init(); err == nil {
+		t.Error("got no error for an unknown SASL type")
+	}
+}
@@ -0,0 +1,257 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/linkedin/goavro/v2"
+	"github.com/robertlestak/pushx/pkg/utils"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Serializers of the Kafka driver, which encode the JSON input in the
+// Confluent wire format with a schema of the schema registry.
+const (
+	SerializerAvro       = "avro"
+	SerializerProtobuf   = "protobuf"
+	SerializerJSONSchema = "json-schema"
+)
+
+// serializerSchemaTypes are the registry schema types of the serializers.
+var serializerSchemaTypes = map[string]string{
+	SerializerAvro:       schemaTypeAvro,
+	SerializerProtobuf:   schemaTypeProtobuf,
+	SerializerJSONSchema: schemaTypeJSON,
+}
+
+// serializer encodes JSON payloads with a registered schema.
+type serializer struct {
+	id int
+	// indexes are the message indexes of a Protobuf message in its file.
+	indexes []int
+	encode  func(bd []byte) ([]byte, error)
+}
+
+// serialize returns bd encoded in the Confluent wire format: a zero magic
+// byte, the big endian schema ID, the message indexes for Protobuf, and
+// the encoded payload.
+func (s *serializer) serialize(bd []byte) ([]byte, error) {
+	v, err := s.encode(bd)
+	if err != nil {
+		return nil, utils.Permanent(err)
+	}
+	b := make([]byte, 5, 5+len(v)+binary.MaxVarintLen64)
+	binary.BigEndian.PutUint32(b[1:], uint32(s.id))
+	if s.indexes != nil {
+		b = appendIndexes(b, s.indexes)
+	}
+	return append(b, v...), nil
+}
+
+// appendIndexes appends the zigzag varint encoded count and message
+// indexes, or a single 0 for the first message of the file.
+func appendIndexes(b []byte, indexes []int) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	if len(indexes) == 1 && indexes[0] == 0 {
+		return append(b, 0)
+	}
+	n := binary.PutVarint(buf[:], int64(len(indexes)))
+	b = append(b, buf[:n]...)
+	for _, i := range indexes {
+		n = binary.PutVarint(buf[:], int64(i))
+		b = append(b, buf[:n]...)
+	}
+	return b
+}
+
+// newAvroSerializer returns a serializer of the Avro schema. Unions are
+// accepted as plain JSON values, rather than wrapped in an object with
+// the name of their type.
+func newAvroSerializer(s *registeredSchema) (*serializer, error) {
+	codec, err := goavro.NewCodecForStandardJSONFull(s.Schema)
+	if err != nil {
+		return nil, err
+	}
+	return &serializer{
+		id: s.ID,
+		encode: func(bd []byte) ([]byte, error) {
+			native, _, err := codec.NativeFromTextual(bd)
+			if err != nil {
+				return nil, err
+			}
+			return codec.BinaryFromNative(nil, native)
+		},
+	}, nil
+}
+
+// newProtobufSerializer returns a serializer of the named message of the
+// Protobuf schema, or of its first message if name is empty.
+func newProtobufSerializer(s *registeredSchema, name string) (*serializer, error) {
+	p := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{"schema.proto": s.Schema}),
+	}
+	fds, err := p.ParseFiles("schema.proto")
+	if err != nil {
+		return nil, err
+	}
+	fd := fds[0]
+	var md protoreflect.MessageDescriptor
+	if name == "" {
+		if len(fd.GetMessageTypes()) == 0 {
+			return nil, errors.New("protobuf schema has no messages")
+		}
+		md = fd.GetMessageTypes()[0].UnwrapMessage()
+	} else {
+		m := fd.FindMessage(name)
+		if m == nil && fd.GetPackage() != "" {
+			m = fd.FindMessage(fd.GetPackage() + "." + name)
+		}
+		if m == nil {
+			return nil, fmt.Errorf("protobuf schema has no message %s", name)
+		}
+		md = m.UnwrapMessage()
+	}
+	var indexes []int
+	for d := protoreflect.Descriptor(md); ; d = d.Parent() {
+		if _, ok := d.(protoreflect.MessageDescriptor); !ok {
+			break
+		}
+		indexes = append([]int{d.Index()}, indexes...)
+	}
+	return &serializer{
+		id:      s.ID,
+		indexes: indexes,
+		encode: func(bd []byte) ([]byte, error) {
+			m := dynamicpb.NewMessage(md)
+			if err := protojson.Unmarshal(bd, m); err != nil {
+				return nil, err
+			}
+			// dynamic messages range over their fields in random order,
+			// unless deterministic, which orders them by number
+			return proto.MarshalOptions{Deterministic: true}.Marshal(m)
+		},
+	}, nil
+}
+
+// newJSONSchemaSerializer returns a serializer which validates the JSON
+// payload against the JSON Schema, and leaves it unchanged.
+func newJSONSchemaSerializer(s *registeredSchema) (*serializer, error) {
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource("schema.json", strings.NewReader(s.Schema)); err != nil {
+		return nil, err
+	}
+	sch, err := c.Compile("schema.json")
+	if err != nil {
+		return nil, err
+	}
+	return &serializer{
+		id: s.ID,
+		encode: func(bd []byte) ([]byte, error) {
+			dec := json.NewDecoder(bytes.NewReader(bd))
+			dec.UseNumber()
+			var v any
+			if err := dec.Decode(&v); err != nil {
+				return nil, err
+			}
+			if err := sch.Validate(v); err != nil {
+				return nil, err
+			}
+			return bd, nil
+		},
+	}, nil
+}
+
+// subject returns the registry subject of the message values, which
+// defaults to <topic>-value.
+func (d *Kafka) subject() string {
+	if d.SchemaSubject != nil && *d.SchemaSubject != "" {
+		return *d.SchemaSubject
+	}
+	if d.Topic != nil {
+		return *d.Topic + "-value"
+	}
+	return ""
+}
+
+// valueSerializer returns the serializer of the schema file registered
+// under the subject, or of the configured schema ID, or of the latest
+// schema of the subject.
+func (d *Kafka) valueSerializer() (*serializer, error) {
+	l := log.WithFields(log.Fields{
+		"pkg": "kafka",
+		"fn":  "valueSerializer",
+	})
+	schemaType := serializerSchemaTypes[*d.Serializer]
+	var s *registeredSchema
+	var err error
+	if d.SchemaFile != nil && *d.SchemaFile != "" {
+		bd, ferr := ioutil.ReadFile(*d.SchemaFile)
+		if ferr != nil {
+			return nil, utils.Permanent(ferr)
+		}
+		s, err = d.registry.register(d.subject(), schemaType, string(bd))
+	} else if d.SchemaID != nil && *d.SchemaID > 0 {
+		s, err = d.registry.byID(*d.SchemaID)
+	} else {
+		s, err = d.registry.latest(d.subject())
+	}
+	if err != nil {
+		l.WithError(err).Error("Failed to get schema")
+		return nil, err
+	}
+	d.serializersMu.Lock()
+	defer d.serializersMu.Unlock()
+	if ser, ok := d.serializers[s.ID]; ok {
+		return ser, nil
+	}
+	st := s.SchemaType
+	if st == "" {
+		st = schemaTypeAvro
+	}
+	if st != schemaType {
+		return nil, utils.Permanent(fmt.Errorf("schema %d is %s, not %s", s.ID, st, schemaType))
+	}
+	var ser *serializer
+	switch schemaType {
+	case schemaTypeAvro:
+		ser, err = newAvroSerializer(s)
+	case schemaTypeProtobuf:
+		var name string
+		if d.SchemaMessage != nil {
+			name = *d.SchemaMessage
+		}
+		ser, err = newProtobufSerializer(s, name)
+	case schemaTypeJSON:
+		ser, err = newJSONSchemaSerializer(s)
+	}
+	if err != nil {
+		l.WithError(err).Error("Failed to parse schema")
+		return nil, utils.Permanent(fmt.Errorf("schema %d: %w", s.ID, err))
+	}
+	d.serializers[s.ID] = ser
+	return ser, nil
+}
+
+// Serialize returns the message value of the JSON payload bd, which is bd
+// itself unless a serializer is configured.
+func (d *Kafka) Serialize(bd []byte) ([]byte, error) {
+	if d.registry == nil {
+		return bd, nil
+	}
+	s, err := d.valueSerializer()
+	if err != nil {
+		return nil, err
+	}
+	return s.serialize(bd)
+}
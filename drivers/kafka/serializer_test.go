@@ -0,0 +1,255 @@
+package kafka_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/linkedin/goavro/v2"
+	pushxkafka "github.com/robertlestak/pushx/drivers/kafka"
+	"github.com/robertlestak/pushx/pkg/utils"
+)
+
+// testRegistry is a Schema Registry stand-in.
+type testRegistry struct {
+	mu       sync.Mutex
+	schemas  map[int]map[string]string
+	latest   map[string]int
+	requests int
+}
+
+func newTestRegistry(t *testing.T) (*testRegistry, *httptest.Server) {
+	r := &testRegistry{
+		schemas: make(map[int]map[string]string),
+		latest:  make(map[string]int),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests++
+		if u, p, _ := req.BasicAuth(); u != "user" || p != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+		switch {
+		case req.Method == http.MethodPost && len(parts) == 3 && parts[2] == "versions":
+			var s map[string]string
+			if err := json.NewDecoder(req.Body).Decode(&s); err != nil {
+				t.Error(err)
+			}
+			json.NewEncoder(w).Encode(map[string]int{"id": r.add(parts[1], s)})
+		case len(parts) == 4 && parts[3] == "latest":
+			id, ok := r.latest[parts[1]]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"error_code":40401,"message":"Subject not found"}`)
+				return
+			}
+			s := map[string]any{"id": id}
+			for k, v := range r.schemas[id] {
+				s[k] = v
+			}
+			json.NewEncoder(w).Encode(s)
+		case len(parts) == 3 && parts[1] == "ids":
+			var id int
+			fmt.Sscan(parts[2], &id)
+			json.NewEncoder(w).Encode(r.schemas[id])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return r, srv
+}
+
+// add registers the schema under the subject, and returns its ID.
+func (r *testRegistry) add(subject string, s map[string]string) int {
+	id := len(r.schemas) + 1
+	r.schemas[id] = s
+	r.latest[subject] = id
+	return id
+}
+
+func (r *testRegistry) requestCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests
+}
+
+func serializerDriver(url, serializer string) *pushxkafka.Kafka {
+	d := &pushxkafka.Kafka{
+		Brokers:                []string{"localhost:9092"},
+		Topic:                  str("pushx"),
+		Serializer:             str(serializer),
+		SchemaRegistryURL:      str(url),
+		SchemaRegistryUsername: str("user"),
+		SchemaRegistryPassword: str("pass"),
+	}
+	return d
+}
+
+func initDriver(t *testing.T, d *pushxkafka.Kafka) {
+	t.Helper()
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Cleanup() })
+}
+
+func TestSerializeAvro(t *testing.T) {
+	reg, srv := newTestRegistry(t)
+	schema := `{"type":"record","name":"User","fields":[
+		{"name":"name","type":"string"},
+		{"name":"age","type":"int"},
+		{"name":"email","type":["null","string"],"default":null}]}`
+	f := filepath.Join(t.TempDir(), "user.avsc")
+	if err := os.WriteFile(f, []byte(schema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := serializerDriver(srv.URL, pushxkafka.SerializerAvro)
+	d.SchemaFile = &f
+	initDriver(t, d)
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for in, want := range map[string]string{
+		`{"name":"a","age":3,"email":"a@example.com"}`: `{"name":"a","age":3,"email":{"string":"a@example.com"}}`,
+		`{"name":"b","age":4,"email":null}`:            `{"name":"b","age":4,"email":null}`,
+	} {
+		v, err := d.Serialize([]byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h := v[:5]; !bytes.Equal(h, []byte{0, 0, 0, 0, 1}) {
+			t.Fatalf("got header %v, want schema 1", h)
+		}
+		native, _, err := codec.NativeFromBinary(v[5:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := codec.TextualFromNative(nil, native)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got, wantv any
+		json.Unmarshal(out, &got)
+		json.Unmarshal([]byte(want), &wantv)
+		if !reflect.DeepEqual(got, wantv) {
+			t.Errorf("got %s, want %s", out, want)
+		}
+	}
+	if n := reg.requestCount(); n != 1 {
+		t.Errorf("got %d registry requests, want the schema ID cached", n)
+	}
+	if s := reg.schemas[1]; s["schema"] != schema || s["schemaType"] != "" {
+		t.Errorf("got registered schema %v", s)
+	}
+	_, err = d.Serialize([]byte(`{"name":"c"}`))
+	var perr *utils.PushError
+	if !errors.As(err, &perr) || perr.Temporary() {
+		t.Errorf("got error %v, want a permanent error for an invalid payload", err)
+	}
+}
+
+func TestSerializeProtobuf(t *testing.T) {
+	reg, srv := newTestRegistry(t)
+	reg.add("orders-value", map[string]string{
+		"schemaType": "PROTOBUF",
+		"schema": `syntax = "proto3";
+package shop;
+message Customer { string id = 1; }
+message Order {
+	message Line { string sku = 1; int32 quantity = 2; }
+	string id = 1;
+}`,
+	})
+	for _, tc := range []struct {
+		message string
+		in      string
+		want    []byte
+	}{
+		{"", `{"id":"x"}`, []byte{0, 0x0a, 1, 'x'}},
+		{"shop.Order", `{"id":"x"}`, []byte{2, 2, 0x0a, 1, 'x'}},
+		{"Order.Line", `{"sku":"x","quantity":2}`, []byte{4, 2, 0, 0x0a, 1, 'x', 0x10, 2}},
+	} {
+		d := serializerDriver(srv.URL, pushxkafka.SerializerProtobuf)
+		d.SchemaSubject = str("orders-value")
+		d.SchemaMessage = str(tc.message)
+		initDriver(t, d)
+		v, err := d.Serialize([]byte(tc.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := append([]byte{0, 0, 0, 0, 1}, tc.want...); !bytes.Equal(v, want) {
+			t.Errorf("message %q: got %v, want %v", tc.message, v, want)
+		}
+	}
+}
+
+func TestSerializeJSONSchema(t *testing.T) {
+	reg, srv := newTestRegistry(t)
+	reg.add("other", map[string]string{"schema": `{"type":"record","name":"A","fields":[]}`})
+	reg.add("other", map[string]string{
+		"schemaType": "JSON",
+		"schema":     `{"type":"object","required":["id"],"properties":{"id":{"type":"integer"}}}`,
+	})
+	d := serializerDriver(srv.URL, pushxkafka.SerializerJSONSchema)
+	id := 2
+	d.SchemaID = &id
+	initDriver(t, d)
+	in := []byte(`{"id":1}`)
+	v, err := d.Serialize(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append([]byte{0, 0, 0, 0, 2}, in...); !bytes.Equal(v, want) {
+		t.Errorf("got %q, want %q", v, want)
+	}
+	if _, err := d.Serialize([]byte(`{"id":"1"}`)); err == nil {
+		t.Error("got no error for a payload which does not match the schema")
+	}
+
+	// an Avro schema does not serialize JSON Schema
+	id = 1
+	d = serializerDriver(srv.URL, pushxkafka.SerializerJSONSchema)
+	d.SchemaID = &id
+	initDriver(t, d)
+	if _, err := d.Serialize(in); err == nil || !strings.Contains(err.Error(), "AVRO") {
+		t.Errorf("got error %v, want a schema type mismatch", err)
+	}
+}
+
+func TestSerializerErrors(t *testing.T) {
+	_, srv := newTestRegistry(t)
+	d := serializerDriver(srv.URL, pushxkafka.SerializerAvro)
+	d.SchemaRegistryPassword = str("wrong")
+	initDriver(t, d)
+	if _, err := d.Serialize([]byte(`{}`)); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("got error %v, want unauthorized", err)
+	}
+	d = serializerDriver(srv.URL, pushxkafka.SerializerAvro)
+	initDriver(t, d)
+	if _, err := d.Serialize([]byte(`{}`)); err == nil || !strings.Contains(err.Error(), "Subject not found") {
+		t.Errorf("got error %v, want subject not found", err)
+	}
+	for name, d := range map[string]*pushxkafka.Kafka{
+		"serializer": serializerDriver(srv.URL, "thrift"),
+		"url":        serializerDriver("", pushxkafka.SerializerAvro),
+	} {
+		if err := d.Init(); err == nil {
+			d.Cleanup()
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
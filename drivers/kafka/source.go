@@ -0,0 +1,64 @@
+package kafka
+
+import (
+	"context"
+
+	kafka "github.com/segmentio/kafka-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// groupReader returns the consumer group reader of the topic, creating
+// it if needed.
+func (d *Kafka) groupReader() *kafka.Reader {
+	if d.reader != nil {
+		return d.reader
+	}
+	rc := kafka.ReaderConfig{
+		Brokers: d.Brokers,
+		GroupID: "pushx",
+		Dialer:  d.dialer,
+	}
+	if d.Topic != nil {
+		rc.Topic = *d.Topic
+	}
+	if d.Group != nil && *d.Group != "" {
+		rc.GroupID = *d.Group
+	}
+	d.reader = kafka.NewReader(rc)
+	return d.reader
+}
+
+// Receive fetches the next message of the topic with the consumer group.
+func (d *Kafka) Receive(ctx context.Context) ([]byte, any, error) {
+	m, err := d.groupReader().FetchMessage(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m.Value, m, nil
+}
+
+// Ack commits the offset of the message for the consumer group.
+func (d *Kafka) Ack(ref any) error {
+	return d.groupReader().CommitMessages(context.Background(), ref.(kafka.Message))
+}
+
+// Nack closes the reader, so that the next Receive resumes from the last
+// committed offset, receiving the message again.
+func (d *Kafka) Nack(ref any) error {
+	return d.closeReader()
+}
+
+func (d *Kafka) closeReader() error {
+	if d.reader == nil {
+		return nil
+	}
+	err := d.reader.Close()
+	d.reader = nil
+	if err != nil {
+		log.WithFields(log.Fields{
+			"pkg": "kafka",
+			"fn":  "closeReader",
+		}).Error(err)
+	}
+	return err
+}
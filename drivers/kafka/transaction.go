@@ -0,0 +1,322 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"net"
+	"time"
+
+	"github.com/robertlestak/pushx/pkg/utils"
+	kafka "github.com/segmentio/kafka-go"
+	log "github.com/sirupsen/logrus"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	saslaws "github.com/twmb/franz-go/pkg/sasl/aws"
+	"github.com/twmb/franz-go/pkg/sasl/oauth"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// txTimeout bounds flushing and ending a transaction.
+const txTimeout = time.Minute
+
+// Transactional reports whether a transactional ID is configured, in which
+// case messages are written with a transactional producer.
+func (d *Kafka) Transactional() bool {
+	return d.TransactionalID != nil && *d.TransactionalID != ""
+}
+
+// txPartitioner returns the partitioner of the transactional producer,
+// which partitions keys like the balancer of the partitioner.
+func (d *Kafka) txPartitioner() (kgo.Partitioner, error) {
+	if d.Partition != nil && *d.Partition >= 0 {
+		return kgo.ManualPartitioner(), nil
+	}
+	var p string
+	if d.Partitioner != nil {
+		p = *d.Partitioner
+	}
+	switch p {
+	case "", PartitionerLeastBytes:
+		return kgo.LeastBackupPartitioner(), nil
+	case PartitionerHash:
+		return kgo.StickyKeyPartitioner(kgo.SaramaCompatHasher(func(b []byte) uint32 {
+			h := fnv.New32a()
+			h.Write(b)
+			return h.Sum32()
+		})), nil
+	case PartitionerMurmur2:
+		return kgo.StickyKeyPartitioner(nil), nil
+	case PartitionerCRC32:
+		return kgo.StickyKeyPartitioner(kgo.SaramaHasher(crc32.ChecksumIEEE)), nil
+	case PartitionerRoundRobin:
+		return kgo.RoundRobinPartitioner(), nil
+	}
+	return nil, fmt.Errorf("unknown partitioner %q", p)
+}
+
+// txSASL returns the SASL mechanism of the transactional producer.
+func (d *Kafka) txSASL() (sasl.Mechanism, error) {
+	var t SaslType
+	if d.SaslType != nil {
+		t = *d.SaslType
+	}
+	switch t {
+	case "":
+		return nil, nil
+	case SaslTypePlain:
+		return plain.Auth{User: value(d.Username), Pass: value(d.Password)}.AsMechanism(), nil
+	case SaslTypeScram, SaslTypeScramSHA512:
+		return scram.Auth{User: value(d.Username), Pass: value(d.Password)}.AsSha512Mechanism(), nil
+	case SaslTypeScramSHA256:
+		return scram.Auth{User: value(d.Username), Pass: value(d.Password)}.AsSha256Mechanism(), nil
+	case SaslTypeOAuthBearer:
+		ts, err := d.tokenSource()
+		if err != nil {
+			return nil, err
+		}
+		return oauth.Oauth(func(context.Context) (oauth.Auth, error) {
+			tok, err := ts.Token()
+			if err != nil {
+				return oauth.Auth{}, err
+			}
+			return oauth.Auth{Token: tok.AccessToken}, nil
+		}), nil
+	case SaslTypeAWSMSKIAM:
+		creds, _, err := d.awsCredentials()
+		if err != nil {
+			return nil, err
+		}
+		return saslaws.ManagedStreamingIAM(func(ctx context.Context) (saslaws.Auth, error) {
+			v, err := creds.GetWithContext(ctx)
+			if err != nil {
+				return saslaws.Auth{}, err
+			}
+			return saslaws.Auth{
+				AccessKey:    v.AccessKeyID,
+				SecretKey:    v.SecretAccessKey,
+				SessionToken: v.SessionToken,
+				UserAgent:    "pushx",
+			}, nil
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown SASL type %q", t)
+}
+
+// txOptions returns the options of the transactional producer. The batch
+// size does not apply, as batches are bounded by bytes rather than
+// messages.
+func (d *Kafka) txOptions() ([]kgo.Opt, error) {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(d.Brokers...),
+		kgo.TransactionalID(*d.TransactionalID),
+	}
+	if d.Topic != nil && *d.Topic != "" {
+		opts = append(opts, kgo.DefaultProduceTopic(*d.Topic))
+	}
+	p, err := d.txPartitioner()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, kgo.RecordPartitioner(p))
+	if d.RequiredAcks != nil && *d.RequiredAcks != "" && *d.RequiredAcks != "all" {
+		return nil, fmt.Errorf("required acks must be all for transactions, not %q", *d.RequiredAcks)
+	}
+	if d.Compression != nil {
+		var c kgo.CompressionCodec
+		switch *d.Compression {
+		case "", "none":
+			c = kgo.NoCompression()
+		case "gzip":
+			c = kgo.GzipCompression()
+		case "snappy":
+			c = kgo.SnappyCompression()
+		case "lz4":
+			c = kgo.Lz4Compression()
+		case "zstd":
+			c = kgo.ZstdCompression()
+		default:
+			return nil, fmt.Errorf("unknown compression %q", *d.Compression)
+		}
+		opts = append(opts, kgo.ProducerBatchCompression(c))
+	}
+	if d.BatchBytes != nil && *d.BatchBytes > 0 {
+		opts = append(opts, kgo.ProducerBatchMaxBytes(int32(*d.BatchBytes)))
+	}
+	if d.BatchTimeout != nil && *d.BatchTimeout != "" {
+		t, err := time.ParseDuration(*d.BatchTimeout)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.ProducerLinger(t))
+	}
+	if d.WriteTimeout != nil && *d.WriteTimeout != "" {
+		t, err := time.ParseDuration(*d.WriteTimeout)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.RecordDeliveryTimeout(t))
+	}
+	pd := utils.Dialer{Timeout: 10 * time.Second}
+	dial := pd.DialContext
+	if d.EnableTLS != nil && *d.EnableTLS {
+		tc, err := utils.TlsConfig(d.EnableTLS, d.TLSInsecure, d.TLSCA, d.TLSCert, d.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		dial = func(ctx context.Context, network, host string) (net.Conn, error) {
+			return pd.DialTLS(ctx, network, host, tc)
+		}
+	}
+	opts = append(opts, kgo.Dialer(dial))
+	if d.EnableSASL != nil && *d.EnableSASL {
+		m, err := d.txSASL()
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			opts = append(opts, kgo.SASL(m))
+		}
+	}
+	return opts, nil
+}
+
+// initTx creates the transactional producer. It does not connect until
+// the first transaction.
+func (d *Kafka) initTx() error {
+	opts, err := d.txOptions()
+	if err != nil {
+		return err
+	}
+	cl, err := kgo.NewClient(opts...)
+	if err != nil {
+		return err
+	}
+	d.txClient = cl
+	return nil
+}
+
+// Begin begins a transaction, in which the following pushes are written
+// until Commit or Abort.
+func (d *Kafka) Begin() error {
+	if d.txClient == nil {
+		return errors.New("no transactional id configured")
+	}
+	if err := d.txClient.BeginTransaction(); err != nil {
+		return err
+	}
+	d.txMu.Lock()
+	defer d.txMu.Unlock()
+	d.inTx = true
+	d.txErr = nil
+	return nil
+}
+
+// Commit flushes the messages of the transaction and commits it, or aborts
+// it if any message failed.
+func (d *Kafka) Commit() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "kafka",
+		"fn":  "Commit",
+	})
+	if d.txClient == nil {
+		return errors.New("no transactional id configured")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), txTimeout)
+	defer cancel()
+	err := d.txClient.Flush(ctx)
+	d.txMu.Lock()
+	if err == nil {
+		err = d.txErr
+	}
+	d.txMu.Unlock()
+	if err != nil {
+		l.WithError(err).Error("Failed to write transaction, aborting")
+		if aerr := d.Abort(); aerr != nil {
+			l.WithError(aerr).Error("Failed to abort transaction")
+		}
+		return txError(err)
+	}
+	err = d.txClient.EndTransaction(ctx, kgo.TryCommit)
+	d.endTx()
+	if err != nil {
+		l.WithError(err).Error("Failed to commit transaction")
+		return txError(err)
+	}
+	l.Debug("Committed transaction")
+	return nil
+}
+
+// Abort discards the messages of the transaction.
+func (d *Kafka) Abort() error {
+	if d.txClient == nil {
+		return errors.New("no transactional id configured")
+	}
+	defer d.endTx()
+	ctx, cancel := context.WithTimeout(context.Background(), txTimeout)
+	defer cancel()
+	if err := d.txClient.AbortBufferedRecords(ctx); err != nil {
+		return err
+	}
+	return d.txClient.EndTransaction(ctx, kgo.TryAbort)
+}
+
+func (d *Kafka) endTx() {
+	d.txMu.Lock()
+	defer d.txMu.Unlock()
+	d.inTx = false
+}
+
+// produce writes m in the current transaction, or in a transaction of its
+// own if none was begun. Messages of a transaction are written
+// asynchronously, and their errors returned by Commit.
+func (d *Kafka) produce(m kafka.Message) error {
+	rec := &kgo.Record{
+		Key:   m.Key,
+		Value: m.Value,
+	}
+	if d.Partition != nil && *d.Partition >= 0 {
+		rec.Partition = int32(*d.Partition)
+	}
+	for _, h := range m.Headers {
+		rec.Headers = append(rec.Headers, kgo.RecordHeader{Key: h.Key, Value: h.Value})
+	}
+	d.txMu.Lock()
+	inTx := d.inTx
+	d.txMu.Unlock()
+	if !inTx {
+		if err := d.Begin(); err != nil {
+			return err
+		}
+		d.txClient.Produce(context.Background(), rec, d.produced)
+		return d.Commit()
+	}
+	d.txClient.Produce(context.Background(), rec, d.produced)
+	return nil
+}
+
+// produced records the first error of the messages of the transaction.
+func (d *Kafka) produced(_ *kgo.Record, err error) {
+	if err == nil {
+		return
+	}
+	d.txMu.Lock()
+	defer d.txMu.Unlock()
+	if d.txErr == nil {
+		d.txErr = err
+	}
+}
+
+// txError returns err, which is permanent if Kafka rejected the
+// transaction with an error which is not retriable.
+func txError(err error) error {
+	var ke *kerr.Error
+	if errors.As(err, &ke) && !ke.Retriable {
+		return utils.Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,249 @@
+package kafka_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	pushxkafka "github.com/robertlestak/pushx/drivers/kafka"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// txCluster is a kfake cluster which also serves the transaction requests
+// of a producer, which kfake does not implement. Produced records are
+// held until their transaction ends, and only kept if it is committed.
+type txCluster struct {
+	*kfake.Cluster
+
+	mu sync.Mutex
+	// failProduce, if not zero, is the error code of every produced
+	// partition.
+	failProduce int16
+	epoch       int16
+	pending     []string
+	committed   []string
+	commits     int
+	aborts      int
+}
+
+// txVersions are the request versions advertised by the cluster.
+var txVersions = map[int16][2]int16{
+	0:  {3, 9},  // Produce
+	3:  {0, 12}, // Metadata
+	10: {0, 4},  // FindCoordinator
+	18: {0, 3},  // ApiVersions
+	22: {0, 4},  // InitProducerID
+	24: {0, 3},  // AddPartitionsToTxn
+	26: {0, 3},  // EndTxn
+}
+
+func newTxCluster(t *testing.T) *txCluster {
+	kc, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "pushx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(kc.Close)
+	c := &txCluster{Cluster: kc}
+	control := func(key int16, fn func(kmsg.Request) kmsg.Response) {
+		c.ControlKey(key, func(req kmsg.Request) (kmsg.Response, error, bool) {
+			c.KeepControl()
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return fn(req), nil, true
+		})
+	}
+	control(18, func(kreq kmsg.Request) kmsg.Response {
+		resp := kreq.ResponseKind().(*kmsg.ApiVersionsResponse)
+		if resp.Version > 3 {
+			resp.Version = 0
+		}
+		for _, key := range []int16{0, 3, 10, 18, 22, 24, 26} {
+			k := kmsg.NewApiVersionsResponseApiKey()
+			k.ApiKey, k.MinVersion, k.MaxVersion = key, txVersions[key][0], txVersions[key][1]
+			resp.ApiKeys = append(resp.ApiKeys, k)
+		}
+		return resp
+	})
+	control(22, func(kreq kmsg.Request) kmsg.Response {
+		resp := kreq.ResponseKind().(*kmsg.InitProducerIDResponse)
+		resp.ProducerID = 1
+		resp.ProducerEpoch = c.epoch
+		c.epoch++
+		return resp
+	})
+	control(24, func(kreq kmsg.Request) kmsg.Response {
+		req := kreq.(*kmsg.AddPartitionsToTxnRequest)
+		resp := req.ResponseKind().(*kmsg.AddPartitionsToTxnResponse)
+		for _, rt := range req.Topics {
+			st := kmsg.NewAddPartitionsToTxnResponseTopic()
+			st.Topic = rt.Topic
+			for _, p := range rt.Partitions {
+				sp := kmsg.NewAddPartitionsToTxnResponseTopicPartition()
+				sp.Partition = p
+				st.Partitions = append(st.Partitions, sp)
+			}
+			resp.Topics = append(resp.Topics, st)
+		}
+		return resp
+	})
+	control(0, func(kreq kmsg.Request) kmsg.Response {
+		req := kreq.(*kmsg.ProduceRequest)
+		resp := req.ResponseKind().(*kmsg.ProduceResponse)
+		for _, rt := range req.Topics {
+			st := kmsg.NewProduceResponseTopic()
+			st.Topic = rt.Topic
+			for _, rp := range rt.Partitions {
+				sp := kmsg.NewProduceResponseTopicPartition()
+				sp.Partition = rp.Partition
+				if c.failProduce != 0 {
+					sp.ErrorCode = c.failProduce
+				} else if vals, err := recordValues(rp.Records); err != nil {
+					sp.ErrorCode = kerr.CorruptMessage.Code
+				} else {
+					c.pending = append(c.pending, vals...)
+				}
+				st.Partitions = append(st.Partitions, sp)
+			}
+			resp.Topics = append(resp.Topics, st)
+		}
+		return resp
+	})
+	control(26, func(kreq kmsg.Request) kmsg.Response {
+		req := kreq.(*kmsg.EndTxnRequest)
+		if req.Commit {
+			c.committed = append(c.committed, c.pending...)
+			c.commits++
+		} else {
+			c.aborts++
+		}
+		c.pending = nil
+		return req.ResponseKind()
+	})
+	return c
+}
+
+// recordValues returns the values of the records of an uncompressed
+// record batch.
+func recordValues(batch []byte) ([]string, error) {
+	var b kmsg.RecordBatch
+	if err := b.ReadFrom(batch); err != nil {
+		return nil, err
+	}
+	var vals []string
+	src := b.Records
+	for i := int32(0); i < b.NumRecords; i++ {
+		n, w := binary.Varint(src)
+		if w <= 0 || int64(len(src)-w) < n {
+			return nil, errors.New("short record")
+		}
+		var r kmsg.Record
+		if err := r.ReadFrom(src[:w+int(n)]); err != nil {
+			return nil, err
+		}
+		vals = append(vals, string(r.Value))
+		src = src[w+int(n):]
+	}
+	return vals, nil
+}
+
+// state returns the committed records, and the counts of committed and
+// aborted transactions.
+func (c *txCluster) state() ([]string, int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.committed...), c.commits, c.aborts
+}
+
+func (c *txCluster) fail(code int16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failProduce = code
+}
+
+func TestTransaction(t *testing.T) {
+	c := newTxCluster(t)
+	d := &pushxkafka.Kafka{
+		Brokers:         c.ListenAddrs(),
+		Topic:           str("pushx"),
+		TransactionalID: str("pushx"),
+		WriteTimeout:    str("1s"),
+	}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Cleanup()
+	want := func(t *testing.T, vals []string, commits, aborts int) {
+		t.Helper()
+		got, c, a := c.state()
+		if !reflect.DeepEqual(got, vals) {
+			t.Errorf("committed %q, want %q", got, vals)
+		}
+		if c != commits || a != aborts {
+			t.Errorf("got %d commits and %d aborts, want %d and %d", c, a, commits, aborts)
+		}
+	}
+
+	t.Run("commit", func(t *testing.T) {
+		if err := d.Begin(); err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []string{"a", "b"} {
+			if err := d.Push(bytes.NewReader([]byte(v))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want(t, nil, 0, 0)
+		if err := d.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		want(t, []string{"a", "b"}, 1, 0)
+		// a push outside of a transaction is committed on its own
+		if err := d.Push(bytes.NewReader([]byte("c"))); err != nil {
+			t.Fatal(err)
+		}
+		want(t, []string{"a", "b", "c"}, 2, 0)
+	})
+
+	t.Run("abort rejected", func(t *testing.T) {
+		c.fail(kerr.MessageTooLarge.Code)
+		defer c.fail(0)
+		if err := d.Begin(); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Push(bytes.NewReader([]byte("d"))); err != nil {
+			t.Fatal(err)
+		}
+		err := d.Commit()
+		if !errors.Is(drivers.PushError(err), drivers.ErrPushRejected) {
+			t.Errorf("got %v, want a permanent error", err)
+		}
+		want(t, []string{"a", "b", "c"}, 2, 1)
+	})
+
+	t.Run("abort retriable", func(t *testing.T) {
+		// the record is retried until the write timeout
+		c.fail(kerr.NotEnoughReplicas.Code)
+		err := d.Push(bytes.NewReader([]byte("e")))
+		c.fail(0)
+		if err == nil {
+			t.Fatal("expected the push to fail")
+		}
+		if !errors.Is(drivers.PushError(err), drivers.ErrPushFailed) {
+			t.Errorf("got %v, want a retryable error", err)
+		}
+		_, _, aborts := c.state()
+		if aborts != 2 {
+			t.Errorf("got %d aborts, want 2", aborts)
+		}
+		if err := d.Push(bytes.NewReader([]byte("f"))); err != nil {
+			t.Fatal(err)
+		}
+		want(t, []string{"a", "b", "c", "f"}, 3, 2)
+	})
+}
@@ -0,0 +1,310 @@
+package mock
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/robertlestak/pushx/pkg/flags"
+	"github.com/robertlestak/pushx/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrInjected = errors.New("mock injected failure")
+)
+
+// Record is a single push captured by the mock driver.
+type Record struct {
+	Seq  int       `json:"seq"`
+	Time time.Time `json:"time"`
+	// Key is the key set with SetKey at the time of the push, if any.
+	Key string `json:"key,omitempty"`
+	// Payload is the pushed data. It is base64 encoded in the capture
+	// file when Encoding is "base64".
+	Payload  string            `json:"payload"`
+	Encoding string            `json:"encoding,omitempty"`
+	Meta     map[string]string `json:"meta,omitempty"`
+	Data     []byte            `json:"-"`
+}
+
+// Mock captures pushes in memory, and optionally to a JSONL file, and
+// can inject failures and latency to exercise retry and fallback behavior.
+type Mock struct {
+	File          *string
+	FailEvery     *int
+	FailError     *string
+	Latency       *string
+	LatencyJitter *string
+	LatencyDist   *string
+	// Transactions, if true, captures the pushes of a transaction only
+	// once it is committed.
+	Transactions *bool
+
+	mu      sync.Mutex
+	key     string
+	records []Record
+	pushes  int
+	f       *os.File
+	latency time.Duration
+	jitter  time.Duration
+	// queue, acked and nacks are the state of the mock as a source
+	queue []*message
+	acked [][]byte
+	nacks int
+	// inTx, pending, commits and aborts are the state of transactions
+	inTx    bool
+	pending []Record
+	commits int
+	aborts  int
+}
+
+func (d *Mock) LoadEnv(prefix string) error {
+	l := log.WithFields(log.Fields{
+		"pkg": "mock",
+		"fn":  "LoadEnv",
+	})
+	l.Debug("Loading environment")
+	if os.Getenv(prefix+"MOCK_FILE") != "" {
+		v := os.Getenv(prefix + "MOCK_FILE")
+		d.File = &v
+	}
+	if os.Getenv(prefix+"MOCK_FAIL_EVERY") != "" {
+		v, err := strconv.Atoi(os.Getenv(prefix + "MOCK_FAIL_EVERY"))
+		if err != nil {
+			l.WithError(err).Error("Failed to parse MOCK_FAIL_EVERY")
+			return err
+		}
+		d.FailEvery = &v
+	}
+	if os.Getenv(prefix+"MOCK_FAIL_ERROR") != "" {
+		v := os.Getenv(prefix + "MOCK_FAIL_ERROR")
+		d.FailError = &v
+	}
+	if os.Getenv(prefix+"MOCK_LATENCY") != "" {
+		v := os.Getenv(prefix + "MOCK_LATENCY")
+		d.Latency = &v
+	}
+	if os.Getenv(prefix+"MOCK_LATENCY_JITTER") != "" {
+		v := os.Getenv(prefix + "MOCK_LATENCY_JITTER")
+		d.LatencyJitter = &v
+	}
+	if os.Getenv(prefix+"MOCK_LATENCY_DIST") != "" {
+		v := os.Getenv(prefix + "MOCK_LATENCY_DIST")
+		d.LatencyDist = &v
+	}
+	if os.Getenv(prefix+"MOCK_TRANSACTIONS") != "" {
+		v := os.Getenv(prefix+"MOCK_TRANSACTIONS") == "true"
+		d.Transactions = &v
+	}
+	return nil
+}
+
+func (d *Mock) LoadFlags() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "mock",
+		"fn":  "LoadFlags",
+	})
+	l.Debug("Loading flags")
+	d.File = flags.MockFile
+	d.FailEvery = flags.MockFailEvery
+	d.FailError = flags.MockFailError
+	d.Latency = flags.MockLatency
+	d.LatencyJitter = flags.MockLatencyJitter
+	d.LatencyDist = flags.MockLatencyDist
+	d.Transactions = flags.MockTransactions
+	return nil
+}
+
+func parseDuration(s *string) (time.Duration, error) {
+	if s == nil || *s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(*s)
+}
+
+func (d *Mock) Init() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "mock",
+		"fn":  "Init",
+	})
+	l.Debug("Initializing mock driver")
+	var err error
+	if d.latency, err = parseDuration(d.Latency); err != nil {
+		l.WithError(err).Error("Failed to parse latency")
+		return err
+	}
+	if d.jitter, err = parseDuration(d.LatencyJitter); err != nil {
+		l.WithError(err).Error("Failed to parse latency jitter")
+		return err
+	}
+	if d.LatencyDist != nil && *d.LatencyDist != "" && *d.LatencyDist != "uniform" && *d.LatencyDist != "normal" {
+		return fmt.Errorf("unknown latency distribution %q", *d.LatencyDist)
+	}
+	if d.FailError != nil && *d.FailError != "" && *d.FailError != "retryable" && *d.FailError != "permanent" {
+		return fmt.Errorf("unknown fail error %q", *d.FailError)
+	}
+	if d.File != nil && *d.File != "" {
+		f, err := os.OpenFile(*d.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			l.WithError(err).Error("Failed to open capture file")
+			return err
+		}
+		d.f = f
+	}
+	return nil
+}
+
+// delay returns the latency to inject for a single push.
+func (d *Mock) delay() time.Duration {
+	if d.jitter == 0 {
+		return d.latency
+	}
+	var j time.Duration
+	if d.LatencyDist != nil && *d.LatencyDist == "normal" {
+		j = time.Duration(rand.NormFloat64() * float64(d.jitter))
+	} else {
+		j = time.Duration(rand.Int63n(int64(2*d.jitter)+1)) - d.jitter
+	}
+	if dl := d.latency + j; dl > 0 {
+		return dl
+	}
+	return 0
+}
+
+// CloudEventsBinding returns the CloudEvents protocol binding of the driver.
+// The mock driver captures events as the HTTP binding would.
+func (d *Mock) CloudEventsBinding() string {
+	return "http"
+}
+
+func (d *Mock) Push(r io.Reader) error {
+	return d.PushMeta(r, nil)
+}
+
+// PushMeta pushes r, capturing meta with the record.
+func (d *Mock) PushMeta(r io.Reader, meta map[string]string) error {
+	l := log.WithFields(log.Fields{
+		"pkg": "mock",
+		"fn":  "Push",
+	})
+	l.Debug("Pushing to mock")
+	bd, err := ioutil.ReadAll(r)
+	if err != nil {
+		l.WithError(err).Error("Failed to read from reader")
+		return err
+	}
+	time.Sleep(d.delay())
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pushes++
+	if d.FailEvery != nil && *d.FailEvery > 0 && d.pushes%*d.FailEvery == 0 {
+		err := fmt.Errorf("%w on push %d", ErrInjected, d.pushes)
+		l.WithError(err).Debug("Injecting failure")
+		if d.FailError != nil && *d.FailError == "permanent" {
+			return utils.Permanent(err)
+		}
+		return utils.Retryable(err)
+	}
+	rec := Record{
+		Seq:     d.pushes,
+		Time:    time.Now(),
+		Key:     d.key,
+		Payload: string(bd),
+		Meta:    meta,
+		Data:    bd,
+	}
+	if !utf8.Valid(bd) {
+		rec.Payload = base64.StdEncoding.EncodeToString(bd)
+		rec.Encoding = "base64"
+	}
+	if d.inTx {
+		d.pending = append(d.pending, rec)
+		l.Debug("Pushed to mock transaction")
+		return nil
+	}
+	if err := d.capture(rec); err != nil {
+		return err
+	}
+	l.Debug("Pushed to mock")
+	return nil
+}
+
+// capture appends rec to the captured records and the capture file.
+func (d *Mock) capture(rec Record) error {
+	if d.f != nil {
+		jd, err := json.Marshal(rec)
+		if err != nil {
+			log.WithError(err).Error("Failed to encode record")
+			return err
+		}
+		if _, err := d.f.Write(append(jd, '\n')); err != nil {
+			log.WithError(err).Error("Failed to write record")
+			return err
+		}
+	}
+	d.records = append(d.records, rec)
+	return nil
+}
+
+// GetKey returns the key recorded with the next push.
+func (d *Mock) GetKey() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.key
+}
+
+// SetKey sets the key recorded with the next push.
+func (d *Mock) SetKey(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.key = key
+}
+
+// Records returns the pushes captured so far, in order.
+func (d *Mock) Records() []Record {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Record(nil), d.records...)
+}
+
+// Reset discards the captured pushes and the push count, along with any
+// open transaction, its pending pushes, and the transaction counts.
+func (d *Mock) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.records = nil
+	d.pushes = 0
+	d.inTx = false
+	d.pending = nil
+	d.commits = 0
+	d.aborts = 0
+}
+
+func (d *Mock) Cleanup() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "mock",
+		"fn":  "Cleanup",
+	})
+	l.Debug("Cleaning up")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.f == nil {
+		return nil
+	}
+	if err := d.f.Close(); err != nil {
+		l.WithError(err).Error("Failed to close capture file")
+		return err
+	}
+	d.f = nil
+	return nil
+}
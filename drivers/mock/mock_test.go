@@ -0,0 +1,154 @@
+package mock_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/robertlestak/pushx/drivers/mock"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest"
+)
+
+func TestConformance(t *testing.T) {
+	var d *mock.Mock
+	driverstest.Run(t, driverstest.Case{
+		New: func() drivers.Driver {
+			d = &mock.Mock{}
+			return d
+		},
+		Flags: map[string]string{
+			"mock-latency":        "1ms",
+			"mock-latency-jitter": "1ms",
+		},
+		Env: map[string]string{
+			"MOCK_LATENCY":        "1ms",
+			"MOCK_LATENCY_JITTER": "1ms",
+		},
+		BadEnv: map[string]string{
+			"MOCK_LATENCY": "soon",
+		},
+		Received: func(t *testing.T) []byte {
+			recs := d.Records()
+			return recs[len(recs)-1].Data
+		},
+	})
+}
+
+func TestFailEvery(t *testing.T) {
+	for _, tc := range []struct {
+		class string
+		want  error
+	}{
+		{"retryable", drivers.ErrPushFailed},
+		{"permanent", drivers.ErrPushRejected},
+	} {
+		t.Run(tc.class, func(t *testing.T) {
+			n, class := 3, tc.class
+			d := &mock.Mock{FailEvery: &n, FailError: &class}
+			if err := d.Init(); err != nil {
+				t.Fatal(err)
+			}
+			for i := 1; i <= 6; i++ {
+				err := d.Push(strings.NewReader("hello"))
+				if i%3 != 0 {
+					if err != nil {
+						t.Fatalf("push %d: %v", i, err)
+					}
+					continue
+				}
+				if !errors.Is(err, mock.ErrInjected) || !errors.Is(drivers.PushError(err), tc.want) {
+					t.Fatalf("push %d: got %v, want %v", i, err, tc.want)
+				}
+			}
+			if n := len(d.Records()); n != 4 {
+				t.Errorf("captured %d records, want 4", n)
+			}
+		})
+	}
+}
+
+func TestReset(t *testing.T) {
+	d := &mock.Mock{}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	for _, end := range []func() error{d.Commit, d.Abort} {
+		if err := d.Begin(); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Push(strings.NewReader("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if err := end(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Push(strings.NewReader("pending")); err != nil {
+		t.Fatal(err)
+	}
+	d.Reset()
+	if commits, aborts := d.TransactionCounts(); commits != 0 || aborts != 0 {
+		t.Errorf("got %d commits and %d aborts after Reset, want 0", commits, aborts)
+	}
+	// the open transaction was discarded, so a new one may begin, and
+	// commits only its own pushes
+	if err := d.Begin(); err != nil {
+		t.Fatalf("Begin after Reset: %v", err)
+	}
+	if err := d.Push(strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if recs := d.Records(); len(recs) != 1 || string(recs[0].Data) != "hello" {
+		t.Errorf("captured %v after Reset, want only hello", recs)
+	}
+}
+
+func TestCaptureFile(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "pushes.jsonl")
+	d := &mock.Mock{File: &f}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"hello", "\xff\xfe"} {
+		if err := d.Push(strings.NewReader(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	fd, err := os.Open(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	var recs []mock.Record
+	sc := bufio.NewScanner(fd)
+	for sc.Scan() {
+		var r mock.Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, r)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2", len(recs))
+	}
+	if recs[0].Payload != "hello" || recs[0].Encoding != "" || recs[0].Seq != 1 {
+		t.Errorf("unexpected first record %+v", recs[0])
+	}
+	if recs[1].Payload != "//4=" || recs[1].Encoding != "base64" {
+		t.Errorf("unexpected second record %+v", recs[1])
+	}
+}
@@ -0,0 +1,72 @@
+package mock
+
+import (
+	"context"
+	"time"
+)
+
+// message is an enqueued message of the mock as a source.
+type message struct {
+	data []byte
+}
+
+// Enqueue adds messages to be received from the mock as a source.
+func (d *Mock) Enqueue(data ...[]byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, bd := range data {
+		d.queue = append(d.queue, &message{data: bd})
+	}
+}
+
+// Receive returns the next enqueued message, waiting until one is
+// enqueued or ctx is done.
+func (d *Mock) Receive(ctx context.Context) ([]byte, any, error) {
+	for {
+		d.mu.Lock()
+		if len(d.queue) > 0 {
+			m := d.queue[0]
+			d.queue = d.queue[1:]
+			d.mu.Unlock()
+			return m.data, m, nil
+		}
+		d.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// Ack records the message as acknowledged.
+func (d *Mock) Ack(ref any) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.acked = append(d.acked, ref.(*message).data)
+	return nil
+}
+
+// Nack returns the message to the front of the queue, to be received
+// again.
+func (d *Mock) Nack(ref any) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.nacks++
+	d.queue = append([]*message{ref.(*message)}, d.queue...)
+	return nil
+}
+
+// Acked returns the data of the acknowledged messages, in order.
+func (d *Mock) Acked() [][]byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([][]byte(nil), d.acked...)
+}
+
+// Nacks returns the number of negative acknowledgements.
+func (d *Mock) Nacks() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.nacks
+}
@@ -0,0 +1,58 @@
+package mock
+
+import "errors"
+
+// Transactional reports whether transactions are enabled.
+func (d *Mock) Transactional() bool {
+	return d.Transactions != nil && *d.Transactions
+}
+
+// Begin begins a transaction, in which pushes are held until Commit.
+func (d *Mock) Begin() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.inTx {
+		return errors.New("transaction already begun")
+	}
+	d.inTx = true
+	return nil
+}
+
+// Commit captures the pushes of the transaction.
+func (d *Mock) Commit() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.inTx {
+		return errors.New("no transaction begun")
+	}
+	d.inTx = false
+	pending := d.pending
+	d.pending = nil
+	d.commits++
+	for _, rec := range pending {
+		if err := d.capture(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Abort discards the pushes of the transaction.
+func (d *Mock) Abort() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.inTx {
+		return errors.New("no transaction begun")
+	}
+	d.inTx = false
+	d.pending = nil
+	d.aborts++
+	return nil
+}
+
+// TransactionCounts returns the number of committed and aborted transactions.
+func (d *Mock) TransactionCounts() (commits, aborts int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.commits, d.aborts
+}
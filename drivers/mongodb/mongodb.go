@@ -136,6 +136,7 @@ func (d *Mongo) Init() error {
 		}
 		opts.SetTLSConfig(tc)
 	}
+	opts.SetDialer(utils.Dialer{})
 	client, err := mongo.Connect(context.TODO(), opts)
 	if err != nil {
 		l.Error(err)
@@ -161,7 +162,7 @@ func (d *Mongo) Push(r io.Reader) error {
 	err := json.NewDecoder(r).Decode(&message)
 	if err != nil {
 		l.Error(err)
-		return err
+		return utils.Permanent(err)
 	}
 	collection := d.Client.Database(d.DB).Collection(d.Collection)
 	res, err := collection.InsertOne(context.TODO(), message)
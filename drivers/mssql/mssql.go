@@ -9,9 +9,10 @@ import (
 	"strconv"
 	"strings"
 
-	_ "github.com/denisenkom/go-mssqldb"
+	mssql "github.com/denisenkom/go-mssqldb"
 	"github.com/robertlestak/pushx/pkg/flags"
 	"github.com/robertlestak/pushx/pkg/schema"
+	"github.com/robertlestak/pushx/pkg/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -108,11 +109,13 @@ func (d *MSSql) Init() error {
 	var err error
 	connStr := fmt.Sprintf("server=%s;user id=%s;password=%s;port=%d;database=%s", d.Host, d.User, d.Pass, d.Port, d.Db)
 	l.Debug("Connecting to mssql: ", connStr)
-	d.Client, err = sql.Open("mssql", connStr)
+	c, err := mssql.NewConnector(connStr)
 	if err != nil {
 		l.Error(err)
 		return err
 	}
+	c.Dialer = utils.Dialer{}
+	d.Client = sql.OpenDB(c)
 	l.Debug("Initialized mssql client")
 	// ping the database to check if it is alive
 	err = d.Client.Ping()
@@ -139,9 +142,9 @@ func (d *MSSql) Push(r io.Reader) error {
 		l.Error(err)
 		return err
 	}
-	d.Query.Params = schema.ReplaceParams(bd, d.Query.Params)
-	l.Debugf("Executing query: %s %v", d.Query.Query, d.Query.Params)
-	_, err = d.Client.Exec(d.Query.Query, d.Query.Params...)
+	params := schema.ReplaceParams(bd, d.Query.Params)
+	l.Debugf("Executing query: %s %v", d.Query.Query, params)
+	_, err = d.Client.Exec(d.Query.Query, params...)
 	if err != nil {
 		l.Error(err)
 		return err
@@ -150,6 +153,19 @@ func (d *MSSql) Push(r io.Reader) error {
 	return nil
 }
 
+func (d *MSSql) Check() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "mssql",
+		"fn":  "Check",
+	})
+	l.Debug("Checking mssql connection")
+	if err := d.Client.Ping(); err != nil {
+		l.Error(err)
+		return err
+	}
+	return nil
+}
+
 func (d *MSSql) Cleanup() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "mssql",
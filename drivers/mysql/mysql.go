@@ -1,17 +1,20 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"strconv"
 	"strings"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/robertlestak/pushx/pkg/flags"
 	"github.com/robertlestak/pushx/pkg/schema"
+	"github.com/robertlestak/pushx/pkg/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -108,6 +111,9 @@ func (d *Mysql) Init() error {
 	var err error
 	connStr := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", d.User, d.Pass, d.Host, d.Port, d.Db)
 	l.Debug("Connecting to mysql: ", connStr)
+	mysql.RegisterDialContext("tcp", func(ctx context.Context, addr string) (net.Conn, error) {
+		return utils.Dialer{}.DialContext(ctx, "tcp", addr)
+	})
 	d.Client, err = sql.Open("mysql", connStr)
 	if err != nil {
 		l.Error(err)
@@ -139,9 +145,9 @@ func (d *Mysql) Push(r io.Reader) error {
 		l.Error(err)
 		return err
 	}
-	d.Query.Params = schema.ReplaceParams(bd, d.Query.Params)
-	l.Debugf("Executing query: %s %v", d.Query.Query, d.Query.Params)
-	_, err = d.Client.Exec(d.Query.Query, d.Query.Params...)
+	params := schema.ReplaceParams(bd, d.Query.Params)
+	l.Debugf("Executing query: %s %v", d.Query.Query, params)
+	_, err = d.Client.Exec(d.Query.Query, params...)
 	if err != nil {
 		l.Error(err)
 		return err
@@ -150,6 +156,19 @@ func (d *Mysql) Push(r io.Reader) error {
 	return nil
 }
 
+func (d *Mysql) Check() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "mysql",
+		"fn":  "Check",
+	})
+	l.Debug("Checking mysql connection")
+	if err := d.Client.Ping(); err != nil {
+		l.Error(err)
+		return err
+	}
+	return nil
+}
+
 func (d *Mysql) Cleanup() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "mysql",
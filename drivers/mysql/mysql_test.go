@@ -0,0 +1,55 @@
+package mysql_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/robertlestak/pushx/drivers/mysql"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest/sqlfake"
+)
+
+func TestConformance(t *testing.T) {
+	db := sqlfake.Open(t)
+	if _, err := db.Exec("CREATE TABLE pushes (data BLOB)"); err != nil {
+		t.Fatal(err)
+	}
+	addr := sqlfake.ServeMySQL(t, db)
+	port := strconv.Itoa(addr.Port)
+	driverstest.Run(t, driverstest.Case{
+		New: func() drivers.Driver { return &mysql.Mysql{} },
+		Flags: map[string]string{
+			"mysql-host":     addr.IP.String(),
+			"mysql-port":     port,
+			"mysql-user":     "pushx",
+			"mysql-password": "pushx",
+			"mysql-database": "pushx",
+			"mysql-query":    "INSERT INTO pushes (data) VALUES (?)",
+			"mysql-params":   "{{pushx_payload}}",
+		},
+		Env: map[string]string{
+			"MYSQL_HOST":         addr.IP.String(),
+			"MYSQL_PORT":         port,
+			"MYSQL_USER":         "pushx",
+			"MYSQL_PASSWORD":     "pushx",
+			"MYSQL_DATABASE":     "pushx",
+			"MYSQL_QUERY":        "INSERT INTO pushes (data) VALUES (?)",
+			"MYSQL_QUERY_PARAMS": "{{pushx_payload}}",
+		},
+		BadEnv: map[string]string{
+			"MYSQL_HOST":         addr.IP.String(),
+			"MYSQL_PORT":         port,
+			"MYSQL_USER":         "pushx",
+			"MYSQL_QUERY":        "INSERT INTO missing (data) VALUES (?)",
+			"MYSQL_QUERY_PARAMS": "{{pushx_payload}}",
+		},
+		Received: func(t *testing.T) []byte {
+			var bd []byte
+			if err := db.QueryRow("SELECT data FROM pushes ORDER BY rowid DESC LIMIT 1").Scan(&bd); err != nil {
+				t.Fatal(err)
+			}
+			return bd
+		},
+	})
+}
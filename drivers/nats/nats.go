@@ -5,6 +5,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/robertlestak/pushx/pkg/flags"
@@ -27,6 +28,10 @@ type NATS struct {
 	TLSCA       *string
 	TLSCert     *string
 	TLSKey      *string
+	// Consumer is the durable JetStream consumer used to receive from the
+	// subject as a relay source. It defaults to pushx.
+	Consumer *string
+	sub      *nats.Subscription
 }
 
 func (d *NATS) LoadEnv(prefix string) error {
@@ -42,6 +47,10 @@ func (d *NATS) LoadEnv(prefix string) error {
 		v := os.Getenv(prefix + "NATS_SUBJECT")
 		d.Subject = &v
 	}
+	if os.Getenv(prefix+"NATS_CONSUMER") != "" {
+		v := os.Getenv(prefix + "NATS_CONSUMER")
+		d.Consumer = &v
+	}
 	if os.Getenv(prefix+"NATS_CREDS_FILE") != "" {
 		v := os.Getenv(prefix + "NATS_CREDS_FILE")
 		d.CredsFile = &v
@@ -97,6 +106,7 @@ func (d *NATS) LoadFlags() error {
 	l.Debug("Loading flags")
 	d.URL = *flags.NATSURL
 	d.Subject = flags.NATSSubject
+	d.Consumer = flags.NATSConsumer
 	d.CredsFile = flags.NATSCredsFile
 	d.JWTFile = flags.NATSJWTFile
 	d.NKeyFile = flags.NATSNKeyFile
@@ -125,7 +135,11 @@ func (d *NATS) authOpts() []nats.Option {
 	}
 	if d.Username != nil && *d.Username != "" {
 		l.Debug("Enabling username")
-		opts = append(opts, nats.UserInfo(*d.Username, *d.Password))
+		var password string
+		if d.Password != nil {
+			password = *d.Password
+		}
+		opts = append(opts, nats.UserInfo(*d.Username, password))
 	}
 	if d.Token != nil && *d.Token != "" {
 		l.Debug("Enabling token")
@@ -160,6 +174,7 @@ func (d *NATS) Init() error {
 		opts = append(opts, nats.Secure(tc))
 	}
 	opts = append(opts, d.authOpts()...)
+	opts = append(opts, nats.SetCustomDialer(utils.Dialer{Timeout: nats.DefaultTimeout}))
 	nc, err := nats.Connect(d.URL, opts...)
 	if err != nil {
 		l.Errorf("error connecting to nats: %v", err)
@@ -169,7 +184,17 @@ func (d *NATS) Init() error {
 	return nil
 }
 
+// CloudEventsBinding returns the CloudEvents protocol binding of the driver.
+func (d *NATS) CloudEventsBinding() string {
+	return "nats"
+}
+
 func (d *NATS) Push(r io.Reader) error {
+	return d.PushMeta(r, nil)
+}
+
+// PushMeta pushes r with meta set as message headers.
+func (d *NATS) PushMeta(r io.Reader, meta map[string]string) error {
 	l := log.WithFields(log.Fields{
 		"pkg": "nats",
 		"fn":  "Push",
@@ -179,12 +204,21 @@ func (d *NATS) Push(r io.Reader) error {
 		l.Error("client is nil")
 		return errors.New("client is nil")
 	}
+	if d.Subject == nil || *d.Subject == "" {
+		l.Error("subject is empty")
+		return errors.New("subject is empty")
+	}
 	bd, err := ioutil.ReadAll(r)
 	if err != nil {
 		l.Errorf("error reading from reader: %v", err)
 		return err
 	}
-	if err := d.Client.Publish(*d.Subject, bd); err != nil {
+	msg := nats.NewMsg(*d.Subject)
+	msg.Data = bd
+	for k, v := range meta {
+		msg.Header.Set(k, v)
+	}
+	if err := d.Client.PublishMsg(msg); err != nil {
 		l.Errorf("%+v", err)
 		return err
 	}
@@ -192,6 +226,23 @@ func (d *NATS) Push(r io.Reader) error {
 	return nil
 }
 
+func (d *NATS) Check() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "nats",
+		"fn":  "Check",
+	})
+	l.Debug("Checking nats connection")
+	if d.Client == nil {
+		l.Error("client is nil")
+		return errors.New("client is nil")
+	}
+	if err := d.Client.FlushTimeout(10 * time.Second); err != nil {
+		l.Errorf("%+v", err)
+		return err
+	}
+	return nil
+}
+
 func (d *NATS) Cleanup() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "nats",
@@ -0,0 +1,89 @@
+package nats_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	pushxnats "github.com/robertlestak/pushx/drivers/nats"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest"
+)
+
+func TestConformance(t *testing.T) {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	opts.MaxPayload = 2 << 20
+	s := natsserver.RunServer(&opts)
+	defer s.Shutdown()
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	msgs := make(chan *nats.Msg, 16)
+	if _, err := nc.ChanSubscribe("pushx", msgs); err != nil {
+		t.Fatal(err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	driverstest.Run(t, driverstest.Case{
+		New: func() drivers.Driver { return &pushxnats.NATS{} },
+		Flags: map[string]string{
+			"nats-url":     s.ClientURL(),
+			"nats-subject": "pushx",
+		},
+		Env: map[string]string{
+			"NATS_URL":     s.ClientURL(),
+			"NATS_SUBJECT": "pushx",
+		},
+		BadEnv: map[string]string{
+			"NATS_URL": s.ClientURL(),
+		},
+		Received: func(t *testing.T) []byte {
+			select {
+			case msg := <-msgs:
+				return msg.Data
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for message")
+			}
+			return nil
+		},
+	})
+}
+
+func TestPushMeta(t *testing.T) {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	s := natsserver.RunServer(&opts)
+	defer s.Shutdown()
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	sub, err := nc.SubscribeSync("pushx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := "pushx"
+	d := &pushxnats.NATS{URL: s.ClientURL(), Subject: &subject}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Cleanup()
+	if err := d.PushMeta(strings.NewReader("hello"), map[string]string{"tenant": "acme"}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := msg.Header.Get("tenant"); v != "acme" {
+		t.Errorf("got header %q, want %q", v, "acme")
+	}
+}
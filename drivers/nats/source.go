@@ -0,0 +1,81 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+// fetchTimeout is how long a single JetStream fetch waits for a message.
+const fetchTimeout = 5 * time.Second
+
+// subscription returns the JetStream pull subscription of the durable
+// consumer, creating it if needed.
+func (d *NATS) subscription() (*nats.Subscription, error) {
+	if d.sub != nil {
+		return d.sub, nil
+	}
+	if d.Subject == nil || *d.Subject == "" {
+		return nil, errors.New("subject is empty")
+	}
+	js, err := d.Client.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	durable := "pushx"
+	if d.Consumer != nil && *d.Consumer != "" {
+		durable = *d.Consumer
+	}
+	sub, err := js.PullSubscribe(*d.Subject, durable)
+	if err != nil {
+		return nil, err
+	}
+	d.sub = sub
+	return sub, nil
+}
+
+// Receive fetches the next message of the subject from JetStream with the
+// durable consumer. A stream must capture the subject.
+func (d *NATS) Receive(ctx context.Context) ([]byte, any, error) {
+	l := log.WithFields(log.Fields{
+		"pkg": "nats",
+		"fn":  "Receive",
+	})
+	sub, err := d.subscription()
+	if err != nil {
+		l.Errorf("error subscribing: %v", err)
+		return nil, nil, err
+	}
+	for {
+		fctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		msgs, err := sub.Fetch(1, nats.Context(fctx))
+		cancel()
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout) {
+			continue
+		} else if err != nil {
+			l.Errorf("error fetching: %v", err)
+			return nil, nil, err
+		}
+		if len(msgs) == 0 {
+			continue
+		}
+		return msgs[0].Data, msgs[0], nil
+	}
+}
+
+// Ack acknowledges the message with JetStream.
+func (d *NATS) Ack(ref any) error {
+	return ref.(*nats.Msg).Ack()
+}
+
+// Nack negatively acknowledges the message, so that JetStream redelivers
+// it.
+func (d *NATS) Nack(ref any) error {
+	return ref.(*nats.Msg).Nak()
+}
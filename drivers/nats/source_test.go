@@ -0,0 +1,71 @@
+package nats_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	pushxnats "github.com/robertlestak/pushx/drivers/nats"
+)
+
+func TestSource(t *testing.T) {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	s := natsserver.RunServer(&opts)
+	defer s.Shutdown()
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "PUSHX", Subjects: []string{"pushx"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []string{"a", "b"} {
+		if _, err := js.Publish("pushx", []byte(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	subject := "pushx"
+	d := &pushxnats.NATS{URL: s.ClientURL(), Subject: &subject}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	bd, ref, err := d.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bd) != "a" {
+		t.Fatalf("got %q, want a", bd)
+	}
+	if err := d.Nack(ref); err != nil {
+		t.Fatal(err)
+	}
+	// the nacked message is redelivered, though not necessarily first
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		bd, ref, err := d.Receive(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[string(bd)] = true
+		if err := d.Ack(ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !got["a"] || !got["b"] {
+		t.Errorf("got messages %v, want a and b", got)
+	}
+}
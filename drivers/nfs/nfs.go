@@ -3,8 +3,10 @@ package nfs
 import (
 	"errors"
 	"io"
+	"net/url"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/robertlestak/pushx/pkg/flags"
@@ -105,15 +107,23 @@ func (d *NFS) Push(r io.Reader) error {
 	if d.Key == "" {
 		return errors.New("no key")
 	}
-	if d.Folder != "" {
-		_, _, err := d.Client.Target.Lookup(d.Folder)
-		if err != nil {
-			// Create the bucket if it doesn't exist
-			_, err = d.Client.Target.Mkdir(d.Folder, 0755)
-			if err != nil {
-				l.Errorf("mvObject error=%v", err)
-				return err
-			}
+	// Create the folder and the subdirectories of the key if they don't exist
+	parent := path.Dir(path.Join(d.Folder, d.Key))
+	var dir string
+	if path.IsAbs(parent) {
+		dir = "/"
+	}
+	for _, p := range strings.Split(parent, "/") {
+		if p == "" || p == "." {
+			continue
+		}
+		dir = path.Join(dir, p)
+		if _, _, err := d.Client.Target.Lookup(dir); err == nil {
+			continue
+		}
+		if _, err := d.Client.Target.Mkdir(dir, 0755); err != nil {
+			l.Errorf("mvObject error=%v", err)
+			return err
 		}
 	}
 	w, err := d.Client.Target.OpenFile(path.Join(d.Folder, d.Key), 0644)
@@ -128,6 +138,21 @@ func (d *NFS) Push(r io.Reader) error {
 	return nil
 }
 
+// GetKey returns the key of the next push.
+func (d *NFS) GetKey() string {
+	return d.Key
+}
+
+// SetKey sets the key of the next push.
+func (d *NFS) SetKey(key string) {
+	d.Key = key
+}
+
+// URI returns the URI of the object at the current key.
+func (d *NFS) URI() string {
+	return (&url.URL{Scheme: "nfs", Host: d.Host, Path: path.Join("/", d.Target, d.Folder, d.Key)}).String()
+}
+
 func (d *NFS) Cleanup() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "nfs",
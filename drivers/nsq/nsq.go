@@ -1,6 +1,7 @@
 package nsq
 
 import (
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
@@ -102,9 +103,9 @@ func (d *NSQ) Init() error {
 		cfg.TlsConfig = t
 	}
 	var addr string
-	if d.NsqLookupdAddress != nil {
+	if d.NsqLookupdAddress != nil && *d.NsqLookupdAddress != "" {
 		addr = *d.NsqLookupdAddress
-	} else {
+	} else if d.NsqdAddress != nil {
 		addr = *d.NsqdAddress
 	}
 	producer, err := nsq.NewProducer(addr, cfg)
@@ -136,6 +137,9 @@ func (d *NSQ) Push(r io.Reader) error {
 		"fn":  "Push",
 	})
 	l.Debug("Pushing message")
+	if d.Topic == nil || *d.Topic == "" {
+		return errors.New("topic is empty")
+	}
 	bd, err := ioutil.ReadAll(r)
 	if err != nil {
 		l.Errorf("%+v", err)
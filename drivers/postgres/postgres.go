@@ -9,9 +9,10 @@ import (
 	"strconv"
 	"strings"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/robertlestak/pushx/pkg/flags"
 	"github.com/robertlestak/pushx/pkg/schema"
+	"github.com/robertlestak/pushx/pkg/utils"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -150,11 +151,13 @@ func (d *Postgres) Init() error {
 		connStr += "&sslkey=" + *d.SSLKey
 	}
 	connStr += opts
-	d.Client, err = sql.Open("postgres", connStr)
+	c, err := pq.NewConnector(connStr)
 	if err != nil {
 		l.Error(err)
 		return err
 	}
+	c.Dialer(utils.Dialer{})
+	d.Client = sql.OpenDB(c)
 	err = d.Client.Ping()
 	if err != nil {
 		l.Error(err)
@@ -179,9 +182,9 @@ func (d *Postgres) Push(r io.Reader) error {
 		l.Error(err)
 		return err
 	}
-	d.Query.Params = schema.ReplaceParams(bd, d.Query.Params)
-	l.Debugf("Executing query: %s %v", d.Query.Query, d.Query.Params)
-	_, err = d.Client.Exec(d.Query.Query, d.Query.Params...)
+	params := schema.ReplaceParams(bd, d.Query.Params)
+	l.Debugf("Executing query: %s %v", d.Query.Query, params)
+	_, err = d.Client.Exec(d.Query.Query, params...)
 	if err != nil {
 		l.Error(err)
 		return err
@@ -190,6 +193,19 @@ func (d *Postgres) Push(r io.Reader) error {
 	return nil
 }
 
+func (d *Postgres) Check() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "postgres",
+		"fn":  "Check",
+	})
+	l.Debug("Checking postgres connection")
+	if err := d.Client.Ping(); err != nil {
+		l.Error(err)
+		return err
+	}
+	return nil
+}
+
 func (d *Postgres) Cleanup() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "postgres",
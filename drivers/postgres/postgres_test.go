@@ -0,0 +1,55 @@
+package postgres_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/robertlestak/pushx/drivers/postgres"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest/sqlfake"
+)
+
+func TestConformance(t *testing.T) {
+	db := sqlfake.Open(t)
+	if _, err := db.Exec("CREATE TABLE pushes (data BLOB)"); err != nil {
+		t.Fatal(err)
+	}
+	addr := sqlfake.ServePostgres(t, db)
+	port := strconv.Itoa(addr.Port)
+	driverstest.Run(t, driverstest.Case{
+		New: func() drivers.Driver { return &postgres.Postgres{} },
+		Flags: map[string]string{
+			"psql-host":     addr.IP.String(),
+			"psql-port":     port,
+			"psql-user":     "pushx",
+			"psql-password": "pushx",
+			"psql-database": "pushx",
+			"psql-query":    "INSERT INTO pushes (data) VALUES ($1)",
+			"psql-params":   "{{pushx_payload}}",
+		},
+		Env: map[string]string{
+			"PSQL_HOST":         addr.IP.String(),
+			"PSQL_PORT":         port,
+			"PSQL_USER":         "pushx",
+			"PSQL_PASSWORD":     "pushx",
+			"PSQL_DATABASE":     "pushx",
+			"PSQL_QUERY":        "INSERT INTO pushes (data) VALUES ($1)",
+			"PSQL_QUERY_PARAMS": "{{pushx_payload}}",
+		},
+		BadEnv: map[string]string{
+			"PSQL_HOST":         addr.IP.String(),
+			"PSQL_PORT":         port,
+			"PSQL_USER":         "pushx",
+			"PSQL_QUERY":        "INSERT INTO missing (data) VALUES ($1)",
+			"PSQL_QUERY_PARAMS": "{{pushx_payload}}",
+		},
+		Received: func(t *testing.T) []byte {
+			var bd []byte
+			if err := db.QueryRow("SELECT data FROM pushes ORDER BY rowid DESC LIMIT 1").Scan(&bd); err != nil {
+				t.Fatal(err)
+			}
+			return bd
+		},
+	})
+}
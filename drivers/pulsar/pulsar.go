@@ -3,6 +3,7 @@ package pulsar
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
@@ -122,29 +123,37 @@ func (d *Pulsar) Init() error {
 	})
 
 	l.Debug("Initializing pulsar driver")
-	ll := log.StandardLogger()
+	// use a dedicated logger so the pulsar client does not change the
+	// level of the standard logger used by the rest of the process
+	ll := log.New()
 	ll.Level = log.FatalLevel
 	lr := pulsarlog.NewLoggerWithLogrus(ll)
 	up := "pulsar://"
 	opts := pulsar.ClientOptions{
-		OperationTimeout:           30 * time.Second,
-		ConnectionTimeout:          30 * time.Second,
-		TLSTrustCertsFilePath:      *d.TLSTrustCertsFilePath,
-		TLSAllowInsecureConnection: *d.TLSAllowInsecureConnection,
-		TLSValidateHostname:        *d.TLSValidateHostname,
-		Logger:                     lr,
-	}
-	if *d.AuthCertPath != "" && *d.AuthKeyPath != "" {
+		OperationTimeout:  30 * time.Second,
+		ConnectionTimeout: 30 * time.Second,
+		Logger:            lr,
+	}
+	if d.TLSTrustCertsFilePath != nil {
+		opts.TLSTrustCertsFilePath = *d.TLSTrustCertsFilePath
+	}
+	if d.TLSAllowInsecureConnection != nil {
+		opts.TLSAllowInsecureConnection = *d.TLSAllowInsecureConnection
+	}
+	if d.TLSValidateHostname != nil {
+		opts.TLSValidateHostname = *d.TLSValidateHostname
+	}
+	if d.AuthCertPath != nil && *d.AuthCertPath != "" && d.AuthKeyPath != nil && *d.AuthKeyPath != "" {
 		opts.Authentication = pulsar.NewAuthenticationTLS(*d.AuthCertPath, *d.AuthKeyPath)
 		up = "pulsar+ssl://"
 	}
-	if *d.AuthToken != "" {
+	if d.AuthToken != nil && *d.AuthToken != "" {
 		opts.Authentication = pulsar.NewAuthenticationToken(*d.AuthToken)
 	}
-	if *d.AuthTokenFile != "" {
+	if d.AuthTokenFile != nil && *d.AuthTokenFile != "" {
 		opts.Authentication = pulsar.NewAuthenticationTokenFromFile(*d.AuthTokenFile)
 	}
-	if *d.AuthOAuthParams != nil && len(*d.AuthOAuthParams) > 0 {
+	if d.AuthOAuthParams != nil && len(*d.AuthOAuthParams) > 0 {
 		opts.Authentication = pulsar.NewAuthenticationOAuth2(*d.AuthOAuthParams)
 	}
 	opts.URL = up + d.Address
@@ -159,11 +168,19 @@ func (d *Pulsar) Init() error {
 }
 
 func (d *Pulsar) Push(r io.Reader) error {
+	return d.PushMeta(r, nil)
+}
+
+// PushMeta pushes r with meta set as message properties.
+func (d *Pulsar) PushMeta(r io.Reader, meta map[string]string) error {
 	l := log.WithFields(log.Fields{
 		"pkg": "pulsar",
 		"fn":  "Push",
 	})
 	l.Debug("Pushing data to pulsar")
+	if d.Topic == nil || *d.Topic == "" {
+		return errors.New("topic is empty")
+	}
 	topic := *d.Topic
 	opts := pulsar.ProducerOptions{
 		Topic: topic,
@@ -179,7 +196,8 @@ func (d *Pulsar) Push(r io.Reader) error {
 		return err
 	}
 	_, err = producer.Send(context.Background(), &pulsar.ProducerMessage{
-		Payload: bd,
+		Payload:    bd,
+		Properties: meta,
 	})
 	if err != nil {
 		l.Errorf("%+v", err)
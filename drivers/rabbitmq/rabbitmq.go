@@ -5,9 +5,11 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/robertlestak/pushx/pkg/flags"
+	"github.com/robertlestak/pushx/pkg/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -16,6 +18,9 @@ type RabbitMQ struct {
 	URL      string
 	Exchange string
 	Queue    string
+
+	ch         *amqp.Channel
+	deliveries <-chan amqp.Delivery
 }
 
 func (d *RabbitMQ) LoadEnv(prefix string) error {
@@ -50,7 +55,11 @@ func (d *RabbitMQ) Init() error {
 		"fn":  "Init",
 	})
 	l.Debug("Initializing rabbitmq driver")
-	conn, err := amqp.Dial(d.URL)
+	conn, err := amqp.DialConfig(d.URL, amqp.Config{
+		Heartbeat: 10 * time.Second,
+		Locale:    "en_US",
+		Dial:      utils.Dialer{Timeout: 30 * time.Second}.Dial,
+	})
 	if err != nil {
 		return err
 	}
@@ -58,7 +67,18 @@ func (d *RabbitMQ) Init() error {
 	return nil
 }
 
+// CloudEventsBinding returns the CloudEvents protocol binding of the driver.
+func (d *RabbitMQ) CloudEventsBinding() string {
+	return "amqp"
+}
+
 func (d *RabbitMQ) Push(r io.Reader) error {
+	return d.PushMeta(r, nil)
+}
+
+// PushMeta pushes r with meta set as message headers, except for
+// content-type which is set as the content type property.
+func (d *RabbitMQ) PushMeta(r io.Reader, meta map[string]string) error {
 	l := log.WithFields(log.Fields{
 		"pkg": "rabbitmq",
 		"fn":  "Push",
@@ -88,6 +108,16 @@ func (d *RabbitMQ) Push(r io.Reader) error {
 		ContentType: "text/plain",
 		Body:        bd,
 	}
+	for k, v := range meta {
+		if k == "content-type" {
+			msg.ContentType = v
+			continue
+		}
+		if msg.Headers == nil {
+			msg.Headers = make(amqp.Table, len(meta))
+		}
+		msg.Headers[k] = v
+	}
 	err = ch.PublishWithContext(
 		context.Background(),
 		d.Exchange, // exchange
@@ -108,6 +138,11 @@ func (d *RabbitMQ) Cleanup() error {
 		"fn":  "Cleanup",
 	})
 	l.Debug("Cleaning up rabbitmq driver")
+	if d.ch != nil {
+		if err := d.ch.Close(); err != nil {
+			return err
+		}
+	}
 	if err := d.Client.Close(); err != nil {
 		return err
 	}
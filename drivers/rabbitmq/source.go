@@ -0,0 +1,87 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// consume returns the deliveries of the queue, starting a consumer with
+// manual acknowledgements if needed. Only one message is delivered at a
+// time.
+func (d *RabbitMQ) consume() (<-chan amqp.Delivery, error) {
+	if d.deliveries != nil {
+		return d.deliveries, nil
+	}
+	ch, err := d.Client.Channel()
+	if err != nil {
+		return nil, err
+	}
+	q, err := ch.QueueDeclare(
+		d.Queue, // name
+		false,   // durable
+		false,   // delete when unused
+		false,   // exclusive
+		false,   // no-wait
+		nil,     // arguments
+	)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	if err := ch.Qos(1, 0, false); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	deliveries, err := ch.Consume(
+		q.Name, // queue
+		"",     // consumer
+		false,  // auto-ack
+		false,  // exclusive
+		false,  // no-local
+		false,  // no-wait
+		nil,    // args
+	)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	d.ch = ch
+	d.deliveries = deliveries
+	return deliveries, nil
+}
+
+// Receive returns the next message delivered from the queue.
+func (d *RabbitMQ) Receive(ctx context.Context) ([]byte, any, error) {
+	l := log.WithFields(log.Fields{
+		"pkg": "rabbitmq",
+		"fn":  "Receive",
+	})
+	deliveries, err := d.consume()
+	if err != nil {
+		l.WithError(err).Error("consume")
+		return nil, nil, err
+	}
+	select {
+	case m, ok := <-deliveries:
+		if !ok {
+			d.ch, d.deliveries = nil, nil
+			return nil, nil, errors.New("delivery channel closed")
+		}
+		return m.Body, m, nil
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+// Ack acknowledges the message.
+func (d *RabbitMQ) Ack(ref any) error {
+	return ref.(amqp.Delivery).Ack(false)
+}
+
+// Nack rejects the message, requeuing it.
+func (d *RabbitMQ) Nack(ref any) error {
+	return ref.(amqp.Delivery).Nack(false, true)
+}
@@ -0,0 +1,21 @@
+package redis
+
+import (
+	"context"
+	"net"
+
+	"github.com/go-redis/redis"
+	"github.com/robertlestak/pushx/pkg/utils"
+)
+
+// dialer returns the dialer of the options, which connects through the
+// proxy, if any.
+func dialer(opt *redis.Options) func() (net.Conn, error) {
+	return func() (net.Conn, error) {
+		d := utils.Dialer{Timeout: opt.DialTimeout}
+		if opt.TLSConfig == nil {
+			return d.Dial("tcp", opt.Addr)
+		}
+		return d.DialTLS(context.Background(), "tcp", opt.Addr, opt.TLSConfig)
+	}
+}
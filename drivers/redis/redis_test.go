@@ -0,0 +1,153 @@
+package redis_test
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/robertlestak/pushx/drivers/redis"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/drivers/driverstest"
+	"github.com/robertlestak/pushx/pkg/utils"
+)
+
+func newCase(m *miniredis.Miniredis, d func() drivers.Driver) driverstest.Case {
+	return driverstest.Case{
+		New: d,
+		Flags: map[string]string{
+			"redis-host": m.Host(),
+			"redis-port": m.Port(),
+			"redis-key":  "pushx",
+		},
+		Env: map[string]string{
+			"REDIS_HOST": m.Host(),
+			"REDIS_PORT": m.Port(),
+			"REDIS_KEY":  "pushx",
+		},
+		BadEnv: map[string]string{
+			"REDIS_HOST":     m.Host(),
+			"REDIS_PORT":     m.Port(),
+			"REDIS_PASSWORD": "wrong",
+		},
+	}
+}
+
+func TestListConformance(t *testing.T) {
+	m := miniredis.RunT(t)
+	c := newCase(m, func() drivers.Driver { return &redis.RedisList{} })
+	c.Received = func(t *testing.T) []byte {
+		l, err := m.List("pushx")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []byte(l[len(l)-1])
+	}
+	driverstest.Run(t, c)
+}
+
+func TestPubSubConformance(t *testing.T) {
+	m := miniredis.RunT(t)
+	sub := m.NewSubscriber()
+	defer sub.Close()
+	sub.Subscribe("pushx")
+	// miniredis blocks publishers until the subscriber reads the message
+	msgs := make(chan miniredis.PubsubMessage, 16)
+	go func() {
+		for msg := range sub.Messages() {
+			msgs <- msg
+		}
+	}()
+	c := newCase(m, func() drivers.Driver { return &redis.RedisPubSub{} })
+	c.Received = func(t *testing.T) []byte {
+		select {
+		case msg := <-msgs:
+			return []byte(msg.Message)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+		return nil
+	}
+	driverstest.Run(t, c)
+}
+
+func TestStreamConformance(t *testing.T) {
+	m := miniredis.RunT(t)
+	c := newCase(m, func() drivers.Driver { return &redis.RedisStream{} })
+	c.JSON = true
+	c.Received = func(t *testing.T) []byte {
+		s, err := m.Stream("pushx")
+		if err != nil {
+			t.Fatal(err)
+		}
+		vals := s[len(s)-1].Values
+		msg := make(map[string]interface{})
+		for i := 0; i+1 < len(vals); i += 2 {
+			var v interface{} = vals[i+1]
+			if strings.HasPrefix(vals[i+1], "{") || strings.HasPrefix(vals[i+1], "[") {
+				if err := json.Unmarshal([]byte(vals[i+1]), &v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			msg[vals[i]] = v
+		}
+		jd, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return jd
+	}
+	driverstest.Run(t, c)
+}
+
+// connectProxy is an HTTP CONNECT proxy which tunnels redis.test to the
+// address, so that only tunneled connections succeed.
+func connectProxy(t *testing.T, addr string) string {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, port, _ := net.SplitHostPort(r.Host)
+		if r.Method != http.MethodConnect || !strings.HasPrefix(r.Host, "redis.test:") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		up, err := net.Dial("tcp", net.JoinHostPort(addr, port))
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer up.Close()
+		c, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go io.Copy(up, c)
+		io.Copy(c, up)
+	}))
+	t.Cleanup(s.Close)
+	return s.URL
+}
+
+func TestProxy(t *testing.T) {
+	defer utils.SetProxy("")
+	m := miniredis.RunT(t)
+	if err := utils.SetProxy(connectProxy(t, m.Host())); err != nil {
+		t.Fatal(err)
+	}
+	d := &redis.RedisList{Host: "redis.test", Port: m.Port(), Key: "pushx"}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Cleanup()
+	if err := d.Push(strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if l, _ := m.List("pushx"); len(l) != 1 || l[0] != "hello" {
+		t.Errorf("got list %q", l)
+	}
+}
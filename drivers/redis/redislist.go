@@ -25,6 +25,8 @@ type RedisList struct {
 	TLSCert     *string
 	TLSKey      *string
 	TLSCA       *string
+
+	recovered bool
 }
 
 func (d *RedisList) LoadEnv(prefix string) error {
@@ -107,6 +109,7 @@ func (d *RedisList) Init() error {
 		}
 		cfg.TLSConfig = tc
 	}
+	cfg.Dialer = dialer(cfg)
 	d.Client = redis.NewClient(cfg)
 	cmd := d.Client.Ping()
 	if cmd.Err() != nil {
@@ -137,15 +140,32 @@ func (d *RedisList) Push(r io.Reader) error {
 	return nil
 }
 
+func (d *RedisList) Check() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "redis",
+		"fn":  "Check",
+	})
+	l.Debug("Checking redis connection")
+	if err := d.Client.Ping().Err(); err != nil {
+		l.WithError(err).Error("Failed to ping redis")
+		return err
+	}
+	return nil
+}
+
 func (d *RedisList) Cleanup() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "redis",
 		"fn":  "Cleanup",
 	})
 	l.Debug("Cleaning up")
+	if d.Client == nil {
+		return nil
+	}
 	if err := d.Client.Close(); err != nil {
 		l.WithError(err).Error("Failed to close redis client")
 		return err
 	}
+	d.Client = nil
 	return nil
 }
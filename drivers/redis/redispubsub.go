@@ -106,6 +106,7 @@ func (d *RedisPubSub) Init() error {
 		}
 		cfg.TLSConfig = tc
 	}
+	cfg.Dialer = dialer(cfg)
 	d.Client = redis.NewClient(cfg)
 	cmd := d.Client.Ping()
 	if cmd.Err() != nil {
@@ -136,15 +137,32 @@ func (d *RedisPubSub) Push(r io.Reader) error {
 	return nil
 }
 
+func (d *RedisPubSub) Check() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "redis",
+		"fn":  "Check",
+	})
+	l.Debug("Checking redis connection")
+	if err := d.Client.Ping().Err(); err != nil {
+		l.WithError(err).Error("Failed to ping redis")
+		return err
+	}
+	return nil
+}
+
 func (d *RedisPubSub) Cleanup() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "redis",
 		"fn":  "Cleanup",
 	})
 	l.Debug("Cleaning up")
+	if d.Client == nil {
+		return nil
+	}
 	if err := d.Client.Close(); err != nil {
 		l.WithError(err).Error("Failed to close redis client")
 		return err
 	}
+	d.Client = nil
 	return nil
 }
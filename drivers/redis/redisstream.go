@@ -21,12 +21,19 @@ type RedisStream struct {
 	Key       string
 	ValueKeys []string
 	MessageID *string
+	// ConsumerGroup and ConsumerName are used to receive from the stream
+	// as a relay source. The group defaults to pushx, and the name to
+	// the hostname.
+	ConsumerGroup *string
+	ConsumerName  *string
 	// TLS
 	EnableTLS   *bool
 	TLSInsecure *bool
 	TLSCert     *string
 	TLSKey      *string
 	TLSCA       *string
+
+	grouped bool
 }
 
 func (d *RedisStream) LoadEnv(prefix string) error {
@@ -71,6 +78,14 @@ func (d *RedisStream) LoadEnv(prefix string) error {
 		v := os.Getenv(prefix + "REDIS_MESSAGE_ID")
 		d.MessageID = &v
 	}
+	if os.Getenv(prefix+"REDIS_CONSUMER_GROUP") != "" {
+		v := os.Getenv(prefix + "REDIS_CONSUMER_GROUP")
+		d.ConsumerGroup = &v
+	}
+	if os.Getenv(prefix+"REDIS_CONSUMER_NAME") != "" {
+		v := os.Getenv(prefix + "REDIS_CONSUMER_NAME")
+		d.ConsumerName = &v
+	}
 	return nil
 }
 
@@ -85,6 +100,8 @@ func (d *RedisStream) LoadFlags() error {
 	d.Password = *flags.RedisPassword
 	d.Key = *flags.RedisKey
 	d.MessageID = flags.RedisMessageID
+	d.ConsumerGroup = flags.RedisConsumerGroup
+	d.ConsumerName = flags.RedisConsumerName
 	d.EnableTLS = flags.RedisEnableTLS
 	d.TLSInsecure = flags.RedisTLSSkipVerify
 	d.TLSCert = flags.RedisCertFile
@@ -113,6 +130,7 @@ func (d *RedisStream) Init() error {
 		}
 		cfg.TLSConfig = tc
 	}
+	cfg.Dialer = dialer(cfg)
 	d.Client = redis.NewClient(cfg)
 	cmd := d.Client.Ping()
 	if cmd.Err() != nil {
@@ -132,16 +150,31 @@ func (d *RedisStream) Push(r io.Reader) error {
 	var message map[string]interface{}
 	if err := json.NewDecoder(r).Decode(&message); err != nil {
 		l.Error("Failed to decode message")
-		return err
+		return utils.Permanent(err)
 	}
 	if d.MessageID == nil || *d.MessageID == "" {
 		v := "*"
 		d.MessageID = &v
 	}
+	values := make(map[string]interface{}, len(message))
+	for k, v := range message {
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			// store nested values as JSON rather than their Go formatting
+			jd, err := json.Marshal(v)
+			if err != nil {
+				l.Error("Failed to encode message value")
+				return utils.Permanent(err)
+			}
+			values[k] = string(jd)
+		default:
+			values[k] = v
+		}
+	}
 	cmd := d.Client.XAdd(&redis.XAddArgs{
 		Stream: d.Key,
 		ID:     *d.MessageID,
-		Values: message,
+		Values: values,
 	})
 	if cmd.Err() != nil {
 		l.Error("Failed to push to redis")
@@ -151,15 +184,32 @@ func (d *RedisStream) Push(r io.Reader) error {
 	return nil
 }
 
+func (d *RedisStream) Check() error {
+	l := log.WithFields(log.Fields{
+		"pkg": "redis",
+		"fn":  "Check",
+	})
+	l.Debug("Checking redis connection")
+	if err := d.Client.Ping().Err(); err != nil {
+		l.WithError(err).Error("Failed to ping redis")
+		return err
+	}
+	return nil
+}
+
 func (d *RedisStream) Cleanup() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "redis",
 		"fn":  "Cleanup",
 	})
 	l.Debug("Cleaning up")
+	if d.Client == nil {
+		return nil
+	}
 	if err := d.Client.Close(); err != nil {
 		l.WithError(err).Error("Failed to close redis client")
 		return err
 	}
+	d.Client = nil
 	return nil
 }
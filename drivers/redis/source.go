@@ -0,0 +1,164 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+// pollInterval is how often an empty list is polled for new messages.
+const pollInterval = 250 * time.Millisecond
+
+// processingKey returns the list messages are moved to while they are
+// being relayed.
+func (d *RedisList) processingKey() string {
+	return d.Key + ":processing"
+}
+
+// Receive moves the next message of the list to its processing list, and
+// returns it. On the first call, messages left in the processing list by
+// a previous run are moved back to the head of the list to be received
+// again.
+func (d *RedisList) Receive(ctx context.Context) ([]byte, any, error) {
+	l := log.WithFields(log.Fields{
+		"pkg": "redis",
+		"fn":  "Receive",
+	})
+	if !d.recovered {
+		for {
+			v, err := d.Client.RPopLPush(d.processingKey(), d.Key).Result()
+			if err == redis.Nil {
+				break
+			} else if err != nil {
+				l.WithError(err).Error("Failed to recover processing messages")
+				return nil, nil, err
+			}
+			l.WithField("message", v).Debug("Recovered processing message")
+		}
+		d.recovered = true
+	}
+	for {
+		v, err := d.Client.Do("lmove", d.Key, d.processingKey(), "left", "right").String()
+		if err == nil {
+			return []byte(v), v, nil
+		} else if err != redis.Nil {
+			l.WithError(err).Error("Failed to receive from redis")
+			return nil, nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Ack removes the message from the processing list.
+func (d *RedisList) Ack(ref any) error {
+	return d.Client.LRem(d.processingKey(), -1, ref.(string)).Err()
+}
+
+// Nack moves the message from the processing list back to the head of
+// the list.
+func (d *RedisList) Nack(ref any) error {
+	_, err := d.Client.TxPipelined(func(p redis.Pipeliner) error {
+		p.LRem(d.processingKey(), -1, ref.(string))
+		p.LPush(d.Key, ref.(string))
+		return nil
+	})
+	return err
+}
+
+// consumer returns the consumer group and name of the stream, creating
+// the group if it does not exist.
+func (d *RedisStream) consumer() (string, string, error) {
+	group, name := "pushx", ""
+	if d.ConsumerGroup != nil && *d.ConsumerGroup != "" {
+		group = *d.ConsumerGroup
+	}
+	if d.ConsumerName != nil && *d.ConsumerName != "" {
+		name = *d.ConsumerName
+	} else if h, err := os.Hostname(); err == nil {
+		name = h
+	} else {
+		name = "pushx"
+	}
+	if !d.grouped {
+		err := d.Client.XGroupCreateMkStream(d.Key, group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return "", "", err
+		}
+		d.grouped = true
+	}
+	return group, name, nil
+}
+
+// Receive reads the next message of the stream with the consumer group,
+// and returns its values as a JSON object. Messages pending for the
+// consumer, which were negatively acknowledged or left unacknowledged
+// by a previous run, are received before new messages.
+func (d *RedisStream) Receive(ctx context.Context) ([]byte, any, error) {
+	l := log.WithFields(log.Fields{
+		"pkg": "redis",
+		"fn":  "Receive",
+	})
+	group, name, err := d.consumer()
+	if err != nil {
+		l.WithError(err).Error("Failed to create consumer group")
+		return nil, nil, err
+	}
+	id := "0"
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		res, err := d.Client.XReadGroup(&redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: name,
+			Streams:  []string{d.Key, id},
+			Count:    1,
+			Block:    time.Second,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			l.WithError(err).Error("Failed to receive from redis")
+			return nil, nil, err
+		}
+		if len(res) == 0 || len(res[0].Messages) == 0 {
+			id = ">"
+			continue
+		}
+		msg := res[0].Messages[0]
+		if len(msg.Values) == 0 {
+			// the pending message was deleted from the stream
+			if err := d.Client.XAck(d.Key, group, msg.ID).Err(); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		bd, err := json.Marshal(msg.Values)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bd, msg.ID, nil
+	}
+}
+
+// Ack acknowledges the message with the consumer group.
+func (d *RedisStream) Ack(ref any) error {
+	group, _, err := d.consumer()
+	if err != nil {
+		return err
+	}
+	return d.Client.XAck(d.Key, group, ref.(string)).Err()
+}
+
+// Nack leaves the message pending for the consumer, so that it is
+// received again before any new message.
+func (d *RedisStream) Nack(ref any) error {
+	return nil
+}
@@ -0,0 +1,110 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/robertlestak/pushx/drivers/redis"
+)
+
+func receive(t *testing.T, src interface {
+	Receive(context.Context) ([]byte, any, error)
+}) ([]byte, any) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	bd, ref, err := src.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bd, ref
+}
+
+func TestListSource(t *testing.T) {
+	m := miniredis.RunT(t)
+	m.RPush("pushx", "a", "b")
+	// left in the processing list by a previous run
+	m.RPush("pushx:processing", "z")
+	d := &redis.RedisList{Host: m.Host(), Port: m.Port(), Key: "pushx"}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Cleanup()
+	bd, ref := receive(t, d)
+	if string(bd) != "z" {
+		t.Fatalf("got %q, want the recovered message", bd)
+	}
+	if err := d.Ack(ref); err != nil {
+		t.Fatal(err)
+	}
+	bd, ref = receive(t, d)
+	if string(bd) != "a" {
+		t.Fatalf("got %q, want a", bd)
+	}
+	if err := d.Nack(ref); err != nil {
+		t.Fatal(err)
+	}
+	bd, ref = receive(t, d)
+	if string(bd) != "a" {
+		t.Fatalf("got %q after nack, want a", bd)
+	}
+	if l, _ := m.List("pushx:processing"); len(l) != 1 || l[0] != "a" {
+		t.Errorf("got processing list %q, want [a]", l)
+	}
+	if err := d.Ack(ref); err != nil {
+		t.Fatal(err)
+	}
+	if l, _ := m.List("pushx:processing"); len(l) != 0 {
+		t.Errorf("got processing list %q after ack, want empty", l)
+	}
+	if l, _ := m.List("pushx"); len(l) != 1 || l[0] != "b" {
+		t.Errorf("got list %q, want [b]", l)
+	}
+}
+
+func TestStreamSource(t *testing.T) {
+	m := miniredis.RunT(t)
+	m.XAdd("pushx", "1-1", []string{"n", "1"})
+	m.XAdd("pushx", "1-2", []string{"n", "2"})
+	group, name := "relay", "worker"
+	d := &redis.RedisStream{
+		Host:          m.Host(),
+		Port:          m.Port(),
+		Key:           "pushx",
+		ConsumerGroup: &group,
+		ConsumerName:  &name,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Cleanup()
+	bd, ref := receive(t, d)
+	if string(bd) != `{"n":"1"}` {
+		t.Fatalf("got %s, want the first message", bd)
+	}
+	if err := d.Nack(ref); err != nil {
+		t.Fatal(err)
+	}
+	// nacked messages are pending, and received again first
+	bd, ref = receive(t, d)
+	if string(bd) != `{"n":"1"}` {
+		t.Fatalf("got %s after nack, want the first message", bd)
+	}
+	if err := d.Ack(ref); err != nil {
+		t.Fatal(err)
+	}
+	bd, ref = receive(t, d)
+	if string(bd) != `{"n":"2"}` {
+		t.Fatalf("got %s, want the second message", bd)
+	}
+	if err := d.Ack(ref); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err := d.Receive(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got error %v with no messages, want deadline exceeded", err)
+	}
+}
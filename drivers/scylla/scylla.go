@@ -10,6 +10,7 @@ import (
 	"github.com/gocql/gocql"
 	"github.com/robertlestak/pushx/pkg/flags"
 	"github.com/robertlestak/pushx/pkg/schema"
+	"github.com/robertlestak/pushx/pkg/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -120,6 +121,7 @@ func (d *Scylla) Init() error {
 	}
 	cluster.ProtoVersion = 4
 	cluster.ConnectTimeout = time.Second * 10
+	cluster.Dialer = utils.Dialer{Timeout: cluster.ConnectTimeout}
 	if d.User != "" || d.Password != "" {
 		cluster.Authenticator = gocql.PasswordAuthenticator{Username: d.User, Password: d.Password}
 	}
@@ -154,9 +156,9 @@ func (d *Scylla) Push(r io.Reader) error {
 		l.Error(err)
 		return err
 	}
-	d.Query.Params = schema.ReplaceParams(bd, d.Query.Params)
-	l.Debugf("Executing query: %s %v", d.Query.Query, d.Query.Params)
-	err = d.Client.Query(d.Query.Query, d.Query.Params...).Exec()
+	params := schema.ReplaceParams(bd, d.Query.Params)
+	l.Debugf("Executing query: %s %v", d.Query.Query, params)
+	err = d.Client.Query(d.Query.Query, params...).Exec()
 	if err != nil {
 		l.Error(err)
 		return err
@@ -2,15 +2,16 @@ package smb
 
 import (
 	"errors"
-	"fmt"
 	"io"
 	"net"
+	"net/url"
 	"os"
 	"path"
 	"strconv"
 
 	"github.com/hirochachacha/go-smb2"
 	"github.com/robertlestak/pushx/pkg/flags"
+	"github.com/robertlestak/pushx/pkg/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -91,7 +92,7 @@ func (d *SMB) Init() error {
 	if d.Host == "" || d.Port == 0 || d.Username == nil || d.Password == nil || d.Share == nil {
 		return errors.New("invalid SMB configuration")
 	}
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", d.Host, d.Port))
+	conn, err := utils.Dialer{}.Dial("tcp", net.JoinHostPort(d.Host, strconv.Itoa(d.Port)))
 	if err != nil {
 		l.Errorf("%+v", err)
 		return err
@@ -155,6 +156,25 @@ func (d *SMB) Push(r io.Reader) error {
 	return nil
 }
 
+// GetKey returns the key of the next push.
+func (d *SMB) GetKey() string {
+	return d.Key
+}
+
+// SetKey sets the key of the next push.
+func (d *SMB) SetKey(key string) {
+	d.Key = key
+}
+
+// URI returns the URI of the object at the current key.
+func (d *SMB) URI() string {
+	var share string
+	if d.Share != nil {
+		share = *d.Share
+	}
+	return (&url.URL{Scheme: "smb", Host: d.Host, Path: path.Join("/", share, d.Key)}).String()
+}
+
 func (d *SMB) Cleanup() error {
 	l := log.WithFields(log.Fields{
 		"pkg": "nfs",
@@ -0,0 +1,39 @@
+package drivers
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// NewDriver returns the named driver configured from cfg, without
+// reading any flags or environment variables. The keys of cfg are the
+// exported field names of the driver struct, for example
+// {"Brokers": []string{"localhost:9092"}, "Topic": "events"} for kafka.
+// Unknown keys are rejected. The returned driver has not been initialized.
+func NewDriver(name DriverName, cfg map[string]any) (Driver, error) {
+	d := GetDriver(name)
+	if d == nil {
+		return nil, ConfigError(ErrDriverNotFound)
+	}
+	if err := LoadConfig(d, cfg); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// LoadConfig sets the fields of driver d from cfg.
+func LoadConfig(d Driver, cfg map[string]any) error {
+	if len(cfg) == 0 {
+		return nil
+	}
+	jd, err := json.Marshal(cfg)
+	if err != nil {
+		return ConfigError(err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(jd))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(d); err != nil {
+		return ConfigError(err)
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package drivers
 
-import "io"
+import (
+	"context"
+	"io"
+)
 
 // Driver is the interface that must be implemented by a driver.
 type Driver interface {
@@ -10,3 +13,80 @@ type Driver interface {
 	Push(io.Reader) error
 	Cleanup() error
 }
+
+// Checker is implemented by drivers which support a non-mutating
+// connectivity and permission probe against an initialized client.
+type Checker interface {
+	Check() error
+}
+
+// IdentityLogger is implemented by drivers which can resolve and log
+// the identity they are authenticated as.
+type IdentityLogger interface {
+	LogIdentity() error
+}
+
+// MetaPusher is implemented by drivers which can attach metadata to a
+// message using the native headers, attributes or properties of their
+// system.
+type MetaPusher interface {
+	PushMeta(r io.Reader, meta map[string]string) error
+}
+
+// ContextSetter is implemented by drivers whose pushes may wait, for
+// example before a retry, so that the wait ends once ctx is done. The
+// context applies to every push until it is set again.
+type ContextSetter interface {
+	SetContext(ctx context.Context)
+}
+
+// CloudEventsBinder is implemented by MetaPushers which follow a
+// CloudEvents protocol binding, so that events can be pushed in binary
+// mode with their attributes set as metadata. The binding is one of
+// "http", "kafka", "amqp" or "nats".
+type CloudEventsBinder interface {
+	CloudEventsBinding() string
+}
+
+// KeyedDriver is implemented by drivers which write each push to a key,
+// such as an object key or file path, which can be changed between
+// pushes.
+type KeyedDriver interface {
+	Driver
+	GetKey() string
+	SetKey(key string)
+}
+
+// BlobDriver is implemented by drivers which store each push as an object
+// under a key, so that they can be used as a claim-check destination.
+type BlobDriver interface {
+	KeyedDriver
+	URI() string
+}
+
+// Source is implemented by drivers which can also consume messages, so
+// that they can be relayed to another driver. Each received message is
+// either acknowledged once it has been handled, removing it from the
+// source, or negatively acknowledged, making it available to be received
+// again.
+type Source interface {
+	Driver
+	// Receive blocks until a message is available or ctx is done, and
+	// returns its data and a reference to acknowledge it with.
+	Receive(ctx context.Context) ([]byte, any, error)
+	Ack(ref any) error
+	Nack(ref any) error
+}
+
+// Transactor is implemented by drivers which can push the records of an
+// input atomically. Pushes between Begin and Commit are only visible once
+// committed, and are discarded by Abort.
+type Transactor interface {
+	Driver
+	// Transactional reports whether the driver is configured to push in
+	// transactions.
+	Transactional() bool
+	Begin() error
+	Commit() error
+	Abort() error
+}
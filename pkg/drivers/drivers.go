@@ -17,6 +17,7 @@ import (
 	"github.com/robertlestak/pushx/drivers/http"
 	"github.com/robertlestak/pushx/drivers/kafka"
 	"github.com/robertlestak/pushx/drivers/local"
+	"github.com/robertlestak/pushx/drivers/mock"
 	"github.com/robertlestak/pushx/drivers/mongodb"
 	"github.com/robertlestak/pushx/drivers/mssql"
 	"github.com/robertlestak/pushx/drivers/mysql"
@@ -52,6 +53,7 @@ var (
 	GCPGCS            DriverName = "gcp-gcs"
 	GCPPubSub         DriverName = "gcp-pubsub"
 	GitHub            DriverName = "github"
+	Mock              DriverName = "mock"
 	MongoDB           DriverName = "mongodb"
 	MSSql             DriverName = "mssql"
 	MySQL             DriverName = "mysql"
@@ -109,6 +111,8 @@ func GetDriver(name DriverName) Driver {
 		return &http.HTTP{}
 	case Kafka:
 		return &kafka.Kafka{}
+	case Mock:
+		return &mock.Mock{}
 	case MongoDB:
 		return &mongodb.Mongo{}
 	case MSSql:
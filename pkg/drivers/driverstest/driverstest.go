@@ -0,0 +1,251 @@
+// Package driverstest implements a conformance suite which every driver
+// runs against an in-process fake of its backend.
+package driverstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/flags"
+)
+
+// EnvKeyPrefix is the prefix the suite sets environment variables with.
+const EnvKeyPrefix = "PUSHX_TEST_"
+
+// Case describes how to run the suite against a single driver.
+type Case struct {
+	// New returns a new, unconfigured driver.
+	New func() drivers.Driver
+	// Flags are the command line flags, without the leading dash, which
+	// configure the driver against the fake.
+	Flags map[string]string
+	// Env are the environment variables, without the key prefix, which
+	// configure the driver identically to Flags.
+	Env map[string]string
+	// BadEnv are environment variables, without the key prefix, for
+	// which either Init or the first Push must fail.
+	BadEnv map[string]string
+	// Received returns the data of the most recent push received by
+	// the fake.
+	Received func(t *testing.T) []byte
+	// JSON is set for drivers which only accept JSON object payloads.
+	// Pushes of other payloads must then fail with a permanent error.
+	JSON bool
+}
+
+// Payload is a single payload pushed by the suite.
+type Payload struct {
+	Name string
+	Data []byte
+	JSON bool
+}
+
+// Payloads returns the payloads pushed by the suite.
+func Payloads() []Payload {
+	bin := make([]byte, 256)
+	for i := range bin {
+		bin[i] = byte(i)
+	}
+	large := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(large)
+	for i := range large {
+		large[i] = 'a' + large[i]%26
+	}
+	return []Payload{
+		{Name: "empty", Data: []byte{}},
+		{Name: "binary", Data: bin},
+		{Name: "large", Data: large},
+		{Name: "json", Data: []byte(`{"id":"1","name":"pushx","nested":{"ok":true}}`), JSON: true},
+	}
+}
+
+// Run runs the conformance suite for c.
+func Run(t *testing.T, c Case) {
+	t.Run("LoadEnvFlags", func(t *testing.T) { testLoad(t, c) })
+	t.Run("BadConfig", func(t *testing.T) { testBadConfig(t, c) })
+	t.Run("Push", func(t *testing.T) { testPush(t, c) })
+	t.Run("Cleanup", func(t *testing.T) { testCleanup(t, c) })
+}
+
+// resetFlags sets all flags to their defaults, restoring the current
+// values when the test completes.
+func resetFlags(t *testing.T) {
+	t.Helper()
+	prev := make(map[string]string)
+	prevKV := make(map[*flags.KeyValues]flags.KeyValues)
+	prevHeaders := make(map[*flags.Headers]flags.Headers)
+	flags.FlagSet.VisitAll(func(f *flag.Flag) {
+		switch v := f.Value.(type) {
+		case *flags.KeyValues:
+			prevKV[v] = *v
+			*v = nil
+			return
+		case *flags.Headers:
+			prevHeaders[v] = *v
+			*v = nil
+			return
+		}
+		prev[f.Name] = f.Value.String()
+		if err := f.Value.Set(f.DefValue); err != nil {
+			t.Fatalf("reset flag %s: %v", f.Name, err)
+		}
+	})
+	t.Cleanup(func() {
+		for k, v := range prev {
+			flags.FlagSet.Set(k, v)
+		}
+		for kv, v := range prevKV {
+			*kv = v
+		}
+		for h, v := range prevHeaders {
+			*h = v
+		}
+	})
+}
+
+func setFlags(t *testing.T, fl map[string]string) {
+	t.Helper()
+	for k, v := range fl {
+		if err := flags.FlagSet.Set(k, v); err != nil {
+			t.Fatalf("set flag %s: %v", k, err)
+		}
+	}
+}
+
+func setEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for k, v := range env {
+		t.Setenv(EnvKeyPrefix+k, v)
+	}
+}
+
+// New returns a driver of c configured from its flags and environment,
+// in the same order as the command line does.
+func New(t *testing.T, c Case, env map[string]string) drivers.Driver {
+	t.Helper()
+	resetFlags(t)
+	d := c.New()
+	if err := d.LoadFlags(); err != nil {
+		t.Fatalf("LoadFlags: %v", err)
+	}
+	setEnv(t, env)
+	if err := d.LoadEnv(EnvKeyPrefix); err != nil {
+		t.Fatalf("LoadEnv: %v", err)
+	}
+	return d
+}
+
+// config returns the exported configuration of d with pointers resolved.
+func config(t *testing.T, d drivers.Driver) map[string]any {
+	t.Helper()
+	jd, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("marshal config: %v", err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(jd, &m); err != nil {
+		t.Fatalf("unmarshal config: %v", err)
+	}
+	return m
+}
+
+func testLoad(t *testing.T, c Case) {
+	fromEnv := New(t, c, c.Env)
+	for k := range c.Env {
+		os.Unsetenv(EnvKeyPrefix + k)
+	}
+	resetFlags(t)
+	setFlags(t, c.Flags)
+	fromFlags := c.New()
+	if err := fromFlags.LoadFlags(); err != nil {
+		t.Fatalf("LoadFlags: %v", err)
+	}
+	if err := fromFlags.LoadEnv(EnvKeyPrefix); err != nil {
+		t.Fatalf("LoadEnv: %v", err)
+	}
+	fe, ff := config(t, fromEnv), config(t, fromFlags)
+	if !reflect.DeepEqual(fe, ff) {
+		t.Errorf("env and flag configurations differ\nenv:   %v\nflags: %v", fe, ff)
+	}
+}
+
+func testBadConfig(t *testing.T, c Case) {
+	if c.BadEnv == nil {
+		t.Skip("no bad configuration")
+	}
+	d := New(t, c, c.BadEnv)
+	if err := d.Init(); err != nil {
+		return
+	}
+	defer d.Cleanup()
+	if err := d.Push(bytes.NewReader(Payloads()[3].Data)); err == nil {
+		t.Error("expected Init or Push to fail")
+	}
+}
+
+func testPush(t *testing.T, c Case) {
+	d := New(t, c, c.Env)
+	if err := d.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	defer d.Cleanup()
+	for _, p := range Payloads() {
+		t.Run(p.Name, func(t *testing.T) {
+			err := d.Push(bytes.NewReader(p.Data))
+			if c.JSON && !p.JSON {
+				if err == nil {
+					t.Fatal("expected non-JSON payload to be rejected")
+				}
+				if !errors.Is(drivers.PushError(err), drivers.ErrPushRejected) {
+					t.Errorf("expected permanent error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Push: %v", err)
+			}
+			if c.Received == nil {
+				return
+			}
+			got := c.Received(t)
+			if c.JSON {
+				assertJSONEqual(t, p.Data, got)
+			} else if !bytes.Equal(got, p.Data) {
+				t.Errorf("received %d bytes, want %d bytes", len(got), len(p.Data))
+			}
+		})
+	}
+}
+
+func assertJSONEqual(t *testing.T, want, got []byte) {
+	t.Helper()
+	var w, g any
+	if err := json.Unmarshal(want, &w); err != nil {
+		t.Fatalf("unmarshal want: %v", err)
+	}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("unmarshal received %q: %v", got, err)
+	}
+	if !reflect.DeepEqual(w, g) {
+		t.Errorf("received %s, want %s", got, want)
+	}
+}
+
+func testCleanup(t *testing.T, c Case) {
+	d := New(t, c, c.Env)
+	if err := d.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := d.Cleanup(); err != nil {
+			t.Fatalf("Cleanup %d: %v", i+1, err)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package sqlfake
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// MySQL commands.
+const (
+	myComQuit             = 0x01
+	myComPing             = 0x0e
+	myComStmtPrepare      = 0x16
+	myComStmtExecute      = 0x17
+	myComStmtSendLongData = 0x18
+	myComStmtClose        = 0x19
+	myComStmtReset        = 0x1a
+)
+
+// myCapabilities are the capability flags of the server: long password,
+// protocol 4.1, transactions, secure connection and plugin auth.
+const myCapabilities = 0x1 | 0x200 | 0x2000 | 0x8000 | 0x80000
+
+// myMaxPacket is the payload size above which a packet is split.
+const myMaxPacket = 1<<24 - 1
+
+// ServeMySQL serves db over the MySQL client/server protocol until the
+// test completes, and returns its address. Statements are executed as
+// prepared statements, the ? placeholders of which SQLite shares.
+func ServeMySQL(t *testing.T, db *sql.DB) *net.TCPAddr {
+	t.Helper()
+	return serve(t, func(c net.Conn) {
+		mc := &myConn{
+			r:     bufio.NewReader(c),
+			w:     bufio.NewWriter(c),
+			db:    db,
+			stmts: make(map[uint32]*myStmt),
+		}
+		mc.serve()
+	})
+}
+
+// myConn is a single client connection.
+type myConn struct {
+	r     *bufio.Reader
+	w     *bufio.Writer
+	db    *sql.DB
+	seq   byte
+	stmts map[uint32]*myStmt
+	next  uint32
+}
+
+// myStmt is a prepared statement, and the long data sent for its
+// parameters.
+type myStmt struct {
+	query  string
+	params int
+	long   map[int][]byte
+}
+
+func (c *myConn) serve() {
+	if err := c.handshake(); err != nil {
+		return
+	}
+	for {
+		bd, err := c.read()
+		if err != nil || len(bd) == 0 {
+			return
+		}
+		switch bd[0] {
+		case myComQuit:
+			return
+		case myComPing:
+			c.ok(0)
+		case myComStmtPrepare:
+			c.prepare(string(bd[1:]))
+		case myComStmtExecute:
+			c.execute(bd[1:])
+		case myComStmtSendLongData:
+			if len(bd) >= 7 {
+				if st := c.stmts[binary.LittleEndian.Uint32(bd[1:])]; st != nil {
+					i := int(binary.LittleEndian.Uint16(bd[5:]))
+					st.long[i] = append(st.long[i], bd[7:]...)
+				}
+			}
+			continue
+		case myComStmtClose:
+			if len(bd) >= 5 {
+				delete(c.stmts, binary.LittleEndian.Uint32(bd[1:]))
+			}
+			continue
+		case myComStmtReset:
+			if len(bd) >= 5 {
+				if st := c.stmts[binary.LittleEndian.Uint32(bd[1:])]; st != nil {
+					st.long = make(map[int][]byte)
+				}
+			}
+			c.ok(0)
+		default:
+			c.error(fmt.Errorf("unsupported command 0x%02x", bd[0]))
+		}
+		if c.w.Flush() != nil {
+			return
+		}
+	}
+}
+
+// read reads a packet, joining those split at the maximum packet size,
+// and sets the sequence of the response.
+func (c *myConn) read() ([]byte, error) {
+	var bd []byte
+	for {
+		var h [4]byte
+		if _, err := io.ReadFull(c.r, h[:]); err != nil {
+			return nil, err
+		}
+		n := int(h[0]) | int(h[1])<<8 | int(h[2])<<16
+		c.seq = h[3] + 1
+		p := make([]byte, n)
+		if _, err := io.ReadFull(c.r, p); err != nil {
+			return nil, err
+		}
+		bd = append(bd, p...)
+		if n < myMaxPacket {
+			return bd, nil
+		}
+	}
+}
+
+// write writes the packet bd with the next sequence.
+func (c *myConn) write(bd []byte) {
+	for {
+		n := len(bd)
+		if n > myMaxPacket {
+			n = myMaxPacket
+		}
+		c.w.Write([]byte{byte(n), byte(n >> 8), byte(n >> 16), c.seq})
+		c.w.Write(bd[:n])
+		c.seq++
+		bd = bd[n:]
+		if n < myMaxPacket {
+			return
+		}
+	}
+}
+
+// handshake sends the initial handshake and accepts any response to it.
+func (c *myConn) handshake() error {
+	bd := []byte{10}
+	bd = append(bd, "8.0.0-sqlfake\x00"...)
+	bd = binary.LittleEndian.AppendUint32(bd, 1)
+	bd = append(bd, "12345678\x00"...)
+	bd = binary.LittleEndian.AppendUint16(bd, myCapabilities&0xffff)
+	bd = append(bd, 45)
+	bd = binary.LittleEndian.AppendUint16(bd, 0x2)
+	bd = binary.LittleEndian.AppendUint16(bd, myCapabilities>>16)
+	bd = append(bd, 21)
+	bd = append(bd, make([]byte, 10)...)
+	bd = append(bd, "123456789012\x00"...)
+	bd = append(bd, "mysql_native_password\x00"...)
+	c.write(bd)
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := c.read(); err != nil {
+		return err
+	}
+	c.ok(0)
+	return c.w.Flush()
+}
+
+// ok sends an OK packet, with the autocommit status, for n affected rows.
+func (c *myConn) ok(n int64) {
+	bd := appendLenEnc([]byte{0x00}, uint64(n))
+	bd = append(bd, 0, 0x2, 0, 0, 0)
+	c.write(bd)
+}
+
+// error sends an ERR packet for err.
+func (c *myConn) error(err error) {
+	bd := []byte{0xff}
+	bd = binary.LittleEndian.AppendUint16(bd, 1105)
+	bd = append(bd, "#HY000"...)
+	bd = append(bd, err.Error()...)
+	c.write(bd)
+}
+
+// prepare sends the statement id, and a definition for each of its
+// parameters. Statements are not expected to return rows.
+func (c *myConn) prepare(q string) {
+	c.next++
+	st := &myStmt{
+		query:  q,
+		params: strings.Count(q, "?"),
+		long:   make(map[int][]byte),
+	}
+	c.stmts[c.next] = st
+	bd := []byte{0x00}
+	bd = binary.LittleEndian.AppendUint32(bd, c.next)
+	bd = binary.LittleEndian.AppendUint16(bd, 0)
+	bd = binary.LittleEndian.AppendUint16(bd, uint16(st.params))
+	bd = append(bd, 0, 0, 0)
+	c.write(bd)
+	if st.params == 0 {
+		return
+	}
+	for i := 0; i < st.params; i++ {
+		def := []byte{}
+		for _, s := range []string{"def", "", "", "", "?", ""} {
+			def = appendLenEnc(def, uint64(len(s)))
+			def = append(def, s...)
+		}
+		def = append(def, 0x0c, 33, 0, 0, 0, 0, 0, 0xfd, 0, 0, 0, 0, 0)
+		c.write(def)
+	}
+	c.write([]byte{0xfe, 0, 0, 0x2, 0})
+}
+
+// execute runs a prepared statement with its parameters, which must be
+// strings, blobs or NULL.
+func (c *myConn) execute(bd []byte) {
+	if len(bd) < 9 {
+		c.error(io.ErrUnexpectedEOF)
+		return
+	}
+	st := c.stmts[binary.LittleEndian.Uint32(bd)]
+	if st == nil {
+		c.error(fmt.Errorf("unknown statement"))
+		return
+	}
+	defer func() { st.long = make(map[int][]byte) }()
+	args, err := st.args(bd[9:])
+	if err != nil {
+		c.error(err)
+		return
+	}
+	_, n, err := exec(c.db, st.query, args)
+	if err != nil {
+		c.error(err)
+		return
+	}
+	c.ok(n)
+}
+
+// args decodes the parameters of a COM_STMT_EXECUTE after its iteration
+// count.
+func (st *myStmt) args(bd []byte) ([][]byte, error) {
+	args := make([][]byte, st.params)
+	if st.params == 0 {
+		return args, nil
+	}
+	mask := (st.params + 7) / 8
+	if len(bd) < mask+1+2*st.params {
+		return nil, io.ErrUnexpectedEOF
+	}
+	nulls, types := bd[:mask], bd[mask+1:mask+1+2*st.params]
+	if bd[mask] != 1 {
+		return nil, fmt.Errorf("parameter types are not bound")
+	}
+	bd = bd[mask+1+2*st.params:]
+	for i := range args {
+		if nulls[i/8]&(1<<(i%8)) != 0 {
+			continue
+		}
+		if v, ok := st.long[i]; ok {
+			args[i] = v
+			continue
+		}
+		switch t := types[2*i]; t {
+		case 0x0f, 0xf5, 0xf9, 0xfa, 0xfb, 0xfc, 0xfd, 0xfe:
+			n, w := readLenEnc(bd)
+			if w == 0 || uint64(len(bd)-w) < n {
+				return nil, io.ErrUnexpectedEOF
+			}
+			args[i] = append([]byte{}, bd[w:w+int(n)]...)
+			bd = bd[w+int(n):]
+		default:
+			return nil, fmt.Errorf("unsupported parameter type 0x%02x", t)
+		}
+	}
+	return args, nil
+}
+
+// appendLenEnc appends the length-encoded integer n to bd.
+func appendLenEnc(bd []byte, n uint64) []byte {
+	switch {
+	case n < 251:
+		return append(bd, byte(n))
+	case n < 1<<16:
+		return binary.LittleEndian.AppendUint16(append(bd, 0xfc), uint16(n))
+	case n < 1<<24:
+		return append(bd, 0xfd, byte(n), byte(n>>8), byte(n>>16))
+	}
+	return binary.LittleEndian.AppendUint64(append(bd, 0xfe), n)
+}
+
+// readLenEnc returns the length-encoded integer at the start of bd, and
+// its width, which is 0 if bd is too short.
+func readLenEnc(bd []byte) (uint64, int) {
+	if len(bd) == 0 {
+		return 0, 0
+	}
+	switch bd[0] {
+	case 0xfc:
+		if len(bd) >= 3 {
+			return uint64(binary.LittleEndian.Uint16(bd[1:])), 3
+		}
+	case 0xfd:
+		if len(bd) >= 4 {
+			return uint64(bd[1]) | uint64(bd[2])<<8 | uint64(bd[3])<<16, 4
+		}
+	case 0xfe:
+		if len(bd) >= 9 {
+			return binary.LittleEndian.Uint64(bd[1:]), 9
+		}
+	default:
+		return uint64(bd[0]), 1
+	}
+	return 0, 0
+}
@@ -0,0 +1,315 @@
+package sqlfake
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// Protocol codes of PostgreSQL startup messages.
+const (
+	pgProtocolVersion = 196608
+	pgSSLRequest      = 80877103
+)
+
+// pgParam matches the $n placeholders of PostgreSQL statements.
+var pgParam = regexp.MustCompile(`\$(\d+)`)
+
+// ServePostgres serves db over the PostgreSQL frontend/backend protocol
+// until the test completes, and returns its address. The $n placeholders
+// of statements are rewritten to their SQLite ?n equivalent.
+func ServePostgres(t *testing.T, db *sql.DB) *net.TCPAddr {
+	t.Helper()
+	return serve(t, func(c net.Conn) {
+		pc := &pgConn{
+			r:     bufio.NewReader(c),
+			w:     bufio.NewWriter(c),
+			db:    db,
+			stmts: make(map[string]string),
+		}
+		pc.serve()
+	})
+}
+
+// pgConn is a single client connection using the extended query protocol
+// with unnamed portals.
+type pgConn struct {
+	r  *bufio.Reader
+	w  *bufio.Writer
+	db *sql.DB
+	// stmts are the parsed statements by name.
+	stmts map[string]string
+	// query and args are bound to the unnamed portal.
+	query string
+	args  [][]byte
+	// failed is set after an error, until the next Sync.
+	failed bool
+}
+
+func (c *pgConn) serve() {
+	if err := c.startup(); err != nil {
+		return
+	}
+	for {
+		typ, err := c.r.ReadByte()
+		if err != nil {
+			return
+		}
+		bd, err := c.read()
+		if err != nil {
+			return
+		}
+		m := &pgMsg{bd: bd}
+		switch typ {
+		case 'Q':
+			c.simpleQuery(m.string())
+		case 'P':
+			name, q := m.string(), m.string()
+			if !c.failed {
+				c.stmts[name] = q
+				c.send('1', nil)
+			}
+		case 'D':
+			kind, name := m.byte(), m.string()
+			if !c.failed {
+				c.describe(kind, name)
+			}
+		case 'B':
+			if !c.failed {
+				c.bind(m)
+			}
+		case 'E':
+			if !c.failed {
+				c.execute()
+			}
+		case 'C':
+			if !c.failed {
+				c.send('3', nil)
+			}
+		case 'S':
+			c.failed = false
+			c.ready()
+		case 'H':
+			c.w.Flush()
+		case 'X':
+			return
+		default:
+			c.error(fmt.Errorf("unsupported message %q", typ))
+			c.ready()
+		}
+	}
+}
+
+// read reads the body of a message after its length.
+func (c *pgConn) read() ([]byte, error) {
+	var n int32
+	if err := binary.Read(c.r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	if n < 4 {
+		return nil, fmt.Errorf("invalid message length %d", n)
+	}
+	bd := make([]byte, n-4)
+	_, err := io.ReadFull(c.r, bd)
+	return bd, err
+}
+
+// startup declines SSL and accepts the startup message without
+// authentication.
+func (c *pgConn) startup() error {
+	for {
+		bd, err := c.read()
+		if err != nil {
+			return err
+		}
+		if len(bd) < 4 {
+			return fmt.Errorf("invalid startup message")
+		}
+		switch binary.BigEndian.Uint32(bd) {
+		case pgSSLRequest:
+			c.w.WriteByte('N')
+			c.w.Flush()
+		case pgProtocolVersion:
+			c.send('R', binary.BigEndian.AppendUint32(nil, 0))
+			c.send('S', []byte("server_version\x0014.0\x00"))
+			c.ready()
+			return nil
+		default:
+			return fmt.Errorf("unsupported protocol version")
+		}
+	}
+}
+
+// send writes a message of type typ.
+func (c *pgConn) send(typ byte, bd []byte) {
+	c.w.WriteByte(typ)
+	binary.Write(c.w, binary.BigEndian, int32(len(bd)+4))
+	c.w.Write(bd)
+}
+
+// ready sends ReadyForQuery, idle, and flushes the connection.
+func (c *pgConn) ready() {
+	c.send('Z', []byte{'I'})
+	c.w.Flush()
+}
+
+// error sends an ErrorResponse for err, and ignores messages until the
+// next Sync.
+func (c *pgConn) error(err error) {
+	var b bytes.Buffer
+	for _, f := range []struct {
+		code byte
+		v    string
+	}{{'S', "ERROR"}, {'V', "ERROR"}, {'C', "XX000"}, {'M', err.Error()}} {
+		b.WriteByte(f.code)
+		b.WriteString(f.v)
+		b.WriteByte(0)
+	}
+	b.WriteByte(0)
+	c.send('E', b.Bytes())
+	c.failed = true
+}
+
+// complete sends the CommandComplete of the statement.
+func (c *pgConn) complete(cmd string, n int64) {
+	tag := cmd
+	switch cmd {
+	case "INSERT":
+		tag = fmt.Sprintf("INSERT 0 %d", n)
+	case "UPDATE", "DELETE":
+		tag = fmt.Sprintf("%s %d", cmd, n)
+	}
+	c.send('C', append([]byte(tag), 0))
+}
+
+func (c *pgConn) simpleQuery(q string) {
+	defer c.ready()
+	c.failed = false
+	if len(bytes.Trim([]byte(q), "; \t\r\n")) == 0 {
+		c.send('I', nil)
+		return
+	}
+	cmd, n, err := exec(c.db, pgParam.ReplaceAllString(q, "?$1"), nil)
+	if err != nil {
+		c.error(err)
+		return
+	}
+	c.complete(cmd, n)
+}
+
+// describe sends the parameters of a statement, all of which are text,
+// and that it returns no rows.
+func (c *pgConn) describe(kind byte, name string) {
+	if kind == 'S' {
+		q, ok := c.stmts[name]
+		if !ok {
+			c.error(fmt.Errorf("statement %q does not exist", name))
+			return
+		}
+		var n int
+		for _, m := range pgParam.FindAllStringSubmatch(q, -1) {
+			if i, _ := strconv.Atoi(m[1]); i > n {
+				n = i
+			}
+		}
+		bd := binary.BigEndian.AppendUint16(nil, uint16(n))
+		for i := 0; i < n; i++ {
+			bd = binary.BigEndian.AppendUint32(bd, 25)
+		}
+		c.send('t', bd)
+	}
+	c.send('n', nil)
+}
+
+// bind binds the parameters of a Bind message to the unnamed portal.
+func (c *pgConn) bind(m *pgMsg) {
+	m.string()
+	name := m.string()
+	q, ok := c.stmts[name]
+	if !ok {
+		c.error(fmt.Errorf("statement %q does not exist", name))
+		return
+	}
+	for i, n := 0, m.int16(); i < n; i++ {
+		if m.int16() != 0 {
+			c.error(fmt.Errorf("binary parameters are not supported"))
+			return
+		}
+	}
+	args := make([][]byte, m.int16())
+	for i := range args {
+		if n := m.int32(); n >= 0 {
+			args[i] = append([]byte{}, m.bytes(n)...)
+		}
+	}
+	if m.err != nil {
+		c.error(m.err)
+		return
+	}
+	c.query, c.args = pgParam.ReplaceAllString(q, "?$1"), args
+	c.send('2', nil)
+}
+
+func (c *pgConn) execute() {
+	cmd, n, err := exec(c.db, c.query, c.args)
+	if err != nil {
+		c.error(err)
+		return
+	}
+	c.complete(cmd, n)
+}
+
+// pgMsg reads the fields of a message body.
+type pgMsg struct {
+	bd  []byte
+	err error
+}
+
+func (m *pgMsg) bytes(n int) []byte {
+	if m.err != nil || n > len(m.bd) {
+		m.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := m.bd[:n]
+	m.bd = m.bd[n:]
+	return b
+}
+
+func (m *pgMsg) byte() byte {
+	if b := m.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (m *pgMsg) int16() int {
+	if b := m.bytes(2); b != nil {
+		return int(int16(binary.BigEndian.Uint16(b)))
+	}
+	return 0
+}
+
+func (m *pgMsg) int32() int {
+	if b := m.bytes(4); b != nil {
+		return int(int32(binary.BigEndian.Uint32(b)))
+	}
+	return 0
+}
+
+func (m *pgMsg) string() string {
+	i := bytes.IndexByte(m.bd, 0)
+	if m.err != nil || i < 0 {
+		m.err = io.ErrUnexpectedEOF
+		return ""
+	}
+	s := string(m.bd[:i])
+	m.bd = m.bd[i+1:]
+	return s
+}
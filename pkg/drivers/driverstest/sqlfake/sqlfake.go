@@ -0,0 +1,75 @@
+// Package sqlfake serves a SQLite database over the PostgreSQL and MySQL
+// wire protocols, so that the SQL drivers can run the conformance suite
+// without a database server. Only the subset of each protocol the drivers
+// use to ping and to execute a statement is implemented, and any
+// credentials are accepted.
+package sqlfake
+
+import (
+	"database/sql"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// Open returns a new SQLite database, which is removed when the test
+// completes. Statements are serialized on a single connection.
+func Open(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// serve accepts connections on a local port until the test completes,
+// handling each of them with handle, and returns the address.
+func serve(t *testing.T, handle func(net.Conn)) *net.TCPAddr {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				handle(c)
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr)
+}
+
+// exec runs the statement q with args, which are bound as blobs so that
+// payloads are stored unmodified, and returns the command keyword of q
+// and the number of rows affected.
+func exec(db *sql.DB, q string, args [][]byte) (string, int64, error) {
+	vals := make([]any, len(args))
+	for i, a := range args {
+		if a != nil {
+			vals[i] = a
+		}
+	}
+	res, err := db.Exec(q, vals...)
+	if err != nil {
+		return "", 0, err
+	}
+	n, _ := res.RowsAffected()
+	var cmd string
+	if f := strings.Fields(q); len(f) > 0 {
+		cmd = strings.ToUpper(f[0])
+	}
+	return cmd, n, nil
+}
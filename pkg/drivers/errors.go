@@ -0,0 +1,131 @@
+package drivers
+
+import (
+	"errors"
+
+	"github.com/robertlestak/pushx/pkg/utils"
+)
+
+var (
+	// ErrConfig is returned when the driver or input configuration is invalid.
+	ErrConfig = errors.New("configuration error")
+	// ErrConnect is returned when the driver fails to initialize or connect.
+	ErrConnect = errors.New("connection error")
+	// ErrPushRejected is returned when the destination permanently rejected
+	// the payload. Retrying the same payload will not succeed.
+	ErrPushRejected = errors.New("push rejected")
+	// ErrPushFailed is returned when the push failed in a way which may
+	// succeed if retried.
+	ErrPushFailed = errors.New("push failed")
+	// ErrPartialBatch is returned when some, but not all, payloads of a
+	// multi-payload push failed.
+	ErrPartialBatch = errors.New("partial batch failure")
+	// ErrMetaUnsupported is returned when message metadata is set for a
+	// driver which does not implement MetaPusher.
+	ErrMetaUnsupported = errors.New("driver does not support message metadata")
+	// ErrCloudEventsBinaryUnsupported is returned when CloudEvents binary
+	// mode is set for a driver which does not implement CloudEventsBinder.
+	ErrCloudEventsBinaryUnsupported = errors.New("driver does not support CloudEvents binary mode")
+	// ErrClaimCheckUnsupported is returned when the claim-check driver
+	// does not implement BlobDriver.
+	ErrClaimCheckUnsupported = errors.New("driver does not support claim-check storage")
+	// ErrSourceUnsupported is returned when the relay source driver does
+	// not implement Source.
+	ErrSourceUnsupported = errors.New("driver does not support relaying as a source")
+	// ErrPayloadTooLarge is returned when the payload exceeds the max
+	// payload size.
+	ErrPayloadTooLarge = errors.New("payload exceeds max payload size")
+)
+
+// Exit codes returned by the pushx CLI for each class of error.
+const (
+	ExitOK           = 0
+	ExitUnknown      = 1
+	ExitConfig       = 2
+	ExitConnect      = 3
+	ExitPushRejected = 4
+	ExitPushFailed   = 5
+	ExitPartialBatch = 6
+)
+
+// Error wraps an underlying error with its class. errors.Is matches both
+// the class sentinel and the wrapped error.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func wrap(kind error, err error) error {
+	if err == nil {
+		return nil
+	}
+	var de *Error
+	if errors.As(err, &de) {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// ConfigError classifies err as a configuration error.
+func ConfigError(err error) error {
+	return wrap(ErrConfig, err)
+}
+
+// ConnectError classifies err as a driver initialization or connection error.
+func ConnectError(err error) error {
+	return wrap(ErrConnect, err)
+}
+
+// PartialBatchError classifies err as a partial failure of a
+// multi-payload push, taking precedence over the class of err.
+func PartialBatchError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: ErrPartialBatch, Err: err}
+}
+
+// PushError classifies an error returned by Driver.Push. Errors marked
+// with utils.Permanent are classified as rejected, all other errors are
+// considered retryable failures.
+func PushError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var pe *utils.PushError
+	if errors.As(err, &pe) && !pe.Retryable {
+		return wrap(ErrPushRejected, err)
+	}
+	return wrap(ErrPushFailed, err)
+}
+
+// ExitCode returns the process exit code for err.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrConfig), errors.Is(err, ErrDriverNotFound):
+		return ExitConfig
+	case errors.Is(err, ErrConnect):
+		return ExitConnect
+	case errors.Is(err, ErrPartialBatch):
+		return ExitPartialBatch
+	case errors.Is(err, ErrPushRejected):
+		return ExitPushRejected
+	case errors.Is(err, ErrPushFailed):
+		return ExitPushFailed
+	}
+	return ExitUnknown
+}
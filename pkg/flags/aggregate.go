@@ -0,0 +1,13 @@
+package flags
+
+var (
+	AggregateFormat     = FlagSet.String("aggregate-format", "", "buffer JSON records and push them together as one object in this format: ndjson, json, csv or parquet")
+	AggregateGzip       = FlagSet.Bool("aggregate-gzip", false, "gzip each aggregated object")
+	AggregateMaxRecords = FlagSet.Int("aggregate-max-records", 0, "number of records which triggers a flush of the aggregated object")
+	AggregateMaxBytes   = FlagSet.String("aggregate-max-bytes", "", "encoded size which triggers a flush of the aggregated object, for example 64MiB")
+	AggregateMaxAge     = FlagSet.String("aggregate-max-age", "", "time after the first buffered record which triggers a flush of the aggregated object, for example 5m")
+
+	AggregateParquetSchemaFile   = FlagSet.String("aggregate-parquet-schema-file", "", "parquet-go JSON schema file of parquet objects. If not set, the schema is inferred from the records of each object")
+	AggregateParquetCompression  = FlagSet.String("aggregate-parquet-compression", "snappy", "compression of parquet objects: snappy, zstd, gzip or none")
+	AggregateParquetRowGroupSize = FlagSet.String("aggregate-parquet-row-group-size", "", "size of parquet row groups, for example 64MiB. Defaults to 128MiB")
+)
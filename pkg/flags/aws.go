@@ -4,12 +4,27 @@ var (
 	AWSRegion     = FlagSet.String("aws-region", "", "AWS region")
 	AWSLoadConfig = FlagSet.Bool("aws-load-config", false, "load AWS config from ~/.aws/config")
 	AWSRoleARN    = FlagSet.String("aws-role-arn", "", "AWS role ARN")
+	AWSEndpoint   = FlagSet.String("aws-endpoint", "", "AWS endpoint URL, for S3 compatible storage or LocalStack. (default: the AWS endpoint of the region)")
 	SQSQueueURL   = FlagSet.String("aws-sqs-queue-url", "", "AWS SQS queue URL")
 
 	AWSDynamoTable = FlagSet.String("aws-dynamo-table", "", "AWS DynamoDB table name")
 
-	AWSS3Bucket = FlagSet.String("aws-s3-bucket", "", "AWS S3 bucket")
-	AWSS3Key    = FlagSet.String("aws-s3-key", "", "AWS S3 key")
-	AWSS3ACL    = FlagSet.String("aws-s3-acl", "", "AWS S3 ACL")
-	AWSS3Tags   = FlagSet.String("aws-s3-tags", "", "AWS S3 tags. Comma separated list of key=value pairs")
+	AWSS3Bucket             = FlagSet.String("aws-s3-bucket", "", "AWS S3 bucket")
+	AWSS3Key                = FlagSet.String("aws-s3-key", "", "AWS S3 key")
+	AWSS3ACL                = FlagSet.String("aws-s3-acl", "", "AWS S3 ACL")
+	AWSS3Tags               = FlagSet.String("aws-s3-tags", "", "AWS S3 tags. Comma separated list of key=value pairs")
+	AWSS3ForcePathStyle     = FlagSet.Bool("aws-s3-force-path-style", false, "AWS S3 path-style addressing, with the bucket in the path rather than the host")
+	AWSS3SSE                = FlagSet.String("aws-s3-sse", "", "AWS S3 server-side encryption. (AES256, aws:kms)")
+	AWSS3SSEKMSKeyID        = FlagSet.String("aws-s3-sse-kms-key-id", "", "AWS S3 KMS key ID of aws:kms server-side encryption")
+	AWSS3SSECustomerKey     = FlagSet.String("aws-s3-sse-c-key", "", "AWS S3 base64 encoded 256-bit customer key of SSE-C server-side encryption")
+	AWSS3StorageClass       = FlagSet.String("aws-s3-storage-class", "", "AWS S3 storage class, e.g. STANDARD_IA")
+	AWSS3ContentType        = FlagSet.String("aws-s3-content-type", "", "AWS S3 object Content-Type")
+	AWSS3CacheControl       = FlagSet.String("aws-s3-cache-control", "", "AWS S3 object Cache-Control")
+	AWSS3ContentDisposition = FlagSet.String("aws-s3-content-disposition", "", "AWS S3 object Content-Disposition")
 )
+
+var AWSS3Metadata = &KeyValues{}
+
+func init() {
+	FlagSet.Var(AWSS3Metadata, "aws-s3-metadata", "AWS S3 user metadata key=value, sent as x-amz-meta-key. May be repeated")
+}
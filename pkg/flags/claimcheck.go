@@ -0,0 +1,7 @@
+package flags
+
+var (
+	ClaimCheckDriver    = FlagSet.String("claim-check-driver", "", "blob driver to offload large payloads to, pushing a pointer instead. (aws-s3, fs, gcp-gcs, nfs, smb)")
+	ClaimCheckThreshold = FlagSet.String("claim-check-threshold", "256KiB", "payload size above which payloads are offloaded to the claim-check driver")
+	ClaimCheckPrefix    = FlagSet.String("claim-check-prefix", "", "key prefix for offloaded payloads")
+)
@@ -0,0 +1,11 @@
+package flags
+
+var (
+	CloudEventsMode            = FlagSet.String("cloudevents-mode", "", "wrap payloads as CloudEvents. (structured, binary)")
+	CloudEventsID              = FlagSet.String("cloudevents-id", "", "CloudEvents id. Default: a new UUID")
+	CloudEventsSource          = FlagSet.String("cloudevents-source", "", "CloudEvents source")
+	CloudEventsType            = FlagSet.String("cloudevents-type", "", "CloudEvents type")
+	CloudEventsSubject         = FlagSet.String("cloudevents-subject", "", "CloudEvents subject")
+	CloudEventsTime            = FlagSet.String("cloudevents-time", "", "CloudEvents time. Default: the time of the push")
+	CloudEventsDataContentType = FlagSet.String("cloudevents-datacontenttype", "", "CloudEvents datacontenttype. Default: application/json for JSON payloads")
+)
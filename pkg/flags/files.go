@@ -0,0 +1,11 @@
+package flags
+
+var (
+	InputDir         = FlagSet.String("in-dir", "", "input directory. Each file is pushed as a separate payload")
+	InputRecursive   = FlagSet.Bool("in-recursive", false, "include the subdirectories of -in-dir")
+	InputGlob        = FlagSet.String("in-glob", "", "input file pattern, in which ** matches any number of directories. Each file is pushed as a separate payload")
+	InputInclude     = FlagSet.String("in-include", "", "comma separated patterns of -in-dir or -in-glob files to push. Patterns without a slash match the file name")
+	InputExclude     = FlagSet.String("in-exclude", "", "comma separated patterns of -in-dir or -in-glob files to skip. Patterns without a slash match the file name")
+	InputConcurrency = FlagSet.Int("in-concurrency", 1, "number of -in-dir or -in-glob files to push at once")
+	OnSuccess        = FlagSet.String("on-success", "", "action for each -in-dir, -in-glob or -watch-dir file once pushed. (delete, move:<dir>)")
+)
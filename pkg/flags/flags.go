@@ -4,8 +4,17 @@ import "flag"
 
 var (
 	FlagSet   = flag.NewFlagSet("pushx", flag.ContinueOnError)
-	Driver    = FlagSet.String("driver", "", "driver to use. (activemq, aws-dynamo, aws-s3, aws-sqs, cassandra, centauri, cockroach, couchbase, elasticsearch, etcd, fs, gcp-bq, gcp-firestore, gcp-gcs, gcp-pubsub, github, http, kafka, local, mongodb, mssql, mysql, nats, nfs, nsq, postgres, pulsar, rabbitmq, redis-list, redis-pubsub, redis-stream, scylla, smb)")
+	Driver    = FlagSet.String("driver", "", "driver to use. (activemq, aws-dynamo, aws-s3, aws-sqs, cassandra, centauri, cockroach, couchbase, elasticsearch, etcd, fs, gcp-bq, gcp-firestore, gcp-gcs, gcp-pubsub, github, http, kafka, local, mock, mongodb, mssql, mysql, nats, nfs, nsq, postgres, pulsar, rabbitmq, redis-list, redis-pubsub, redis-stream, scylla, smb)")
 	InputFile = FlagSet.String("in-file", "-", "input file to use. (default: stdin)")
 	InputStr  = FlagSet.String("in", "", "input string to use. Will take precedence over -in-file")
 	Output    = FlagSet.String("out", "", "output file to use in addition to the driver. If '-' then stdout is used.")
+
+	MaxPayloadSize = FlagSet.String("max-payload-size", "", "maximum payload size, e.g. 64MiB. Larger payloads are rejected. (default: unlimited)")
+	Proxy          = FlagSet.String("proxy", "", "proxy of driver connections. (socks5://, socks5h://, http:// or https://) (default: HTTP_PROXY and HTTPS_PROXY for HTTP drivers, ALL_PROXY for others)")
 )
+
+var Meta = &KeyValues{}
+
+func init() {
+	FlagSet.Var(Meta, "meta", "message metadata key=value, set as the driver's native headers or attributes. Values may be templated from the payload. May be repeated")
+}
@@ -0,0 +1,7 @@
+package flags
+
+var (
+	InputFormat  = FlagSet.String("in-format", "raw", "input format. Input other than raw is decoded into JSON records, each pushed as a separate payload. (raw, json, csv, tsv, yaml, msgpack)")
+	InputColumns = FlagSet.String("in-columns", "", "comma separated csv or tsv column names. If not set, the first row is the header")
+	InputNoInfer = FlagSet.Bool("in-no-infer", false, "keep csv and tsv fields as strings, rather than converting numbers, booleans and empty fields")
+)
@@ -1,6 +1,7 @@
 package flags
 
 var (
+	GitHubAPIURL        = FlagSet.String("github-api-url", "", "GitHub API URL, for GitHub Enterprise")
 	GitHubRepo          = FlagSet.String("github-repo", "", "GitHub repo")
 	GitHubOwner         = FlagSet.String("github-owner", "", "GitHub owner")
 	GitHubToken         = FlagSet.String("github-token", "", "GitHub token")
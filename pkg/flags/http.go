@@ -5,10 +5,56 @@ var (
 	HTTPURL                   = FlagSet.String("http-url", "", "HTTP url")
 	HTTPContentType           = FlagSet.String("http-content-type", "", "HTTP content type")
 	HTTPSuccessfulStatusCodes = FlagSet.String("http-successful-status-codes", "", "HTTP successful status codes")
-	HTTPHeaders               = FlagSet.String("http-headers", "", "HTTP headers")
+	HTTPHeaders               = FlagSet.String("http-headers", "", "HTTP headers, comma separated Name:value pairs")
+	HTTPListenAddr            = FlagSet.String("http-listen-addr", "", "HTTP listen address, for example :8080, when used as a relay source")
 	HTTPEnableTLS             = FlagSet.Bool("http-enable-tls", false, "HTTP enable tls")
 	HTTPTLSInsecure           = FlagSet.Bool("http-tls-insecure", false, "HTTP tls insecure")
 	HTTPTLSCertFile           = FlagSet.String("http-tls-cert-file", "", "HTTP tls cert file")
 	HTTPTLSKeyFile            = FlagSet.String("http-tls-key-file", "", "HTTP tls key file")
 	HTTPTLSCAFile             = FlagSet.String("http-tls-ca-file", "", "HTTP tls ca file")
+	HTTPBodyTemplate          = FlagSet.String("http-body-template", "", "HTTP body template rendered with the payload, for example '{\"text\":\"{{message}}\"}'. {{pushx_payload}} is the whole payload")
+	HTTPBodyMode              = FlagSet.String("http-body-mode", "raw", "HTTP body mode. (raw, multipart, form)")
+	HTTPMultipartField        = FlagSet.String("http-multipart-field", "file", "HTTP multipart field name of the payload part")
+	HTTPMultipartFilename     = FlagSet.String("http-multipart-filename", "file", "HTTP multipart filename of the payload part")
+	HTTPMultipartContentType  = FlagSet.String("http-multipart-content-type", "", "HTTP multipart content type of the payload part. (default: -http-content-type, or application/octet-stream)")
+	HTTPTimeout               = FlagSet.String("http-timeout", "", "HTTP timeout of each attempt of a request, including reading the response, for example 30s. (default: none)")
+	HTTPRetries               = FlagSet.Int("http-retries", 0, "HTTP number of times a request is retried when it responds with a retry status code")
+	HTTPRetryStatusCodes      = FlagSet.String("http-retry-status-codes", "429,502,503,504", "HTTP status codes which are retried")
+	HTTPRetryBackoff          = FlagSet.String("http-retry-backoff", "1s", "HTTP delay before the first retry, doubled for each further retry, if the response has no Retry-After header")
+	HTTPRetryMaxWait          = FlagSet.String("http-retry-max-wait", "1m", "HTTP longest wait before a retry. Longer backoffs are shortened, and a longer Retry-After fails the push")
+	HTTPResponseTimeout       = FlagSet.String("http-response-timeout", "", "HTTP timeout waiting for the response headers once the request is sent. (default: none)")
+	HTTPResponseOut           = FlagSet.String("http-response-out", "", "HTTP file each response status and body is written to as a JSON line. If '-' then stdout is used")
+	HTTPResponseAssert        = FlagSet.String("http-response-assert", "", "HTTP assertion on the JSON body of successful responses, for example '.ok == true'. Assertions may be joined with &&")
+
+	HTTPAuthType              = FlagSet.String("http-auth-type", "", "HTTP auth type. (basic, bearer, oauth2, aws-sigv4)")
+	HTTPAuthUsername          = FlagSet.String("http-auth-username", "", "HTTP basic auth username")
+	HTTPAuthPassword          = FlagSet.String("http-auth-password", "", "HTTP basic auth password")
+	HTTPAuthToken             = FlagSet.String("http-auth-token", "", "HTTP bearer token")
+	HTTPAuthTokenFile         = FlagSet.String("http-auth-token-file", "", "HTTP bearer token file, read again when it changes")
+	HTTPAuthOAuthTokenURL     = FlagSet.String("http-auth-oauth-token-url", "", "HTTP OAuth2 token URL to fetch tokens from with the client credentials grant")
+	HTTPAuthOAuthClientID     = FlagSet.String("http-auth-oauth-client-id", "", "HTTP OAuth2 client ID")
+	HTTPAuthOAuthClientSecret = FlagSet.String("http-auth-oauth-client-secret", "", "HTTP OAuth2 client secret")
+	HTTPAuthOAuthScopes       = FlagSet.String("http-auth-oauth-scopes", "", "HTTP OAuth2 scopes, comma separated")
+	HTTPAuthAWSRegion         = FlagSet.String("http-auth-aws-region", "", "HTTP AWS SigV4 region. (default AWS_REGION)")
+	HTTPAuthAWSService        = FlagSet.String("http-auth-aws-service", "execute-api", "HTTP AWS SigV4 service, for example execute-api for API Gateway or es for OpenSearch")
+	HTTPAuthAWSRoleARN        = FlagSet.String("http-auth-aws-role-arn", "", "HTTP AWS SigV4 role ARN to assume")
+
+	HTTPSignSecret          = FlagSet.String("http-sign-secret", "", "HTTP HMAC signing secret. Requests are signed if set")
+	HTTPSignSecretFile      = FlagSet.String("http-sign-secret-file", "", "HTTP HMAC signing secret file")
+	HTTPSignAlgorithm       = FlagSet.String("http-sign-algorithm", "sha256", "HTTP HMAC signing algorithm. (sha1, sha256, sha512)")
+	HTTPSignHeader          = FlagSet.String("http-sign-header", "X-Signature", "HTTP signature header")
+	HTTPSignFormat          = FlagSet.String("http-sign-format", "{{signature}}", "HTTP signature header value, with {{signature}} and {{timestamp}} replaced")
+	HTTPSignPayload         = FlagSet.String("http-sign-payload", "{{body}}", "HTTP signed message, with {{timestamp}} and {{body}} replaced")
+	HTTPSignTimestampHeader = FlagSet.String("http-sign-timestamp-header", "", "HTTP header the Unix timestamp of the signature is sent in")
+	HTTPSignEncoding        = FlagSet.String("http-sign-encoding", "hex", "HTTP signature encoding. (hex, base64)")
+)
+
+var (
+	HTTPHeader    = &Headers{}
+	HTTPFormField = &KeyValues{}
 )
+
+func init() {
+	FlagSet.Var(HTTPHeader, "http-header", "HTTP header 'Name: value'. Values may contain commas and colons. May be repeated")
+	FlagSet.Var(HTTPFormField, "http-form-field", "HTTP form field key=value sent with the multipart and form body modes. May be repeated")
+}
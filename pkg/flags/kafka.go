@@ -1,15 +1,40 @@
 package flags
 
 var (
-	KafkaBrokers      = FlagSet.String("kafka-brokers", "", "Kafka brokers, comma separated")
-	KafkaTopic        = FlagSet.String("kafka-topic", "", "Kafka topic")
-	KafkaEnableTLS    = FlagSet.Bool("kafka-enable-tls", false, "Enable TLS")
-	KafkaTLSInsecure  = FlagSet.Bool("kafka-tls-insecure", false, "Enable TLS insecure")
-	KafkaCAFile       = FlagSet.String("kafka-tls-ca-file", "", "Kafka TLS CA file")
-	KafkaCertFile     = FlagSet.String("kafka-tls-cert-file", "", "Kafka TLS cert file")
-	KafkaKeyFile      = FlagSet.String("kafka-tls-key-file", "", "Kafka TLS key file")
-	KafkaEnableSasl   = FlagSet.Bool("kafka-enable-sasl", false, "Enable SASL")
-	KafkaSaslType     = FlagSet.String("kafka-sasl-type", "", "Kafka SASL type. Can be either 'scram' or 'plain'")
-	KafkaSaslUsername = FlagSet.String("kafka-sasl-username", "", "Kafka SASL user")
-	KafkaSaslPassword = FlagSet.String("kafka-sasl-password", "", "Kafka SASL password")
+	KafkaBrokers                = FlagSet.String("kafka-brokers", "", "Kafka brokers, comma separated")
+	KafkaTopic                  = FlagSet.String("kafka-topic", "", "Kafka topic")
+	KafkaKey                    = FlagSet.String("kafka-key", "", "Kafka message key. May be templated from the payload, for example {{id}}")
+	KafkaPartitioner            = FlagSet.String("kafka-partitioner", "least-bytes", "Kafka partitioner. (hash, murmur2, crc32, round-robin, least-bytes)")
+	KafkaPartition              = FlagSet.Int("kafka-partition", -1, "Kafka partition to write every message to in place of the partitioner. -1 to use the partitioner")
+	KafkaRequiredAcks           = FlagSet.String("kafka-required-acks", "all", "Kafka required acks. (none, one, all)")
+	KafkaCompression            = FlagSet.String("kafka-compression", "none", "Kafka compression codec. (none, gzip, snappy, lz4, zstd)")
+	KafkaBatchSize              = FlagSet.Int("kafka-batch-size", 0, "Kafka batch size. 0 for the default of 100")
+	KafkaBatchBytes             = FlagSet.Int("kafka-batch-bytes", 0, "Kafka maximum bytes of a batch, which bounds the size of a message. 0 for the client default of about 1MB")
+	KafkaBatchTimeout           = FlagSet.String("kafka-batch-timeout", "", "Kafka batch timeout, for example 10ms. (default 1s)")
+	KafkaWriteTimeout           = FlagSet.String("kafka-write-timeout", "", "Kafka write timeout. (default 10s)")
+	KafkaGroup                  = FlagSet.String("kafka-group", "pushx", "Kafka consumer group, when used as a relay source")
+	KafkaSerializer             = FlagSet.String("kafka-serializer", "", "Kafka value serializer, which encodes the JSON input in the Confluent wire format with a schema of the schema registry. (avro, protobuf, json-schema)")
+	KafkaSchemaRegistryURL      = FlagSet.String("kafka-schema-registry-url", "", "Kafka schema registry URL")
+	KafkaSchemaRegistryUsername = FlagSet.String("kafka-schema-registry-username", "", "Kafka schema registry basic auth username")
+	KafkaSchemaRegistryPassword = FlagSet.String("kafka-schema-registry-password", "", "Kafka schema registry basic auth password")
+	KafkaSchemaSubject          = FlagSet.String("kafka-schema-subject", "", "Kafka schema registry subject. (default <topic>-value)")
+	KafkaSchemaFile             = FlagSet.String("kafka-schema-file", "", "Kafka schema file to register under the subject and serialize with, in place of the latest schema of the subject")
+	KafkaSchemaID               = FlagSet.Int("kafka-schema-id", 0, "Kafka schema registry ID of the schema to serialize with, in place of the latest schema of the subject")
+	KafkaSchemaMessage          = FlagSet.String("kafka-schema-message", "", "Kafka fully qualified Protobuf message name of the schema. (default the first message)")
+	KafkaTransactionalID        = FlagSet.String("kafka-transactional-id", "", "Kafka transactional ID. If set, the records of an input are written in a transaction and committed atomically")
+	KafkaEnableTLS              = FlagSet.Bool("kafka-enable-tls", false, "Enable TLS")
+	KafkaTLSInsecure            = FlagSet.Bool("kafka-tls-insecure", false, "Enable TLS insecure")
+	KafkaCAFile                 = FlagSet.String("kafka-tls-ca-file", "", "Kafka TLS CA file")
+	KafkaCertFile               = FlagSet.String("kafka-tls-cert-file", "", "Kafka TLS cert file")
+	KafkaKeyFile                = FlagSet.String("kafka-tls-key-file", "", "Kafka TLS key file")
+	KafkaEnableSasl             = FlagSet.Bool("kafka-enable-sasl", false, "Enable SASL")
+	KafkaSaslType               = FlagSet.String("kafka-sasl-type", "", "Kafka SASL type. (plain, scram, scram-sha-256, scram-sha-512, oauthbearer, aws-msk-iam). scram is scram-sha-512")
+	KafkaSaslUsername           = FlagSet.String("kafka-sasl-username", "", "Kafka SASL user")
+	KafkaSaslPassword           = FlagSet.String("kafka-sasl-password", "", "Kafka SASL password")
+	KafkaSaslOAuthToken         = FlagSet.String("kafka-sasl-oauth-token", "", "Kafka SASL OAUTHBEARER static token")
+	KafkaSaslOAuthTokenURL      = FlagSet.String("kafka-sasl-oauth-token-url", "", "Kafka SASL OAUTHBEARER token URL to fetch tokens from with the client credentials grant")
+	KafkaSaslOAuthClientID      = FlagSet.String("kafka-sasl-oauth-client-id", "", "Kafka SASL OAUTHBEARER client ID")
+	KafkaSaslOAuthClientSecret  = FlagSet.String("kafka-sasl-oauth-client-secret", "", "Kafka SASL OAUTHBEARER client secret")
+	KafkaSaslOAuthScopes        = FlagSet.String("kafka-sasl-oauth-scopes", "", "Kafka SASL OAUTHBEARER scopes, comma separated")
+	KafkaSaslAWSRegion          = FlagSet.String("kafka-sasl-aws-region", "", "Kafka SASL AWS_MSK_IAM region. (default AWS_REGION)")
 )
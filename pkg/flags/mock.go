@@ -0,0 +1,11 @@
+package flags
+
+var (
+	MockFile          = FlagSet.String("mock-file", "", "Mock JSONL capture file. If empty, pushes are only captured in memory")
+	MockFailEvery     = FlagSet.Int("mock-fail-every", 0, "Mock fail every Nth push. 0 to never fail")
+	MockFailError     = FlagSet.String("mock-fail-error", "retryable", "Mock injected error class. (retryable, permanent)")
+	MockLatency       = FlagSet.String("mock-latency", "", "Mock push latency, for example 100ms")
+	MockLatencyJitter = FlagSet.String("mock-latency-jitter", "", "Mock push latency jitter, for example 20ms")
+	MockLatencyDist   = FlagSet.String("mock-latency-dist", "uniform", "Mock latency jitter distribution. (uniform, normal)")
+	MockTransactions  = FlagSet.Bool("mock-transactions", false, "Mock transactions, capturing the records of an input only once they are committed")
+)
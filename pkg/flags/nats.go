@@ -3,6 +3,7 @@ package flags
 var (
 	NATSURL         = FlagSet.String("nats-url", "", "NATS URL")
 	NATSSubject     = FlagSet.String("nats-subject", "", "NATS subject")
+	NATSConsumer    = FlagSet.String("nats-consumer", "pushx", "NATS JetStream durable consumer, when used as a relay source")
 	NATSCredsFile   = FlagSet.String("nats-creds-file", "", "NATS creds file")
 	NATSJWTFile     = FlagSet.String("nats-jwt-file", "", "NATS JWT file")
 	NATSNKeyFile    = FlagSet.String("nats-nkey-file", "", "NATS NKey file")
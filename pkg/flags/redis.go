@@ -12,5 +12,7 @@ var (
 	RedisCertFile      = FlagSet.String("redis-tls-cert-file", "", "Redis TLS cert file")
 	RedisKeyFile       = FlagSet.String("redis-tls-key-file", "", "Redis TLS key file")
 
-	RedisMessageID = FlagSet.String("redis-message-id", "*", "Redis stream message id")
+	RedisMessageID     = FlagSet.String("redis-message-id", "*", "Redis stream message id")
+	RedisConsumerGroup = FlagSet.String("redis-consumer-group", "pushx", "Redis stream consumer group, when used as a relay source")
+	RedisConsumerName  = FlagSet.String("redis-consumer-name", "", "Redis stream consumer name, when used as a relay source. Defaults to the hostname")
 )
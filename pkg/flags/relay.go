@@ -0,0 +1,9 @@
+package flags
+
+var (
+	RelaySource       = FlagSet.String("relay-source", "", "source driver to receive messages from with the relay command. (aws-sqs, fs, http, kafka, mock, nats, rabbitmq, redis-list, redis-stream)")
+	RelayRetries      = FlagSet.Int("relay-retries", 3, "number of times a failed relay push is retried before the message is dead lettered or returned to the source")
+	RelayRetryBackoff = FlagSet.String("relay-retry-backoff", "1s", "delay before the first relay retry, doubled for each further retry")
+	RelayDLQDriver    = FlagSet.String("relay-dlq-driver", "", "driver to push messages which fail to relay to, before acknowledging them. Without it, payloads rejected by the driver are dropped")
+	RelayMetricsAddr  = FlagSet.String("relay-metrics-addr", "", "address to serve relay Prometheus metrics on at /metrics, for example :9090")
+)
@@ -0,0 +1,85 @@
+package flags
+
+import (
+	"errors"
+	"strings"
+)
+
+// KeyValues is a repeatable flag of key=value pairs.
+type KeyValues []string
+
+func (kv *KeyValues) String() string {
+	return strings.Join(*kv, ",")
+}
+
+func (kv *KeyValues) Set(s string) error {
+	if !strings.Contains(s, "=") {
+		return errors.New("expected key=value")
+	}
+	*kv = append(*kv, s)
+	return nil
+}
+
+// Map returns the pairs as a map. Later pairs override earlier pairs
+// with the same key.
+func (kv *KeyValues) Map() map[string]string {
+	if len(*kv) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(*kv))
+	for _, v := range *kv {
+		p := strings.SplitN(v, "=", 2)
+		m[p[0]] = p[1]
+	}
+	return m
+}
+
+// Headers is a repeatable flag of "Name: value" headers.
+type Headers []string
+
+func (h *Headers) String() string {
+	return strings.Join(*h, ",")
+}
+
+func (h *Headers) Set(s string) error {
+	if i := strings.Index(s, ":"); i < 1 {
+		return errors.New("expected Name: value")
+	}
+	*h = append(*h, s)
+	return nil
+}
+
+// Map returns the headers as a map. Later headers override earlier headers
+// with the same name.
+func (h *Headers) Map() map[string]string {
+	if len(*h) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(*h))
+	for _, v := range *h {
+		p := strings.SplitN(v, ":", 2)
+		m[strings.TrimSpace(p[0])] = strings.TrimSpace(p[1])
+	}
+	return m
+}
+
+// SplitList splits a comma separated list from an environment variable. A
+// comma within an item is escaped as \, and a backslash as \\, so that
+// values such as JSON fragments can be set.
+func SplitList(s string) []string {
+	var items []string
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s) && (s[i+1] == ',' || s[i+1] == '\\'):
+			i++
+			b.WriteByte(s[i])
+		case c == ',':
+			items = append(items, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return append(items, b.String())
+}
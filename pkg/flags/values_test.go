@@ -0,0 +1,23 @@
+package flags_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/robertlestak/pushx/pkg/flags"
+)
+
+func TestSplitList(t *testing.T) {
+	for s, want := range map[string][]string{
+		"a=1":                 {"a=1"},
+		"a=1,b=2":             {"a=1", "b=2"},
+		`tags=x\,y,b=2`:       {"tags=x,y", "b=2"},
+		`json={"a":1\,"b":2}`: {`json={"a":1,"b":2}`},
+		`path=C:\\dir\\,b=\x`: {`path=C:\dir\`, `b=\x`},
+		`trailing=\`:          {`trailing=\`},
+	} {
+		if got := flags.SplitList(s); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package flags
+
+var (
+	WatchFile         = FlagSet.String("watch-file", "", "file to follow, pushing each appended line until signaled. Rotation and truncation are detected")
+	WatchDir          = FlagSet.String("watch-dir", "", "directory to watch, pushing each new file until signaled")
+	WatchStateFile    = FlagSet.String("watch-state-file", "", "file to persist the watch progress to, so that a restart neither duplicates nor skips data")
+	WatchBatch        = FlagSet.Int("watch-batch", 1, "maximum number of -watch-file lines pushed as one newline separated payload")
+	WatchPollInterval = FlagSet.String("watch-poll-interval", "1s", "interval to check -watch-file for new data")
+	WatchSettle       = FlagSet.String("watch-settle", "1s", "time a new -watch-dir file must go unmodified before it is pushed")
+)
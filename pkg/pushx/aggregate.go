@@ -0,0 +1,361 @@
+package pushx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/schema"
+	"github.com/robertlestak/pushx/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// AggregateNDJSON writes one JSON record per line.
+	AggregateNDJSON = "ndjson"
+	// AggregateJSON writes the records as a JSON array.
+	AggregateJSON = "json"
+	// AggregateCSV writes the fields of JSON object records as CSV rows,
+	// with a header of the fields of the first record.
+	AggregateCSV = "csv"
+	// AggregateParquet writes JSON object records as a parquet file.
+	AggregateParquet = "parquet"
+)
+
+// Aggregate configures buffering payloads as records and pushing them
+// together as one object. A flush is triggered by whichever of
+// MaxRecords, MaxBytes or MaxAge is reached first, and on Close.
+type Aggregate struct {
+	// Format is AggregateNDJSON, AggregateJSON, AggregateCSV or
+	// AggregateParquet. Records must be JSON, and JSON objects for
+	// AggregateCSV and AggregateParquet.
+	Format string `json:"format"`
+	// Gzip compresses each object, other than parquet objects.
+	Gzip bool `json:"gzip"`
+	// ParquetSchema is the parquet-go JSON schema of parquet objects. If
+	// empty, the schema is inferred from the records of each object, with
+	// every column optional.
+	ParquetSchema string `json:"parquetSchema"`
+	// ParquetCompression is the compression codec of parquet objects:
+	// ParquetSnappy, ParquetZstd, ParquetGzip or ParquetNone.
+	ParquetCompression string `json:"parquetCompression"`
+	// ParquetRowGroupSize is the size of parquet row groups. It defaults
+	// to 128MiB.
+	ParquetRowGroupSize int64 `json:"parquetRowGroupSize"`
+	// MaxRecords is the number of records which triggers a flush.
+	MaxRecords int `json:"maxRecords"`
+	// MaxBytes is the encoded, uncompressed size which triggers a flush.
+	MaxBytes int64 `json:"maxBytes"`
+	// MaxAge is the time after the first buffered record which triggers
+	// a flush.
+	MaxAge time.Duration `json:"maxAge"`
+}
+
+// aggregator is the buffer of an Aggregate. It also serializes the use of
+// the driver between pushes and timed flushes.
+type aggregator struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	count   int
+	start   time.Time
+	columns []string
+	timer   *time.Timer
+	// tmpl is the key template of keyed drivers
+	tmpl string
+	// closed is set once the drivers are cleaned up, after which the
+	// timer no longer flushes
+	closed bool
+}
+
+// check returns an error if the configuration is invalid.
+func (a *Aggregate) check() error {
+	if a == nil {
+		return nil
+	}
+	switch a.Format {
+	case AggregateNDJSON, AggregateJSON, AggregateCSV:
+	case AggregateParquet:
+		if err := a.checkParquet(); err != nil {
+			return err
+		}
+	default:
+		return drivers.ConfigError(fmt.Errorf("unknown aggregate format %q", a.Format))
+	}
+	if a.MaxRecords < 0 || a.MaxBytes < 0 || a.MaxAge < 0 {
+		return drivers.ConfigError(errors.New("aggregate limits must not be negative"))
+	}
+	return nil
+}
+
+// checkInput returns an error if aggregation is combined with input whose
+// progress is recorded once a payload is pushed, since a push only buffers
+// its records, which are lost if the flush fails or pushx exits first.
+func (a *Aggregate) checkInput(f *Files, w *Watch) error {
+	if a == nil {
+		return nil
+	}
+	if (f != nil && f.OnSuccess != "") || (w != nil && w.OnSuccess != "") {
+		return drivers.ConfigError(errors.New("aggregation is not supported with an on-success action, since files would be deleted or moved before their records are flushed"))
+	}
+	if w != nil && w.StateFile != "" {
+		return drivers.ConfigError(errors.New("aggregation is not supported with a watch state file, since the state would advance before records are flushed"))
+	}
+	return nil
+}
+
+// records returns the JSON records of the payload bd, which is either a
+// single JSON value or newline delimited JSON.
+func records(bd []byte) ([][]byte, error) {
+	if json.Valid(bd) {
+		return [][]byte{bd}, nil
+	}
+	var recs [][]byte
+	for _, ln := range bytes.Split(bd, []byte("\n")) {
+		ln = bytes.TrimSpace(ln)
+		if len(ln) == 0 {
+			continue
+		}
+		if !json.Valid(ln) {
+			return nil, utils.Permanent(errors.New("aggregate record is not valid JSON"))
+		}
+		recs = append(recs, ln)
+	}
+	return recs, nil
+}
+
+// encode appends the record bd to the buffer.
+func (a *Aggregate) encode(g *aggregator, bd []byte) error {
+	switch a.Format {
+	case AggregateParquet:
+		var rec map[string]json.RawMessage
+		if err := json.Unmarshal(bd, &rec); err != nil {
+			return utils.Permanent(fmt.Errorf("aggregate record is not a JSON object: %w", err))
+		}
+		fallthrough
+	case AggregateNDJSON:
+		if err := json.Compact(&g.buf, bd); err != nil {
+			return utils.Permanent(err)
+		}
+		g.buf.WriteByte('\n')
+	case AggregateJSON:
+		if g.count == 0 {
+			g.buf.WriteByte('[')
+		} else {
+			g.buf.WriteByte(',')
+		}
+		if err := json.Compact(&g.buf, bd); err != nil {
+			return utils.Permanent(err)
+		}
+	case AggregateCSV:
+		var rec map[string]json.RawMessage
+		if err := json.Unmarshal(bd, &rec); err != nil {
+			return utils.Permanent(fmt.Errorf("aggregate record is not a JSON object: %w", err))
+		}
+		w := csv.NewWriter(&g.buf)
+		if g.count == 0 {
+			g.columns = nil
+			for k := range rec {
+				g.columns = append(g.columns, k)
+			}
+			sort.Strings(g.columns)
+			w.Write(g.columns)
+		}
+		row := make([]string, len(g.columns))
+		for i, c := range g.columns {
+			v, ok := rec[c]
+			if !ok || string(v) == "null" {
+				continue
+			}
+			var s string
+			if err := json.Unmarshal(v, &s); err == nil {
+				row[i] = s
+			} else {
+				row[i] = string(v)
+			}
+		}
+		w.Write(row)
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// object returns the buffered records as an object.
+func (a *Aggregate) object(g *aggregator) ([]byte, error) {
+	data := g.buf.Bytes()
+	if a.Format == AggregateParquet {
+		return a.parquet(data)
+	}
+	if a.Format == AggregateJSON {
+		data = append(append([]byte(nil), data...), ']')
+	}
+	if !a.Gzip {
+		return data, nil
+	}
+	var zb bytes.Buffer
+	zw := gzip.NewWriter(&zb)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return zb.Bytes(), nil
+}
+
+// aggregate buffers the payload r as a record, flushing the buffer if a
+// limit is reached. If the flush fails, the record is removed from the
+// buffer again, so that it can be retried without being duplicated. The
+// payload may be newline delimited JSON, in which case each line is a
+// record.
+func (j *PushX) aggregate(r io.Reader) error {
+	a := j.Aggregate
+	bd, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if j.agg == nil {
+		if err := a.check(); err != nil {
+			return err
+		}
+		j.agg = &aggregator{}
+		if kd, ok := j.Driver.(drivers.KeyedDriver); ok {
+			j.agg.tmpl = kd.GetKey()
+		}
+	}
+	g := j.agg
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	recs, err := records(bd)
+	if err != nil {
+		return err
+	}
+	size, count, columns := g.buf.Len(), g.count, g.columns
+	rollback := func() {
+		g.buf.Truncate(size)
+		g.count, g.columns = count, columns
+		if count == 0 && g.timer != nil {
+			g.timer.Stop()
+			g.timer = nil
+		}
+	}
+	for _, rec := range recs {
+		if err := a.encode(g, rec); err != nil {
+			rollback()
+			return err
+		}
+		g.count++
+	}
+	if count == 0 && g.count > 0 {
+		g.start = time.Now()
+		if a.MaxAge > 0 {
+			g.timer = time.AfterFunc(a.MaxAge, j.flushAggregateTimer)
+		}
+	}
+	if (a.MaxRecords > 0 && g.count >= a.MaxRecords) || (a.MaxBytes > 0 && int64(g.buf.Len()) >= a.MaxBytes) {
+		if err := j.flushAggregate(); err != nil {
+			rollback()
+			return err
+		}
+	}
+	return nil
+}
+
+// flushAggregateTimer flushes the buffer once MaxAge has passed. Failed
+// flushes are retried after MaxAge.
+func (j *PushX) flushAggregateTimer() {
+	g := j.agg
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return
+	}
+	if err := j.flushAggregate(); err != nil {
+		log.WithFields(log.Fields{
+			"fn":     "flushAggregateTimer",
+			"driver": j.DriverName,
+		}).WithError(err).Error("flush failed, retrying")
+		g.timer = time.AfterFunc(j.Aggregate.MaxAge, j.flushAggregateTimer)
+	}
+}
+
+// FlushAggregate pushes the buffered records, if any.
+func (j *PushX) FlushAggregate() error {
+	if j.agg == nil {
+		return nil
+	}
+	j.agg.mu.Lock()
+	defer j.agg.mu.Unlock()
+	return j.flushAggregate()
+}
+
+// closeAggregate flushes the buffered records before the drivers are
+// cleaned up, and stops the timer even if the flush fails.
+func (j *PushX) closeAggregate() error {
+	g := j.agg
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	err := j.flushAggregate()
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+	g.closed = true
+	return err
+}
+
+// flushAggregate pushes the buffered records as one object, with the key
+// of keyed drivers rendered from their key template. j.agg.mu must be
+// held.
+func (j *PushX) flushAggregate() error {
+	l := log.WithFields(log.Fields{
+		"fn":     "flushAggregate",
+		"driver": j.DriverName,
+	})
+	g := j.agg
+	if g.count == 0 {
+		return nil
+	}
+	obj, err := j.Aggregate.object(g)
+	if err != nil {
+		return err
+	}
+	if kd, ok := j.Driver.(drivers.KeyedDriver); ok {
+		key, err := schema.RenderKey(g.tmpl, map[string]any{
+			"batch": map[string]any{
+				"count": g.count,
+				"start": g.start,
+			},
+		})
+		if err != nil {
+			return drivers.ConfigError(err)
+		}
+		kd.SetKey(key)
+		l = l.WithField("key", key)
+	}
+	if err := j.send(bytes.NewReader(obj)); err != nil {
+		return drivers.PushError(err)
+	}
+	l.WithField("records", g.count).Debug("flushed")
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+	g.buf.Reset()
+	g.count = 0
+	return nil
+}
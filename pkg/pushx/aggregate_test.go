@@ -0,0 +1,201 @@
+package pushx_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/pushx/drivers/mock"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/pushx"
+)
+
+func newAggregate(t *testing.T, m *mock.Mock, a *pushx.Aggregate) *pushx.PushX {
+	t.Helper()
+	p, err := pushx.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Aggregate = a
+	return p
+}
+
+func pushStrings(t *testing.T, p *pushx.PushX, records ...string) {
+	t.Helper()
+	for _, r := range records {
+		if err := p.PushBytes(context.Background(), []byte(r)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAggregateNDJSON(t *testing.T) {
+	m := &mock.Mock{}
+	m.SetKey(`events/{{.batch.count}}.ndjson`)
+	p := newAggregate(t, m, &pushx.Aggregate{Format: pushx.AggregateNDJSON, MaxRecords: 2})
+	// newline delimited payloads are split into records
+	pushStrings(t, p, `{"a": 1}`, "{\"a\": 2}\n{\"a\": 3}\n", `{"a": 4}`)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	recs := m.Records()
+	if len(recs) != 2 {
+		t.Fatalf("got %d objects, want 2", len(recs))
+	}
+	want := []struct{ key, data string }{
+		{"events/3.ndjson", "{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n"},
+		{"events/1.ndjson", "{\"a\":4}\n"},
+	}
+	for i, w := range want {
+		if recs[i].Key != w.key || string(recs[i].Data) != w.data {
+			t.Errorf("got object %q %q, want %q %q", recs[i].Key, recs[i].Data, w.key, w.data)
+		}
+	}
+}
+
+func TestAggregateJSONGzip(t *testing.T) {
+	m := &mock.Mock{}
+	p := newAggregate(t, m, &pushx.Aggregate{Format: pushx.AggregateJSON, Gzip: true, MaxBytes: 10})
+	pushStrings(t, p, `"a"`, `{"b": [1, 2]}`)
+	recs := m.Records()
+	if len(recs) != 1 {
+		t.Fatalf("got %d objects, want 1", len(recs))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(recs[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bd, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `["a",{"b":[1,2]}]`; string(bd) != want {
+		t.Errorf("got %s, want %s", bd, want)
+	}
+	p.Close()
+}
+
+func TestAggregateCSV(t *testing.T) {
+	m := &mock.Mock{}
+	p := newAggregate(t, m, &pushx.Aggregate{Format: pushx.AggregateCSV})
+	pushStrings(t, p, `{"name": "a, b", "n": 1}`, `{"n": 2, "other": true}`)
+	if len(m.Records()) != 0 {
+		t.Fatal("got object before flush")
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := "n,name\n1,\"a, b\"\n2,\n"
+	if got := string(m.Records()[0].Data); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAggregateMaxAge(t *testing.T) {
+	m := &mock.Mock{}
+	p := newAggregate(t, m, &pushx.Aggregate{Format: pushx.AggregateNDJSON, MaxAge: 50 * time.Millisecond})
+	defer p.Close()
+	pushStrings(t, p, `1`, `2`)
+	for deadline := time.Now().Add(5 * time.Second); len(m.Records()) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	recs := m.Records()
+	if len(recs) != 1 || string(recs[0].Data) != "1\n2\n" {
+		t.Fatalf("got %v, want one object of both records", recs)
+	}
+}
+
+func TestAggregateInvalid(t *testing.T) {
+	p := newAggregate(t, &mock.Mock{}, &pushx.Aggregate{Format: pushx.AggregateNDJSON})
+	defer p.Close()
+	err := p.PushBytes(context.Background(), []byte("not json"))
+	if code := drivers.ExitCode(err); code != drivers.ExitPushRejected {
+		t.Errorf("got exit code %d for %v, want %d", code, err, drivers.ExitPushRejected)
+	}
+	p = newAggregate(t, &mock.Mock{}, &pushx.Aggregate{Format: "xml"})
+	if err := p.PushBytes(context.Background(), []byte("{}")); !errors.Is(err, drivers.ErrConfig) {
+		t.Errorf("got %v, want %v", err, drivers.ErrConfig)
+	}
+}
+
+func TestAggregateFailedFlush(t *testing.T) {
+	every := 1
+	m := &mock.Mock{FailEvery: &every}
+	p := newAggregate(t, m, &pushx.Aggregate{Format: pushx.AggregateNDJSON, MaxRecords: 2})
+	pushStrings(t, p, `1`)
+	if err := p.PushBytes(context.Background(), []byte(`2`)); err == nil {
+		t.Fatal("got nil error from failed flush")
+	}
+	// the failed record is not kept, so a retry does not duplicate it
+	m.FailEvery = nil
+	pushStrings(t, p, `2`)
+	recs := m.Records()
+	if len(recs) != 1 || string(recs[0].Data) != "1\n2\n" {
+		t.Fatalf("got %v, want one object of both records", recs)
+	}
+	p.Close()
+}
+
+// pushCounter counts the pushes of a driver.
+type pushCounter struct {
+	*mock.Mock
+	pushes atomic.Int32
+}
+
+func (c *pushCounter) Push(r io.Reader) error {
+	c.pushes.Add(1)
+	return c.Mock.Push(r)
+}
+
+func TestAggregateCloseFailedFlush(t *testing.T) {
+	every := 1
+	d := &pushCounter{Mock: &mock.Mock{FailEvery: &every}}
+	p, err := pushx.New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Aggregate = &pushx.Aggregate{Format: pushx.AggregateNDJSON, MaxAge: 20 * time.Millisecond}
+	pushStrings(t, p, `1`)
+	if err := p.Close(); err == nil {
+		t.Fatal("got nil error from failed flush")
+	}
+	// the timer no longer retries the flush with the cleaned up driver
+	n := d.pushes.Load()
+	time.Sleep(100 * time.Millisecond)
+	if got := d.pushes.Load(); got != n {
+		t.Errorf("got %d pushes after Close, want %d", got, n)
+	}
+}
+
+func TestAggregateRecordedInput(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"id":1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := newAggregate(t, &mock.Mock{}, &pushx.Aggregate{Format: pushx.AggregateNDJSON, MaxRecords: 100})
+	defer p.Close()
+	p.Files = &pushx.Files{Dir: dir, OnSuccess: pushx.OnSuccessDelete}
+	if err := p.Push(); !errors.Is(err, drivers.ErrConfig) {
+		t.Errorf("got %v, want a configuration error for an on-success action", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.json")); err != nil {
+		t.Errorf("file was deleted before its records were flushed: %v", err)
+	}
+	p.Files = nil
+	for _, w := range []*pushx.Watch{
+		{Dir: dir, OnSuccess: pushx.OnSuccessDelete},
+		{File: filepath.Join(dir, "a.json"), StateFile: filepath.Join(dir, "state.json")},
+	} {
+		p.Watch = w
+		if err := p.PushWatch(context.Background()); !errors.Is(err, drivers.ErrConfig) {
+			t.Errorf("got %v, want a configuration error for %+v", err, w)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package pushx
+
+import (
+	"time"
+
+	"github.com/robertlestak/pushx/pkg/drivers"
+	log "github.com/sirupsen/logrus"
+)
+
+// CheckResult is the outcome of a single preflight step.
+type CheckResult struct {
+	Step    string        `json:"step"`
+	Latency time.Duration `json:"latency"`
+	Err     error         `json:"-"`
+	Skipped bool          `json:"skipped"`
+}
+
+// Ok reports whether the step passed or was skipped.
+func (r CheckResult) Ok() bool {
+	return r.Err == nil
+}
+
+// Check loads and initializes the configured driver and runs its
+// non-mutating probe, without reading any input or pushing any data.
+// Steps after the first failure are not run.
+func (j *PushX) Check(envKeyPrefix string) []CheckResult {
+	l := log.WithFields(log.Fields{
+		"fn":     "Check",
+		"driver": j.DriverName,
+	})
+	l.Debug("Check")
+	var results []CheckResult
+	step := func(name string, fn func() error) bool {
+		start := time.Now()
+		err := fn()
+		results = append(results, CheckResult{
+			Step:    name,
+			Latency: time.Since(start),
+			Err:     err,
+		})
+		if err != nil {
+			l.WithError(err).Errorf("%s failed", name)
+		}
+		return err == nil
+	}
+	config := func() error {
+		if err := j.LoadDriver(envKeyPrefix); err != nil {
+			return err
+		}
+		if err := j.checkMeta(j.Meta); err != nil {
+			return err
+		}
+		return j.checkCloudEvent()
+	}
+	if !step("config", config) {
+		return results
+	}
+	if !step("init", func() error { return drivers.ConnectError(j.Driver.Init()) }) {
+		return results
+	}
+	if il, ok := j.Driver.(drivers.IdentityLogger); ok {
+		if !step("identity", func() error { return drivers.ConnectError(il.LogIdentity()) }) {
+			return results
+		}
+	}
+	if c, ok := j.Driver.(drivers.Checker); ok {
+		if !step("probe", func() error { return drivers.ConnectError(c.Check()) }) {
+			return results
+		}
+	} else {
+		results = append(results, CheckResult{
+			Step:    "probe",
+			Skipped: true,
+		})
+	}
+	if j.ClaimCheck != nil && j.ClaimCheck.DriverName != "" {
+		step("claim-check", func() error {
+			if err := j.loadClaimCheck(envKeyPrefix); err != nil {
+				return err
+			}
+			if c, ok := j.ClaimCheck.Driver.(drivers.Checker); ok {
+				return drivers.ConnectError(c.Check())
+			}
+			return nil
+		})
+	}
+	return results
+}
@@ -0,0 +1,143 @@
+package pushx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/robertlestak/pushx/pkg/drivers"
+	log "github.com/sirupsen/logrus"
+)
+
+// ClaimCheck configures offloading payloads larger than Threshold to a
+// blob driver, in which case a JSON pointer to the stored payload is
+// pushed in place of the payload.
+type ClaimCheck struct {
+	// DriverName is the blob driver to load from flags and environment
+	// variables on Init, if Driver is not set.
+	DriverName drivers.DriverName `json:"driverName"`
+	// Driver is the initialized blob driver payloads are stored with.
+	Driver drivers.BlobDriver `json:"-"`
+	// Threshold is the payload size in bytes above which payloads are
+	// offloaded.
+	Threshold int64 `json:"threshold"`
+	// Prefix is prepended to the content-addressed key of each payload.
+	Prefix string `json:"prefix"`
+}
+
+// ClaimCheckPointer is pushed in place of an offloaded payload.
+type ClaimCheckPointer struct {
+	ClaimCheck string `json:"claimCheck"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+}
+
+// check returns an error if the claim-check conflicts with the maximum
+// payload size max, which would reject payloads pushed inline.
+func (cc *ClaimCheck) check(max int64) error {
+	if cc == nil || max <= 0 {
+		return nil
+	}
+	if max <= cc.Threshold {
+		return drivers.ConfigError(fmt.Errorf("max payload size %d must be larger than the claim-check threshold %d", max, cc.Threshold))
+	}
+	return nil
+}
+
+// loadClaimCheck loads and initializes the claim-check driver, if one is
+// configured by name.
+func (j *PushX) loadClaimCheck(envKeyPrefix string) error {
+	l := log.WithFields(log.Fields{
+		"fn": "loadClaimCheck",
+	})
+	l.Debug("loadClaimCheck")
+	cc := j.ClaimCheck
+	if cc == nil || cc.Driver != nil || cc.DriverName == "" {
+		return nil
+	}
+	d := drivers.GetDriver(cc.DriverName)
+	if d == nil {
+		return drivers.ConfigError(drivers.ErrDriverNotFound)
+	}
+	bd, ok := d.(drivers.BlobDriver)
+	if !ok {
+		return drivers.ConfigError(fmt.Errorf("%w: %s", drivers.ErrClaimCheckUnsupported, cc.DriverName))
+	}
+	if err := bd.LoadFlags(); err != nil {
+		return drivers.ConfigError(err)
+	}
+	if err := bd.LoadEnv(envKeyPrefix); err != nil {
+		return drivers.ConfigError(err)
+	}
+	if err := bd.Init(); err != nil {
+		l.WithError(err).Error("Init")
+		return drivers.ConnectError(err)
+	}
+	cc.Driver = bd
+	return nil
+}
+
+// claimCheck returns r unmodified if the payload is within the threshold.
+// Otherwise the payload is stored with the claim-check driver under the
+// hex sha256 of its content, and a reader of the JSON pointer to it is
+// returned, along with the first Threshold bytes of the payload to render
+// templates from. Payloads are spooled to a temporary file while hashing,
+// so only Threshold bytes are held in memory.
+func (j *PushX) claimCheck(r io.Reader) (io.Reader, []byte, error) {
+	l := log.WithFields(log.Fields{
+		"fn":     "claimCheck",
+		"driver": j.DriverName,
+	})
+	l.Debug("claimCheck")
+	cc := j.ClaimCheck
+	if cc.Driver == nil {
+		return nil, nil, drivers.ConfigError(fmt.Errorf("%w: no claim-check driver", drivers.ErrClaimCheckUnsupported))
+	}
+	head, err := ioutil.ReadAll(io.LimitReader(r, cc.Threshold+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(head)) <= cc.Threshold {
+		return bytes.NewReader(head), nil, nil
+	}
+	f, err := ioutil.TempFile("", "pushx-claim-check-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.MultiReader(bytes.NewReader(head), r))
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	cc.Driver.SetKey(cc.Prefix + sum)
+	l = l.WithFields(log.Fields{
+		"size": n,
+		"uri":  cc.Driver.URI(),
+	})
+	l.Debug("storing payload")
+	if err := cc.Driver.Push(f); err != nil {
+		l.WithError(err).Error("claim-check push")
+		return nil, nil, err
+	}
+	jd, err := json.Marshal(ClaimCheckPointer{
+		ClaimCheck: cc.Driver.URI(),
+		Size:       n,
+		SHA256:     sum,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	l.Debug("payload stored")
+	return bytes.NewReader(jd), head[:cc.Threshold], nil
+}
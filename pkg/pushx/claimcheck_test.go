@@ -0,0 +1,104 @@
+package pushx_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/robertlestak/pushx/drivers/fs"
+	"github.com/robertlestak/pushx/drivers/mock"
+	"github.com/robertlestak/pushx/pkg/pushx"
+)
+
+func TestClaimCheck(t *testing.T) {
+	dir := t.TempDir()
+	m := &mock.Mock{}
+	p, err := pushx.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.ClaimCheck = &pushx.ClaimCheck{
+		Driver:    &fs.FS{Folder: dir},
+		Threshold: 16,
+		Prefix:    "claim-",
+	}
+	small := []byte("small payload")
+	large := bytes.Repeat([]byte("large payload "), 100)
+	for _, b := range [][]byte{small, large} {
+		if err := p.PushBytes(context.Background(), b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recs := m.Records()
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2", len(recs))
+	}
+	if !bytes.Equal(recs[0].Data, small) {
+		t.Errorf("small payload pushed as %q", recs[0].Data)
+	}
+	var ptr pushx.ClaimCheckPointer
+	if err := json.Unmarshal(recs[1].Data, &ptr); err != nil {
+		t.Fatalf("large payload not replaced with a pointer: %v", err)
+	}
+	sum := sha256.Sum256(large)
+	key := "claim-" + hex.EncodeToString(sum[:])
+	if ptr.SHA256 != hex.EncodeToString(sum[:]) || ptr.Size != int64(len(large)) {
+		t.Errorf("unexpected pointer %+v", ptr)
+	}
+	if want := "file://" + filepath.ToSlash(filepath.Join(dir, key)); ptr.ClaimCheck != want {
+		t.Errorf("got claim check %q, want %q", ptr.ClaimCheck, want)
+	}
+	stored, err := os.ReadFile(filepath.Join(dir, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, large) {
+		t.Error("stored payload differs")
+	}
+}
+
+func TestClaimCheckTemplates(t *testing.T) {
+	m := &mock.Mock{}
+	p, err := pushx.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.ClaimCheck = &pushx.ClaimCheck{
+		Driver:    &fs.FS{Folder: t.TempDir()},
+		Threshold: 32,
+	}
+	p.Meta = map[string]string{"order": "{{order.id}}"}
+	p.CloudEvent = &pushx.CloudEvent{
+		Mode:   pushx.CloudEventsBinary,
+		Source: "test",
+		Type:   "order",
+		ID:     "{{order.id}}",
+	}
+	payload := []byte(`{"order":{"id":"o-1"},"items":"` + strings.Repeat("x", 100) + `"}`)
+	if err := p.PushBytes(context.Background(), payload); err != nil {
+		t.Fatal(err)
+	}
+	recs := m.Records()
+	if len(recs) != 1 {
+		t.Fatalf("got %d records, want 1", len(recs))
+	}
+	// templates are rendered from the offloaded payload, not the pointer
+	if got := recs[0].Meta["order"]; got != "o-1" {
+		t.Errorf("got meta order %q, want %q", got, "o-1")
+	}
+	if got := recs[0].Meta["ce-id"]; got != "o-1" {
+		t.Errorf("got event id %q, want %q", got, "o-1")
+	}
+	var ptr pushx.ClaimCheckPointer
+	if err := json.Unmarshal(recs[0].Data, &ptr); err != nil || ptr.Size != int64(len(payload)) {
+		t.Errorf("got %q, want a pointer to the payload", recs[0].Data)
+	}
+}
@@ -0,0 +1,127 @@
+package pushx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/robertlestak/pushx/pkg/drivers"
+	log "github.com/sirupsen/logrus"
+)
+
+// New returns a PushX for an already configured driver, for example
+// &kafka.Kafka{Brokers: []string{"localhost:9092"}, Topic: &topic}.
+// The driver is initialized, but no flags, environment variables or
+// input are read. A PushX is not safe for concurrent use, however any
+// number of independently configured PushX may be used in one process.
+// The proxy is the exception: it is process-wide, set with utils.SetProxy
+// for every driver, or read from the proxy environment variables.
+func New(d drivers.Driver) (*PushX, error) {
+	l := log.WithFields(log.Fields{
+		"fn": "New",
+	})
+	l.Debug("New")
+	if d == nil {
+		return nil, drivers.ConfigError(drivers.ErrDriverNotFound)
+	}
+	j := &PushX{
+		Driver: d,
+	}
+	if err := d.Init(); err != nil {
+		l.WithError(err).Error("Init")
+		return nil, drivers.ConnectError(err)
+	}
+	return j, nil
+}
+
+// NewFromConfig constructs the named driver from cfg, keyed by the
+// exported field names of the driver struct, and returns an initialized
+// PushX for it. See drivers.NewDriver.
+func NewFromConfig(name drivers.DriverName, cfg map[string]any) (*PushX, error) {
+	d, err := drivers.NewDriver(name, cfg)
+	if err != nil {
+		return nil, err
+	}
+	j, err := New(d)
+	if err != nil {
+		return nil, err
+	}
+	j.DriverName = name
+	j.config = cfg
+	return j, nil
+}
+
+// PushReader pushes r to the driver, or each record of r if an input
+// format is set. Drivers do not support cancellation once a push has
+// started, so if ctx is done before the push completes, reads of r fail
+// with ctx.Err(), which aborts a streaming push, and PushReader returns
+// ctx.Err() once the push has returned. The driver and r are never used
+// after PushReader returns.
+func (j *PushX) PushReader(ctx context.Context, r io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer j.setContext(ctx)()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- j.pushInput(&ctxReader{ctx: ctx, r: r})
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		<-errc
+		return ctx.Err()
+	}
+}
+
+// setContext sets ctx on the driver if it waits within pushes, and
+// returns a func which unsets it.
+func (j *PushX) setContext(ctx context.Context) func() {
+	cs, ok := j.Driver.(drivers.ContextSetter)
+	if !ok {
+		return func() {}
+	}
+	cs.SetContext(ctx)
+	return func() { cs.SetContext(nil) }
+}
+
+// ctxReader is a reader which fails once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// PushBytes pushes b to the driver. See PushReader.
+func (j *PushX) PushBytes(ctx context.Context, b []byte) error {
+	return j.PushReader(ctx, bytes.NewReader(b))
+}
+
+// Close flushes any aggregated records, stopping any timed flush, and
+// cleans up the driver, and the claim-check and relay drivers if any are
+// set. Every driver is cleaned up
+// even if the flush or another cleanup fails, and the errors are joined.
+func (j *PushX) Close() error {
+	errs := []error{j.closeAggregate()}
+	if j.Relay != nil {
+		if j.Relay.Source != nil {
+			errs = append(errs, j.Relay.Source.Cleanup())
+		}
+		if j.Relay.DLQ != nil {
+			errs = append(errs, j.Relay.DLQ.Cleanup())
+		}
+	}
+	if j.ClaimCheck != nil && j.ClaimCheck.Driver != nil {
+		errs = append(errs, j.ClaimCheck.Driver.Cleanup())
+	}
+	errs = append(errs, j.Driver.Cleanup())
+	return errors.Join(errs...)
+}
@@ -0,0 +1,207 @@
+package pushx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/schema"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// CloudEventsStructured wraps the payload in a JSON event envelope,
+	// which is supported by every driver.
+	CloudEventsStructured = "structured"
+	// CloudEventsBinary pushes the payload unmodified, with the event
+	// attributes set as metadata following the protocol binding of the
+	// driver.
+	CloudEventsBinary = "binary"
+
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsJSON        = "application/cloudevents+json"
+)
+
+// CloudEvent configures wrapping payloads as CloudEvents 1.0. Attributes
+// may be templated from the payload, for example {{order.id}}.
+type CloudEvent struct {
+	Mode   string `json:"mode"`
+	Source string `json:"source"`
+	Type   string `json:"type"`
+	// ID defaults to a new UUID for each event.
+	ID      string `json:"id"`
+	Subject string `json:"subject"`
+	// Time defaults to the time of the push.
+	Time string `json:"time"`
+	// DataContentType defaults to application/json for JSON payloads.
+	DataContentType string `json:"datacontenttype"`
+}
+
+// cloudEventsBindings are the attribute prefixes and the content type
+// metadata key of each supported protocol binding.
+var cloudEventsBindings = map[string]struct {
+	prefix      string
+	contentType string
+}{
+	"http":  {"ce-", "Content-Type"},
+	"kafka": {"ce_", "content-type"},
+	"amqp":  {"cloudEvents_", "content-type"},
+	"nats":  {"ce-", "Content-Type"},
+}
+
+// cloudEventsBinding returns the protocol binding of the driver, or an
+// empty string if it does not implement one.
+func (j *PushX) cloudEventsBinding() string {
+	if _, ok := j.Driver.(drivers.MetaPusher); !ok {
+		return ""
+	}
+	b, ok := j.Driver.(drivers.CloudEventsBinder)
+	if !ok {
+		return ""
+	}
+	if _, ok := cloudEventsBindings[b.CloudEventsBinding()]; !ok {
+		return ""
+	}
+	return b.CloudEventsBinding()
+}
+
+// checkCloudEvent returns an error if the CloudEvents configuration is
+// invalid or not supported by the driver.
+func (j *PushX) checkCloudEvent() error {
+	ce := j.CloudEvent
+	if ce == nil || ce.Mode == "" {
+		return nil
+	}
+	switch ce.Mode {
+	case CloudEventsStructured:
+	case CloudEventsBinary:
+		if j.cloudEventsBinding() == "" {
+			return drivers.ConfigError(fmt.Errorf("%w: %s", drivers.ErrCloudEventsBinaryUnsupported, j.DriverName))
+		}
+	default:
+		return drivers.ConfigError(fmt.Errorf("unknown CloudEvents mode %q", ce.Mode))
+	}
+	if ce.Source == "" || ce.Type == "" {
+		return drivers.ConfigError(errors.New("CloudEvents source and type are required"))
+	}
+	return nil
+}
+
+// attributes returns the event context attributes for the event data bd,
+// templated from src.
+func (ce *CloudEvent) attributes(src, bd []byte) map[string]string {
+	render := func(s string) string {
+		if !strings.Contains(s, "{{") {
+			return s
+		}
+		return schema.ReplaceParamsString(src, s)
+	}
+	attrs := map[string]string{
+		"specversion": cloudEventsSpecVersion,
+		"id":          render(ce.ID),
+		"source":      render(ce.Source),
+		"type":        render(ce.Type),
+		"time":        render(ce.Time),
+	}
+	if attrs["id"] == "" {
+		attrs["id"] = uuid.New().String()
+	}
+	if attrs["time"] == "" {
+		attrs["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	if s := render(ce.Subject); s != "" {
+		attrs["subject"] = s
+	}
+	if ct := render(ce.DataContentType); ct != "" {
+		attrs["datacontenttype"] = ct
+	} else if json.Valid(bd) {
+		attrs["datacontenttype"] = "application/json"
+	}
+	return attrs
+}
+
+// envelope returns the structured mode JSON event for the payload bd.
+// JSON data is embedded as is, other text data as a string, and binary
+// data base64 encoded.
+func (ce *CloudEvent) envelope(attrs map[string]string, bd []byte) ([]byte, error) {
+	ev := make(map[string]any, len(attrs)+1)
+	for k, v := range attrs {
+		ev[k] = v
+	}
+	ct := attrs["datacontenttype"]
+	switch {
+	case isJSONContentType(ct) && json.Valid(bd):
+		ev["data"] = json.RawMessage(bd)
+	case utf8.Valid(bd):
+		ev["data"] = string(bd)
+	default:
+		ev["data_base64"] = bd
+	}
+	return json.Marshal(ev)
+}
+
+func isJSONContentType(ct string) bool {
+	ct = strings.TrimSpace(strings.Split(ct, ";")[0])
+	return ct == "application/json" || strings.HasSuffix(ct, "+json") || strings.HasPrefix(ct, "text/json")
+}
+
+// pushCloudEvent pushes r wrapped as a CloudEvent, along with any
+// configured metadata, templated from src if it is not nil, or else from
+// the payload.
+func (j *PushX) pushCloudEvent(r io.Reader, src []byte) error {
+	l := log.WithFields(log.Fields{
+		"fn":     "pushCloudEvent",
+		"driver": j.DriverName,
+		"mode":   j.CloudEvent.Mode,
+	})
+	l.Debug("pushCloudEvent")
+	if err := j.checkCloudEvent(); err != nil {
+		return err
+	}
+	bd, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if src == nil {
+		src = bd
+	}
+	meta, err := j.renderMeta(func() ([]byte, error) { return src, nil })
+	if err != nil {
+		return err
+	}
+	attrs := j.CloudEvent.attributes(src, bd)
+	binding, hasBinding := cloudEventsBindings[j.cloudEventsBinding()]
+	data := bd
+	if j.CloudEvent.Mode == CloudEventsBinary {
+		for k, v := range attrs {
+			if k == "datacontenttype" {
+				meta[binding.contentType] = v
+				continue
+			}
+			meta[binding.prefix+k] = v
+		}
+	} else {
+		if data, err = j.CloudEvent.envelope(attrs, bd); err != nil {
+			return err
+		}
+		if hasBinding {
+			meta[binding.contentType] = cloudEventsJSON
+		}
+	}
+	l.WithField("id", attrs["id"]).Debug("event created")
+	if len(meta) == 0 {
+		return j.Driver.Push(bytes.NewReader(data))
+	}
+	if err := j.checkMeta(meta); err != nil {
+		return err
+	}
+	return j.Driver.(drivers.MetaPusher).PushMeta(bytes.NewReader(data), meta)
+}
@@ -0,0 +1,158 @@
+package pushx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robertlestak/pushx/drivers/fs"
+	"github.com/robertlestak/pushx/drivers/mock"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/pushx"
+)
+
+func pushCloudEvent(t *testing.T, ce *pushx.CloudEvent, payload []byte) mock.Record {
+	t.Helper()
+	m := &mock.Mock{}
+	p, err := pushx.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.CloudEvent = ce
+	if err := p.PushBytes(context.Background(), payload); err != nil {
+		t.Fatal(err)
+	}
+	return m.Records()[0]
+}
+
+func TestCloudEventsStructured(t *testing.T) {
+	rec := pushCloudEvent(t, &pushx.CloudEvent{
+		Mode:    pushx.CloudEventsStructured,
+		Source:  "/orders",
+		Type:    "com.example.order.{{status}}",
+		Subject: "{{id}}",
+	}, []byte(`{"id":"42","status":"created"}`))
+	var ev map[string]any
+	if err := json.Unmarshal(rec.Data, &ev); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{
+		"specversion":     "1.0",
+		"source":          "/orders",
+		"type":            "com.example.order.created",
+		"subject":         "42",
+		"datacontenttype": "application/json",
+	} {
+		if ev[k] != v {
+			t.Errorf("%s = %v, want %q", k, ev[k], v)
+		}
+	}
+	if _, err := uuid.Parse(ev["id"].(string)); err != nil {
+		t.Errorf("id %v is not a UUID: %v", ev["id"], err)
+	}
+	if ev["time"] == "" {
+		t.Error("time not set")
+	}
+	data, ok := ev["data"].(map[string]any)
+	if !ok || data["id"] != "42" {
+		t.Errorf("data = %v, want the JSON payload", ev["data"])
+	}
+	if ct := rec.Meta["Content-Type"]; ct != "application/cloudevents+json" {
+		t.Errorf("Content-Type = %q, want application/cloudevents+json", ct)
+	}
+}
+
+func TestCloudEventsStructuredBinaryData(t *testing.T) {
+	rec := pushCloudEvent(t, &pushx.CloudEvent{
+		Mode:   pushx.CloudEventsStructured,
+		Source: "/blobs",
+		Type:   "com.example.blob",
+	}, []byte{0xff, 0x00, 0xfe})
+	var ev map[string]any
+	if err := json.Unmarshal(rec.Data, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev["data_base64"] != "/wD+" {
+		t.Errorf("data_base64 = %v, want /wD+", ev["data_base64"])
+	}
+	if _, ok := ev["data"]; ok {
+		t.Error("data set for binary payload")
+	}
+}
+
+func TestCloudEventsBinary(t *testing.T) {
+	payload := []byte(`{"id":"42"}`)
+	rec := pushCloudEvent(t, &pushx.CloudEvent{
+		Mode:   pushx.CloudEventsBinary,
+		ID:     "order-{{id}}",
+		Source: "/orders",
+		Type:   "com.example.order",
+	}, payload)
+	if string(rec.Data) != string(payload) {
+		t.Errorf("data = %s, want %s", rec.Data, payload)
+	}
+	for k, v := range map[string]string{
+		"ce-specversion": "1.0",
+		"ce-id":          "order-42",
+		"ce-source":      "/orders",
+		"ce-type":        "com.example.order",
+		"Content-Type":   "application/json",
+	} {
+		if rec.Meta[k] != v {
+			t.Errorf("%s = %q, want %q", k, rec.Meta[k], v)
+		}
+	}
+}
+
+func TestCloudEventsConfig(t *testing.T) {
+	for name, tc := range map[string]struct {
+		driver drivers.Driver
+		ce     *pushx.CloudEvent
+		want   error
+	}{
+		"binary unsupported": {
+			driver: &fs.FS{Folder: t.TempDir(), Key: "out"},
+			ce:     &pushx.CloudEvent{Mode: pushx.CloudEventsBinary, Source: "s", Type: "t"},
+			want:   drivers.ErrCloudEventsBinaryUnsupported,
+		},
+		"missing type": {
+			driver: &mock.Mock{},
+			ce:     &pushx.CloudEvent{Mode: pushx.CloudEventsStructured, Source: "s"},
+			want:   drivers.ErrConfig,
+		},
+		"unknown mode": {
+			driver: &mock.Mock{},
+			ce:     &pushx.CloudEvent{Mode: "envelope", Source: "s", Type: "t"},
+			want:   drivers.ErrConfig,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p, err := pushx.New(tc.driver)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+			p.CloudEvent = tc.ce
+			err = p.PushBytes(context.Background(), []byte("{}"))
+			if !errors.Is(err, tc.want) || drivers.ExitCode(err) != drivers.ExitConfig {
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestCloudEventsStructuredUnboundDriver(t *testing.T) {
+	dir := t.TempDir()
+	p, err := pushx.New(&fs.FS{Folder: dir, Key: "out"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.CloudEvent = &pushx.CloudEvent{Mode: pushx.CloudEventsStructured, Source: "s", Type: "t"}
+	if err := p.PushBytes(context.Background(), []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,426 @@
+package pushx
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/schema"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// OnSuccessDelete deletes each file once it has been pushed.
+	OnSuccessDelete = "delete"
+	// OnSuccessMove, followed by a directory, moves each file into the
+	// directory once it has been pushed, keeping its relative path.
+	OnSuccessMove = "move:"
+)
+
+// Files configures pushing every file in a directory, or every file
+// matching a glob, as a separate payload.
+type Files struct {
+	// Dir is the directory to push the files of. Subdirectories are
+	// included if Recursive is set.
+	Dir       string `json:"dir"`
+	Recursive bool   `json:"recursive"`
+	// Glob is a file pattern, in which ** matches any number of
+	// directories, for example reports/**/*.csv. Relative paths are
+	// relative to the leading directories of the pattern which contain
+	// no wildcards.
+	Glob string `json:"glob"`
+	// Include and Exclude filter the files by relative path. Patterns
+	// which contain no slash match the file name.
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// Concurrency is the number of files pushed at once, each worker
+	// with its own driver. It defaults to 1.
+	Concurrency int `json:"concurrency"`
+	// OnSuccess is OnSuccessDelete, or OnSuccessMove followed by a
+	// directory, to remove each file from the input once pushed.
+	OnSuccess string `json:"onSuccess"`
+}
+
+// File is a file matched for pushing.
+type File struct {
+	// Path is the path of the file as found, relative to the working
+	// directory if the directory or glob is relative.
+	Path string `json:"path"`
+	// RelPath is the slash separated path relative to the directory or
+	// the leading directories of the glob.
+	RelPath string      `json:"relpath"`
+	Info    fs.FileInfo `json:"-"`
+}
+
+// templateData returns the key template data of the file, available as
+// {{.file.relpath}} and so on.
+func (f File) templateData() map[string]any {
+	name := path.Base(f.RelPath)
+	ext := path.Ext(name)
+	return map[string]any{
+		"file": map[string]any{
+			"path":    f.Path,
+			"relpath": f.RelPath,
+			"dir":     path.Dir(f.RelPath),
+			"name":    name,
+			"base":    strings.TrimSuffix(name, ext),
+			"ext":     ext,
+			"size":    f.Info.Size(),
+			"modtime": f.Info.ModTime(),
+		},
+	}
+}
+
+// check returns an error if the configuration is invalid.
+func (f *Files) check() error {
+	if f == nil {
+		return nil
+	}
+	if (f.Dir == "") == (f.Glob == "") {
+		return drivers.ConfigError(errors.New("exactly one of the input dir or glob is required"))
+	}
+	if f.Concurrency < 0 {
+		return drivers.ConfigError(errors.New("input concurrency must not be negative"))
+	}
+	if err := checkOnSuccess(f.OnSuccess); err != nil {
+		return err
+	}
+	for _, p := range append(append([]string{f.Glob}, f.Include...), f.Exclude...) {
+		for _, s := range strings.Split(p, "/") {
+			if _, err := path.Match(s, ""); err != nil {
+				return drivers.ConfigError(fmt.Errorf("invalid pattern %q: %w", p, err))
+			}
+		}
+	}
+	return nil
+}
+
+// checkOnSuccess returns an error if action is not a valid on-success
+// action.
+func checkOnSuccess(action string) error {
+	switch {
+	case action == "", action == OnSuccessDelete:
+	case strings.HasPrefix(action, OnSuccessMove) && len(action) > len(OnSuccessMove):
+	default:
+		return drivers.ConfigError(fmt.Errorf("unknown on-success action %q", action))
+	}
+	return nil
+}
+
+// root returns the directory to walk, and the pattern relative paths in
+// it must match, if any.
+func (f *Files) root() (string, string) {
+	if f.Dir != "" {
+		return f.Dir, ""
+	}
+	segs := strings.Split(filepath.ToSlash(f.Glob), "/")
+	i := 0
+	for i < len(segs)-1 && !strings.ContainsAny(segs[i], `*?[\`) {
+		i++
+	}
+	root := strings.Join(segs[:i], "/")
+	if root == "" && i > 0 {
+		root = "/"
+	} else if root == "" {
+		root = "."
+	}
+	return filepath.FromSlash(root), strings.Join(segs[i:], "/")
+}
+
+// match reports whether a file with relative path rel should be pushed.
+func (f *Files) match(pattern, rel string) bool {
+	if pattern != "" && !matchGlob(pattern, rel) {
+		return false
+	}
+	matchAny := func(patterns []string) bool {
+		for _, p := range patterns {
+			if !strings.Contains(p, "/") && matchGlob(p, path.Base(rel)) {
+				return true
+			}
+			if matchGlob(p, rel) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(f.Include) > 0 && !matchAny(f.Include) {
+		return false
+	}
+	return !matchAny(f.Exclude)
+}
+
+// List returns the files to push, in lexical order.
+func (f *Files) List() ([]File, error) {
+	root, pattern := f.root()
+	var files []File
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != root && f.Dir != "" && !f.Recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !f.match(pattern, rel) {
+			return nil
+		}
+		// follow symlinks to regular files
+		fi, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		files = append(files, File{Path: p, RelPath: rel, Info: fi})
+		return nil
+	})
+	if err != nil {
+		return nil, drivers.ConfigError(err)
+	}
+	return files, nil
+}
+
+// matchGlob reports whether the slash separated name matches pattern, in
+// which ** matches any number of path segments.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// fileKey returns the driver key for f from the key template of the
+// driver. Templated keys are rendered with the file data, an empty key
+// is the relative path of the file, and any other key is used as a
+// prefix of the relative path.
+func fileKey(tmpl string, f File) (string, error) {
+	switch {
+	case strings.Contains(tmpl, "{{"):
+		k, err := schema.RenderKey(tmpl, f.templateData())
+		if err != nil {
+			return "", drivers.ConfigError(err)
+		}
+		return k, nil
+	case tmpl == "":
+		return f.RelPath, nil
+	}
+	return path.Join(tmpl, f.RelPath), nil
+}
+
+// clone returns a new PushX with the same configuration and its own
+// initialized driver, for use by another worker.
+func (j *PushX) clone() (*PushX, error) {
+	if j.DriverName == "" {
+		return nil, drivers.ConfigError(errors.New("concurrent pushes require a driver loaded by name"))
+	}
+	c := &PushX{
+		DriverName:     j.DriverName,
+		Meta:           j.Meta,
+		CloudEvent:     j.CloudEvent,
+		MaxPayloadSize: j.MaxPayloadSize,
+		InputFormat:    j.InputFormat,
+		Files:          j.Files,
+		Aggregate:      j.Aggregate,
+		config:         j.config,
+	}
+	if j.ClaimCheck != nil {
+		if j.ClaimCheck.DriverName == "" {
+			return nil, drivers.ConfigError(errors.New("concurrent pushes require a claim-check driver loaded by name"))
+		}
+		cc := *j.ClaimCheck
+		cc.Driver = nil
+		c.ClaimCheck = &cc
+	}
+	if j.config != nil {
+		d, err := drivers.NewDriver(j.DriverName, j.config)
+		if err != nil {
+			return nil, err
+		}
+		c.Driver = d
+	} else if err := c.LoadDriver(j.envKeyPrefix); err != nil {
+		return nil, err
+	}
+	if err := c.initDriver(j.envKeyPrefix); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// pushFiles pushes each of the configured files as a separate payload.
+// If only some of the files fail, the error is classified as
+// drivers.ErrPartialBatch.
+func (j *PushX) pushFiles() error {
+	l := log.WithFields(log.Fields{
+		"fn":     "pushFiles",
+		"driver": j.DriverName,
+	})
+	if err := j.Files.check(); err != nil {
+		return err
+	}
+	if err := j.Aggregate.checkInput(j.Files, nil); err != nil {
+		return err
+	}
+	files, err := j.Files.List()
+	if err != nil {
+		l.WithError(err).Error("List")
+		return err
+	}
+	l.WithField("files", len(files)).Debug("files matched")
+	if len(files) == 0 {
+		l.Warn("no files matched")
+		return nil
+	}
+	n := j.Files.Concurrency
+	if n < 1 {
+		n = 1
+	}
+	if n > len(files) {
+		n = len(files)
+	}
+	if n > 1 && (j.Output != nil || j.OutputFile != "") {
+		return drivers.ConfigError(errors.New("output is not supported with concurrent pushes"))
+	}
+	if tx, ok := j.Driver.(drivers.Transactor); ok && n > 1 && tx.Transactional() {
+		return drivers.ConfigError(errors.New("transactions are not supported with concurrent pushes"))
+	}
+	workers := []*PushX{j}
+	for i := 1; i < n; i++ {
+		w, err := j.clone()
+		if err != nil {
+			l.WithError(err).Error("clone")
+			for _, w := range workers[1:] {
+				w.Close()
+			}
+			return err
+		}
+		workers = append(workers, w)
+	}
+	var (
+		mu       sync.Mutex
+		failed   int
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	ch := make(chan File)
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w *PushX) {
+			defer wg.Done()
+			var tmpl string
+			if kd, ok := w.Driver.(drivers.KeyedDriver); ok {
+				tmpl = kd.GetKey()
+			}
+			for f := range ch {
+				if err := w.pushFile(tmpl, f, j.Files.OnSuccess); err != nil {
+					mu.Lock()
+					failed++
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}(w)
+	}
+	for _, f := range files {
+		ch <- f
+	}
+	close(ch)
+	wg.Wait()
+	for _, w := range workers[1:] {
+		if err := w.Close(); err != nil {
+			l.WithError(err).Error("Close")
+		}
+	}
+	switch {
+	case failed == 0:
+		return nil
+	case failed == len(files):
+		return firstErr
+	}
+	return drivers.PartialBatchError(fmt.Errorf("%d of %d files failed: %w", failed, len(files), firstErr))
+}
+
+// pushFile pushes the file f, setting the key of keyed drivers from the
+// key template tmpl, and then applies the on-success action.
+func (j *PushX) pushFile(tmpl string, f File, action string) error {
+	l := log.WithFields(log.Fields{
+		"fn":     "pushFile",
+		"driver": j.DriverName,
+		"file":   f.Path,
+	})
+	// aggregated files are pushed with the key of the aggregate
+	if kd, ok := j.Driver.(drivers.KeyedDriver); ok && j.Aggregate == nil {
+		key, err := fileKey(tmpl, f)
+		if err != nil {
+			l.WithError(err).Error("fileKey")
+			return err
+		}
+		kd.SetKey(key)
+		l = l.WithField("key", key)
+	}
+	fh, err := os.Open(f.Path)
+	if err != nil {
+		l.WithError(err).Error("Open")
+		return drivers.ConfigError(err)
+	}
+	err = j.pushInput(fh)
+	fh.Close()
+	if err != nil {
+		return err
+	}
+	l.Debug("file pushed")
+	if err := onSuccess(action, f); err != nil {
+		l.WithError(err).Error("onSuccess")
+		return err
+	}
+	return nil
+}
+
+// onSuccess applies the on-success action to the pushed file.
+func onSuccess(action string, file File) error {
+	switch {
+	case action == OnSuccessDelete:
+		return os.Remove(file.Path)
+	case strings.HasPrefix(action, OnSuccessMove):
+		dst := filepath.Join(strings.TrimPrefix(action, OnSuccessMove), filepath.FromSlash(file.RelPath))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		return os.Rename(file.Path, dst)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package pushx_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/robertlestak/pushx/drivers/mock"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/pushx"
+)
+
+func writeFiles(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFilesList(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.csv", "b.txt", "sub/c.csv", "sub/deep/d.csv", "sub/deep/e.tmp")
+	tests := []struct {
+		name  string
+		files pushx.Files
+		want  []string
+	}{
+		{"dir", pushx.Files{Dir: dir}, []string{"a.csv", "b.txt"}},
+		{"dir recursive", pushx.Files{Dir: dir, Recursive: true}, []string{"a.csv", "b.txt", "sub/c.csv", "sub/deep/d.csv", "sub/deep/e.tmp"}},
+		{"glob", pushx.Files{Glob: filepath.Join(dir, "*.csv")}, []string{"a.csv"}},
+		{"glob recursive", pushx.Files{Glob: filepath.Join(dir, "**", "*.csv")}, []string{"a.csv", "sub/c.csv", "sub/deep/d.csv"}},
+		{"glob prefix", pushx.Files{Glob: filepath.Join(dir, "sub", "**")}, []string{"c.csv", "deep/d.csv", "deep/e.tmp"}},
+		{"include", pushx.Files{Dir: dir, Recursive: true, Include: []string{"*.csv"}}, []string{"a.csv", "sub/c.csv", "sub/deep/d.csv"}},
+		{"exclude", pushx.Files{Dir: dir, Recursive: true, Exclude: []string{"*.tmp", "sub/deep/**"}}, []string{"a.csv", "b.txt", "sub/c.csv"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := tt.files.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range files {
+				got = append(got, f.RelPath)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPushFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.csv", "sub/b.csv")
+	m := &mock.Mock{}
+	p, err := pushx.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	m.SetKey("reports/{{.file.relpath}}.{{.file.base}}")
+	p.Files = &pushx.Files{Dir: dir, Recursive: true, OnSuccess: pushx.OnSuccessDelete}
+	if err := p.Push(); err != nil {
+		t.Fatal(err)
+	}
+	recs := m.Records()
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2", len(recs))
+	}
+	want := map[string]string{"reports/a.csv.a": "a.csv", "reports/sub/b.csv.b": "sub/b.csv"}
+	for _, r := range recs {
+		if want[r.Key] != string(r.Data) {
+			t.Errorf("got key %q with payload %q", r.Key, r.Data)
+		}
+	}
+	files, err := (&pushx.Files{Dir: dir, Recursive: true}).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("got %d files after delete, want 0", len(files))
+	}
+}
+
+func TestPushFilesMove(t *testing.T) {
+	dir := t.TempDir()
+	done := t.TempDir()
+	writeFiles(t, dir, "sub/a.csv")
+	p, err := pushx.New(&mock.Mock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.Files = &pushx.Files{Dir: dir, Recursive: true, OnSuccess: pushx.OnSuccessMove + done}
+	if err := p.Push(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(done, "sub", "a.csv")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub", "a.csv")); !os.IsNotExist(err) {
+		t.Errorf("got %v, want file moved", err)
+	}
+}
+
+func TestPushFilesPartial(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a", "b", "c", "d")
+	every := 2
+	m := &mock.Mock{FailEvery: &every}
+	p, err := pushx.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.Files = &pushx.Files{Dir: dir, OnSuccess: pushx.OnSuccessDelete}
+	err = p.Push()
+	if !errors.Is(err, drivers.ErrPartialBatch) {
+		t.Fatalf("got %v, want %v", err, drivers.ErrPartialBatch)
+	}
+	if code := drivers.ExitCode(err); code != drivers.ExitPartialBatch {
+		t.Errorf("got exit code %d, want %d", code, drivers.ExitPartialBatch)
+	}
+	// only the failed files are left for the next run
+	files, err := (&pushx.Files{Dir: dir}).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("got %d files left, want 2", len(files))
+	}
+}
+
+func TestPushFilesConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	capture := filepath.Join(t.TempDir(), "capture.jsonl")
+	names := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	writeFiles(t, dir, names...)
+	p, err := pushx.NewFromConfig(drivers.Mock, map[string]any{"File": capture})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Files = &pushx.Files{Dir: dir, Concurrency: 3}
+	if err := p.Push(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bd, err := os.ReadFile(capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range bytes.Split(bytes.TrimSpace(bd), []byte("\n")) {
+		var r mock.Record
+		if err := json.Unmarshal(l, &r); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r.Payload)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, names) {
+		t.Errorf("got %v, want %v", got, names)
+	}
+}
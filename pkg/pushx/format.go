@@ -0,0 +1,341 @@
+package pushx
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/robertlestak/pushx/pkg/drivers"
+	log "github.com/sirupsen/logrus"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// FormatRaw pushes the input as is. It is the default.
+	FormatRaw = "raw"
+	// FormatJSON pushes each JSON value of the input, and each element of
+	// top level JSON arrays, as a record.
+	FormatJSON = "json"
+	// FormatCSV pushes each row of CSV input as a JSON object record.
+	FormatCSV = "csv"
+	// FormatTSV pushes each row of tab separated input as a JSON object
+	// record.
+	FormatTSV = "tsv"
+	// FormatYAML pushes each YAML document of the input, and each element
+	// of top level sequences, as a JSON record.
+	FormatYAML = "yaml"
+	// FormatMsgpack pushes each msgpack value of the input, and each
+	// element of top level arrays, as a JSON record.
+	FormatMsgpack = "msgpack"
+)
+
+// InputFormat configures decoding the input into JSON records, each of
+// which is pushed as a separate payload, so that for example a CSV file can
+// be inserted into a database a row at a time.
+type InputFormat struct {
+	// Format is one of the Format constants.
+	Format string `json:"format"`
+	// Columns are the CSV or TSV column names. If empty, the first row is
+	// the header.
+	Columns []string `json:"columns"`
+	// NoInfer keeps CSV and TSV fields as strings. Otherwise, numbers and
+	// booleans are converted, and empty fields are null.
+	NoInfer bool `json:"noInfer"`
+}
+
+// check returns an error if the configuration is invalid.
+func (f *InputFormat) check() error {
+	if f == nil {
+		return nil
+	}
+	switch f.Format {
+	case "", FormatRaw, FormatJSON, FormatYAML, FormatMsgpack:
+		if len(f.Columns) > 0 {
+			return drivers.ConfigError(errors.New("input columns are only supported for csv and tsv input"))
+		}
+	case FormatCSV, FormatTSV:
+	default:
+		return drivers.ConfigError(fmt.Errorf("unknown input format %q", f.Format))
+	}
+	return nil
+}
+
+// raw reports whether the input is pushed as is.
+func (f *InputFormat) raw() bool {
+	return f == nil || f.Format == "" || f.Format == FormatRaw
+}
+
+// decoder returns a func which returns the next record of r, or io.EOF.
+func (f *InputFormat) decoder(r io.Reader) func() ([]byte, error) {
+	var next func() (any, error)
+	switch f.Format {
+	case FormatCSV, FormatTSV:
+		return f.csvDecoder(r)
+	case FormatJSON:
+		d := json.NewDecoder(r)
+		next = func() (any, error) {
+			var v json.RawMessage
+			if err := d.Decode(&v); err != nil {
+				return nil, err
+			}
+			if bytes.HasPrefix(v, []byte("[")) {
+				var vs []json.RawMessage
+				if err := json.Unmarshal(v, &vs); err != nil {
+					return nil, err
+				}
+				return vs, nil
+			}
+			return v, nil
+		}
+	case FormatYAML:
+		d := yaml.NewDecoder(r)
+		next = func() (any, error) {
+			var v any
+			if err := d.Decode(&v); err != nil {
+				return nil, err
+			}
+			return jsonValue(v), nil
+		}
+	case FormatMsgpack:
+		d := msgpack.NewDecoder(r)
+		next = func() (any, error) {
+			v, err := d.DecodeInterface()
+			if err != nil {
+				return nil, err
+			}
+			return jsonValue(v), nil
+		}
+	}
+	// pending are the remaining elements of a top level array
+	var pending []any
+	return func() ([]byte, error) {
+		for len(pending) == 0 {
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			switch t := v.(type) {
+			case []json.RawMessage:
+				for _, e := range t {
+					pending = append(pending, e)
+				}
+			case []any:
+				pending = t
+			default:
+				pending = []any{v}
+			}
+		}
+		v := pending[0]
+		pending = pending[1:]
+		if raw, ok := v.(json.RawMessage); ok {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, raw); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		}
+		return json.Marshal(v)
+	}
+}
+
+// jsonValue converts decoded YAML or msgpack maps with non-string keys into
+// maps which can be encoded as JSON.
+func jsonValue(v any) any {
+	switch t := v.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(t))
+		for k, e := range t {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case map[string]any:
+		for k, e := range t {
+			t[k] = jsonValue(e)
+		}
+	case []any:
+		for i, e := range t {
+			t[i] = jsonValue(e)
+		}
+	}
+	return v
+}
+
+// jsonNumber matches fields inferred as numbers. Numbers with leading
+// zeros, such as zip codes, are kept as strings.
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// csvDecoder returns a decoder of CSV or TSV rows as JSON objects, with
+// the keys in column order.
+func (f *InputFormat) csvDecoder(r io.Reader) func() ([]byte, error) {
+	cr := csv.NewReader(r)
+	if f.Format == FormatTSV {
+		cr.Comma = '\t'
+		cr.LazyQuotes = true
+	}
+	columns := f.Columns
+	if len(columns) > 0 {
+		cr.FieldsPerRecord = len(columns)
+	}
+	return func() ([]byte, error) {
+		if columns == nil {
+			h, err := cr.Read()
+			if err != nil {
+				return nil, err
+			}
+			columns = append([]string(nil), h...)
+		}
+		row, err := cr.Read()
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		buf.WriteByte('{')
+		for i, c := range columns {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			k, _ := json.Marshal(c)
+			buf.Write(k)
+			buf.WriteByte(':')
+			buf.Write(f.csvValue(row[i]))
+		}
+		buf.WriteByte('}')
+		return buf.Bytes(), nil
+	}
+}
+
+// csvValue returns the JSON value of the CSV field s.
+func (f *InputFormat) csvValue(s string) []byte {
+	if !f.NoInfer {
+		switch {
+		case s == "":
+			return []byte("null")
+		case s == "true", s == "false":
+			return []byte(s)
+		case jsonNumber.MatchString(s):
+			return []byte(s)
+		}
+	}
+	v, _ := json.Marshal(s)
+	return v
+}
+
+// pushRecords decodes r into records in the input format, and pushes each
+// of them as a separate payload. With an output, the records are written
+// to it as newline delimited JSON. If only some of the records fail, or
+// the input can not be decoded after some records were pushed, the error
+// is classified as drivers.ErrPartialBatch.
+func (j *PushX) pushRecords(r io.Reader) error {
+	l := log.WithFields(log.Fields{
+		"fn":     "pushRecords",
+		"driver": j.DriverName,
+		"format": j.InputFormat.Format,
+	})
+	if err := j.output(); err != nil {
+		l.WithError(err).Error("output")
+		return err
+	}
+	next := j.InputFormat.decoder(r)
+	if tx, ok := j.Driver.(drivers.Transactor); ok && tx.Transactional() && j.Aggregate == nil {
+		return j.pushTransaction(tx, next)
+	}
+	var (
+		pushed, failed int
+		firstErr       error
+	)
+	for {
+		rec, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			err = fmt.Errorf("decode %s input after %d records: %w", j.InputFormat.Format, pushed+failed, err)
+			l.WithError(err).Error("decode")
+			if pushed > 0 {
+				return drivers.PartialBatchError(err)
+			}
+			return drivers.ConfigError(err)
+		}
+		err = j.push(bytes.NewReader(rec))
+		if j.Output != nil {
+			if _, werr := j.Output.Write([]byte("\n")); werr != nil {
+				return werr
+			}
+		}
+		if err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		pushed++
+	}
+	l.WithFields(log.Fields{
+		"pushed": pushed,
+		"failed": failed,
+	}).Debug("records pushed")
+	switch {
+	case failed == 0:
+		return nil
+	case pushed == 0:
+		return firstErr
+	}
+	return drivers.PartialBatchError(fmt.Errorf("%d of %d records failed: %w", failed, pushed+failed, firstErr))
+}
+
+// pushTransaction pushes each record returned by next in a transaction of
+// the driver, so that either all of the records are committed or none of
+// them are.
+func (j *PushX) pushTransaction(tx drivers.Transactor, next func() ([]byte, error)) error {
+	l := log.WithFields(log.Fields{
+		"fn":     "pushTransaction",
+		"driver": j.DriverName,
+		"format": j.InputFormat.Format,
+	})
+	if err := tx.Begin(); err != nil {
+		l.WithError(err).Error("Begin")
+		return drivers.PushError(err)
+	}
+	abort := func() {
+		if err := tx.Abort(); err != nil {
+			l.WithError(err).Error("Abort")
+		}
+	}
+	var pushed int
+	for {
+		rec, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			abort()
+			err = fmt.Errorf("decode %s input after %d records: %w", j.InputFormat.Format, pushed, err)
+			l.WithError(err).Error("decode")
+			return drivers.ConfigError(err)
+		}
+		err = j.push(bytes.NewReader(rec))
+		if j.Output != nil {
+			if _, werr := j.Output.Write([]byte("\n")); werr != nil {
+				abort()
+				return werr
+			}
+		}
+		if err != nil {
+			abort()
+			return fmt.Errorf("record %d, transaction aborted: %w", pushed+1, err)
+		}
+		pushed++
+	}
+	if err := tx.Commit(); err != nil {
+		l.WithError(err).Error("Commit")
+		return drivers.PushError(err)
+	}
+	l.WithField("pushed", pushed).Debug("records committed")
+	return nil
+}
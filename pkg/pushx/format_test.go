@@ -0,0 +1,152 @@
+package pushx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/robertlestak/pushx/drivers/mock"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/pushx"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestInputFormat(t *testing.T) {
+	mp, err := msgpack.Marshal([]any{map[string]any{"a": 1}, "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		format pushx.InputFormat
+		in     string
+		want   []string
+	}{
+		{
+			name:   "csv",
+			format: pushx.InputFormat{Format: pushx.FormatCSV},
+			in:     "id,name,zip,ok,score\n1,\"a, b\",01234,true,-1.5e3\n2,,0,false,x\n",
+			want: []string{
+				`{"id":1,"name":"a, b","zip":"01234","ok":true,"score":-1.5e3}`,
+				`{"id":2,"name":null,"zip":0,"ok":false,"score":"x"}`,
+			},
+		},
+		{
+			name:   "tsv columns",
+			format: pushx.InputFormat{Format: pushx.FormatTSV, Columns: []string{"id", "name"}, NoInfer: true},
+			in:     "1\ta \"b\"\n2\t\n",
+			want:   []string{`{"id":"1","name":"a \"b\""}`, `{"id":"2","name":""}`},
+		},
+		{
+			name:   "json",
+			format: pushx.InputFormat{Format: pushx.FormatJSON},
+			in:     "[{\"a\": 1}, 2]\n{\"b\": [1, 2]}\n\"c\"",
+			want:   []string{`{"a":1}`, `2`, `{"b":[1,2]}`, `"c"`},
+		},
+		{
+			name:   "yaml",
+			format: pushx.InputFormat{Format: pushx.FormatYAML},
+			in:     "a: 1\nb: [x, y]\n---\n- 1: one\n- c\n",
+			want:   []string{`{"a":1,"b":["x","y"]}`, `{"1":"one"}`, `"c"`},
+		},
+		{
+			name:   "msgpack",
+			format: pushx.InputFormat{Format: pushx.FormatMsgpack},
+			in:     string(mp),
+			want:   []string{`{"a":1}`, `"b"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mock.Mock{}
+			p, err := pushx.New(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+			var out bytes.Buffer
+			p.Output = &out
+			p.InputFormat = &tt.format
+			if err := p.PushBytes(context.Background(), []byte(tt.in)); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range m.Records() {
+				got = append(got, string(r.Data))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			// the output is newline delimited JSON
+			if want := strings.Join(tt.want, "\n") + "\n"; out.String() != want {
+				t.Errorf("got output %q, want %q", out.String(), want)
+			}
+		})
+	}
+}
+
+func TestInputFormatErrors(t *testing.T) {
+	every := 2
+	m := &mock.Mock{FailEvery: &every}
+	p, err := pushx.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.InputFormat = &pushx.InputFormat{Format: pushx.FormatCSV}
+	err = p.PushBytes(context.Background(), []byte("a\n1\n2\n3\n"))
+	if !errors.Is(err, drivers.ErrPartialBatch) {
+		t.Errorf("got %v, want %v", err, drivers.ErrPartialBatch)
+	}
+	// a row with the wrong number of fields can not be decoded
+	m.FailEvery = nil
+	err = p.PushBytes(context.Background(), []byte("a,b\n1\n"))
+	if !errors.Is(err, drivers.ErrConfig) {
+		t.Errorf("got %v, want %v", err, drivers.ErrConfig)
+	}
+	p.InputFormat = &pushx.InputFormat{Format: "xml"}
+	err = p.PushBytes(context.Background(), []byte("<a/>"))
+	if !errors.Is(err, drivers.ErrConfig) {
+		t.Errorf("got %v, want %v", err, drivers.ErrConfig)
+	}
+}
+
+func TestInputFormatTransaction(t *testing.T) {
+	tx := true
+	m := &mock.Mock{Transactions: &tx}
+	p, err := pushx.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.InputFormat = &pushx.InputFormat{Format: pushx.FormatCSV}
+	if err := p.PushBytes(context.Background(), []byte("a\n1\n2\n")); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(m.Records()); n != 2 {
+		t.Errorf("got %d records, want 2", n)
+	}
+	// a failed record aborts the whole input, rather than a partial batch
+	m.Reset()
+	every := 2
+	m.FailEvery = &every
+	err = p.PushBytes(context.Background(), []byte("a\n1\n2\n3\n"))
+	if err == nil || errors.Is(err, drivers.ErrPartialBatch) || !errors.Is(err, drivers.ErrPushFailed) {
+		t.Errorf("got %v, want %v", err, drivers.ErrPushFailed)
+	}
+	m.FailEvery = nil
+	err = p.PushBytes(context.Background(), []byte("a,b\n1,2\n3\n"))
+	if !errors.Is(err, drivers.ErrConfig) {
+		t.Errorf("got %v, want %v", err, drivers.ErrConfig)
+	}
+	if n := len(m.Records()); n != 0 {
+		t.Errorf("got %d records of aborted transactions, want 0", n)
+	}
+	// the counts start again from Reset
+	if commits, aborts := m.TransactionCounts(); commits != 0 || aborts != 2 {
+		t.Errorf("got %d commits and %d aborts, want 0 and 2", commits, aborts)
+	}
+}
@@ -0,0 +1,64 @@
+package pushx
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/utils"
+)
+
+// limitReader fails once more than max bytes have been read, so that
+// drivers which buffer the payload fail before buffering more than max
+// bytes rather than exhausting memory.
+type limitReader struct {
+	r        io.Reader
+	max      int64
+	n        int64
+	exceeded bool
+}
+
+func (l *limitReader) err() error {
+	return payloadTooLarge(l.max)
+}
+
+// payloadTooLarge returns the permanent error for a payload larger than max.
+func payloadTooLarge(max int64) error {
+	return utils.Permanent(fmt.Errorf("%w: more than %d bytes", drivers.ErrPayloadTooLarge, max))
+}
+
+// payloadSize returns the size of r if it is known before reading, as for
+// regular files and in-memory input.
+func payloadSize(r io.Reader) (int64, bool) {
+	switch v := r.(type) {
+	case *ctxReader:
+		return payloadSize(v.r)
+	case interface{ Len() int }:
+		return int64(v.Len()), true
+	case *os.File:
+		fi, err := v.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			return 0, false
+		}
+		return fi.Size(), true
+	}
+	return 0, false
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, l.err()
+	}
+	// read at most one byte past max to detect an oversized payload
+	if rem := l.max - l.n + 1; int64(len(p)) > rem {
+		p = p[:rem]
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.max {
+		l.exceeded = true
+		return n - int(l.n-l.max), l.err()
+	}
+	return n, err
+}
@@ -0,0 +1,94 @@
+package pushx_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/robertlestak/pushx/drivers/fs"
+	"github.com/robertlestak/pushx/drivers/mock"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/pushx"
+)
+
+func TestMaxPayloadSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		// stream hides the payload size from the size check
+		stream  bool
+		wantErr bool
+	}{
+		{"at limit", bytes.Repeat([]byte("a"), 16), false, false},
+		{"at limit stream", bytes.Repeat([]byte("a"), 16), true, false},
+		{"over limit", bytes.Repeat([]byte("a"), 17), false, true},
+		{"over limit stream", bytes.Repeat([]byte("a"), 1<<20), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mock.Mock{}
+			p, err := pushx.New(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+			p.MaxPayloadSize = 16
+			var r io.Reader = bytes.NewReader(tt.payload)
+			if tt.stream {
+				r = io.MultiReader(r)
+			}
+			err = p.PushReader(context.Background(), r)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if recs := m.Records(); len(recs) != 1 || !bytes.Equal(recs[0].Data, tt.payload) {
+					t.Errorf("payload not pushed")
+				}
+				return
+			}
+			if !errors.Is(err, drivers.ErrPayloadTooLarge) {
+				t.Fatalf("got %v, want %v", err, drivers.ErrPayloadTooLarge)
+			}
+			if code := drivers.ExitCode(err); code != drivers.ExitPushRejected {
+				t.Errorf("got exit code %d, want %d", code, drivers.ExitPushRejected)
+			}
+			if recs := m.Records(); len(recs) != 0 {
+				t.Errorf("got %d records, want 0", len(recs))
+			}
+		})
+	}
+}
+
+func TestMaxPayloadSizeClaimCheck(t *testing.T) {
+	m := &mock.Mock{}
+	p, err := pushx.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.ClaimCheck = &pushx.ClaimCheck{
+		Driver:    &fs.FS{Folder: t.TempDir()},
+		Threshold: 16,
+	}
+	p.MaxPayloadSize = 16
+	if err := p.PushBytes(context.Background(), []byte("a")); !errors.Is(err, drivers.ErrConfig) {
+		t.Errorf("got %v, want a configuration error for a limit within the threshold", err)
+	}
+	// payloads over the limit are offloaded rather than rejected
+	p.MaxPayloadSize = 32
+	if err := p.PushBytes(context.Background(), bytes.Repeat([]byte("a"), 64)); err != nil {
+		t.Fatal(err)
+	}
+	recs := m.Records()
+	if len(recs) != 1 {
+		t.Fatalf("got %d records, want 1", len(recs))
+	}
+	var ptr pushx.ClaimCheckPointer
+	if err := json.Unmarshal(recs[0].Data, &ptr); err != nil || ptr.Size != 64 {
+		t.Errorf("got %q, want a pointer to the payload", recs[0].Data)
+	}
+}
@@ -0,0 +1,310 @@
+package pushx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/utils"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/schema"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Parquet compression codecs. The default is ParquetSnappy.
+const (
+	ParquetSnappy = "snappy"
+	ParquetZstd   = "zstd"
+	ParquetGzip   = "gzip"
+	ParquetNone   = "none"
+)
+
+// parquetCodecs are the supported parquet compression codecs.
+var parquetCodecs = map[string]parquet.CompressionCodec{
+	"":            parquet.CompressionCodec_SNAPPY,
+	ParquetSnappy: parquet.CompressionCodec_SNAPPY,
+	ParquetZstd:   parquet.CompressionCodec_ZSTD,
+	ParquetGzip:   parquet.CompressionCodec_GZIP,
+	ParquetNone:   parquet.CompressionCodec_UNCOMPRESSED,
+}
+
+// checkParquet returns an error if the parquet options are invalid.
+func (a *Aggregate) checkParquet() error {
+	if _, ok := parquetCodecs[a.ParquetCompression]; !ok {
+		return drivers.ConfigError(fmt.Errorf("unknown parquet compression %q", a.ParquetCompression))
+	}
+	if a.Gzip {
+		return drivers.ConfigError(errors.New("parquet objects are compressed with the parquet compression, not gzip"))
+	}
+	if a.ParquetRowGroupSize < 0 {
+		return drivers.ConfigError(errors.New("parquet row group size must not be negative"))
+	}
+	if a.ParquetSchema != "" {
+		if _, err := schema.NewSchemaHandlerFromJSON(a.ParquetSchema); err != nil {
+			return drivers.ConfigError(fmt.Errorf("invalid parquet schema: %w", err))
+		}
+	}
+	return nil
+}
+
+// parquet returns the newline delimited JSON object records nd as a
+// parquet file. Without a ParquetSchema, the schema is inferred from the
+// records.
+func (a *Aggregate) parquet(nd []byte) ([]byte, error) {
+	var recs []any
+	for _, ln := range bytes.Split(bytes.TrimSpace(nd), []byte("\n")) {
+		var v any
+		d := json.NewDecoder(bytes.NewReader(ln))
+		d.UseNumber()
+		if err := d.Decode(&v); err != nil {
+			return nil, err
+		}
+		recs = append(recs, v)
+	}
+	sch := a.ParquetSchema
+	rows := make([]any, len(recs))
+	if sch == "" {
+		var root *parquetNode
+		for _, r := range recs {
+			root = root.merge(inferParquet(r))
+		}
+		if len(root.names) == 0 {
+			return nil, utils.Permanent(errors.New("parquet records have no fields"))
+		}
+		for i, r := range recs {
+			bd, err := json.Marshal(root.normalize(r))
+			if err != nil {
+				return nil, err
+			}
+			rows[i] = bd
+		}
+		bd, err := json.Marshal(parquetSchemaItem{
+			Tag:    "name=parquet_go_root, repetitiontype=REQUIRED",
+			Fields: root.fields(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		sch = string(bd)
+	} else {
+		for i, ln := range bytes.Split(bytes.TrimSpace(nd), []byte("\n")) {
+			rows[i] = ln
+		}
+	}
+	var buf bytes.Buffer
+	pw, err := writer.NewJSONWriterFromWriter(sch, &buf, int64(runtime.NumCPU()))
+	if err != nil {
+		return nil, drivers.ConfigError(fmt.Errorf("invalid parquet schema: %w", err))
+	}
+	pw.CompressionType = parquetCodecs[a.ParquetCompression]
+	if a.ParquetRowGroupSize > 0 {
+		pw.RowGroupSize = a.ParquetRowGroupSize
+	}
+	for _, r := range rows {
+		if err := pw.Write(r); err != nil {
+			return nil, err
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parquetSchemaItem is a node of a parquet-go JSON schema.
+type parquetSchemaItem struct {
+	Tag    string              `json:"Tag"`
+	Fields []parquetSchemaItem `json:"Fields,omitempty"`
+}
+
+// parquet kinds of inferred JSON values. Values of conflicting kinds are
+// written as strings of their JSON encoding.
+const (
+	parquetNull   = "null"
+	parquetString = "string"
+	parquetInt    = "int"
+	parquetDouble = "double"
+	parquetBool   = "bool"
+	parquetObject = "object"
+	parquetList   = "list"
+)
+
+// parquetNode is the inferred schema of a JSON value.
+type parquetNode struct {
+	kind string
+	// names are the column names of the keys of an object, in order,
+	// and origs the keys
+	names []string
+	origs []string
+	keys  map[string]string
+	props map[string]*parquetNode
+	elem  *parquetNode
+}
+
+// parquetName returns the column name for the JSON key k, since parquet-go
+// schema tags can not contain commas or equals signs.
+func parquetName(k string) string {
+	return strings.NewReplacer(",", "_", "=", "_").Replace(strings.TrimSpace(k))
+}
+
+// inferParquet returns the schema of the decoded JSON value v.
+func inferParquet(v any) *parquetNode {
+	switch t := v.(type) {
+	case nil:
+		return &parquetNode{kind: parquetNull}
+	case string:
+		return &parquetNode{kind: parquetString}
+	case bool:
+		return &parquetNode{kind: parquetBool}
+	case json.Number:
+		if _, err := t.Int64(); err == nil {
+			return &parquetNode{kind: parquetInt}
+		}
+		return &parquetNode{kind: parquetDouble}
+	case []any:
+		n := &parquetNode{kind: parquetList}
+		for _, e := range t {
+			if e != nil {
+				n.elem = n.elem.merge(inferParquet(e))
+			}
+		}
+		return n
+	case map[string]any:
+		n := &parquetNode{kind: parquetObject}
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			n.addProp(k, inferParquet(t[k]))
+		}
+		return n
+	}
+	return &parquetNode{kind: parquetString}
+}
+
+// addProp merges the schema p of the object key k into n. Keys which map
+// to the same parquet-go field as an earlier key are dropped.
+func (n *parquetNode) addProp(k string, p *parquetNode) {
+	name := parquetName(k)
+	if name == "" {
+		return
+	}
+	if n.props == nil {
+		n.keys = map[string]string{}
+		n.props = map[string]*parquetNode{}
+	}
+	if _, ok := n.props[name]; !ok {
+		for _, o := range n.names {
+			if common.StringToVariableName(o) == common.StringToVariableName(name) {
+				return
+			}
+		}
+		n.names = append(n.names, name)
+		n.origs = append(n.origs, k)
+		n.keys[k] = name
+	} else if _, ok := n.keys[k]; !ok {
+		return
+	}
+	n.props[name] = n.props[name].merge(p)
+}
+
+// merge returns the schema of values of either schema n or o.
+func (n *parquetNode) merge(o *parquetNode) *parquetNode {
+	switch {
+	case n == nil || n.kind == parquetNull:
+		return o
+	case o == nil || o.kind == parquetNull:
+		return n
+	case n.kind == o.kind:
+		switch n.kind {
+		case parquetObject:
+			for i, name := range o.names {
+				n.addProp(o.origs[i], o.props[name])
+			}
+		case parquetList:
+			n.elem = n.elem.merge(o.elem)
+		}
+		return n
+	case (n.kind == parquetInt && o.kind == parquetDouble) || (n.kind == parquetDouble && o.kind == parquetInt):
+		return &parquetNode{kind: parquetDouble}
+	}
+	return &parquetNode{kind: parquetString}
+}
+
+// normalize returns v with the keys renamed to their columns, and values
+// of conflicting kinds, and empty objects, encoded as JSON strings. Null
+// list elements can not be written, and are dropped.
+func (n *parquetNode) normalize(v any) any {
+	if v == nil {
+		return nil
+	}
+	switch {
+	case n.kind == parquetObject && len(n.names) > 0:
+		m := map[string]any{}
+		for k, e := range v.(map[string]any) {
+			if name, ok := n.keys[k]; ok {
+				m[name] = n.props[name].normalize(e)
+			}
+		}
+		return m
+	case n.kind == parquetList:
+		l := []any{}
+		for _, e := range v.([]any) {
+			if e != nil {
+				l = append(l, n.elem.normalize(e))
+			}
+		}
+		return l
+	case n.kind == parquetString, n.kind == parquetNull, n.kind == parquetObject:
+		if s, ok := v.(string); ok {
+			return s
+		}
+		bd, _ := json.Marshal(v)
+		return string(bd)
+	}
+	return v
+}
+
+// fields returns the parquet-go JSON schema of the columns of an object.
+func (n *parquetNode) fields() []parquetSchemaItem {
+	var items []parquetSchemaItem
+	for _, name := range n.names {
+		items = append(items, n.props[name].item("name="+name+", repetitiontype=OPTIONAL"))
+	}
+	return items
+}
+
+// item returns the parquet-go JSON schema of n with the tag prefix tag.
+func (n *parquetNode) item(tag string) parquetSchemaItem {
+	if n == nil {
+		n = &parquetNode{kind: parquetNull}
+	}
+	switch n.kind {
+	case parquetInt:
+		return parquetSchemaItem{Tag: tag + ", type=INT64"}
+	case parquetDouble:
+		return parquetSchemaItem{Tag: tag + ", type=DOUBLE"}
+	case parquetBool:
+		return parquetSchemaItem{Tag: tag + ", type=BOOLEAN"}
+	case parquetObject:
+		if len(n.names) == 0 {
+			// parquet groups must have a column
+			return parquetSchemaItem{Tag: tag + ", type=BYTE_ARRAY, convertedtype=UTF8"}
+		}
+		return parquetSchemaItem{Tag: tag, Fields: n.fields()}
+	case parquetList:
+		return parquetSchemaItem{
+			Tag:    tag + ", type=LIST",
+			Fields: []parquetSchemaItem{n.elem.item("name=element, repetitiontype=REQUIRED")},
+		}
+	}
+	return parquetSchemaItem{Tag: tag + ", type=BYTE_ARRAY, convertedtype=UTF8"}
+}
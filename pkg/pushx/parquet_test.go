@@ -0,0 +1,78 @@
+package pushx_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/robertlestak/pushx/drivers/mock"
+	"github.com/robertlestak/pushx/pkg/pushx"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// readParquet returns the rows of the parquet file bd as JSON.
+func readParquet(t *testing.T, bd []byte) string {
+	t.Helper()
+	bf, err := buffer.NewBufferFile(bd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := reader.NewParquetReader(bf, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+	rows, err := pr.ReadByNumber(int(pr.GetNumRows()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jd, err := json.Marshal(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(jd)
+}
+
+func TestAggregateParquet(t *testing.T) {
+	for _, codec := range []string{pushx.ParquetSnappy, pushx.ParquetZstd} {
+		t.Run(codec, func(t *testing.T) {
+			m := &mock.Mock{}
+			p := newAggregate(t, m, &pushx.Aggregate{Format: pushx.AggregateParquet, ParquetCompression: codec})
+			pushStrings(t, p,
+				`{"id": 1, "name": "a", "tags": ["x", "y"], "geo": {"lat": 1.5}}`,
+				`{"id": 2, "score": 2.5, "geo": {"lat": 2}, "mixed": 1}`,
+				`{"id": 3, "name": null, "mixed": "s"}`,
+			)
+			if err := p.Close(); err != nil {
+				t.Fatal(err)
+			}
+			got := readParquet(t, m.Records()[0].Data)
+			want := `[` +
+				`{"Geo":{"Lat":1.5},"Id":1,"Name":"a","Tags":["x","y"],"Mixed":null,"Score":null},` +
+				`{"Geo":{"Lat":2},"Id":2,"Name":null,"Tags":null,"Mixed":"1","Score":2.5},` +
+				`{"Geo":null,"Id":3,"Name":null,"Tags":null,"Mixed":"s","Score":null}]`
+			if got != want {
+				t.Errorf("got %s\nwant %s", got, want)
+			}
+		})
+	}
+}
+
+func TestAggregateParquetSchema(t *testing.T) {
+	m := &mock.Mock{}
+	p := newAggregate(t, m, &pushx.Aggregate{
+		Format: pushx.AggregateParquet,
+		ParquetSchema: `{"Tag": "name=root", "Fields": [
+			{"Tag": "name=id, type=INT32"},
+			{"Tag": "name=name, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"}
+		]}`,
+	})
+	pushStrings(t, p, `{"id": 1, "name": "a", "other": true}`, `{"id": 2}`)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := readParquet(t, m.Records()[0].Data)
+	if want := `[{"Id":1,"Name":"a"},{"Id":2,"Name":null}]`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -1,11 +1,16 @@
 package pushx
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
 
 	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/schema"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -17,6 +22,43 @@ type PushX struct {
 	Input      io.Reader          `json:"-"`
 	OutputFile string             `json:"outFile"`
 	Output     io.Writer          `json:"-"`
+	// Meta is set as the native message headers or attributes of the
+	// driver. Values may be templated from the payload, for example
+	// {{id}}. Drivers which do not implement drivers.MetaPusher return
+	// drivers.ErrMetaUnsupported.
+	Meta map[string]string `json:"meta"`
+	// CloudEvent, if set with a mode, wraps each payload as a CloudEvent.
+	CloudEvent *CloudEvent `json:"cloudEvent"`
+	// ClaimCheck, if set, offloads large payloads to a blob driver and
+	// pushes a pointer to them instead.
+	ClaimCheck *ClaimCheck `json:"claimCheck"`
+	// MaxPayloadSize, if greater than 0, is the maximum payload size in
+	// bytes. Larger payloads fail with drivers.ErrPayloadTooLarge. With
+	// a ClaimCheck, it must be larger than the threshold, and payloads
+	// above the threshold are offloaded instead.
+	MaxPayloadSize int64 `json:"maxPayloadSize"`
+	// InputFormat, if set, decodes the input and files into JSON records
+	// which are pushed as separate payloads.
+	InputFormat *InputFormat `json:"inputFormat"`
+	// Files, if set, pushes every matched file as a separate payload in
+	// place of the input.
+	Files *Files `json:"files"`
+	// Aggregate, if set, buffers payloads as records which are pushed
+	// together as one object.
+	Aggregate *Aggregate `json:"aggregate"`
+	// Watch, if set, configures PushWatch to push data continuously from
+	// a file or directory in place of the input.
+	Watch *Watch `json:"watch"`
+	// Relay, if set, configures PushRelay to push the messages received
+	// from a source driver in place of the input.
+	Relay *Relay `json:"relay"`
+
+	// envKeyPrefix and config are used to load the driver of additional
+	// workers when pushing files concurrently.
+	envKeyPrefix string
+	config       map[string]any
+	agg          *aggregator
+	relayStats   relayStats
 }
 
 func (j *PushX) Init(envKeyPrefix string) error {
@@ -24,29 +66,60 @@ func (j *PushX) Init(envKeyPrefix string) error {
 		"fn": "Init",
 	})
 	l.Debug("Init")
-	if j.DriverName == "" {
-		l.Error("no driver specified")
-		return drivers.ErrDriverNotFound
+	if err := j.Files.check(); err != nil {
+		l.WithError(err).Error("Files")
+		return err
 	}
-	l.Debug("driver specified")
-	j.Driver = drivers.GetDriver(j.DriverName)
-	if j.Driver == nil {
-		l.Error("driver not found")
-		return drivers.ErrDriverNotFound
+	if err := j.Watch.check(); err != nil {
+		l.WithError(err).Error("Watch")
+		return err
 	}
-	if err := j.Driver.LoadFlags(); err != nil {
-		l.WithError(err).Error("LoadFlags")
+	if err := j.Aggregate.check(); err != nil {
+		l.WithError(err).Error("Aggregate")
 		return err
 	}
-	if err := j.Driver.LoadEnv(envKeyPrefix); err != nil {
-		l.WithError(err).Error("LoadEnv")
+	if err := j.InputFormat.check(); err != nil {
+		l.WithError(err).Error("InputFormat")
 		return err
 	}
-	if err := j.Driver.Init(); err != nil {
-		l.WithError(err).Error("Init")
+	if err := j.Relay.check(); err != nil {
+		l.WithError(err).Error("Relay")
 		return err
 	}
-	l.Debug("driver initialized")
+	if err := j.ClaimCheck.check(j.MaxPayloadSize); err != nil {
+		l.WithError(err).Error("ClaimCheck")
+		return err
+	}
+	if j.Files != nil && j.Watch != nil {
+		return drivers.ConfigError(errors.New("files and watch input are mutually exclusive"))
+	}
+	if j.Relay != nil && (j.Files != nil || j.Watch != nil) {
+		return drivers.ConfigError(errors.New("relay is mutually exclusive with files and watch input"))
+	}
+	if j.Relay != nil && j.Aggregate != nil {
+		return drivers.ConfigError(errors.New("aggregation is not supported with relay, since messages would be acknowledged before they are flushed"))
+	}
+	if err := j.Aggregate.checkInput(j.Files, j.Watch); err != nil {
+		l.WithError(err).Error("Aggregate")
+		return err
+	}
+	if j.Watch != nil && !j.InputFormat.raw() {
+		return drivers.ConfigError(errors.New("input formats are not supported with watch input"))
+	}
+	if err := j.LoadDriver(envKeyPrefix); err != nil {
+		return err
+	}
+	if err := j.initDriver(envKeyPrefix); err != nil {
+		return err
+	}
+	if j.Relay != nil {
+		l.Debug("input is relay source")
+		return j.loadRelay(envKeyPrefix)
+	}
+	if j.Files != nil || j.Watch != nil {
+		l.Debug("input is files")
+		return nil
+	}
 	if j.InputStr != "" {
 		l.Debug("input string specified")
 		j.Input = strings.NewReader(j.InputStr)
@@ -59,19 +132,76 @@ func (j *PushX) Init(envKeyPrefix string) error {
 		j.Input, err = os.Open(j.InputFile)
 		if err != nil {
 			l.WithError(err).Error("Open")
-			return err
+			return drivers.ConfigError(err)
 		}
 	}
 	return nil
 }
 
+// initDriver validates the push options against the loaded driver, and
+// initializes it and the claim-check driver.
+func (j *PushX) initDriver(envKeyPrefix string) error {
+	l := log.WithFields(log.Fields{
+		"fn": "initDriver",
+	})
+	j.envKeyPrefix = envKeyPrefix
+	if err := j.checkMeta(j.Meta); err != nil {
+		l.WithError(err).Error("checkMeta")
+		return err
+	}
+	if err := j.checkCloudEvent(); err != nil {
+		l.WithError(err).Error("checkCloudEvent")
+		return err
+	}
+	if err := j.Driver.Init(); err != nil {
+		l.WithError(err).Error("Init")
+		return drivers.ConnectError(err)
+	}
+	l.Debug("driver initialized")
+	if err := j.loadClaimCheck(envKeyPrefix); err != nil {
+		l.WithError(err).Error("loadClaimCheck")
+		return err
+	}
+	return nil
+}
+
+// LoadDriver resolves the configured driver and loads its flags and
+// environment, without initializing it.
+func (j *PushX) LoadDriver(envKeyPrefix string) error {
+	l := log.WithFields(log.Fields{
+		"fn": "LoadDriver",
+	})
+	l.Debug("LoadDriver")
+	if j.DriverName == "" {
+		l.Error("no driver specified")
+		return drivers.ConfigError(drivers.ErrDriverNotFound)
+	}
+	l.Debug("driver specified")
+	j.Driver = drivers.GetDriver(j.DriverName)
+	if j.Driver == nil {
+		l.Error("driver not found")
+		return drivers.ConfigError(drivers.ErrDriverNotFound)
+	}
+	if err := j.Driver.LoadFlags(); err != nil {
+		l.WithError(err).Error("LoadFlags")
+		return drivers.ConfigError(err)
+	}
+	if err := j.Driver.LoadEnv(envKeyPrefix); err != nil {
+		l.WithError(err).Error("LoadEnv")
+		return drivers.ConfigError(err)
+	}
+	return nil
+}
+
 func (j *PushX) output() error {
 	l := log.WithFields(log.Fields{
 		"fn":     "output",
 		"driver": j.DriverName,
 	})
 	l.Debug("output")
-	if j.OutputFile == "-" {
+	if j.Output != nil {
+		l.Debug("output writer specified")
+	} else if j.OutputFile == "-" {
 		l.Debug("output is stdout")
 		j.Output = os.Stdout
 	} else if j.OutputFile != "" {
@@ -80,7 +210,7 @@ func (j *PushX) output() error {
 		j.Output, err = os.Create(j.OutputFile)
 		if err != nil {
 			log.WithError(err).Error("Create")
-			return err
+			return drivers.ConfigError(err)
 		}
 	} else {
 		l.Debug("no output")
@@ -88,27 +218,148 @@ func (j *PushX) output() error {
 	return nil
 }
 
+// send pushes in to the driver, applying the claim-check, CloudEvents
+// and metadata options. The metadata and event attributes of an offloaded
+// payload are templated from its head rather than the pointer pushed.
+func (j *PushX) send(in io.Reader) error {
+	var head []byte
+	if j.ClaimCheck != nil {
+		var err error
+		if in, head, err = j.claimCheck(in); err != nil {
+			return err
+		}
+	}
+	if j.CloudEvent != nil && j.CloudEvent.Mode != "" {
+		return j.pushCloudEvent(in, head)
+	}
+	if len(j.Meta) > 0 {
+		return j.pushMeta(in, head)
+	}
+	return j.Driver.Push(in)
+}
+
+// checkMeta returns an error if meta is set but not supported by the driver.
+func (j *PushX) checkMeta(meta map[string]string) error {
+	if len(meta) == 0 {
+		return nil
+	}
+	if _, ok := j.Driver.(drivers.MetaPusher); !ok {
+		return drivers.ConfigError(fmt.Errorf("%w: %s", drivers.ErrMetaUnsupported, j.DriverName))
+	}
+	return nil
+}
+
+// renderMeta returns the metadata with values templated from the payload
+// bd. bd is only read if a value is templated.
+func (j *PushX) renderMeta(bd func() ([]byte, error)) (map[string]string, error) {
+	meta := make(map[string]string, len(j.Meta))
+	for k, v := range j.Meta {
+		if !strings.Contains(v, "{{") {
+			meta[k] = v
+			continue
+		}
+		b, err := bd()
+		if err != nil {
+			return nil, err
+		}
+		meta[k] = schema.ReplaceParamsString(b, v)
+	}
+	return meta, nil
+}
+
+// Push pushes the configured input, or each of the configured files, to
+// the driver.
 func (j *PushX) Push() error {
+	if j.Files != nil {
+		return j.pushFiles()
+	}
+	return j.pushInput(j.Input)
+}
+
+// pushInput pushes r, or the records decoded from it if an input format
+// is set.
+func (j *PushX) pushInput(r io.Reader) error {
+	if j.InputFormat.raw() {
+		return j.push(r)
+	}
+	if err := j.InputFormat.check(); err != nil {
+		return err
+	}
+	return j.pushRecords(r)
+}
+
+func (j *PushX) push(r io.Reader) error {
 	l := log.WithFields(log.Fields{
 		"fn":     "Push",
 		"driver": j.DriverName,
 	})
-	var in io.Reader
-	if j.OutputFile == "" {
-		l.Debug("no output")
-		in = j.Input
-	} else {
-		if err := j.output(); err != nil {
-			l.WithError(err).Error("output")
-			return err
+	if err := j.output(); err != nil {
+		l.WithError(err).Error("output")
+		return err
+	}
+	if err := j.ClaimCheck.check(j.MaxPayloadSize); err != nil {
+		return err
+	}
+	var lr *limitReader
+	// payloads above the claim-check threshold are offloaded rather than
+	// rejected, and those within it are within the limit
+	if j.MaxPayloadSize > 0 && j.ClaimCheck == nil {
+		if n, ok := payloadSize(r); ok && n > j.MaxPayloadSize {
+			l.WithField("size", n).Error("payload too large")
+			return drivers.PushError(payloadTooLarge(j.MaxPayloadSize))
 		}
-		in = io.TeeReader(j.Input, j.Output)
+		lr = &limitReader{r: r, max: j.MaxPayloadSize}
+		r = lr
+	}
+	in := r
+	if j.Output != nil {
+		in = io.TeeReader(r, j.Output)
+	}
+	var err error
+	if j.Aggregate != nil {
+		err = j.aggregate(in)
+	} else {
+		err = j.send(in)
+	}
+	if lr != nil && lr.exceeded {
+		// drivers may not return or wrap the read error
+		err = lr.err()
 	}
-	err := j.Driver.Push(in)
 	if err != nil {
 		l.Error("push error:", err)
-		return err
+		return drivers.PushError(err)
 	}
 	l.Debug("work pushed")
 	return nil
 }
+
+// pushMeta pushes r with the configured metadata, templated from src if
+// it is not nil, or else from the payload.
+func (j *PushX) pushMeta(r io.Reader, src []byte) error {
+	if err := j.checkMeta(j.Meta); err != nil {
+		return err
+	}
+	var bd []byte
+	read := func() ([]byte, error) {
+		if src != nil {
+			return src, nil
+		}
+		if bd != nil {
+			return bd, nil
+		}
+		var err error
+		bd, err = ioutil.ReadAll(r)
+		if bd == nil {
+			bd = []byte{}
+		}
+		return bd, err
+	}
+	meta, err := j.renderMeta(read)
+	if err != nil {
+		return err
+	}
+	if bd != nil {
+		r = bytes.NewReader(bd)
+	}
+	return j.Driver.(drivers.MetaPusher).PushMeta(r, meta)
+}
@@ -0,0 +1,159 @@
+package pushx_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/pushx/drivers/fs"
+	pushxhttp "github.com/robertlestak/pushx/drivers/http"
+	"github.com/robertlestak/pushx/drivers/mock"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/pushx"
+)
+
+func TestPushMeta(t *testing.T) {
+	m := &mock.Mock{}
+	p, err := pushx.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.Meta = map[string]string{
+		"static":   "value",
+		"id":       "{{id}}",
+		"customer": "c-{{customer.name}}",
+	}
+	payload := `{"id":"42","customer":{"name":"acme"}}`
+	if err := p.PushBytes(context.Background(), []byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+	recs := m.Records()
+	if len(recs) != 1 {
+		t.Fatalf("got %d records, want 1", len(recs))
+	}
+	if string(recs[0].Data) != payload {
+		t.Errorf("got payload %q, want %q", recs[0].Data, payload)
+	}
+	want := map[string]string{"static": "value", "id": "42", "customer": "c-acme"}
+	for k, v := range want {
+		if recs[0].Meta[k] != v {
+			t.Errorf("meta %s = %q, want %q", k, recs[0].Meta[k], v)
+		}
+	}
+}
+
+func TestPushMetaUnsupported(t *testing.T) {
+	dir := t.TempDir()
+	p, err := pushx.New(&fs.FS{Folder: dir, Key: "out"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.Meta = map[string]string{"k": "v"}
+	err = p.PushBytes(context.Background(), []byte("hello"))
+	if !errors.Is(err, drivers.ErrMetaUnsupported) {
+		t.Fatalf("got %v, want %v", err, drivers.ErrMetaUnsupported)
+	}
+	if code := drivers.ExitCode(err); code != drivers.ExitConfig {
+		t.Errorf("got exit code %d, want %d", code, drivers.ExitConfig)
+	}
+}
+
+// cancelReader cancels its context when it is first read.
+type cancelReader struct {
+	cancel context.CancelFunc
+	reads  int
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	r.reads++
+	r.cancel()
+	return copy(p, "hello"), nil
+}
+
+func TestPushReaderCancel(t *testing.T) {
+	m := &mock.Mock{}
+	p, err := pushx.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &cancelReader{cancel: cancel}
+	if err := p.PushReader(ctx, r); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+	// the push was aborted, and r is not read once PushReader has returned
+	reads := r.reads
+	if err := p.PushBytes(context.Background(), []byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	if r.reads != reads {
+		t.Errorf("got %d reads after PushReader returned", r.reads-reads)
+	}
+	if recs := m.Records(); len(recs) != 1 || string(recs[0].Data) != "world" {
+		t.Errorf("got records %+v, want only the second push", recs)
+	}
+}
+
+func TestPushReaderCancelRetry(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+	p, err := pushx.New(&pushxhttp.HTTP{Request: &pushxhttp.HTTPRequest{URL: s.URL, Retries: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := p.PushBytes(ctx, []byte("hello")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	// the wait before the retry ends with the context
+	if e := time.Since(start); e > 2*time.Second {
+		t.Errorf("returned after %s", e)
+	}
+}
+
+// failingBlob is a blob driver whose Cleanup fails.
+type failingBlob struct {
+	*fs.FS
+}
+
+func (failingBlob) Cleanup() error {
+	return errors.New("blob cleanup failed")
+}
+
+// cleanupCounter counts the Cleanup calls of a driver.
+type cleanupCounter struct {
+	*mock.Mock
+	cleanups int
+}
+
+func (c *cleanupCounter) Cleanup() error {
+	c.cleanups++
+	return c.Mock.Cleanup()
+}
+
+func TestCloseCleansUpAll(t *testing.T) {
+	d := &cleanupCounter{Mock: &mock.Mock{}}
+	p, err := pushx.New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ClaimCheck = &pushx.ClaimCheck{Driver: failingBlob{&fs.FS{Folder: t.TempDir()}}}
+	if err := p.Close(); err == nil || err.Error() != "blob cleanup failed" {
+		t.Errorf("got %v, want the claim-check cleanup error", err)
+	}
+	if d.cleanups != 1 {
+		t.Errorf("got %d cleanups of the driver, want 1", d.cleanups)
+	}
+}
@@ -0,0 +1,313 @@
+package pushx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/robertlestak/pushx/pkg/drivers"
+	log "github.com/sirupsen/logrus"
+)
+
+// Relay configures PushRelay to receive messages from a source driver and
+// push each of them to the driver. A message is only acknowledged with
+// the source once it has been pushed or dead lettered, so every message
+// is delivered at least once.
+type Relay struct {
+	// SourceName is the source driver to load from flags and environment
+	// variables on Init, if Source is not set. Environment variables with
+	// the SOURCE_ infix, such as PUSHX_SOURCE_REDIS_KEY, take precedence
+	// for the source, so that it can be of the same type as the driver.
+	SourceName drivers.DriverName `json:"sourceName"`
+	// Source is the initialized driver messages are received from.
+	Source drivers.Source `json:"-"`
+	// Retries is the number of times a failed push is retried before the
+	// message is dead lettered, or negatively acknowledged. Rejected
+	// payloads are not retried.
+	Retries int `json:"retries"`
+	// RetryBackoff is the delay before the first retry, doubled for each
+	// further retry. It defaults to 1s.
+	RetryBackoff time.Duration `json:"retryBackoff"`
+	// DLQName is the driver to load, like SourceName with the DLQ_ infix,
+	// if DLQ is not set.
+	DLQName drivers.DriverName `json:"dlqName"`
+	// DLQ, if set, is pushed the messages which could not be pushed to
+	// the driver, after which they are acknowledged. If it is not set,
+	// messages rejected by the driver are acknowledged and dropped.
+	DLQ drivers.Driver `json:"-"`
+	// MetricsAddr, if set, is the address Prometheus metrics are served
+	// on at /metrics.
+	MetricsAddr string `json:"metricsAddr"`
+}
+
+// RelayStats are the counts of messages handled by PushRelay.
+type RelayStats struct {
+	Received      uint64 `json:"received"`
+	Pushed        uint64 `json:"pushed"`
+	Retries       uint64 `json:"retries"`
+	DeadLettered  uint64 `json:"deadLettered"`
+	Dropped       uint64 `json:"dropped"`
+	Nacked        uint64 `json:"nacked"`
+	ReceiveErrors uint64 `json:"receiveErrors"`
+	AckErrors     uint64 `json:"ackErrors"`
+}
+
+// relayStats guards the RelayStats of a running relay.
+type relayStats struct {
+	mu sync.Mutex
+	RelayStats
+}
+
+func (s *relayStats) add(f func(*RelayStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(&s.RelayStats)
+}
+
+// check returns an error if the configuration is invalid.
+func (r *Relay) check() error {
+	if r == nil {
+		return nil
+	}
+	if r.Source == nil && r.SourceName == "" {
+		return drivers.ConfigError(errors.New("relay source is required"))
+	}
+	if r.Retries < 0 || r.RetryBackoff < 0 {
+		return drivers.ConfigError(errors.New("relay retries and retry backoff must not be negative"))
+	}
+	return nil
+}
+
+// backoff returns the delay before the retry attempt, counting from 0.
+func (r *Relay) backoff(attempt int) time.Duration {
+	d := r.RetryBackoff
+	if d == 0 {
+		d = time.Second
+	}
+	return d << attempt
+}
+
+// loadNamedDriver returns the named driver with its flags and
+// environment loaded, with the variables of the envKeyPrefix and infix
+// prefix taking precedence.
+func loadNamedDriver(name drivers.DriverName, envKeyPrefix, infix string) (drivers.Driver, error) {
+	d := drivers.GetDriver(name)
+	if d == nil {
+		return nil, drivers.ConfigError(drivers.ErrDriverNotFound)
+	}
+	if err := d.LoadFlags(); err != nil {
+		return nil, drivers.ConfigError(err)
+	}
+	if err := d.LoadEnv(envKeyPrefix); err != nil {
+		return nil, drivers.ConfigError(err)
+	}
+	if err := d.LoadEnv(envKeyPrefix + infix); err != nil {
+		return nil, drivers.ConfigError(err)
+	}
+	return d, nil
+}
+
+// loadRelay loads and initializes the source and dead letter drivers, if
+// they are configured by name.
+func (j *PushX) loadRelay(envKeyPrefix string) error {
+	l := log.WithFields(log.Fields{
+		"fn": "loadRelay",
+	})
+	l.Debug("loadRelay")
+	r := j.Relay
+	if r.Source == nil {
+		d, err := loadNamedDriver(r.SourceName, envKeyPrefix, "SOURCE_")
+		if err != nil {
+			return err
+		}
+		src, ok := d.(drivers.Source)
+		if !ok {
+			return drivers.ConfigError(fmt.Errorf("%w: %s", drivers.ErrSourceUnsupported, r.SourceName))
+		}
+		if err := src.Init(); err != nil {
+			l.WithError(err).Error("source Init")
+			return drivers.ConnectError(err)
+		}
+		r.Source = src
+	}
+	if r.DLQ == nil && r.DLQName != "" {
+		d, err := loadNamedDriver(r.DLQName, envKeyPrefix, "DLQ_")
+		if err != nil {
+			return err
+		}
+		if err := d.Init(); err != nil {
+			l.WithError(err).Error("dlq Init")
+			return drivers.ConnectError(err)
+		}
+		r.DLQ = d
+	}
+	return nil
+}
+
+// sleep waits for d, and reports whether ctx is still not done.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// PushRelay receives messages from the relay source and pushes each of
+// them to the already initialized driver, until ctx is done.
+func (j *PushX) PushRelay(ctx context.Context) error {
+	l := log.WithFields(log.Fields{
+		"fn":     "PushRelay",
+		"driver": j.DriverName,
+	})
+	r := j.Relay
+	if r == nil {
+		return drivers.ConfigError(errors.New("no relay configured"))
+	}
+	if err := r.check(); err != nil {
+		return err
+	}
+	if r.Source == nil {
+		return drivers.ConfigError(errors.New("relay source is not loaded"))
+	}
+	if r.MetricsAddr != "" {
+		srv, err := j.serveRelayMetrics(r.MetricsAddr)
+		if err != nil {
+			l.WithError(err).Error("serveRelayMetrics")
+			return drivers.ConfigError(err)
+		}
+		defer srv.Close()
+	}
+	defer j.setContext(ctx)()
+	for {
+		bd, ref, err := r.Source.Receive(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			l.WithError(err).Error("receive failed")
+			j.relayStats.add(func(s *RelayStats) { s.ReceiveErrors++ })
+			sleep(ctx, r.backoff(0))
+			continue
+		}
+		j.relayStats.add(func(s *RelayStats) { s.Received++ })
+		if err := j.relayMessage(ctx, bd, ref); err != nil {
+			return err
+		}
+	}
+}
+
+// relayMessage pushes the message bd, retrying failed pushes, and then
+// acknowledges it, or dead letters it, or negatively acknowledges it.
+// Payloads rejected by the driver are dropped if there is no DLQ, since
+// they would be rejected again each time they are received. A
+// configuration error is returned, after negatively acknowledging the
+// message, as every other message would fail in the same way.
+func (j *PushX) relayMessage(ctx context.Context, bd []byte, ref any) error {
+	l := log.WithFields(log.Fields{
+		"fn":     "relayMessage",
+		"driver": j.DriverName,
+	})
+	r := j.Relay
+	err := j.pushInput(bytes.NewReader(bd))
+	for i := 0; err != nil && i < r.Retries; i++ {
+		if errors.Is(err, drivers.ErrPushRejected) || errors.Is(err, drivers.ErrConfig) {
+			break
+		}
+		l.WithError(err).Warn("push failed, retrying")
+		if !sleep(ctx, r.backoff(i)) {
+			break
+		}
+		j.relayStats.add(func(s *RelayStats) { s.Retries++ })
+		err = j.pushInput(bytes.NewReader(bd))
+	}
+	ack := func() {
+		if err := r.Source.Ack(ref); err != nil {
+			l.WithError(err).Error("ack failed, the message may be received again")
+			j.relayStats.add(func(s *RelayStats) { s.AckErrors++ })
+		}
+	}
+	nack := func() {
+		j.relayStats.add(func(s *RelayStats) { s.Nacked++ })
+		if err := r.Source.Nack(ref); err != nil {
+			l.WithError(err).Error("nack failed")
+			j.relayStats.add(func(s *RelayStats) { s.AckErrors++ })
+		}
+	}
+	if err == nil {
+		j.relayStats.add(func(s *RelayStats) { s.Pushed++ })
+		ack()
+		return nil
+	}
+	l.WithError(err).Error("push failed")
+	if errors.Is(err, drivers.ErrConfig) {
+		nack()
+		return err
+	}
+	if r.DLQ != nil && ctx.Err() == nil {
+		if derr := r.DLQ.Push(bytes.NewReader(bd)); derr != nil {
+			l.WithError(derr).Error("dead letter push failed")
+		} else {
+			j.relayStats.add(func(s *RelayStats) { s.DeadLettered++ })
+			ack()
+			return nil
+		}
+	} else if r.DLQ == nil && errors.Is(err, drivers.ErrPushRejected) {
+		l.Error("payload rejected and no dead letter driver set, dropping it")
+		j.relayStats.add(func(s *RelayStats) { s.Dropped++ })
+		ack()
+		return nil
+	}
+	nack()
+	// the message may be received again at once
+	sleep(ctx, r.backoff(0))
+	return nil
+}
+
+// RelayStats returns the counts of messages handled by PushRelay.
+func (j *PushX) RelayStats() RelayStats {
+	j.relayStats.mu.Lock()
+	defer j.relayStats.mu.Unlock()
+	return j.relayStats.RelayStats
+}
+
+// serveRelayMetrics serves the relay stats in the Prometheus text format
+// at /metrics on addr.
+func (j *PushX) serveRelayMetrics(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		s := j.RelayStats()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintln(w, "# HELP pushx_relay_received_total Messages received from the relay source.")
+		fmt.Fprintln(w, "# TYPE pushx_relay_received_total counter")
+		fmt.Fprintf(w, "pushx_relay_received_total %d\n", s.Received)
+		fmt.Fprintln(w, "# HELP pushx_relay_messages_total Messages handled by the relay, by result.")
+		fmt.Fprintln(w, "# TYPE pushx_relay_messages_total counter")
+		fmt.Fprintf(w, "pushx_relay_messages_total{result=\"pushed\"} %d\n", s.Pushed)
+		fmt.Fprintf(w, "pushx_relay_messages_total{result=\"dead_lettered\"} %d\n", s.DeadLettered)
+		fmt.Fprintf(w, "pushx_relay_messages_total{result=\"dropped\"} %d\n", s.Dropped)
+		fmt.Fprintf(w, "pushx_relay_messages_total{result=\"nacked\"} %d\n", s.Nacked)
+		fmt.Fprintln(w, "# HELP pushx_relay_retries_total Push retries of the relay.")
+		fmt.Fprintln(w, "# TYPE pushx_relay_retries_total counter")
+		fmt.Fprintf(w, "pushx_relay_retries_total %d\n", s.Retries)
+		fmt.Fprintln(w, "# HELP pushx_relay_errors_total Source errors of the relay, by operation.")
+		fmt.Fprintln(w, "# TYPE pushx_relay_errors_total counter")
+		fmt.Fprintf(w, "pushx_relay_errors_total{op=\"receive\"} %d\n", s.ReceiveErrors)
+		fmt.Fprintf(w, "pushx_relay_errors_total{op=\"ack\"} %d\n", s.AckErrors)
+	})
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	return srv, nil
+}
@@ -0,0 +1,206 @@
+package pushx_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/pushx/drivers/fs"
+	"github.com/robertlestak/pushx/drivers/mock"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	"github.com/robertlestak/pushx/pkg/pushx"
+)
+
+// startRelay runs PushRelay to dst until the returned stop func is
+// called.
+func startRelay(t *testing.T, dst *mock.Mock, r *pushx.Relay) (*pushx.PushX, func()) {
+	t.Helper()
+	p, err := pushx.New(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Relay = r
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- p.PushRelay(ctx)
+	}()
+	return p, func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		p.Close()
+	}
+}
+
+// waitFor waits for cond to be true.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func acked(m *mock.Mock) []string {
+	var s []string
+	for _, bd := range m.Acked() {
+		s = append(s, string(bd))
+	}
+	return s
+}
+
+func TestRelay(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	src := &mock.Mock{}
+	src.Enqueue([]byte("a"), []byte("b"), []byte("c"))
+	every := 2
+	dst := &mock.Mock{FailEvery: &every}
+	p, stop := startRelay(t, dst, &pushx.Relay{
+		Source:       src,
+		Retries:      1,
+		RetryBackoff: time.Millisecond,
+		MetricsAddr:  addr,
+	})
+	defer stop()
+	waitFor(t, "acks", func() bool { return len(src.Acked()) == 3 })
+	if got, want := acked(src), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got acked %q, want %q", got, want)
+	}
+	waitPayloads(t, dst, []string{"a", "b", "c"})
+	want := pushx.RelayStats{Received: 3, Pushed: 3, Retries: 2}
+	if s := p.RelayStats(); s != want {
+		t.Errorf("got stats %+v, want %+v", s, want)
+	}
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	bd, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []string{
+		`pushx_relay_messages_total{result="pushed"} 3`,
+		`pushx_relay_retries_total 2`,
+	} {
+		if !strings.Contains(string(bd), m) {
+			t.Errorf("metrics missing %q:\n%s", m, bd)
+		}
+	}
+}
+
+func TestRelayDeadLetter(t *testing.T) {
+	src := &mock.Mock{}
+	src.Enqueue([]byte("a"), []byte("b"))
+	every, class := 2, "permanent"
+	dst := &mock.Mock{FailEvery: &every, FailError: &class}
+	dlq := &mock.Mock{}
+	p, stop := startRelay(t, dst, &pushx.Relay{
+		Source:       src,
+		DLQ:          dlq,
+		Retries:      3,
+		RetryBackoff: time.Millisecond,
+	})
+	defer stop()
+	waitFor(t, "acks", func() bool { return len(src.Acked()) == 2 })
+	waitPayloads(t, dst, []string{"a"})
+	// rejected payloads are dead lettered without retries
+	waitPayloads(t, dlq, []string{"b"})
+	want := pushx.RelayStats{Received: 2, Pushed: 1, DeadLettered: 1}
+	if s := p.RelayStats(); s != want {
+		t.Errorf("got stats %+v, want %+v", s, want)
+	}
+}
+
+func TestRelayNack(t *testing.T) {
+	src := &mock.Mock{}
+	src.Enqueue([]byte("a"))
+	every := 1
+	dst := &mock.Mock{FailEvery: &every}
+	p, stop := startRelay(t, dst, &pushx.Relay{
+		Source:       src,
+		RetryBackoff: time.Millisecond,
+	})
+	waitFor(t, "redelivery", func() bool { return src.Nacks() >= 2 })
+	stop()
+	if n := len(src.Acked()); n != 0 {
+		t.Errorf("got %d acks, want 0", n)
+	}
+	if s := p.RelayStats(); s.Received < 2 || s.Nacked < 2 {
+		t.Errorf("got stats %+v, want the message received and nacked again", s)
+	}
+}
+
+func TestRelayDropRejected(t *testing.T) {
+	src := &mock.Mock{}
+	src.Enqueue([]byte("a"), []byte("b"))
+	every, class := 2, "permanent"
+	dst := &mock.Mock{FailEvery: &every, FailError: &class}
+	p, stop := startRelay(t, dst, &pushx.Relay{
+		Source:       src,
+		Retries:      3,
+		RetryBackoff: time.Millisecond,
+	})
+	defer stop()
+	// without a DLQ, a rejected payload is dropped rather than received
+	// again forever
+	waitFor(t, "acks", func() bool { return len(src.Acked()) == 2 })
+	waitPayloads(t, dst, []string{"a"})
+	want := pushx.RelayStats{Received: 2, Pushed: 1, Dropped: 1}
+	if s := p.RelayStats(); s != want {
+		t.Errorf("got stats %+v, want %+v", s, want)
+	}
+}
+
+func TestRelayConfigError(t *testing.T) {
+	src := &mock.Mock{}
+	src.Enqueue([]byte("a"))
+	p, err := pushx.New(&fs.FS{Folder: t.TempDir(), Key: "out"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.Meta = map[string]string{"k": "v"}
+	p.Relay = &pushx.Relay{Source: src, RetryBackoff: time.Millisecond}
+	// every message would fail, so the relay stops
+	if err := p.PushRelay(context.Background()); !errors.Is(err, drivers.ErrMetaUnsupported) {
+		t.Errorf("got %v, want %v", err, drivers.ErrMetaUnsupported)
+	}
+	if src.Nacks() != 1 || len(src.Acked()) != 0 {
+		t.Errorf("got %d nacks and %d acks, want the message returned", src.Nacks(), len(src.Acked()))
+	}
+}
+
+func TestRelayConfig(t *testing.T) {
+	p := &pushx.PushX{
+		DriverName: "mock",
+		Relay:      &pushx.Relay{SourceName: "postgres"},
+	}
+	if err := p.Init("PUSHX_TEST_"); err == nil || !strings.Contains(err.Error(), "relaying as a source") {
+		t.Errorf("got error %v, want unsupported source", err)
+	}
+	p = &pushx.PushX{
+		DriverName: "mock",
+		Relay:      &pushx.Relay{SourceName: "mock"},
+		Aggregate:  &pushx.Aggregate{Format: pushx.AggregateNDJSON},
+	}
+	if err := p.Init("PUSHX_TEST_"); err == nil {
+		t.Error("got no error for relay with aggregation")
+	}
+}
@@ -0,0 +1,461 @@
+package pushx
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/robertlestak/pushx/pkg/drivers"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// fingerprintSize is the number of leading bytes of a followed file
+	// used to recognize it across restarts.
+	fingerprintSize = 256
+	// tailChunkSize is the most data read from a followed file at once.
+	tailChunkSize = 1 << 20
+)
+
+// Watch configures pushing data continuously as it is written, until the
+// context passed to PushWatch is done.
+type Watch struct {
+	// File is followed like tail -F, pushing each appended line. Rotation
+	// by rename and truncation in place are detected.
+	File string `json:"file"`
+	// Dir is watched for new files, each of which is pushed as a separate
+	// payload once it has not been written to for Settle.
+	Dir string `json:"dir"`
+	// StateFile persists the read offset of File, and the files of Dir
+	// already pushed, so that a restart neither duplicates nor skips data.
+	StateFile string `json:"stateFile"`
+	// Batch is the maximum number of lines pushed as one newline
+	// separated payload. It defaults to 1.
+	Batch int `json:"batch"`
+	// PollInterval is how often File is checked for new data. It
+	// defaults to 1s.
+	PollInterval time.Duration `json:"pollInterval"`
+	// Settle is how long a new file in Dir must go unmodified before it
+	// is pushed. It defaults to 1s.
+	Settle time.Duration `json:"settle"`
+	// OnSuccess is applied to each pushed file of Dir. See Files.
+	OnSuccess string `json:"onSuccess"`
+}
+
+// watchState is the persisted progress of a watch.
+type watchState struct {
+	// Offset is the read offset of the followed file, and Fingerprint
+	// the hex sha256 of its first min(Offset, fingerprintSize) bytes.
+	Offset      int64  `json:"offset,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Files are the pushed files of the watched directory, by name.
+	Files map[string]watchedFile `json:"files,omitempty"`
+}
+
+type watchedFile struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// check returns an error if the configuration is invalid.
+func (w *Watch) check() error {
+	if w == nil {
+		return nil
+	}
+	if (w.File == "") == (w.Dir == "") {
+		return drivers.ConfigError(errors.New("exactly one of the watch file or dir is required"))
+	}
+	if w.Batch < 0 || w.PollInterval < 0 || w.Settle < 0 {
+		return drivers.ConfigError(errors.New("watch batch, poll interval and settle must not be negative"))
+	}
+	return checkOnSuccess(w.OnSuccess)
+}
+
+func (w *Watch) loadState() (*watchState, error) {
+	s := &watchState{Files: map[string]watchedFile{}}
+	if w.StateFile == "" {
+		return s, nil
+	}
+	bd, err := os.ReadFile(w.StateFile)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, drivers.ConfigError(err)
+	}
+	if err := json.Unmarshal(bd, s); err != nil {
+		return nil, drivers.ConfigError(err)
+	}
+	if s.Files == nil {
+		s.Files = map[string]watchedFile{}
+	}
+	return s, nil
+}
+
+// saveState atomically replaces the state file with s.
+func (w *Watch) saveState(s *watchState) error {
+	if w.StateFile == "" {
+		return nil
+	}
+	bd, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := w.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, bd, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.StateFile)
+}
+
+// PushWatch pushes data from the watched file or directory until ctx is
+// done, using the already initialized driver.
+func (j *PushX) PushWatch(ctx context.Context) error {
+	if j.Watch == nil {
+		return drivers.ConfigError(errors.New("no watch configured"))
+	}
+	if err := j.Watch.check(); err != nil {
+		return err
+	}
+	if err := j.Aggregate.checkInput(nil, j.Watch); err != nil {
+		return err
+	}
+	defer j.setContext(ctx)()
+	if j.Watch.File != "" {
+		return j.watchFile(ctx)
+	}
+	return j.watchDir(ctx)
+}
+
+// fingerprint returns the hex sha256 of the first min(n,
+// fingerprintSize) bytes of f.
+func fingerprint(f *os.File, n int64) (string, error) {
+	if n > fingerprintSize {
+		n = fingerprintSize
+	}
+	buf := make([]byte, n)
+	if _, err := f.ReadAt(buf, 0); err != nil && err != io.EOF {
+		return "", err
+	}
+	h := sha256.Sum256(buf)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// tail is a followed file.
+type tail struct {
+	f      *os.File
+	fi     os.FileInfo
+	offset int64
+	// partial is a trailing line which is not yet terminated
+	partial []byte
+	// pending are read lines whose push failed, retried before more
+	// data is read so that an unavailable driver doesn't buffer the file
+	pending [][]byte
+}
+
+// openTail opens the file at path, resuming from the state offset if the
+// file has the same fingerprint.
+func openTail(path string, s *watchState) (*tail, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	t := &tail{f: f, fi: fi}
+	if s != nil && s.Offset > 0 && s.Offset <= fi.Size() {
+		if fp, err := fingerprint(f, s.Offset); err == nil && fp == s.Fingerprint {
+			t.offset = s.Offset
+		}
+	}
+	if _, err := f.Seek(t.offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// lines reads up to tailChunkSize of the data appended since the last
+// read, and returns the complete lines and whether there is more data to
+// read. With final set, an unterminated trailing line is returned as well
+// once all data has been read.
+func (t *tail) lines(final bool) ([][]byte, bool, error) {
+	bd, err := io.ReadAll(io.LimitReader(t.f, tailChunkSize))
+	if err != nil {
+		return nil, false, err
+	}
+	more := len(bd) == tailChunkSize
+	bd = append(t.partial, bd...)
+	t.partial = nil
+	var lines [][]byte
+	for {
+		i := bytes.IndexByte(bd, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, bd[:i+1])
+		bd = bd[i+1:]
+	}
+	if len(bd) > 0 {
+		if final && !more {
+			lines = append(lines, bd)
+		} else {
+			t.partial = bd
+		}
+	}
+	return lines, more, nil
+}
+
+// pushLines pushes lines in batches of up to n, advancing the offset of t
+// and saving the state after each successful batch. Permanently rejected
+// batches are skipped, and the lines of a failed batch are left pending
+// on t.
+func (j *PushX) pushLines(t *tail, lines [][]byte, n int, s *watchState) error {
+	l := log.WithFields(log.Fields{
+		"fn":     "pushLines",
+		"driver": j.DriverName,
+		"file":   j.Watch.File,
+	})
+	for len(lines) > 0 {
+		b := lines
+		if len(b) > n {
+			b = b[:n]
+		}
+		payload := bytes.TrimSuffix(bytes.Join(b, nil), []byte("\n"))
+		if err := j.push(bytes.NewReader(payload)); err != nil {
+			if !errors.Is(err, drivers.ErrPushRejected) {
+				// retry the lines on the next poll
+				t.pending = lines
+				return err
+			}
+			l.WithError(err).Error("batch rejected, skipping")
+		}
+		for _, ln := range b {
+			t.offset += int64(len(ln))
+		}
+		lines = lines[len(b):]
+		s.Offset = t.offset
+		fp, err := fingerprint(t.f, t.offset)
+		if err != nil {
+			return err
+		}
+		s.Fingerprint = fp
+		if err := j.Watch.saveState(s); err != nil {
+			l.WithError(err).Error("saveState")
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *PushX) watchFile(ctx context.Context) error {
+	l := log.WithFields(log.Fields{
+		"fn":     "watchFile",
+		"driver": j.DriverName,
+		"file":   j.Watch.File,
+	})
+	l.Debug("watchFile")
+	w := j.Watch
+	batch := w.Batch
+	if batch < 1 {
+		batch = 1
+	}
+	interval := w.PollInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	s, err := w.loadState()
+	if err != nil {
+		return err
+	}
+	var t *tail
+	defer func() {
+		if t != nil {
+			t.f.Close()
+		}
+	}()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if t == nil {
+			if t, err = openTail(w.File, s); err != nil {
+				// the file may not have been created yet
+				l.WithError(err).Debug("openTail")
+				t = nil
+			}
+		}
+		if t != nil {
+			if err := j.pollTail(t, batch, s); err != nil {
+				l.WithError(err).Error("push failed, retrying")
+			}
+			if fi, err := os.Stat(w.File); err == nil && !os.SameFile(fi, t.fi) && t.partial == nil && t.pending == nil {
+				l.Info("file rotated")
+				t.f.Close()
+				t = nil
+				s.Offset, s.Fingerprint = 0, ""
+				continue
+			}
+		}
+		select {
+		case <-ctx.Done():
+			l.Debug("done")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollTail pushes the pending lines of t, and then the lines appended to
+// it. If the file has been truncated, it is read again from the start. If
+// it has been rotated, the unterminated trailing line is pushed as well.
+func (j *PushX) pollTail(t *tail, batch int, s *watchState) error {
+	if lines := t.pending; lines != nil {
+		t.pending = nil
+		if err := j.pushLines(t, lines, batch, s); err != nil {
+			return err
+		}
+	}
+	fi, err := t.f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() < t.offset {
+		log.WithField("file", j.Watch.File).Info("file truncated")
+		if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		t.offset, t.partial = 0, nil
+	}
+	cur, err := os.Stat(j.Watch.File)
+	rotated := err != nil || !os.SameFile(cur, t.fi)
+	for {
+		lines, more, err := t.lines(rotated)
+		if err != nil {
+			return err
+		}
+		if err := j.pushLines(t, lines, batch, s); err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+func (j *PushX) watchDir(ctx context.Context) error {
+	l := log.WithFields(log.Fields{
+		"fn":     "watchDir",
+		"driver": j.DriverName,
+		"dir":    j.Watch.Dir,
+	})
+	l.Debug("watchDir")
+	w := j.Watch
+	settle := w.Settle
+	if settle == 0 {
+		settle = time.Second
+	}
+	s, err := w.loadState()
+	if err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return drivers.ConfigError(err)
+	}
+	defer watcher.Close()
+	if err := watcher.Add(w.Dir); err != nil {
+		return drivers.ConfigError(err)
+	}
+	var tmpl string
+	if kd, ok := j.Driver.(drivers.KeyedDriver); ok {
+		tmpl = kd.GetKey()
+	}
+	// pending is the time of the last write to each file not yet pushed
+	pending := map[string]time.Time{}
+	// files created or changed while not watching are pushed right away
+	entries, err := os.ReadDir(w.Dir)
+	if err != nil {
+		return drivers.ConfigError(err)
+	}
+	present := map[string]bool{}
+	for _, e := range entries {
+		present[e.Name()] = true
+		fi, err := e.Info()
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		if p, ok := s.Files[e.Name()]; ok && p.Size == fi.Size() && p.ModTime.Equal(fi.ModTime()) {
+			continue
+		}
+		pending[e.Name()] = time.Time{}
+	}
+	for name := range s.Files {
+		if !present[name] {
+			delete(s.Files, name)
+		}
+	}
+	ticker := time.NewTicker(settle / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			l.Debug("done")
+			return w.saveState(s)
+		case err := <-watcher.Errors:
+			l.WithError(err).Error("watcher")
+		case ev := <-watcher.Events:
+			name := filepath.Base(ev.Name)
+			switch {
+			case ev.Op&(fsnotify.Create|fsnotify.Write) != 0:
+				pending[name] = time.Now()
+			case ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+				delete(pending, name)
+				delete(s.Files, name)
+			}
+		case now := <-ticker.C:
+			for name, last := range pending {
+				if now.Sub(last) < settle {
+					continue
+				}
+				if err := j.pushWatchedFile(tmpl, name, s); err != nil {
+					l.WithError(err).WithField("file", name).Error("push failed")
+					if !errors.Is(err, drivers.ErrPushFailed) {
+						delete(pending, name)
+					}
+					continue
+				}
+				delete(pending, name)
+			}
+		}
+	}
+}
+
+// pushWatchedFile pushes the file name of the watched directory, and
+// records it in the state unless it was removed by the on-success action.
+func (j *PushX) pushWatchedFile(tmpl, name string, s *watchState) error {
+	p := filepath.Join(j.Watch.Dir, name)
+	fi, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+	if err := j.pushFile(tmpl, File{Path: p, RelPath: name, Info: fi}, j.Watch.OnSuccess); err != nil {
+		return err
+	}
+	if j.Watch.OnSuccess == "" {
+		s.Files[name] = watchedFile{Size: fi.Size(), ModTime: fi.ModTime()}
+	}
+	return j.Watch.saveState(s)
+}
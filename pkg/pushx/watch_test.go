@@ -0,0 +1,206 @@
+package pushx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/robertlestak/pushx/drivers/mock"
+	"github.com/robertlestak/pushx/pkg/pushx"
+	"github.com/robertlestak/pushx/pkg/utils"
+)
+
+// startWatch runs PushWatch with a new mock driver until the returned
+// stop func is called.
+func startWatch(t *testing.T, w *pushx.Watch) (*mock.Mock, func()) {
+	t.Helper()
+	m := &mock.Mock{}
+	p, err := pushx.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Watch = w
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- p.PushWatch(ctx)
+	}()
+	return m, func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		p.Close()
+	}
+}
+
+// waitPayloads waits for the mock to have captured want.
+func waitPayloads(t *testing.T, m *mock.Mock, want []string) {
+	t.Helper()
+	var got []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		got = nil
+		for _, r := range m.Records() {
+			got = append(got, string(r.Data))
+		}
+		if len(got) >= len(want) {
+			break
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got payloads %q, want %q", got, want)
+	}
+}
+
+func appendFile(t *testing.T, name, data string) {
+	t.Helper()
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "app.log")
+	w := &pushx.Watch{
+		File:         log,
+		StateFile:    filepath.Join(dir, "state.json"),
+		PollInterval: 10 * time.Millisecond,
+	}
+	appendFile(t, log, "a\nb\n")
+	m, stop := startWatch(t, w)
+	waitPayloads(t, m, []string{"a", "b"})
+	// partial lines are held until terminated
+	appendFile(t, log, "c\npart")
+	waitPayloads(t, m, []string{"a", "b", "c"})
+	appendFile(t, log, "ial\n")
+	waitPayloads(t, m, []string{"a", "b", "c", "partial"})
+	// lines written to the rotated file are pushed before the new file
+	if err := os.Rename(log, log+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, log+".1", "d\n")
+	appendFile(t, log, "e\n")
+	waitPayloads(t, m, []string{"a", "b", "c", "partial", "d", "e"})
+	stop()
+
+	// a restart resumes from the saved offset
+	appendFile(t, log, "f\n")
+	m, stop = startWatch(t, w)
+	defer stop()
+	waitPayloads(t, m, []string{"f"})
+}
+
+func TestWatchFileBatch(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "app.log")
+	appendFile(t, log, "a\nb\nc\n")
+	m, stop := startWatch(t, &pushx.Watch{
+		File:         log,
+		Batch:        2,
+		PollInterval: 10 * time.Millisecond,
+	})
+	defer stop()
+	waitPayloads(t, m, []string{"a\nb", "c"})
+}
+
+// outage is a driver which fails its first pushes, appending a line to
+// file after each failure.
+type outage struct {
+	*mock.Mock
+	file  string
+	fails int
+	// failed are the payloads of the failed pushes
+	failed []string
+}
+
+func (d *outage) Push(r io.Reader) error {
+	bd, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(d.failed) < d.fails {
+		d.failed = append(d.failed, string(bd))
+		f, err := os.OpenFile(d.file, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := f.WriteString("more\n"); err != nil {
+			return err
+		}
+		return utils.Retryable(errors.New("unavailable"))
+	}
+	return d.Mock.Push(bytes.NewReader(bd))
+}
+
+func TestWatchFileOutage(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "app.log")
+	appendFile(t, log, "a\n")
+	d := &outage{Mock: &mock.Mock{}, file: log, fails: 3}
+	p, err := pushx.New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.Watch = &pushx.Watch{
+		File:         log,
+		Batch:        10,
+		PollInterval: 10 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- p.PushWatch(ctx)
+	}()
+	waitPayloads(t, d.Mock, []string{"a", "more\nmore\nmore"})
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// the failed lines are retried without reading what was appended
+	if want := []string{"a", "a", "a"}; !reflect.DeepEqual(d.failed, want) {
+		t.Errorf("got failed payloads %q, want %q", d.failed, want)
+	}
+}
+
+func TestWatchDir(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in")
+	if err := os.Mkdir(in, 0755); err != nil {
+		t.Fatal(err)
+	}
+	w := &pushx.Watch{
+		Dir:       in,
+		StateFile: filepath.Join(dir, "state.json"),
+		Settle:    50 * time.Millisecond,
+	}
+	appendFile(t, filepath.Join(in, "existing"), "1")
+	m, stop := startWatch(t, w)
+	waitPayloads(t, m, []string{"1"})
+	appendFile(t, filepath.Join(in, "new"), "2")
+	waitPayloads(t, m, []string{"1", "2"})
+	stop()
+
+	// pushed files are not pushed again after a restart
+	appendFile(t, filepath.Join(in, "later"), "3")
+	m, stop = startWatch(t, w)
+	defer stop()
+	waitPayloads(t, m, []string{"3"})
+	time.Sleep(200 * time.Millisecond)
+	if n := len(m.Records()); n != 1 {
+		t.Errorf("got %d pushes after restart, want 1", n)
+	}
+}
@@ -0,0 +1,42 @@
+package schema
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// keyFuncs are the functions available to key templates.
+var keyFuncs = template.FuncMap{
+	"now": func() time.Time {
+		return time.Now().UTC()
+	},
+	"date": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+	"uuid": func() string {
+		return uuid.New().String()
+	},
+}
+
+// RenderKey renders the object key template s, for example
+// "reports/{{.file.relpath}}" or
+// `events/{{now | date "2006/01/02"}}/{{uuid}}.ndjson`, with data.
+// Strings which do not contain a template are returned unmodified.
+func RenderKey(s string, data map[string]any) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	t, err := template.New("key").Funcs(keyFuncs).Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
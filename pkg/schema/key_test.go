@@ -0,0 +1,42 @@
+package schema
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestRenderKey(t *testing.T) {
+	data := map[string]any{
+		"file": map[string]any{"relpath": "a/b.csv", "name": "b.csv"},
+	}
+	tests := []struct {
+		tmpl    string
+		want    string
+		wantErr bool
+	}{
+		{"static/key", "static/key", false},
+		{"reports/{{.file.relpath}}", "reports/a/b.csv", false},
+		{"{{.file.name}}.gz", "b.csv.gz", false},
+		{`{{now | date "2006"}}/x`, time.Now().UTC().Format("2006") + "/x", false},
+		{"{{.file.missing}}", "", true},
+		{"{{.file.relpath", "", true},
+	}
+	for _, tt := range tests {
+		got, err := RenderKey(tt.tmpl, data)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("RenderKey(%q) error = %v, wantErr %v", tt.tmpl, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("RenderKey(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+	got, err := RenderKey("{{uuid}}.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f-]{36}\.json$`).MatchString(got) {
+		t.Errorf("got %q, want a uuid key", got)
+	}
+}
@@ -44,17 +44,22 @@ func ExtractMustacheKeys(s string) []string {
 	return keys
 }
 
+// ReplaceParams returns params with the templated values rendered from
+// the payload bd. params is not modified, so that it can be rendered again
+// for each payload.
 func ReplaceParams(bd []byte, params []any) []any {
+	out := make([]any, len(params))
 	for i, v := range params {
+		out[i] = v
 		sv := fmt.Sprintf("%s", v)
 		if sv == "{{pushx_payload}}" {
-			params[i] = string(bd)
+			out[i] = string(bd)
 		} else if strings.Contains(sv, "{{") {
 			key := ExtractMustacheKey(sv)
-			params[i] = gjson.GetBytes(bd, key).String()
+			out[i] = gjson.GetBytes(bd, key).String()
 		}
 	}
-	return params
+	return out
 }
 
 func ReplaceJSONKey(query string, k string, v string) string {
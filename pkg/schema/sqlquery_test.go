@@ -0,0 +1,24 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReplaceParams(t *testing.T) {
+	params := []any{"static", "{{id}}", "{{pushx_payload}}"}
+	for _, tt := range []struct {
+		payload string
+		want    []any
+	}{
+		{`{"id":"1"}`, []any{"static", "1", `{"id":"1"}`}},
+		{`{"id":"2"}`, []any{"static", "2", `{"id":"2"}`}},
+	} {
+		if got := ReplaceParams([]byte(tt.payload), params); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ReplaceParams(%s) = %q, want %q", tt.payload, got, tt.want)
+		}
+	}
+	if want := []any{"static", "{{id}}", "{{pushx_payload}}"}; !reflect.DeepEqual(params, want) {
+		t.Errorf("params modified to %q", params)
+	}
+}
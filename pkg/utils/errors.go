@@ -0,0 +1,37 @@
+package utils
+
+// PushError annotates a driver push error with whether the push may
+// succeed if retried.
+type PushError struct {
+	Err       error
+	Retryable bool
+}
+
+func (e *PushError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PushError) Unwrap() error {
+	return e.Err
+}
+
+func (e *PushError) Temporary() bool {
+	return e.Retryable
+}
+
+// Permanent marks err as a rejection which will not succeed if retried,
+// such as an invalid payload or a 4xx response.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PushError{Err: err, Retryable: false}
+}
+
+// Retryable marks err as a transient failure which may succeed if retried.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PushError{Err: err, Retryable: true}
+}
@@ -0,0 +1,276 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+var (
+	proxyMu sync.Mutex
+	// proxyURL is the proxy of all connections, set with SetProxy.
+	proxyURL string
+	// httpProxy and tcpProxy return the proxy of a URL, or nil if it is
+	// connected to directly. They are created when first used.
+	httpProxy, tcpProxy func(*url.URL) (*url.URL, error)
+)
+
+// SetProxy sets the proxy of all connections, a socks5://, socks5h://,
+// http:// or https:// URL, which may contain a username and password. If it
+// is empty, HTTP requests use the HTTP_PROXY and HTTPS_PROXY environment
+// variables, and other connections ALL_PROXY. Hosts matching NO_PROXY,
+// localhost, and link-local addresses such as the cloud instance metadata
+// services, are always connected to directly. The environment is read
+// again when the proxy is set. The proxy is process-wide: it applies to
+// every driver created before or after it is set.
+func SetProxy(s string) error {
+	if s != "" {
+		u, err := url.Parse(s)
+		if err != nil {
+			return fmt.Errorf("invalid proxy: %w", err)
+		}
+		switch u.Scheme {
+		case "socks5", "socks5h", "http", "https":
+		default:
+			return fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("invalid proxy %q: no host", u.Redacted())
+		}
+	}
+	proxyMu.Lock()
+	defer proxyMu.Unlock()
+	proxyURL = s
+	httpProxy, tcpProxy = nil, nil
+	return nil
+}
+
+// Proxy returns the proxy set with SetProxy, or an empty string if the
+// proxy environment variables are used.
+func Proxy() string {
+	proxyMu.Lock()
+	defer proxyMu.Unlock()
+	return proxyURL
+}
+
+func proxyFuncs() (func(*url.URL) (*url.URL, error), func(*url.URL) (*url.URL, error)) {
+	proxyMu.Lock()
+	defer proxyMu.Unlock()
+	if httpProxy == nil {
+		hc := httpproxy.FromEnvironment()
+		tc := &httpproxy.Config{
+			HTTPSProxy: getenvAny("ALL_PROXY", "all_proxy"),
+			NoProxy:    hc.NoProxy,
+		}
+		if proxyURL != "" {
+			hc.HTTPProxy, hc.HTTPSProxy, tc.HTTPSProxy = proxyURL, proxyURL, proxyURL
+		}
+		hc.HTTPProxy, hc.HTTPSProxy, tc.HTTPSProxy = socks5(hc.HTTPProxy), socks5(hc.HTTPSProxy), socks5(tc.HTTPSProxy)
+		httpProxy, tcpProxy = linkLocalDirect(hc.ProxyFunc()), linkLocalDirect(tc.ProxyFunc())
+	}
+	return httpProxy, tcpProxy
+}
+
+// socks5 returns the proxy s with the socks5h scheme replaced with socks5,
+// which httpproxy does not parse. They are the same here, as host names are
+// always resolved by the proxy.
+func socks5(s string) string {
+	if strings.HasPrefix(s, "socks5h://") {
+		return "socks5://" + strings.TrimPrefix(s, "socks5h://")
+	}
+	return s
+}
+
+// linkLocalDirect returns a proxy func which connects to link-local
+// addresses directly, as they are only reachable from the host itself.
+func linkLocalDirect(f func(*url.URL) (*url.URL, error)) func(*url.URL) (*url.URL, error) {
+	return func(u *url.URL) (*url.URL, error) {
+		if ip := net.ParseIP(u.Hostname()); ip != nil && ip.IsLinkLocalUnicast() {
+			return nil, nil
+		}
+		return f(u)
+	}
+}
+
+func getenvAny(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// HTTPProxy returns the proxy of the request, for http.Transport.Proxy.
+func HTTPProxy(req *http.Request) (*url.URL, error) {
+	h, _ := proxyFuncs()
+	return h(req.URL)
+}
+
+// HTTPClient returns an HTTP client which connects through the proxy, for
+// client libraries which accept a custom http.Client.
+func HTTPClient() *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = HTTPProxy
+	return &http.Client{Transport: tr}
+}
+
+// Dialer dials TCP connections through the proxy, for clients which accept
+// a custom dialer.
+type Dialer struct {
+	// Timeout bounds the connection, including the proxy handshake.
+	Timeout time.Duration
+}
+
+func (d Dialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d Dialer) DialTimeout(network, addr string, timeout time.Duration) (net.Conn, error) {
+	return Dialer{Timeout: timeout}.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to the address through the proxy, or directly if
+// there is none for the address.
+func (d Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	l := log.WithFields(log.Fields{
+		"pkg": "utils",
+		"fn":  "DialContext",
+	})
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	nd := &net.Dialer{}
+	_, t := proxyFuncs()
+	u, err := t(&url.URL{Scheme: "https", Host: addr})
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nd.DialContext(ctx, network, addr)
+	}
+	l.Debugf("Dialing %s through proxy %s", addr, u.Redacted())
+	switch u.Scheme {
+	case "socks5":
+		var auth *proxy.Auth
+		if u.User != nil {
+			p, _ := u.User.Password()
+			auth = &proxy.Auth{User: u.User.Username(), Password: p}
+		}
+		sd, err := proxy.SOCKS5("tcp", u.Host, auth, nd)
+		if err != nil {
+			return nil, err
+		}
+		return sd.(proxy.ContextDialer).DialContext(ctx, network, addr)
+	case "http", "https":
+		return dialConnect(ctx, nd, u, addr)
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+}
+
+// DialTLS connects to the address through the proxy, and then with TLS. The
+// server name is the host of the address, if it is not set in tc.
+func (d Dialer) DialTLS(ctx context.Context, network, addr string, tc *tls.Config) (net.Conn, error) {
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	conn, err := Dialer{}.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	c := tc.Clone()
+	if c.ServerName == "" {
+		c.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	tconn := tls.Client(conn, c)
+	if err := tconn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tconn, nil
+}
+
+// dialConnect opens a tunnel to the address with an HTTP CONNECT request to
+// the proxy.
+func dialConnect(ctx context.Context, nd *net.Dialer, u *url.URL, addr string) (net.Conn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	conn, err := nd.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "https" {
+		tconn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tconn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tconn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u.User != nil {
+		p, _ := u.User.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u.User.Username()+":"+p)))
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %s", u.Redacted(), resp.Status)
+	}
+	if br.Buffered() > 0 {
+		// the server spoke first, as NATS servers do
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a connection whose first bytes were read into a buffer.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -0,0 +1,254 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// listen serves each connection with fn until the test ends.
+func listen(t *testing.T, fn func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				fn(c)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// echoServer writes a greeting, as NATS servers do, and then echoes what it
+// reads.
+func echoServer(t *testing.T) string {
+	return listen(t, func(c net.Conn) {
+		c.Write([]byte("hi\n"))
+		io.Copy(c, c)
+	})
+}
+
+func pipe(a, b net.Conn) {
+	go io.Copy(a, b)
+	io.Copy(b, a)
+}
+
+// connectProxy is an HTTP CONNECT proxy which tunnels to the hosts, which
+// map unresolvable names to addresses, so that only tunneled connections
+// succeed.
+func connectProxy(t *testing.T, hosts map[string]string, auth string, n *int32) string {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(n, 1)
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if u, p, _ := parseProxyAuth(r.Header.Get("Proxy-Authorization")); u+":"+p != auth {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		host, port, _ := net.SplitHostPort(r.Host)
+		up, err := net.Dial("tcp", net.JoinHostPort(hosts[host], port))
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer up.Close()
+		c, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		pipe(c, up)
+	}))
+	t.Cleanup(s.Close)
+	return s.Listener.Addr().String()
+}
+
+func parseProxyAuth(h string) (string, string, bool) {
+	r := &http.Request{Header: http.Header{"Authorization": {h}}}
+	return r.BasicAuth()
+}
+
+// socksProxy is a SOCKS5 proxy with username and password authentication
+// which connects to the hosts, as connectProxy.
+func socksProxy(t *testing.T, hosts map[string]string, user, pass string, n *int32) string {
+	return listen(t, func(c net.Conn) {
+		atomic.AddInt32(n, 1)
+		r := bufio.NewReader(c)
+		// greeting: version, methods
+		hdr := make([]byte, 2)
+		io.ReadFull(r, hdr)
+		io.ReadFull(r, make([]byte, hdr[1]))
+		c.Write([]byte{5, 2})
+		// username and password
+		io.ReadFull(r, hdr)
+		u := make([]byte, hdr[1])
+		io.ReadFull(r, u)
+		pl, _ := r.ReadByte()
+		p := make([]byte, pl)
+		io.ReadFull(r, p)
+		if string(u) != user || string(p) != pass {
+			c.Write([]byte{1, 1})
+			return
+		}
+		c.Write([]byte{1, 0})
+		// request: version, command, reserved, domain name address
+		req := make([]byte, 5)
+		io.ReadFull(r, req)
+		name := make([]byte, req[4])
+		io.ReadFull(r, name)
+		port := make([]byte, 2)
+		io.ReadFull(r, port)
+		up, err := net.Dial("tcp", net.JoinHostPort(hosts[string(name)], strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+		if err != nil {
+			c.Write([]byte{5, 4, 0, 1, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		defer up.Close()
+		c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		pipe(c, up)
+	})
+}
+
+func dialEcho(t *testing.T, addr string) error {
+	t.Helper()
+	c, err := Dialer{Timeout: 5 * time.Second}.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(c)
+	if l, err := r.ReadString('\n'); err != nil || l != "hi\n" {
+		t.Errorf("got greeting %q, %v", l, err)
+	}
+	c.Write([]byte("hello\n"))
+	if l, err := r.ReadString('\n'); err != nil || l != "hello\n" {
+		t.Errorf("got echo %q, %v", l, err)
+	}
+	return nil
+}
+
+func TestDialProxy(t *testing.T) {
+	t.Cleanup(func() { SetProxy("") })
+	echo := echoServer(t)
+	_, port, _ := net.SplitHostPort(echo)
+	hosts := map[string]string{"echo.test": "127.0.0.1"}
+	var connects, socks int32
+	connect := connectProxy(t, hosts, "user:pass", &connects)
+	socks5 := socksProxy(t, hosts, "user", "pass", &socks)
+	target := net.JoinHostPort("echo.test", port)
+
+	for _, p := range []string{"http://user:pass@" + connect, "socks5://user:pass@" + socks5, "socks5h://user:pass@" + socks5} {
+		if err := SetProxy(p); err != nil {
+			t.Fatal(err)
+		}
+		if err := dialEcho(t, target); err != nil {
+			t.Errorf("%s: %v", p, err)
+		}
+	}
+	if connects != 1 || socks != 2 {
+		t.Errorf("got %d connect and %d socks connections, want 1 and 2", connects, socks)
+	}
+
+	for _, p := range []string{"http://user:wrong@" + connect, "socks5://user:wrong@" + socks5} {
+		SetProxy(p)
+		if err := dialEcho(t, target); err == nil {
+			t.Errorf("%s: got no error for wrong credentials", p)
+		}
+	}
+	SetProxy("http://user:wrong@" + connect)
+	if err := dialEcho(t, target); err == nil || !strings.Contains(err.Error(), "407") || strings.Contains(err.Error(), "wrong") {
+		t.Errorf("got %v, want a 407 error without the password", err)
+	}
+
+	// localhost is connected to directly
+	connects = 0
+	SetProxy("http://user:pass@" + connect)
+	if err := dialEcho(t, echo); err != nil || connects != 0 {
+		t.Errorf("got %v with %d proxy connections, want a direct connection", err, connects)
+	}
+}
+
+func TestProxyEnvironment(t *testing.T) {
+	t.Cleanup(func() { SetProxy("") })
+	echo := echoServer(t)
+	_, port, _ := net.SplitHostPort(echo)
+	var socks int32
+	socks5 := socksProxy(t, map[string]string{"echo.test": "127.0.0.1"}, "user", "pass", &socks)
+	t.Setenv("HTTP_PROXY", "http://http-proxy.test:3128")
+	t.Setenv("HTTPS_PROXY", "http://https-proxy.test:3128")
+	t.Setenv("ALL_PROXY", "socks5://user:pass@"+socks5)
+	t.Setenv("NO_PROXY", "internal.test,.corp.test")
+	SetProxy("")
+
+	if err := dialEcho(t, net.JoinHostPort("echo.test", port)); err != nil || socks != 1 {
+		t.Errorf("got %v with %d proxy connections, want a connection through ALL_PROXY", err, socks)
+	}
+	for target, want := range map[string]string{
+		"http://api.test/":           "http://http-proxy.test:3128",
+		"https://api.test/":          "http://https-proxy.test:3128",
+		"https://internal.test/":     "",
+		"https://db.corp.test:5432/": "",
+	} {
+		u, _ := url.Parse(target)
+		got, err := HTTPProxy(&http.Request{URL: u})
+		if err != nil || (got == nil) != (want == "") || (got != nil && got.String() != want) {
+			t.Errorf("%s: got proxy %v, %v, want %q", target, got, err, want)
+		}
+	}
+	_, tcp := proxyFuncs()
+	if got, _ := tcp(&url.URL{Scheme: "https", Host: "db.corp.test:5432"}); got != nil {
+		t.Errorf("got proxy %v for a host matching NO_PROXY", got)
+	}
+
+	// an explicit proxy is used for all connections
+	SetProxy("socks5://proxy.test:1080")
+	u, _ := url.Parse("http://api.test/")
+	if got, _ := HTTPProxy(&http.Request{URL: u}); got == nil || got.String() != "socks5://proxy.test:1080" {
+		t.Errorf("got proxy %v, want the explicit proxy", got)
+	}
+	if got, _ := tcp(&url.URL{Scheme: "https", Host: "internal.test:1"}); got != nil {
+		t.Errorf("got proxy %v for a host matching NO_PROXY", got)
+	}
+	// the instance metadata services are connected to directly
+	for _, target := range []string{"http://169.254.169.254/latest/meta-data/", "http://169.254.170.2/v2/credentials"} {
+		u, _ := url.Parse(target)
+		if got, _ := HTTPProxy(&http.Request{URL: u}); got != nil {
+			t.Errorf("%s: got proxy %v for a link-local address", target, got)
+		}
+	}
+	if Proxy() != "socks5://proxy.test:1080" {
+		t.Errorf("got proxy %q", Proxy())
+	}
+}
+
+func TestSetProxyInvalid(t *testing.T) {
+	t.Cleanup(func() { SetProxy("") })
+	for _, p := range []string{"ftp://proxy.test", "socks5://", "://proxy.test", "proxy.test:3128"} {
+		if err := SetProxy(p); err == nil {
+			t.Errorf("%s: got no error", p)
+		}
+	}
+}
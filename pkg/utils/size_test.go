@@ -0,0 +1,30 @@
+package utils
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]int64{
+		"":       0,
+		"1024":   1024,
+		"256KiB": 256 << 10,
+		"256KB":  256000,
+		"1.5GiB": 3 << 29,
+		"10M":    10 << 20,
+		"10 MB":  10000000,
+		"5B":     5,
+	} {
+		got, err := ParseSize(s)
+		if err != nil {
+			t.Errorf("ParseSize(%q): %v", s, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseSize(%q) = %d, want %d", s, got, want)
+		}
+	}
+	for _, s := range []string{"big", "-1", "10XB"} {
+		if _, err := ParseSize(s); err == nil {
+			t.Errorf("ParseSize(%q) succeeded, want error", s)
+		}
+	}
+}